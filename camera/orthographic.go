@@ -60,6 +60,12 @@ func (c *Orthographic) Aspect() float64 {
 	return c.right / c.top
 }
 
+// Clip returns the clipping planes of the given camera, where near and
+// far are view space coordinates.
+func (c *Orthographic) Clip() (left, right, bottom, top, near, far float64) {
+	return c.left, c.right, c.bottom, c.top, c.near, c.far
+}
+
 // SetAspect sets the aspect of the given camera
 func (c *Orthographic) SetAspect(width, height float64) {
 	c.top = height / 2
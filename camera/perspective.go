@@ -48,6 +48,12 @@ func (c *Perspective) Aspect() float64 {
 	return c.aspect
 }
 
+// Clip returns the near and far clipping plane distances of the given
+// camera.
+func (c *Perspective) Clip() (near, far float64) {
+	return c.near, c.far
+}
+
 // SetAspect sets the aspect of the given camera
 func (c *Perspective) SetAspect(width, height float64) {
 	c.aspect = width / height
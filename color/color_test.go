@@ -85,3 +85,19 @@ func BenchmarkEqual(b *testing.B) {
 		color.Equal(c1, c2)
 	}
 }
+
+func TestMap(t *testing.T) {
+	m := color.Map{color.Black, color.White}
+	if !color.Equal(m.At(-1), color.Black) || !color.Equal(m.At(2), color.White) {
+		t.Fatalf("values are not clamped: %v, %v", m.At(-1), m.At(2))
+	}
+	if c := m.At(0.5); c.R != 128 || c.G != 128 || c.B != 128 || c.A != 255 {
+		t.Fatalf("unexpected interpolation: %v", c)
+	}
+	if !color.Equal(color.Viridis.At(1), color.FromHex("#fde725")) {
+		t.Fatalf("unexpected end of color map: %v", color.Viridis.At(1))
+	}
+	if c := color.CoolWarm.At(0.5); c.R != c.G || c.G != c.B {
+		t.Fatalf("diverging color map is not neutral at the center: %v", c)
+	}
+}
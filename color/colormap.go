@@ -0,0 +1,51 @@
+// Copyright 2021 Changkun Ou <changkun.de>. All rights reserved.
+// Use of this source code is governed by a GPLv3 license that
+// can be found in the LICENSE file.
+
+package color
+
+import (
+	"image/color"
+
+	"poly.red/math"
+)
+
+// Map is a color map, which maps values of [0, 1] to colors by linear
+// interpolation between equally spaced colors.
+type Map []color.RGBA
+
+var (
+	// Viridis is a perceptually uniform sequential color map from dark
+	// blue to yellow, which suits values of one sign, e.g. magnitudes.
+	Viridis = Map{
+		FromHex("#440154"), FromHex("#472d7b"), FromHex("#3b528b"),
+		FromHex("#2c728e"), FromHex("#21918c"), FromHex("#28ae80"),
+		FromHex("#5ec962"), FromHex("#addc30"), FromHex("#fde725"),
+	}
+	// CoolWarm is a diverging color map from blue over light gray to
+	// red, which suits signed values if the range is symmetric around
+	// zero, e.g. curvatures.
+	CoolWarm = Map{
+		FromHex("#3b4cc0"), FromHex("#6788ee"), FromHex("#9abbff"),
+		FromHex("#c9d7f0"), FromHex("#dddddd"), FromHex("#edd1c2"),
+		FromHex("#f7a889"), FromHex("#e26952"), FromHex("#b40426"),
+	}
+)
+
+// At returns the color of the given value, which is clamped to [0, 1].
+func (m Map) At(t float64) color.RGBA {
+	if len(m) == 0 {
+		return Black
+	}
+	t = math.Clamp(t, 0, 1) * float64(len(m)-1)
+	i := int(t)
+	if i >= len(m)-1 {
+		return m[len(m)-1]
+	}
+	f := t - float64(i)
+	c1, c2 := m[i], m[i+1]
+	lerp := func(a, b uint8) uint8 {
+		return uint8(math.Round(float64(a) + f*(float64(b)-float64(a))))
+	}
+	return color.RGBA{lerp(c1.R, c2.R), lerp(c1.G, c2.G), lerp(c1.B, c2.B), lerp(c1.A, c2.A)}
+}
@@ -6,6 +6,7 @@ package geometry
 
 import (
 	"image/color"
+	"sort"
 
 	"poly.red/geometry/primitive"
 	"poly.red/material"
@@ -22,6 +23,7 @@ var (
 	AttributeNor AttributeName = "normal"
 	AttributeUV  AttributeName = "uv"
 	AttributeCol AttributeName = "color"
+	AttributeTan AttributeName = "tangent"
 )
 
 type BufferAttribute struct {
@@ -39,6 +41,7 @@ func NewBufferAttribute(stride int, values []float64) *BufferAttribute {
 // implements the Mesh interface.
 type BufferedMesh struct {
 	vertIdx    []uint64
+	version    int // incremented by each change of the vertex index
 	attributes map[AttributeName]*BufferAttribute
 	aabb       *primitive.AABB
 	material   material.Material
@@ -53,6 +56,7 @@ func NewBufferedMesh() *BufferedMesh {
 			AttributeNor: nil,
 			AttributeUV:  nil,
 			AttributeCol: nil,
+			AttributeTan: nil,
 		},
 	}
 	bm.ResetContext()
@@ -61,6 +65,7 @@ func NewBufferedMesh() *BufferedMesh {
 
 func (bm *BufferedMesh) SetVertexIndex(vertIdx []uint64) {
 	bm.vertIdx = vertIdx
+	bm.version++
 }
 
 func (bm *BufferedMesh) SetAttribute(name AttributeName, attribute *BufferAttribute) {
@@ -71,6 +76,126 @@ func (bm *BufferedMesh) GetAttribute(name AttributeName) *BufferAttribute {
 	return bm.attributes[name]
 }
 
+// AttributeNames returns the sorted names of all attributes that are
+// set on the buffered mesh.
+func (bm *BufferedMesh) AttributeNames() []AttributeName {
+	names := make([]AttributeName, 0, len(bm.attributes))
+	for name, attr := range bm.attributes {
+		if attr != nil {
+			names = append(names, name)
+		}
+	}
+	sort.Slice(names, func(i, j int) bool { return names[i] < names[j] })
+	return names
+}
+
+// NumVertices returns the number of vertices of the buffered mesh.
+func (bm *BufferedMesh) NumVertices() int {
+	attr := bm.GetAttribute(AttributePos)
+	if attr == nil || attr.Stride == 0 {
+		return 0
+	}
+	return len(attr.Values) / attr.Stride
+}
+
+// clone returns a copy of the buffered mesh, which shares neither the
+// vertex index nor the attributes with the buffered mesh.
+func (bm *BufferedMesh) clone() *BufferedMesh {
+	c := &BufferedMesh{
+		vertIdx:          append([]uint64(nil), bm.vertIdx...),
+		attributes:       make(map[AttributeName]*BufferAttribute, len(bm.attributes)),
+		material:         bm.material,
+		TransformContext: bm.TransformContext,
+	}
+	for name, attr := range bm.attributes {
+		if attr != nil {
+			attr = NewBufferAttribute(attr.Stride, append([]float64(nil), attr.Values...))
+		}
+		c.attributes[name] = attr
+	}
+	if bm.aabb != nil {
+		aabb := *bm.aabb
+		c.aabb = &aabb
+	}
+	return c
+}
+
+// splitVertices assigns the corners of the vertex index to vertices by
+// the given group of each corner, where the corners of a group refer to
+// the same vertex. The first group of a vertex keeps the vertex, and
+// the other groups of the vertex become split vertices that are
+// appended to the buffer and copy all attributes of the vertex.
+func (bm *BufferedMesh) splitVertices(group []int) {
+	n := bm.NumVertices()
+	verts := map[int]int{} // vertex of each group
+	assigned := make([]bool, n)
+	var copies []int // the original vertex of each split vertex
+	idx := make([]uint64, len(bm.vertIdx))
+	for i, v := range bm.vertIdx {
+		w, ok := verts[group[i]]
+		if !ok {
+			w = int(v)
+			if assigned[v] {
+				w = n + len(copies)
+				copies = append(copies, int(v))
+			}
+			assigned[v] = true
+			verts[group[i]] = w
+		}
+		idx[i] = uint64(w)
+	}
+	bm.SetVertexIndex(idx)
+	if len(copies) == 0 {
+		return
+	}
+
+	// Attributes are replaced rather than appended to, as they may be
+	// shared with other meshes.
+	for name, attr := range bm.attributes {
+		if attr == nil || len(attr.Values) < attr.Stride*n {
+			continue
+		}
+		values := make([]float64, len(attr.Values), len(attr.Values)+attr.Stride*len(copies))
+		copy(values, attr.Values)
+		for _, v := range copies {
+			values = append(values, attr.Values[attr.Stride*v:attr.Stride*(v+1)]...)
+		}
+		bm.attributes[name] = NewBufferAttribute(attr.Stride, values)
+	}
+}
+
+// positions returns the position of each vertex of the buffer.
+func (bm *BufferedMesh) positions() []math.Vec3 {
+	attr := bm.GetAttribute(AttributePos)
+	ps := make([]math.Vec3, bm.NumVertices())
+	for i := range ps {
+		ps[i] = math.NewVec3(
+			attr.Values[attr.Stride*i+0],
+			attr.Values[attr.Stride*i+1],
+			attr.Values[attr.Stride*i+2],
+		)
+	}
+	return ps
+}
+
+// weldPositions welds equal positions, such as the copies of a vertex
+// along a texture seam. It returns the welded vertex of each position,
+// and the distinct positions in the order of their first occurrence.
+func weldPositions(pos []math.Vec3) (weld []int, welded []math.Vec3) {
+	weld = make([]int, len(pos))
+	index := map[math.Vec3]int{}
+	for i, p := range pos {
+		w, ok := index[p]
+		if !ok {
+			w = len(welded)
+			index[p] = w
+			welded = append(welded, p)
+		}
+		weld[i] = w
+	}
+	return weld, welded
+}
+
 func (bm *BufferedMesh) Type() object.Type {
 	return object.TypeMesh
 }
@@ -136,90 +261,21 @@ func (bm *BufferedMesh) NumTriangles() uint64 {
 }
 
 func (bm *BufferedMesh) Faces(iter func(primitive.Face, material.Material) bool) {
+	bm.faces(bm.vertIdx, iter)
+}
 
+// faces iterates over the triangles of the given vertex index.
+func (bm *BufferedMesh) faces(vertIdx []uint64, iter func(primitive.Face, material.Material) bool) {
 	attrPos := bm.GetAttribute(AttributePos)
 	attrNor := bm.GetAttribute(AttributeNor)
 	attrColor := bm.GetAttribute(AttributeCol)
 	attrUV := bm.GetAttribute(AttributeUV)
+	attrTan := bm.GetAttribute(AttributeTan)
 
-	for i := 0; i < len(bm.vertIdx); i += 3 {
-		var px, py, pz, nx, ny, nz, u, v float64
-		var cr, cb, cg, ca uint8
-		px = attrPos.Values[bm.vertIdx[i]+0]
-		py = attrPos.Values[bm.vertIdx[i]+1]
-		pz = attrPos.Values[bm.vertIdx[i]+2]
-		if attrNor != nil {
-			nx = attrNor.Values[bm.vertIdx[i]+0]
-			ny = attrNor.Values[bm.vertIdx[i]+1]
-			nz = attrNor.Values[bm.vertIdx[i]+2]
-		}
-		if attrColor != nil {
-			cr = uint8(attrColor.Values[bm.vertIdx[i]+0])
-			cb = uint8(attrColor.Values[bm.vertIdx[i]+1])
-			cg = uint8(attrColor.Values[bm.vertIdx[i]+2])
-			ca = uint8(attrColor.Values[bm.vertIdx[i]+3])
-		}
-		if attrUV != nil {
-			u = attrUV.Values[bm.vertIdx[i]+0]
-			v = attrUV.Values[bm.vertIdx[i]+1]
-		}
-		v1 := primitive.Vertex{
-			Pos: math.NewVec4(px, py, pz, 1),
-			Nor: math.NewVec4(nx, ny, nz, 0),
-			UV:  math.NewVec4(u, v, 0, 1),
-			Col: color.RGBA{cr, cb, cg, ca},
-		}
-
-		px = attrPos.Values[bm.vertIdx[i+1]+0]
-		py = attrPos.Values[bm.vertIdx[i+1]+1]
-		pz = attrPos.Values[bm.vertIdx[i+1]+2]
-		if attrNor != nil {
-			nx = attrNor.Values[bm.vertIdx[i+1]+0]
-			ny = attrNor.Values[bm.vertIdx[i+1]+1]
-			nz = attrNor.Values[bm.vertIdx[i+1]+2]
-		}
-		if attrColor != nil {
-			cr = uint8(attrColor.Values[bm.vertIdx[i+1]+0])
-			cb = uint8(attrColor.Values[bm.vertIdx[i+1]+1])
-			cg = uint8(attrColor.Values[bm.vertIdx[i+1]+2])
-			ca = uint8(attrColor.Values[bm.vertIdx[i+1]+3])
-		}
-		if attrUV != nil {
-			u = attrUV.Values[bm.vertIdx[i+1]+0]
-			v = attrUV.Values[bm.vertIdx[i+1]+1]
-		}
-		v2 := primitive.Vertex{
-			Pos: math.NewVec4(px, py, pz, 1),
-			Nor: math.NewVec4(nx, ny, nz, 0),
-			UV:  math.NewVec4(u, v, 0, 1),
-			Col: color.RGBA{cr, cb, cg, ca},
-		}
-
-		px = attrPos.Values[bm.vertIdx[i+2]+0]
-		py = attrPos.Values[bm.vertIdx[i+2]+1]
-		pz = attrPos.Values[bm.vertIdx[i+2]+2]
-		if attrNor != nil {
-			nx = attrNor.Values[bm.vertIdx[i+2]+0]
-			ny = attrNor.Values[bm.vertIdx[i+2]+1]
-			nz = attrNor.Values[bm.vertIdx[i+2]+2]
-		}
-		if attrColor != nil {
-			cr = uint8(attrColor.Values[bm.vertIdx[i+2]+0])
-			cb = uint8(attrColor.Values[bm.vertIdx[i+2]+1])
-			cg = uint8(attrColor.Values[bm.vertIdx[i+2]+2])
-			ca = uint8(attrColor.Values[bm.vertIdx[i+2]+3])
-		}
-		if attrUV != nil {
-			u = attrUV.Values[bm.vertIdx[i+2]+0]
-			v = attrUV.Values[bm.vertIdx[i+2]+1]
-		}
-		v3 := primitive.Vertex{
-			Pos: math.NewVec4(px, py, pz, 1),
-			Nor: math.NewVec4(nx, ny, nz, 0),
-			UV:  math.NewVec4(u, v, 0, 1),
-			Col: color.RGBA{cr, cb, cg, ca},
-		}
-
+	for i := 0; i < len(vertIdx); i += 3 {
+		v1 := vertex(vertIdx[i], attrPos, attrNor, attrColor, attrUV, attrTan)
+		v2 := vertex(vertIdx[i+1], attrPos, attrNor, attrColor, attrUV, attrTan)
+		v3 := vertex(vertIdx[i+2], attrPos, attrNor, attrColor, attrUV, attrTan)
 		if !iter(&primitive.Triangle{
 			V1: v1, V2: v2, V3: v3,
 		}, bm.material) {
@@ -237,85 +293,60 @@ func (bm *BufferedMesh) GetVertexBuffer() []*primitive.Vertex {
 	attrNor := bm.GetAttribute(AttributeNor)
 	attrColor := bm.GetAttribute(AttributeCol)
 	attrUV := bm.GetAttribute(AttributeUV)
+	attrTan := bm.GetAttribute(AttributeTan)
 
 	vs := make([]*primitive.Vertex, len(bm.vertIdx))
-	for i := 0; i < len(bm.vertIdx); i += 3 {
-		var px, py, pz, nx, ny, nz, u, v float64
-		var cr, cb, cg, ca uint8
-		px = attrPos.Values[bm.vertIdx[i]+0]
-		py = attrPos.Values[bm.vertIdx[i]+1]
-		pz = attrPos.Values[bm.vertIdx[i]+2]
-		if attrNor != nil {
-			nx = attrNor.Values[bm.vertIdx[i]+0]
-			ny = attrNor.Values[bm.vertIdx[i]+1]
-			nz = attrNor.Values[bm.vertIdx[i]+2]
-		}
-		if attrColor != nil {
-			cr = uint8(attrColor.Values[bm.vertIdx[i]+0])
-			cb = uint8(attrColor.Values[bm.vertIdx[i]+1])
-			cg = uint8(attrColor.Values[bm.vertIdx[i]+2])
-			ca = uint8(attrColor.Values[bm.vertIdx[i]+3])
-		}
-		if attrUV != nil {
-			u = attrUV.Values[bm.vertIdx[i]+0]
-			v = attrUV.Values[bm.vertIdx[i]+1]
-		}
-		vs[i] = &primitive.Vertex{
-			Pos: math.NewVec4(px, py, pz, 1),
-			Nor: math.NewVec4(nx, ny, nz, 0),
-			UV:  math.NewVec4(u, v, 0, 1),
-			Col: color.RGBA{cr, cb, cg, ca},
-		}
-
-		px = attrPos.Values[bm.vertIdx[i+1]+0]
-		py = attrPos.Values[bm.vertIdx[i+1]+1]
-		pz = attrPos.Values[bm.vertIdx[i+1]+2]
-		if attrNor != nil {
-			nx = attrNor.Values[bm.vertIdx[i+1]+0]
-			ny = attrNor.Values[bm.vertIdx[i+1]+1]
-			nz = attrNor.Values[bm.vertIdx[i+1]+2]
-		}
-		if attrColor != nil {
-			cr = uint8(attrColor.Values[bm.vertIdx[i+1]+0])
-			cb = uint8(attrColor.Values[bm.vertIdx[i+1]+1])
-			cg = uint8(attrColor.Values[bm.vertIdx[i+1]+2])
-			ca = uint8(attrColor.Values[bm.vertIdx[i+1]+3])
-		}
-		if attrUV != nil {
-			u = attrUV.Values[bm.vertIdx[i+1]+0]
-			v = attrUV.Values[bm.vertIdx[i+1]+1]
-		}
-		vs[i+1] = &primitive.Vertex{
-			Pos: math.NewVec4(px, py, pz, 1),
-			Nor: math.NewVec4(nx, ny, nz, 0),
-			UV:  math.NewVec4(u, v, 0, 1),
-			Col: color.RGBA{cr, cb, cg, ca},
-		}
+	for i := 0; i < len(bm.vertIdx); i++ {
+		v := vertex(bm.vertIdx[i], attrPos, attrNor, attrColor, attrUV, attrTan)
+		vs[i] = &v
+	}
+	return vs
+}
 
-		px = attrPos.Values[bm.vertIdx[i+2]+0]
-		py = attrPos.Values[bm.vertIdx[i+2]+1]
-		pz = attrPos.Values[bm.vertIdx[i+2]+2]
-		if attrNor != nil {
-			nx = attrNor.Values[bm.vertIdx[i+2]+0]
-			ny = attrNor.Values[bm.vertIdx[i+2]+1]
-			nz = attrNor.Values[bm.vertIdx[i+2]+2]
-		}
-		if attrColor != nil {
-			cr = uint8(attrColor.Values[bm.vertIdx[i+2]+0])
-			cb = uint8(attrColor.Values[bm.vertIdx[i+2]+1])
-			cg = uint8(attrColor.Values[bm.vertIdx[i+2]+2])
-			ca = uint8(attrColor.Values[bm.vertIdx[i+2]+3])
-		}
-		if attrUV != nil {
-			u = attrUV.Values[bm.vertIdx[i+2]+0]
-			v = attrUV.Values[bm.vertIdx[i+2]+1]
+// vertex assembles the idx-th vertex from the given attributes. The color
+// attribute is either RGB or RGBA, where the missing alpha is opaque.
+// Without a color attribute, vertices are opaque white. The tangent
+// attribute holds the handedness of the bitangent as the fourth value.
+func vertex(idx uint64, attrPos, attrNor, attrColor, attrUV, attrTan *BufferAttribute) primitive.Vertex {
+	var px, py, pz, nx, ny, nz, u, v float64
+	cr, cg, cb, ca := uint8(0xff), uint8(0xff), uint8(0xff), uint8(0xff)
+	i := int(idx)
+	px = attrPos.Values[attrPos.Stride*i+0]
+	py = attrPos.Values[attrPos.Stride*i+1]
+	pz = attrPos.Values[attrPos.Stride*i+2]
+	if attrNor != nil {
+		nx = attrNor.Values[attrNor.Stride*i+0]
+		ny = attrNor.Values[attrNor.Stride*i+1]
+		nz = attrNor.Values[attrNor.Stride*i+2]
+	}
+	if attrColor != nil {
+		cr = uint8(attrColor.Values[attrColor.Stride*i+0])
+		cg = uint8(attrColor.Values[attrColor.Stride*i+1])
+		cb = uint8(attrColor.Values[attrColor.Stride*i+2])
+		ca = 0xff
+		if attrColor.Stride > 3 {
+			ca = uint8(attrColor.Values[attrColor.Stride*i+3])
 		}
-		vs[i+2] = &primitive.Vertex{
-			Pos: math.NewVec4(px, py, pz, 1),
-			Nor: math.NewVec4(nx, ny, nz, 0),
-			UV:  math.NewVec4(u, v, 0, 1),
-			Col: color.RGBA{cr, cb, cg, ca},
+	}
+	if attrUV != nil {
+		u = attrUV.Values[attrUV.Stride*i+0]
+		v = attrUV.Values[attrUV.Stride*i+1]
+	}
+	var tan math.Vec4
+	if attrTan != nil {
+		tan.X = attrTan.Values[attrTan.Stride*i+0]
+		tan.Y = attrTan.Values[attrTan.Stride*i+1]
+		tan.Z = attrTan.Values[attrTan.Stride*i+2]
+		tan.W = 1
+		if attrTan.Stride > 3 {
+			tan.W = attrTan.Values[attrTan.Stride*i+3]
 		}
 	}
-	return vs
+	return primitive.Vertex{
+		Pos: math.NewVec4(px, py, pz, 1),
+		Nor: math.NewVec4(nx, ny, nz, 0),
+		Tan: tan,
+		UV:  math.NewVec4(u, v, 0, 1),
+		Col: color.RGBA{cr, cg, cb, ca},
+	}
 }
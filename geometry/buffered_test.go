@@ -5,11 +5,13 @@
 package geometry_test
 
 import (
+	"image/color"
 	"testing"
 
 	"poly.red/geometry"
 	"poly.red/geometry/primitive"
 	"poly.red/material"
+	"poly.red/math"
 )
 
 func TestBufferedMesh(t *testing.T) {
@@ -44,3 +46,42 @@ func TestBufferedMesh(t *testing.T) {
 		t.Fatalf("expect 4 faces, but only got %v", counter)
 	}
 }
+
+func TestBufferedMesh_Faces(t *testing.T) {
+	bm := geometry.NewBufferedMesh()
+	bm.SetAttribute(geometry.AttributePos, geometry.NewBufferAttribute(3, []float64{
+		0, 0, 0,
+		1, 0, 0,
+		0, 1, 0,
+		0, 0, 1,
+	}))
+	bm.SetAttribute(geometry.AttributeCol, geometry.NewBufferAttribute(3, []float64{
+		255, 0, 0,
+		0, 255, 0,
+		0, 0, 255,
+		255, 255, 255,
+	}))
+	bm.SetVertexIndex([]uint64{1, 2, 3})
+
+	bm.Faces(func(f primitive.Face, m material.Material) bool {
+		tri := f.(*primitive.Triangle)
+		if !tri.V1.Pos.Eq(math.NewVec4(1, 0, 0, 1)) ||
+			!tri.V2.Pos.Eq(math.NewVec4(0, 1, 0, 1)) ||
+			!tri.V3.Pos.Eq(math.NewVec4(0, 0, 1, 1)) {
+			t.Fatalf("unexpected face positions: %v, %v, %v", tri.V1.Pos, tri.V2.Pos, tri.V3.Pos)
+		}
+		if tri.V3.Col != (color.RGBA{255, 255, 255, 255}) {
+			t.Fatalf("unexpected vertex color: %v", tri.V3.Col)
+		}
+		return true
+	})
+
+	// Vertices are white without a color attribute.
+	bm.SetAttribute(geometry.AttributeCol, nil)
+	bm.Faces(func(f primitive.Face, m material.Material) bool {
+		if tri := f.(*primitive.Triangle); tri.V1.Col != (color.RGBA{255, 255, 255, 255}) {
+			t.Fatalf("unexpected default vertex color: %v", tri.V1.Col)
+		}
+		return true
+	})
+}
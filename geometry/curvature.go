@@ -0,0 +1,259 @@
+// Copyright 2021 Changkun Ou <changkun.de>. All rights reserved.
+// Use of this source code is governed by a GPLv3 license that
+// can be found in the LICENSE file.
+
+package geometry
+
+import (
+	"errors"
+	"fmt"
+
+	"poly.red/color"
+	"poly.red/geometry/primitive"
+	"poly.red/math"
+)
+
+// Names of the curvature attributes of buffered meshes.
+const (
+	// AttributeMeanCurvature holds the mean curvature of each vertex.
+	AttributeMeanCurvature AttributeName = "mean_curvature"
+	// AttributeGaussianCurvature holds the Gaussian curvature of each
+	// vertex.
+	AttributeGaussianCurvature AttributeName = "gaussian_curvature"
+	// AttributePrincipalCurvatures holds the maximum and the minimum
+	// principal curvature of each vertex.
+	AttributePrincipalCurvatures AttributeName = "principal_curvatures"
+	// AttributePrincipalDirections holds the directions of the maximum
+	// and the minimum principal curvature of each vertex, three values
+	// each.
+	AttributePrincipalDirections AttributeName = "principal_directions"
+)
+
+// Curvature is the discrete curvature at a vertex. Curvatures are
+// positive where the surface bends away from the normal, e.g. a sphere
+// of radius r with outward normals has the curvatures 1/r.
+type Curvature struct {
+	Mean     float64
+	Gaussian float64
+	Max, Min float64 // principal curvatures
+
+	// MaxDir and MinDir are the unit principal directions, which are
+	// tangent to the surface.
+	MaxDir, MinDir math.Vec3
+}
+
+// Curvatures estimates the curvature of each vertex of the halfedge
+// mesh, which must consist of triangles.
+//
+// The mean curvature is the cotangent Laplacian of the positions, and
+// the Gaussian curvature is the angle defect, both are averaged over
+// the mixed Voronoi area of the vertex after Meyer et al. The principal
+// curvatures follow from the mean and the Gaussian curvature, and the
+// principal directions are the eigenvectors of the curvature tensor of
+// Cohen-Steiner and Morvan, which sums the dihedral angles of the edges
+// of the vertex. Curvatures of boundary vertices lack the faces beyond
+// the boundary and are less accurate. Isolated vertices have zero
+// curvatures.
+func (m *HalfedgeMesh) Curvatures() ([]Curvature, error) {
+	for _, f := range m.faces {
+		if f.NumVertices() != 3 {
+			return nil, errors.New("geometry: curvatures require a triangle mesh")
+		}
+	}
+
+	cs := make([]Curvature, len(m.verts))
+	for i := range m.verts {
+		if m.outgoing[i] == nil {
+			continue
+		}
+		pi := m.verts[i].Pos.ToVec3()
+		var (
+			laplacian, normal math.Vec3
+			area, angles      float64
+		)
+		m.OneRing(i, func(j int, he *primitive.Halfedge) bool {
+			pj := m.verts[j].Pos.ToVec3()
+			w := cotan(he) + cotan(he.Twin())
+			laplacian = laplacian.Add(pj.Sub(pi).Scale(w, w, w))
+			if he.OnBoundary() {
+				return true
+			}
+
+			// The triangle (i, j, k) contributes its normal, its angle at
+			// i and its part of the mixed Voronoi area of i.
+			pk := he.Prev().Vertex().Pos.ToVec3()
+			eij, eik, ejk := pj.Sub(pi), pk.Sub(pi), pk.Sub(pj)
+			cross := eij.Cross(eik)
+			normal = normal.Add(cross)
+			a := cross.Len() / 2
+			if a == 0 {
+				return true
+			}
+			ai := math.Atan2(cross.Len(), eij.Dot(eik))
+			aj := math.Atan2(cross.Len(), eij.Scale(-1, -1, -1).Dot(ejk))
+			ak := math.Pi - ai - aj
+			angles += ai
+			switch {
+			case ai > math.Pi/2:
+				area += a / 2
+			case aj > math.Pi/2 || ak > math.Pi/2:
+				area += a / 4
+			default:
+				cotj, cotk := math.Cos(aj)/math.Sin(aj), math.Cos(ak)/math.Sin(ak)
+				area += (eik.Dot(eik)*cotj + eij.Dot(eij)*cotk) / 8
+			}
+			return true
+		})
+		if area == 0 || normal.IsZero() {
+			continue
+		}
+		n := normal.Unit()
+
+		c := &cs[i]
+		c.Mean = -laplacian.Dot(n) / (4 * area)
+		defect := 2 * math.Pi
+		if m.IsBoundaryVertex(i) {
+			defect = math.Pi
+		}
+		c.Gaussian = (defect - angles) / area
+		d := math.Sqrt(math.Max(c.Mean*c.Mean-c.Gaussian, 0))
+		c.Max, c.Min = c.Mean+d, c.Mean-d
+
+		// The curvature tensor in the tangent plane, where the edge
+		// directions are weighted by their dihedral angles and half of
+		// their lengths. The edges bend along the direction of minimum
+		// curvature, thus the eigenvector of the largest eigenvalue is
+		// the direction of the minimum curvature for convex surfaces.
+		t1 := orthogonal(n)
+		t2 := n.Cross(t1)
+		var a, b, cc float64
+		m.OneRing(i, func(j int, he *primitive.Halfedge) bool {
+			e := m.verts[j].Pos.ToVec3().Sub(pi)
+			beta := dihedralAngle(he) * e.Len() / 2
+			x, y := e.Dot(t1), e.Dot(t2)
+			if l := x*x + y*y; l > 0 {
+				a += beta * x * x / l
+				b += beta * x * y / l
+				cc += beta * y * y / l
+			}
+			return true
+		})
+		theta := math.Atan2(2*b, a-cc) / 2
+		v := t1.Scale(math.Cos(theta), math.Cos(theta), math.Cos(theta)).
+			Add(t2.Scale(math.Sin(theta), math.Sin(theta), math.Sin(theta)))
+		c.MaxDir = n.Cross(v).Unit()
+		c.MinDir = n.Cross(c.MaxDir).Unit()
+	}
+	return cs, nil
+}
+
+// cotan returns the cotangent weight of the halfedge, see
+// Halfedge.Cotan, which is zero if the face of the halfedge is
+// degenerate and has no defined angles.
+func cotan(he *primitive.Halfedge) float64 {
+	if he.OnBoundary() || degenerate(he) {
+		return 0
+	}
+	return he.Cotan()
+}
+
+// dihedralAngle returns the dihedral angle of the edge of the
+// halfedge, see Halfedge.DihedralAngle, which is zero if one of the
+// faces of the edge is degenerate and has no normal.
+func dihedralAngle(he *primitive.Halfedge) float64 {
+	if he.OnBoundary() || he.Twin().OnBoundary() ||
+		degenerate(he) || degenerate(he.Twin()) {
+		return 0
+	}
+	return he.DihedralAngle()
+}
+
+// degenerate reports whether the face of the halfedge has zero area.
+func degenerate(he *primitive.Halfedge) bool {
+	return he.Vec().Cross(he.Next().Vec()).IsZero()
+}
+
+// ComputeCurvature estimates the curvature of each vertex of the
+// buffered mesh, see HalfedgeMesh.Curvatures, and stores the mean, the
+// Gaussian and the principal curvatures and the principal directions as
+// attributes. Vertices of equal positions are welded, thus the copies
+// of a vertex along a texture seam share their curvature. It returns
+// an error wrapping ErrNonManifold if the surface is not a manifold.
+func (bm *BufferedMesh) ComputeCurvature() error {
+	attrPos := bm.GetAttribute(AttributePos)
+	if attrPos == nil {
+		return errors.New("geometry: curvatures require positions")
+	}
+
+	// Vertices of the same position are welded, and faces that
+	// degenerate by welding are dropped.
+	n := bm.NumVertices()
+	weld, ps := weldPositions(bm.positions())
+	var faces [][]int
+	for i := 0; i+2 < len(bm.vertIdx); i += 3 {
+		a, b, c := weld[bm.vertIdx[i]], weld[bm.vertIdx[i+1]], weld[bm.vertIdx[i+2]]
+		if a != b && b != c && c != a {
+			faces = append(faces, []int{a, b, c})
+		}
+	}
+	vs := make([]*primitive.Vertex, len(ps))
+	for i, p := range ps {
+		vs[i] = &primitive.Vertex{Pos: p.ToVec4(1)}
+	}
+	m, err := NewHalfedgeMesh(vs, faces)
+	if err != nil {
+		return err
+	}
+	cs, err := m.Curvatures()
+	if err != nil {
+		return err
+	}
+
+	mean := make([]float64, n)
+	gauss := make([]float64, n)
+	principal := make([]float64, 2*n)
+	dirs := make([]float64, 6*n)
+	for i, w := range weld {
+		c := cs[w]
+		mean[i] = c.Mean
+		gauss[i] = c.Gaussian
+		principal[2*i], principal[2*i+1] = c.Max, c.Min
+		copy(dirs[6*i:], []float64{
+			c.MaxDir.X, c.MaxDir.Y, c.MaxDir.Z,
+			c.MinDir.X, c.MinDir.Y, c.MinDir.Z,
+		})
+	}
+	bm.SetAttribute(AttributeMeanCurvature, NewBufferAttribute(1, mean))
+	bm.SetAttribute(AttributeGaussianCurvature, NewBufferAttribute(1, gauss))
+	bm.SetAttribute(AttributePrincipalCurvatures, NewBufferAttribute(2, principal))
+	bm.SetAttribute(AttributePrincipalDirections, NewBufferAttribute(6, dirs))
+	return nil
+}
+
+// ApplyColorMap sets the color attribute of the buffered mesh from the
+// k-th value of the given attribute, where the values of [min, max] are
+// mapped to the color map and values outside are clamped. For example,
+// the mean curvature is visualized by
+//
+//	bm.ApplyColorMap(geometry.AttributeMeanCurvature, 0, -1, 1, color.CoolWarm)
+func (bm *BufferedMesh) ApplyColorMap(name AttributeName, k int, min, max float64, cm color.Map) error {
+	attr := bm.GetAttribute(name)
+	if attr == nil {
+		return fmt.Errorf("geometry: attribute %s is not set", name)
+	}
+	if k < 0 || k >= attr.Stride {
+		return fmt.Errorf("geometry: attribute %s has no value %d", name, k)
+	}
+	n := len(attr.Values) / attr.Stride
+	cols := make([]float64, 0, 4*n)
+	for i := 0; i < n; i++ {
+		t := 0.5
+		if max != min {
+			t = (attr.Values[attr.Stride*i+k] - min) / (max - min)
+		}
+		c := cm.At(t)
+		cols = append(cols, float64(c.R), float64(c.G), float64(c.B), float64(c.A))
+	}
+	bm.SetAttribute(AttributeCol, NewBufferAttribute(4, cols))
+	return nil
+}
@@ -0,0 +1,182 @@
+// Copyright 2021 Changkun Ou <changkun.de>. All rights reserved.
+// Use of this source code is governed by a GPLv3 license that
+// can be found in the LICENSE file.
+
+package geometry_test
+
+import (
+	"testing"
+
+	"poly.red/color"
+	"poly.red/geometry"
+	"poly.red/math"
+)
+
+// cylinder returns an open cylinder of radius 1 along the z axis, which
+// has m vertices per ring and n rings.
+func cylinder(m, n int) *geometry.BufferedMesh {
+	var (
+		pos []float64
+		idx []uint64
+	)
+	for k := 0; k < n; k++ {
+		for i := 0; i < m; i++ {
+			a := 2 * math.Pi * float64(i) / float64(m)
+			pos = append(pos, math.Cos(a), math.Sin(a), 0.2*float64(k))
+		}
+	}
+	for k := 0; k+1 < n; k++ {
+		for i := 0; i < m; i++ {
+			a, b := uint64(k*m+i), uint64(k*m+(i+1)%m)
+			c, d := b+uint64(m), a+uint64(m)
+			idx = append(idx, a, b, c, a, c, d)
+		}
+	}
+	bm := geometry.NewBufferedMesh()
+	bm.SetAttribute(geometry.AttributePos, geometry.NewBufferAttribute(3, pos))
+	bm.SetVertexIndex(idx)
+	return bm
+}
+
+// icosphere returns an icosahedron that is refined by the given levels
+// of Loop subdivision and projected to the unit sphere.
+func icosphere(levels int) *geometry.BufferedMesh {
+	p := (1 + math.Sqrt(5)) / 2
+	bm := geometry.NewBufferedMesh()
+	bm.SetAttribute(geometry.AttributePos, geometry.NewBufferAttribute(3, []float64{
+		-1, p, 0, 1, p, 0, -1, -p, 0, 1, -p, 0,
+		0, -1, p, 0, 1, p, 0, -1, -p, 0, 1, -p,
+		p, 0, -1, p, 0, 1, -p, 0, -1, -p, 0, 1,
+	}))
+	bm.SetVertexIndex([]uint64{
+		0, 11, 5, 0, 5, 1, 0, 1, 7, 0, 7, 10, 0, 10, 11,
+		1, 5, 9, 5, 11, 4, 11, 10, 2, 10, 7, 6, 7, 1, 8,
+		3, 9, 4, 3, 4, 2, 3, 2, 6, 3, 6, 8, 3, 8, 9,
+		4, 9, 5, 2, 4, 11, 6, 2, 10, 8, 6, 7, 9, 8, 1,
+	})
+	bm = &geometry.NewTriangleMesh(bm).SubdivideLoop(geometry.WithSubdivisionLevels(levels)).BufferedMesh
+	pos := bm.GetAttribute(geometry.AttributePos)
+	for i := 0; i < len(pos.Values); i += 3 {
+		p := math.NewVec3(pos.Values[i], pos.Values[i+1], pos.Values[i+2]).Unit()
+		pos.Values[i], pos.Values[i+1], pos.Values[i+2] = p.X, p.Y, p.Z
+	}
+	return bm
+}
+
+func TestBufferedMesh_ComputeCurvature(t *testing.T) {
+	bm := icosphere(3)
+	if err := bm.ComputeCurvature(); err != nil {
+		t.Fatal(err)
+	}
+	mean := bm.GetAttribute(geometry.AttributeMeanCurvature)
+	gauss := bm.GetAttribute(geometry.AttributeGaussianCurvature)
+	principal := bm.GetAttribute(geometry.AttributePrincipalCurvatures)
+	for i := 0; i < bm.NumVertices(); i++ {
+		h, k := mean.Values[i], gauss.Values[i]
+		k1, k2 := principal.Values[2*i], principal.Values[2*i+1]
+		if !math.ApproxEq(h, 1, 0.05) || !math.ApproxEq(k, 1, 0.1) || k1 < k2 ||
+			!math.ApproxEq(k1, 1, 0.3) || !math.ApproxEq(k2, 1, 0.3) {
+			t.Fatalf("vertex %d: unexpected curvatures of a sphere: H=%v, K=%v, k1=%v, k2=%v", i, h, k, k1, k2)
+		}
+	}
+
+	// The principal directions of a cylinder are around and along its
+	// axis.
+	const m, n = 32, 8
+	bm = cylinder(m, n)
+	if err := bm.ComputeCurvature(); err != nil {
+		t.Fatal(err)
+	}
+	mean = bm.GetAttribute(geometry.AttributeMeanCurvature)
+	gauss = bm.GetAttribute(geometry.AttributeGaussianCurvature)
+	principal = bm.GetAttribute(geometry.AttributePrincipalCurvatures)
+	dirs := bm.GetAttribute(geometry.AttributePrincipalDirections)
+	for i := m; i < (n-1)*m; i++ {
+		h, k := mean.Values[i], gauss.Values[i]
+		k1, k2 := principal.Values[2*i], principal.Values[2*i+1]
+		if !math.ApproxEq(h, 0.5, 0.01) || !math.ApproxEq(k, 0, 1e-9) ||
+			!math.ApproxEq(k1, 1, 0.02) || !math.ApproxEq(k2, 0, 0.02) {
+			t.Fatalf("vertex %d: unexpected curvatures of a cylinder: H=%v, K=%v, k1=%v, k2=%v", i, h, k, k1, k2)
+		}
+		d1 := math.NewVec3(dirs.Values[6*i], dirs.Values[6*i+1], dirs.Values[6*i+2])
+		d2 := math.NewVec3(dirs.Values[6*i+3], dirs.Values[6*i+4], dirs.Values[6*i+5])
+		if !math.ApproxEq(math.Abs(d1.Z), 0, 1e-6) || !math.ApproxEq(math.Abs(d2.Z), 1, 1e-6) {
+			t.Fatalf("vertex %d: unexpected principal directions: %v, %v", i, d1, d2)
+		}
+	}
+
+	if err := bm.ApplyColorMap(geometry.AttributePrincipalCurvatures, 0, -1, 1, color.CoolWarm); err != nil {
+		t.Fatal(err)
+	}
+	col := bm.GetAttribute(geometry.AttributeCol)
+	if c := color.CoolWarm.At(1); col.Values[4*m] != float64(c.R) || col.Values[4*m+2] != float64(c.B) {
+		t.Fatalf("unexpected color of a curvature of one: %v", col.Values[4*m:4*m+4])
+	}
+	if err := bm.ApplyColorMap(geometry.AttributePrincipalCurvatures, 2, -1, 1, color.CoolWarm); err == nil {
+		t.Fatalf("expect an error for a missing value")
+	}
+}
+
+func TestHalfedgeMesh_Curvatures(t *testing.T) {
+	vs := vertices(
+		math.NewVec3(0, 0, 0),
+		math.NewVec3(1, 0, 0),
+		math.NewVec3(1, 1, 0),
+		math.NewVec3(0, 1, 0),
+	)
+	m, err := geometry.NewHalfedgeMesh(vs, [][]int{{0, 1, 2, 3}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Curvatures(); err == nil {
+		t.Fatalf("expect an error for quads")
+	}
+
+	// A flat triangle fan has no curvature.
+	vs = vertices(
+		math.NewVec3(0, 0, 0),
+		math.NewVec3(1, 0, 0),
+		math.NewVec3(0, 1, 0),
+		math.NewVec3(-1, 0, 0),
+		math.NewVec3(0, -1, 0),
+	)
+	m, err = geometry.NewHalfedgeMesh(vs, [][]int{{0, 1, 2}, {0, 2, 3}, {0, 3, 4}, {0, 4, 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cs, err := m.Curvatures()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := cs[0]; c.Mean != 0 || !math.ApproxEq(c.Gaussian, 0, 1e-9) || c.Max != 0 || c.Min != 0 {
+		t.Fatalf("unexpected curvature of a flat vertex: %+v", c)
+	}
+
+	// A collinear triangle has no angles and must not spread NaNs to
+	// the curvatures of its vertices.
+	vs = vertices(
+		math.NewVec3(0, 0, 0),
+		math.NewVec3(1, 0, 0),
+		math.NewVec3(2, 0, 0),
+		math.NewVec3(1, 1, 0),
+	)
+	m, err = geometry.NewHalfedgeMesh(vs, [][]int{{0, 1, 3}, {1, 2, 3}, {0, 2, 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cs, err = m.Curvatures()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, c := range cs {
+		for _, v := range []float64{
+			c.Mean, c.Gaussian, c.Max, c.Min,
+			c.MaxDir.X, c.MaxDir.Y, c.MaxDir.Z,
+			c.MinDir.X, c.MinDir.Y, c.MinDir.Z,
+		} {
+			if v != v {
+				t.Fatalf("unexpected NaN curvature of vertex %d: %+v", i, c)
+			}
+		}
+	}
+}
@@ -4,6 +4,468 @@
 
 package geometry
 
+import (
+	"errors"
+	"fmt"
+
+	"poly.red/geometry/primitive"
+	"poly.red/material"
+	"poly.red/math"
+)
+
+// ErrNonManifold is returned when a mesh cannot be represented by a
+// halfedge mesh, i.e. an edge is shared by more than two faces, faces
+// are inconsistently oriented, or a vertex joins several fans of faces.
+var ErrNonManifold = errors.New("geometry: non-manifold mesh")
+
+var _ primitive.Face = &HalfedgeFace{}
+
+// HalfedgeMesh is a connectivity representation of a manifold polygon
+// mesh, which offers constant time traversal of the neighborhood of
+// vertices, edges and faces.
+//
+// Each face is bounded by a loop of halfedges, and each edge consists
+// of two twin halfedges of opposite direction. The halfedges along the
+// boundary of a mesh have no face and form the boundary loops. Faces
+// reference the vertices of the mesh, hence the modification of a
+// vertex is visible from all its faces.
 type HalfedgeMesh struct {
-	// TODO:
+	verts     []*primitive.Vertex
+	faces     []*HalfedgeFace
+	halfedges []*primitive.Halfedge
+	// outgoing halfedge of each vertex, which is the boundary halfedge
+	// for boundary vertices, or nil for isolated vertices.
+	outgoing []*primitive.Halfedge
+	// origin vertex index of each halfedge.
+	origin   []int
+	material material.Material
+}
+
+// HalfedgeFace is a face of a halfedge mesh.
+type HalfedgeFace struct {
+	he  *primitive.Halfedge
+	idx int
+}
+
+// NewHalfedgeMesh returns a halfedge mesh of the given vertices and
+// polygon faces, where each face is a counterclockwise loop of at least
+// three vertex indices. An error wrapping ErrNonManifold is returned if
+// the faces do not form a manifold.
+func NewHalfedgeMesh(vs []*primitive.Vertex, faces [][]int) (*HalfedgeMesh, error) {
+	m := &HalfedgeMesh{
+		verts:    vs,
+		faces:    make([]*HalfedgeFace, len(faces)),
+		outgoing: make([]*primitive.Halfedge, len(vs)),
+	}
+
+	type edge struct{ a, b int }
+	edges := make(map[edge]*primitive.Halfedge, 3*len(faces))
+	newHalfedge := func(a int, f primitive.Face) *primitive.Halfedge {
+		he := primitive.NewHalfedge(vs[a], f, int64(len(m.halfedges)))
+		m.halfedges = append(m.halfedges, he)
+		m.origin = append(m.origin, a)
+		return he
+	}
+
+	for i, face := range faces {
+		if len(face) < 3 {
+			return nil, fmt.Errorf("geometry: face %d has %d vertices", i, len(face))
+		}
+		f := &HalfedgeFace{idx: i}
+		m.faces[i] = f
+
+		var first, prev *primitive.Halfedge
+		for k, a := range face {
+			b := face[(k+1)%len(face)]
+			if a < 0 || a >= len(vs) {
+				return nil, fmt.Errorf("geometry: face %d references vertex %d out of range", i, a)
+			}
+			if a == b {
+				return nil, fmt.Errorf("geometry: face %d has a degenerate edge at vertex %d", i, a)
+			}
+			if _, ok := edges[edge{a, b}]; ok {
+				return nil, fmt.Errorf("%w: edge (%d, %d) of face %d is shared by more than two faces or faces are inconsistently oriented", ErrNonManifold, a, b, i)
+			}
+
+			he := newHalfedge(a, f)
+			edges[edge{a, b}] = he
+			if prev != nil {
+				prev.SetNext(he)
+			} else {
+				first = he
+			}
+			prev = he
+		}
+		prev.SetNext(first)
+		f.he = first
+	}
+
+	// Link twins, and close open edges by boundary halfedges. Each
+	// vertex may start at most one boundary halfedge, otherwise the
+	// boundary loops through the vertex are ambiguous.
+	boundary := map[int]*primitive.Halfedge{}
+	n := len(m.halfedges)
+	for i := 0; i < n; i++ {
+		he := m.halfedges[i]
+		if he.Twin() != nil {
+			continue
+		}
+		a, b := m.origin[i], m.origin[he.Next().Index()]
+		if twin, ok := edges[edge{b, a}]; ok {
+			he.SetTwin(twin)
+			continue
+		}
+		if _, ok := boundary[b]; ok {
+			return nil, fmt.Errorf("%w: vertex %d is shared by several boundaries", ErrNonManifold, b)
+		}
+		twin := newHalfedge(b, nil)
+		he.SetTwin(twin)
+		boundary[b] = twin
+	}
+	for _, he := range m.halfedges[n:] {
+		he.SetNext(boundary[m.origin[he.Twin().Index()]])
+	}
+
+	// Every outgoing halfedge of a vertex must be reachable by rotating
+	// around the vertex, otherwise the vertex joins several fans.
+	degree := make([]int, len(vs))
+	for i, he := range m.halfedges {
+		a := m.origin[i]
+		degree[a]++
+		if m.outgoing[a] == nil || he.OnBoundary() {
+			m.outgoing[a] = he
+		}
+	}
+	for i, start := range m.outgoing {
+		if start == nil {
+			continue
+		}
+		count := 0
+		for he := start; count <= degree[i]; {
+			count++
+			he = he.Twin().Next()
+			if he == start {
+				break
+			}
+		}
+		if count != degree[i] {
+			return nil, fmt.Errorf("%w: vertex %d joins several fans of faces", ErrNonManifold, i)
+		}
+	}
+	return m, nil
+}
+
+// NewHalfedgeMeshFromBufferedMesh returns a halfedge mesh of the given
+// buffered mesh. Triangles share vertices through the vertex index of
+// the buffered mesh, thus vertices that are duplicated in the buffer,
+// e.g. along texture seams, separate the surface.
+func NewHalfedgeMeshFromBufferedMesh(bm *BufferedMesh) (*HalfedgeMesh, error) {
+	attrPos := bm.GetAttribute(AttributePos)
+	attrNor := bm.GetAttribute(AttributeNor)
+	attrColor := bm.GetAttribute(AttributeCol)
+	attrUV := bm.GetAttribute(AttributeUV)
+	attrTan := bm.GetAttribute(AttributeTan)
+
+	vs := make([]*primitive.Vertex, bm.NumVertices())
+	for i := range vs {
+		v := vertex(uint64(i), attrPos, attrNor, attrColor, attrUV, attrTan)
+		vs[i] = &v
+	}
+	idx := bm.GetVertexIndex()
+	faces := make([][]int, len(idx)/3)
+	for i := range faces {
+		faces[i] = []int{int(idx[3*i]), int(idx[3*i+1]), int(idx[3*i+2])}
+	}
+
+	m, err := NewHalfedgeMesh(vs, faces)
+	if err != nil {
+		return nil, err
+	}
+	m.material = bm.GetMaterial()
+	return m, nil
+}
+
+// NewHalfedgeMeshFromTriangleSoup returns a halfedge mesh of the given
+// triangle soup. Vertices of the same position are welded, and keep the
+// attributes of their first occurrence. Triangles that degenerate to an
+// edge or a point by welding are dropped.
+func NewHalfedgeMeshFromTriangleSoup(ts *TriangleSoup) (*HalfedgeMesh, error) {
+	corners := make([]*primitive.Vertex, 0, 3*len(ts.faces))
+	pos := make([]math.Vec3, 0, 3*len(ts.faces))
+	for _, t := range ts.faces {
+		for _, v := range []*primitive.Vertex{&t.V1, &t.V2, &t.V3} {
+			corners = append(corners, v)
+			pos = append(pos, v.Pos.ToVec3())
+		}
+	}
+	weld, welded := weldPositions(pos)
+	vs := make([]*primitive.Vertex, len(welded))
+	for i, w := range weld {
+		if vs[w] == nil {
+			v := *corners[i]
+			vs[w] = &v
+		}
+	}
+
+	var faces [][]int
+	for i := 0; i+2 < len(weld); i += 3 {
+		a, b, c := weld[i], weld[i+1], weld[i+2]
+		if a == b || b == c || c == a {
+			continue
+		}
+		faces = append(faces, []int{a, b, c})
+	}
+
+	m, err := NewHalfedgeMesh(vs, faces)
+	if err != nil {
+		return nil, err
+	}
+	m.material = ts.GetMaterial()
+	return m, nil
+}
+
+// NumVertices returns the number of vertices.
+func (m *HalfedgeMesh) NumVertices() int { return len(m.verts) }
+
+// NumFaces returns the number of faces.
+func (m *HalfedgeMesh) NumFaces() int { return len(m.faces) }
+
+// NumHalfedges returns the number of halfedges, including the
+// halfedges on the boundary.
+func (m *HalfedgeMesh) NumHalfedges() int { return len(m.halfedges) }
+
+// NumEdges returns the number of edges.
+func (m *HalfedgeMesh) NumEdges() int { return len(m.halfedges) / 2 }
+
+// Vertex returns the i-th vertex.
+func (m *HalfedgeMesh) Vertex(i int) *primitive.Vertex { return m.verts[i] }
+
+// Face returns the i-th face.
+func (m *HalfedgeMesh) Face(i int) *HalfedgeFace { return m.faces[i] }
+
+// Halfedge returns the i-th halfedge.
+func (m *HalfedgeMesh) Halfedge(i int) *primitive.Halfedge { return m.halfedges[i] }
+
+// Origin returns the index of the vertex where the given halfedge
+// starts.
+func (m *HalfedgeMesh) Origin(he *primitive.Halfedge) int {
+	return m.origin[he.Index()]
+}
+
+// Outgoing returns an outgoing halfedge of the i-th vertex, which is
+// the boundary halfedge if the vertex is on the boundary, or nil if the
+// vertex has no face.
+func (m *HalfedgeMesh) Outgoing(i int) *primitive.Halfedge { return m.outgoing[i] }
+
+// GetMaterial returns the material of the halfedge mesh.
+func (m *HalfedgeMesh) GetMaterial() material.Material { return m.material }
+
+// SetMaterial sets the material of the halfedge mesh.
+func (m *HalfedgeMesh) SetMaterial(mat material.Material) { m.material = mat }
+
+// Vertices iterates over all vertices and their indices.
+func (m *HalfedgeMesh) Vertices(iter func(i int, v *primitive.Vertex) bool) {
+	for i, v := range m.verts {
+		if !iter(i, v) {
+			return
+		}
+	}
+}
+
+// Faces iterates over all faces.
+func (m *HalfedgeMesh) Faces(iter func(f *HalfedgeFace) bool) {
+	for _, f := range m.faces {
+		if !iter(f) {
+			return
+		}
+	}
+}
+
+// Halfedges iterates over all halfedges, including the halfedges on the
+// boundary.
+func (m *HalfedgeMesh) Halfedges(iter func(he *primitive.Halfedge) bool) {
+	for _, he := range m.halfedges {
+		if !iter(he) {
+			return
+		}
+	}
+}
+
+// Edges iterates over all edges, each is represented by one of its
+// halfedges.
+func (m *HalfedgeMesh) Edges(iter func(he *primitive.Halfedge) bool) {
+	for _, he := range m.halfedges {
+		if he.Index() < he.Twin().Index() && !iter(he) {
+			return
+		}
+	}
+}
+
+// OneRing iterates over the neighbors of the i-th vertex in clockwise
+// order, together with the outgoing halfedge that points to each
+// neighbor. Boundary vertices start with the neighbor along the
+// boundary.
+func (m *HalfedgeMesh) OneRing(i int, iter func(j int, he *primitive.Halfedge) bool) {
+	start := m.outgoing[i]
+	if start == nil {
+		return
+	}
+	he := start
+	for {
+		if !iter(m.origin[he.Twin().Index()], he) {
+			return
+		}
+		he = he.Twin().Next()
+		if he == start {
+			return
+		}
+	}
+}
+
+// VertexFaces iterates over the faces around the i-th vertex.
+func (m *HalfedgeMesh) VertexFaces(i int, iter func(f *HalfedgeFace) bool) {
+	m.OneRing(i, func(j int, he *primitive.Halfedge) bool {
+		if he.OnBoundary() {
+			return true
+		}
+		return iter(he.Face().(*HalfedgeFace))
+	})
+}
+
+// Valence returns the number of neighbors of the i-th vertex.
+func (m *HalfedgeMesh) Valence(i int) int {
+	n := 0
+	m.OneRing(i, func(j int, he *primitive.Halfedge) bool {
+		n++
+		return true
+	})
+	return n
+}
+
+// IsBoundaryVertex reports whether the i-th vertex is on the boundary.
+// Isolated vertices are on the boundary as well.
+func (m *HalfedgeMesh) IsBoundaryVertex(i int) bool {
+	return m.outgoing[i] == nil || m.outgoing[i].OnBoundary()
+}
+
+// BoundaryLoops returns the vertex indices of each boundary loop. A
+// closed mesh has no boundary loop.
+func (m *HalfedgeMesh) BoundaryLoops() [][]int {
+	var loops [][]int
+	visited := make([]bool, len(m.halfedges))
+	for _, start := range m.halfedges {
+		if !start.OnBoundary() || visited[start.Index()] {
+			continue
+		}
+		var loop []int
+		for he := start; !visited[he.Index()]; he = he.Next() {
+			visited[he.Index()] = true
+			loop = append(loop, m.origin[he.Index()])
+		}
+		loops = append(loops, loop)
+	}
+	return loops
+}
+
+// ToBufferedMesh converts the halfedge mesh to a buffered mesh that can
+// be rendered. Polygon faces are triangulated as triangle fans.
+func (m *HalfedgeMesh) ToBufferedMesh() *BufferedMesh {
+	n := len(m.verts)
+	pos := make([]float64, 0, 3*n)
+	nor := make([]float64, 0, 3*n)
+	uv := make([]float64, 0, 2*n)
+	col := make([]float64, 0, 4*n)
+	for _, v := range m.verts {
+		pos = append(pos, v.Pos.X, v.Pos.Y, v.Pos.Z)
+		nor = append(nor, v.Nor.X, v.Nor.Y, v.Nor.Z)
+		uv = append(uv, v.UV.X, v.UV.Y)
+		col = append(col, float64(v.Col.R), float64(v.Col.G), float64(v.Col.B), float64(v.Col.A))
+	}
+
+	var idx []uint64
+	for _, f := range m.faces {
+		first := m.origin[f.he.Index()]
+		for he := f.he.Next(); he.Next() != f.he; he = he.Next() {
+			idx = append(idx, uint64(first), uint64(m.origin[he.Index()]), uint64(m.origin[he.Next().Index()]))
+		}
+	}
+
+	bm := NewBufferedMesh()
+	bm.SetAttribute(AttributePos, NewBufferAttribute(3, pos))
+	bm.SetAttribute(AttributeNor, NewBufferAttribute(3, nor))
+	bm.SetAttribute(AttributeUV, NewBufferAttribute(2, uv))
+	bm.SetAttribute(AttributeCol, NewBufferAttribute(4, col))
+	bm.SetVertexIndex(idx)
+	bm.SetMaterial(m.material)
+	return bm
+}
+
+// Index returns the index of the face in its mesh.
+func (f *HalfedgeFace) Index() int { return f.idx }
+
+// Halfedge returns a halfedge of the face.
+func (f *HalfedgeFace) Halfedge() *primitive.Halfedge { return f.he }
+
+// NumVertices returns the number of vertices of the face.
+func (f *HalfedgeFace) NumVertices() int {
+	n := 0
+	f.Vertices(func(v *primitive.Vertex) bool {
+		n++
+		return true
+	})
+	return n
+}
+
+// Normal returns the unit normal of the face, which is computed using
+// Newell's method for polygons that are not planar.
+func (f *HalfedgeFace) Normal() math.Vec4 {
+	var n math.Vec4
+	he := f.he
+	for {
+		p, q := he.Vertex().Pos, he.Next().Vertex().Pos
+		n.X += (p.Y - q.Y) * (p.Z + q.Z)
+		n.Y += (p.Z - q.Z) * (p.X + q.X)
+		n.Z += (p.X - q.X) * (p.Y + q.Y)
+		he = he.Next()
+		if he == f.he {
+			break
+		}
+	}
+	return n.Unit()
+}
+
+// AABB returns the axis aligned bounding box of the face.
+func (f *HalfedgeFace) AABB() primitive.AABB {
+	var ps []math.Vec3
+	f.Vertices(func(v *primitive.Vertex) bool {
+		ps = append(ps, v.Pos.ToVec3())
+		return true
+	})
+	return primitive.NewAABB(ps...)
+}
+
+// Vertices iterates over the vertices of the face in counterclockwise
+// order.
+func (f *HalfedgeFace) Vertices(iter func(v *primitive.Vertex) bool) {
+	he := f.he
+	for {
+		if !iter(he.Vertex()) {
+			return
+		}
+		he = he.Next()
+		if he == f.he {
+			return
+		}
+	}
+}
+
+// Triangles iterates over the triangles of a fan triangulation of the
+// face.
+func (f *HalfedgeFace) Triangles(iter func(t *primitive.Triangle) bool) {
+	v0 := f.he.Vertex()
+	for he := f.he.Next(); he.Next() != f.he; he = he.Next() {
+		if !iter(primitive.NewTriangle(v0, he.Vertex(), he.Next().Vertex())) {
+			return
+		}
+	}
 }
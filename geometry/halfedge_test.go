@@ -0,0 +1,215 @@
+// Copyright 2021 Changkun Ou <changkun.de>. All rights reserved.
+// Use of this source code is governed by a GPLv3 license that
+// can be found in the LICENSE file.
+
+package geometry_test
+
+import (
+	"errors"
+	"testing"
+
+	"poly.red/geometry"
+	"poly.red/geometry/primitive"
+	"poly.red/math"
+)
+
+func vertices(ps ...math.Vec3) []*primitive.Vertex {
+	vs := make([]*primitive.Vertex, len(ps))
+	for i, p := range ps {
+		vs[i] = &primitive.Vertex{Pos: p.ToVec4(1)}
+	}
+	return vs
+}
+
+// tetrahedron returns the vertices and faces of a closed tetrahedron.
+func tetrahedron() ([]*primitive.Vertex, [][]int) {
+	vs := vertices(
+		math.NewVec3(0, 0, 0),
+		math.NewVec3(1, 0, 0),
+		math.NewVec3(0, 1, 0),
+		math.NewVec3(0, 0, 1),
+	)
+	return vs, [][]int{{0, 2, 1}, {0, 1, 3}, {0, 3, 2}, {1, 2, 3}}
+}
+
+func TestHalfedgeMesh(t *testing.T) {
+	m, err := geometry.NewHalfedgeMesh(tetrahedron())
+	if err != nil {
+		t.Fatalf("cannot create halfedge mesh: %v", err)
+	}
+	if m.NumVertices() != 4 || m.NumFaces() != 4 || m.NumEdges() != 6 || m.NumHalfedges() != 12 {
+		t.Fatalf("unexpected size: %d vertices, %d faces, %d edges",
+			m.NumVertices(), m.NumFaces(), m.NumEdges())
+	}
+	if loops := m.BoundaryLoops(); len(loops) != 0 {
+		t.Fatalf("expect a closed mesh, got boundary loops %v", loops)
+	}
+
+	m.Halfedges(func(he *primitive.Halfedge) bool {
+		if he.Twin().Twin() != he || he.Next().Prev() != he {
+			t.Fatalf("halfedge %d is not linked", he.Index())
+		}
+		if m.Origin(he.Twin()) != m.Origin(he.Next()) {
+			t.Fatalf("twin of halfedge %d has a wrong origin", he.Index())
+		}
+		return true
+	})
+
+	var ring []int
+	m.OneRing(0, func(j int, he *primitive.Halfedge) bool {
+		if m.Origin(he) != 0 {
+			t.Fatalf("halfedge %d does not start at vertex 0", he.Index())
+		}
+		ring = append(ring, j)
+		return true
+	})
+	if len(ring) != 3 || m.Valence(0) != 3 {
+		t.Fatalf("unexpected one-ring: %v", ring)
+	}
+	faces := 0
+	m.VertexFaces(3, func(f *geometry.HalfedgeFace) bool {
+		faces++
+		return true
+	})
+	if faces != 3 || m.IsBoundaryVertex(3) {
+		t.Fatalf("unexpected faces around vertex 3: %d", faces)
+	}
+
+	// The face (0, 2, 1) faces downwards, and the dihedral angle of its
+	// edges to the face (0, 1, 3) is a right angle.
+	f := m.Face(0)
+	if !f.Normal().Eq(math.NewVec4(0, 0, -1, 0)) || f.NumVertices() != 3 {
+		t.Fatalf("unexpected face normal: %v", f.Normal())
+	}
+	m.Edges(func(he *primitive.Halfedge) bool {
+		a, b := m.Origin(he), m.Origin(he.Twin())
+		if a+b == 1 && !math.ApproxEq(math.Abs(he.DihedralAngle()), math.Pi/2, 1e-9) {
+			t.Fatalf("unexpected dihedral angle: %v", he.DihedralAngle())
+		}
+		return true
+	})
+
+	// Vertices are shared by faces.
+	m.Vertex(3).Pos = math.NewVec4(0, 0, 2, 1)
+	if aabb := m.Face(1).AABB(); aabb.Max.Z != 2 {
+		t.Fatalf("face does not see the modified vertex: %v", aabb)
+	}
+
+	bm := m.ToBufferedMesh()
+	if bm.NumTriangles() != 4 || bm.NumVertices() != 4 {
+		t.Fatalf("unexpected buffered mesh: %d triangles, %d vertices",
+			bm.NumTriangles(), bm.NumVertices())
+	}
+}
+
+func TestHalfedgeMeshBoundary(t *testing.T) {
+	// A quad and a triangle that share an edge.
+	vs := vertices(
+		math.NewVec3(0, 0, 0),
+		math.NewVec3(1, 0, 0),
+		math.NewVec3(1, 1, 0),
+		math.NewVec3(0, 1, 0),
+		math.NewVec3(2, 0, 0),
+	)
+	m, err := geometry.NewHalfedgeMesh(vs, [][]int{{0, 1, 2, 3}, {1, 4, 2}})
+	if err != nil {
+		t.Fatalf("cannot create halfedge mesh: %v", err)
+	}
+	loops := m.BoundaryLoops()
+	if len(loops) != 1 || len(loops[0]) != 5 {
+		t.Fatalf("unexpected boundary loops: %v", loops)
+	}
+	for i := 0; i < m.NumVertices(); i++ {
+		if !m.IsBoundaryVertex(i) {
+			t.Fatalf("vertex %d is not on the boundary", i)
+		}
+	}
+
+	var ring []int
+	m.OneRing(1, func(j int, he *primitive.Halfedge) bool {
+		ring = append(ring, j)
+		return true
+	})
+	if len(ring) != 3 || !m.Outgoing(1).OnBoundary() {
+		t.Fatalf("unexpected one-ring of a boundary vertex: %v", ring)
+	}
+
+	bm := m.ToBufferedMesh()
+	if bm.NumTriangles() != 3 {
+		t.Fatalf("expect 3 triangles, got %d", bm.NumTriangles())
+	}
+	n := 0
+	m.Face(0).Triangles(func(tri *primitive.Triangle) bool {
+		n++
+		return true
+	})
+	if n != 2 {
+		t.Fatalf("expect 2 triangles of a quad, got %d", n)
+	}
+}
+
+func TestHalfedgeMeshNonManifold(t *testing.T) {
+	vs := vertices(
+		math.NewVec3(0, 0, 0),
+		math.NewVec3(1, 0, 0),
+		math.NewVec3(0, 1, 0),
+		math.NewVec3(0, -1, 0),
+		math.NewVec3(0, 0, 1),
+		math.NewVec3(-1, 0, 0),
+		math.NewVec3(-1, 1, 0),
+	)
+	tests := map[string][][]int{
+		"three faces on an edge": {{0, 1, 2}, {1, 0, 3}, {0, 1, 4}},
+		"inconsistent faces":     {{0, 1, 2}, {0, 1, 3}},
+		"bowtie":                 {{0, 1, 2}, {0, 5, 6}},
+	}
+	for name, faces := range tests {
+		if _, err := geometry.NewHalfedgeMesh(vs, faces); !errors.Is(err, geometry.ErrNonManifold) {
+			t.Fatalf("%s: expect a non-manifold error, got %v", name, err)
+		}
+	}
+
+	// Two closed tetrahedra that share a vertex.
+	tvs, faces := tetrahedron()
+	tvs = append(tvs, vertices(
+		math.NewVec3(-1, 0, 0),
+		math.NewVec3(0, -1, 0),
+		math.NewVec3(0, 0, -1),
+	)...)
+	faces = append(faces, [][]int{{0, 4, 5}, {0, 5, 6}, {0, 6, 4}, {4, 6, 5}}...)
+	if _, err := geometry.NewHalfedgeMesh(tvs, faces); !errors.Is(err, geometry.ErrNonManifold) {
+		t.Fatalf("expect a non-manifold vertex, got %v", err)
+	}
+
+	for _, faces := range [][][]int{{{0, 1}}, {{0, 1, 9}}, {{0, 0, 1}}} {
+		if _, err := geometry.NewHalfedgeMesh(vs, faces); err == nil || errors.Is(err, geometry.ErrNonManifold) {
+			t.Fatalf("expect an invalid face error for %v, got %v", faces, err)
+		}
+	}
+}
+
+func TestHalfedgeMeshFromMesh(t *testing.T) {
+	vs, faces := tetrahedron()
+	var ts []*primitive.Triangle
+	for _, f := range faces {
+		ts = append(ts, primitive.NewTriangle(vs[f[0]], vs[f[1]], vs[f[2]]))
+	}
+	// A triangle that degenerates to an edge is dropped.
+	ts = append(ts, primitive.NewTriangle(vs[0], vs[1], vs[0]))
+
+	m, err := geometry.NewHalfedgeMeshFromTriangleSoup(geometry.NewTriangleSoup(ts))
+	if err != nil {
+		t.Fatalf("cannot create halfedge mesh: %v", err)
+	}
+	if m.NumVertices() != 4 || m.NumFaces() != 4 || len(m.BoundaryLoops()) != 0 {
+		t.Fatalf("unexpected welded mesh: %d vertices, %d faces", m.NumVertices(), m.NumFaces())
+	}
+
+	m, err = geometry.NewHalfedgeMeshFromBufferedMesh(m.ToBufferedMesh())
+	if err != nil {
+		t.Fatalf("cannot create halfedge mesh: %v", err)
+	}
+	if m.NumVertices() != 4 || m.NumFaces() != 4 || m.NumEdges() != 6 {
+		t.Fatalf("unexpected mesh: %d vertices, %d faces", m.NumVertices(), m.NumFaces())
+	}
+}
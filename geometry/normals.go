@@ -0,0 +1,212 @@
+// Copyright 2021 Changkun Ou <changkun.de>. All rights reserved.
+// Use of this source code is governed by a GPLv3 license that
+// can be found in the LICENSE file.
+
+package geometry
+
+import (
+	"poly.red/math"
+)
+
+// NormalWeighting is the weighting of face normals when they are
+// averaged to vertex normals.
+type NormalWeighting int
+
+const (
+	// NormalWeightingArea weights face normals by the face area, which
+	// is the default.
+	NormalWeightingArea NormalWeighting = iota
+	// NormalWeightingUniform weights all face normals equally.
+	NormalWeightingUniform
+	// NormalWeightingAngle weights face normals by the interior angle of
+	// the face at the vertex, which is independent of the tessellation.
+	NormalWeightingAngle
+)
+
+// NormalOption offers custom configurations for computing vertex
+// normals.
+type NormalOption struct {
+	weighting NormalWeighting
+	crease    float64
+}
+
+type ComputeNormalOption func(o *NormalOption)
+
+// WithNormalWeighting sets the weighting of face normals. The default
+// is NormalWeightingArea.
+func WithNormalWeighting(w NormalWeighting) ComputeNormalOption {
+	return func(o *NormalOption) {
+		o.weighting = w
+	}
+}
+
+// WithCreaseAngle sets the crease angle in degrees. Faces around a
+// vertex only share the vertex normal if the angle between their
+// normals does not exceed the crease angle, hence edges sharper than
+// the crease angle are kept sharp. The default is 180 degrees, which
+// smooths all edges.
+func WithCreaseAngle(deg float64) ComputeNormalOption {
+	return func(o *NormalOption) {
+		o.crease = deg
+	}
+}
+
+// ComputeNormals recomputes the normal attribute of the buffered mesh
+// as the weighted average of the normals of adjacent faces. Faces are
+// adjacent if they share a vertex position, thus vertices that are
+// duplicated in the buffer, e.g. along texture seams, receive the same
+// normal.
+//
+// A vertex is split into several vertices if its faces are separated
+// by edges sharper than the crease angle. Split vertices are appended
+// to the buffer and copy all attributes of the original vertex.
+func (bm *BufferedMesh) ComputeNormals(opts ...ComputeNormalOption) {
+	attrPos := bm.GetAttribute(AttributePos)
+	pos := func(i int) math.Vec3 {
+		v := int(bm.vertIdx[i])
+		return math.NewVec3(
+			attrPos.Values[attrPos.Stride*v+0],
+			attrPos.Values[attrPos.Stride*v+1],
+			attrPos.Values[attrPos.Stride*v+2],
+		)
+	}
+	nors := computeNormals(pos, len(bm.vertIdx)/3, newNormalOption(opts...))
+
+	// Corners of a vertex that receive different normals are split into
+	// separate vertices.
+	type key struct {
+		v int
+		n math.Vec3
+	}
+	groups := map[key]int{}
+	group := make([]int, len(bm.vertIdx))
+	for i, v := range bm.vertIdx {
+		k := key{int(v), nors[i]}
+		g, ok := groups[k]
+		if !ok {
+			g = len(groups)
+			groups[k] = g
+		}
+		group[i] = g
+	}
+	bm.splitVertices(group)
+
+	nor := make([]float64, 3*bm.NumVertices())
+	for i, v := range bm.vertIdx {
+		c := nors[i]
+		nor[3*v], nor[3*v+1], nor[3*v+2] = c.X, c.Y, c.Z
+	}
+	bm.SetAttribute(AttributeNor, NewBufferAttribute(3, nor))
+}
+
+// ComputeNormals recomputes the vertex normals of the triangle soup as
+// the weighted average of the normals of adjacent faces, where faces are
+// adjacent if they share a vertex position. Faces that are separated by
+// edges sharper than the crease angle do not share the vertex normal.
+func (t *TriangleSoup) ComputeNormals(opts ...ComputeNormalOption) {
+	pos := func(i int) math.Vec3 {
+		f := t.faces[i/3]
+		switch i % 3 {
+		case 0:
+			return f.V1.Pos.ToVec3()
+		case 1:
+			return f.V2.Pos.ToVec3()
+		}
+		return f.V3.Pos.ToVec3()
+	}
+	nors := computeNormals(pos, len(t.faces), newNormalOption(opts...))
+	for i, f := range t.faces {
+		f.V1.Nor = nors[3*i].ToVec4(0)
+		f.V2.Nor = nors[3*i+1].ToVec4(0)
+		f.V3.Nor = nors[3*i+2].ToVec4(0)
+	}
+}
+
+func newNormalOption(opts ...ComputeNormalOption) *NormalOption {
+	o := &NormalOption{
+		weighting: NormalWeightingArea,
+		crease:    180,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// computeNormals computes the normal of each corner of n triangles,
+// where pos returns the position of the i-th corner and the i-th
+// triangle consists of the corners 3i, 3i+1 and 3i+2.
+func computeNormals(pos func(i int) math.Vec3, n int, o *NormalOption) []math.Vec3 {
+	// Face normals are unit normals, and the weight of each corner
+	// is scaled separately.
+	faceNors := make([]math.Vec3, n)
+	weights := make([]float64, 3*n)
+	for f := 0; f < n; f++ {
+		p := [3]math.Vec3{pos(3 * f), pos(3*f + 1), pos(3*f + 2)}
+		c := p[1].Sub(p[0]).Cross(p[2].Sub(p[0]))
+		l := c.Len()
+		if l == 0 {
+			continue
+		}
+		faceNors[f] = c.Scale(1/l, 1/l, 1/l)
+		for k := 0; k < 3; k++ {
+			switch o.weighting {
+			case NormalWeightingUniform:
+				weights[3*f+k] = 1
+			case NormalWeightingAngle:
+				a := p[(k+1)%3].Sub(p[k])
+				b := p[(k+2)%3].Sub(p[k])
+				weights[3*f+k] = math.Atan2(a.Cross(b).Len(), a.Dot(b))
+			default:
+				weights[3*f+k] = l / 2
+			}
+		}
+	}
+
+	// Corners of the same position form a fan, and each corner sums
+	// the weighted normals of the faces of its fan that are within the
+	// crease angle. Without a crease, all corners of a fan share one
+	// normal.
+	fans := map[math.Vec3][]int{}
+	for i := 0; i < 3*n; i++ {
+		p := pos(i)
+		fans[p] = append(fans[p], i)
+	}
+	cosCrease := math.Cos(math.DegToRad(o.crease))
+	smooth := o.crease >= 180
+
+	nors := make([]math.Vec3, 3*n)
+	for _, fan := range fans {
+		if smooth {
+			var sum math.Vec3
+			for _, c := range fan {
+				sum = sum.Add(faceNors[c/3].Scale(weights[c], weights[c], weights[c]))
+			}
+			sum = unitOr(sum, faceNors[fan[0]/3])
+			for _, c := range fan {
+				nors[c] = sum
+			}
+			continue
+		}
+
+		for _, c := range fan {
+			fn := faceNors[c/3]
+			var sum math.Vec3
+			for _, d := range fan {
+				if d/3 == c/3 || fn.Dot(faceNors[d/3]) >= cosCrease {
+					sum = sum.Add(faceNors[d/3].Scale(weights[d], weights[d], weights[d]))
+				}
+			}
+			nors[c] = unitOr(sum, fn)
+		}
+	}
+	return nors
+}
+
+// unitOr returns the unit vector of v, or the fallback if v is zero.
+func unitOr(v, fallback math.Vec3) math.Vec3 {
+	if v.IsZero() {
+		return fallback
+	}
+	return v.Unit()
+}
@@ -0,0 +1,119 @@
+// Copyright 2021 Changkun Ou <changkun.de>. All rights reserved.
+// Use of this source code is governed by a GPLv3 license that
+// can be found in the LICENSE file.
+
+package geometry_test
+
+import (
+	"testing"
+
+	"poly.red/geometry"
+	"poly.red/geometry/primitive"
+	"poly.red/material"
+	"poly.red/math"
+)
+
+// cube returns a unit cube of 8 shared vertices and 12 triangles.
+func cube() *geometry.BufferedMesh {
+	bm := geometry.NewBufferedMesh()
+	bm.SetAttribute(geometry.AttributePos, geometry.NewBufferAttribute(3, []float64{
+		-1, -1, -1,
+		1, -1, -1,
+		1, 1, -1,
+		-1, 1, -1,
+		-1, -1, 1,
+		1, -1, 1,
+		1, 1, 1,
+		-1, 1, 1,
+	}))
+	bm.SetAttribute(geometry.AttributeUV, geometry.NewBufferAttribute(2, []float64{
+		0, 0, 1, 0, 1, 1, 0, 1, 0, 0, 1, 0, 1, 1, 0, 1,
+	}))
+	bm.SetVertexIndex([]uint64{
+		0, 3, 2, 0, 2, 1, // back
+		4, 5, 6, 4, 6, 7, // front
+		0, 1, 5, 0, 5, 4, // bottom
+		3, 7, 6, 3, 6, 2, // top
+		0, 4, 7, 0, 7, 3, // left
+		1, 2, 6, 1, 6, 5, // right
+	})
+	return bm
+}
+
+func TestBufferedMesh_ComputeNormals(t *testing.T) {
+	bm := cube()
+	bm.ComputeNormals(geometry.WithNormalWeighting(geometry.NormalWeightingAngle))
+	if bm.NumVertices() != 8 {
+		t.Fatalf("expect 8 vertices of a smooth cube, got %d", bm.NumVertices())
+	}
+	bm.Faces(func(f primitive.Face, _ material.Material) bool {
+		f.Vertices(func(v *primitive.Vertex) bool {
+			want := v.Pos.ToVec3().Unit().ToVec4(0)
+			if !v.Nor.Eq(want) {
+				t.Fatalf("expect normal %v at %v, got %v", want, v.Pos, v.Nor)
+			}
+			return true
+		})
+		return true
+	})
+
+	// Edges of the cube are sharper than the crease angle, which splits
+	// each vertex into one vertex per side.
+	bm = cube()
+	bm.ComputeNormals(geometry.WithCreaseAngle(60))
+	if bm.NumVertices() != 24 || len(bm.GetAttribute(geometry.AttributeUV).Values) != 48 {
+		t.Fatalf("expect 24 vertices of a sharp cube, got %d", bm.NumVertices())
+	}
+	bm.Faces(func(f primitive.Face, _ material.Material) bool {
+		f.Vertices(func(v *primitive.Vertex) bool {
+			if !v.Nor.Eq(f.Normal()) {
+				t.Fatalf("expect the face normal %v, got %v", f.Normal(), v.Nor)
+			}
+			return true
+		})
+		return true
+	})
+}
+
+func TestTriangleSoup_ComputeNormals(t *testing.T) {
+	// Two triangles of a roof with a ridge of 90 degrees.
+	vs := vertices(
+		math.NewVec3(0, 0, 0),
+		math.NewVec3(0, 0, 1),
+		math.NewVec3(1, 1, 0),
+		math.NewVec3(-1, 1, 0),
+	)
+	soup := func() *geometry.TriangleSoup {
+		return geometry.NewTriangleSoup([]*primitive.Triangle{
+			primitive.NewTriangle(vs[0], vs[2], vs[1]),
+			primitive.NewTriangle(vs[0], vs[1], vs[3]),
+		})
+	}
+	normals := func(ts *geometry.TriangleSoup) []math.Vec4 {
+		var ns []math.Vec4
+		ts.Faces(func(f primitive.Face, _ material.Material) bool {
+			f.Vertices(func(v *primitive.Vertex) bool {
+				ns = append(ns, v.Nor)
+				return true
+			})
+			return true
+		})
+		return ns
+	}
+
+	ts := soup()
+	ts.ComputeNormals(geometry.WithNormalWeighting(geometry.NormalWeightingUniform))
+	ns := normals(ts)
+	if !ns[0].Eq(math.NewVec4(0, -1, 0, 0)) || !ns[0].Eq(ns[3]) || !ns[1].Eq(ns[1].Unit()) {
+		t.Fatalf("unexpected smooth normals: %v", ns)
+	}
+
+	ts = soup()
+	ts.ComputeNormals(geometry.WithCreaseAngle(45))
+	ns = normals(ts)
+	a := math.NewVec4(1, -1, 0, 0).Unit()
+	b := math.NewVec4(-1, -1, 0, 0).Unit()
+	if !ns[0].Eq(a) || !ns[2].Eq(a) || !ns[3].Eq(b) || !ns[4].Eq(b) {
+		t.Fatalf("unexpected sharp normals: %v", ns)
+	}
+}
@@ -0,0 +1,748 @@
+// Copyright 2021 Changkun Ou <changkun.de>. All rights reserved.
+// Use of this source code is governed by a GPLv3 license that
+// can be found in the LICENSE file.
+
+package geometry
+
+import (
+	"errors"
+	"fmt"
+
+	"poly.red/math"
+)
+
+// ParameterizationMethod is the method that computes texture
+// coordinates of a mesh.
+type ParameterizationMethod int
+
+const (
+	// ParameterizeLSCM computes least squares conformal maps of Lévy et
+	// al., which preserve angles as well as possible with a free
+	// boundary. It is the default.
+	ParameterizeLSCM ParameterizationMethod = iota
+	// ParameterizeHarmonic maps the boundary to a circle and computes
+	// the harmonic map of the interior with cotangent weights.
+	ParameterizeHarmonic
+	// ParameterizeTutte maps the boundary to a circle and places each
+	// interior vertex at the average of its neighbors, which never
+	// flips triangles but ignores the shape of the mesh.
+	ParameterizeTutte
+)
+
+// ParameterizationOption offers custom configurations for computing
+// texture coordinates.
+type ParameterizationOption struct {
+	method ParameterizationMethod
+}
+
+type ParameterizeOption func(o *ParameterizationOption)
+
+// WithParameterization sets the parameterization method. The default
+// is ParameterizeLSCM.
+func WithParameterization(m ParameterizationMethod) ParameterizeOption {
+	return func(o *ParameterizationOption) {
+		o.method = m
+	}
+}
+
+// ErrNotDisk is returned when a parameterization requires a mesh of
+// disk topology, i.e. a connected mesh with a single boundary loop and
+// without handles.
+var ErrNotDisk = errors.New("geometry: mesh is not a topological disk")
+
+// Parameterize computes the texture coordinates of the buffered mesh,
+// which must be a topological disk, see CutSeams for closed meshes. The
+// surface is connected through the vertex index, thus vertices that
+// are duplicated in the buffer separate the surface. The texture
+// coordinates fit into the unit square and keep the aspect ratio of the
+// parameterization.
+func (bm *BufferedMesh) Parameterize(opts ...ParameterizeOption) error {
+	o := &ParameterizationOption{method: ParameterizeLSCM}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if bm.GetAttribute(AttributePos) == nil {
+		return errors.New("geometry: parameterization requires positions")
+	}
+
+	tm := NewTriangleMesh(bm)
+	if err := checkManifoldEdges(tm); err != nil {
+		return err
+	}
+	if _, n := tm.ConnectedComponents(); n != 1 {
+		return fmt.Errorf("%w: %d connected components", ErrNotDisk, n)
+	}
+	loop, err := boundaryLoop(tm)
+	if err != nil {
+		return err
+	}
+
+	var uv []float64
+	switch o.method {
+	case ParameterizeHarmonic, ParameterizeTutte:
+		uv = parameterizeFixed(tm, loop, o.method == ParameterizeHarmonic)
+	default:
+		uv = parameterizeLSCM(tm, loop)
+	}
+	normalizeUV(tm, uv)
+	bm.SetAttribute(AttributeUV, NewBufferAttribute(2, uv))
+	return nil
+}
+
+// CutSeams cuts the buffered mesh along seams into a topological disk,
+// which can be parameterized. Vertices along the seams are duplicated,
+// and duplicates copy all attributes of the original vertex. Meshes of
+// disk topology remain unchanged.
+//
+// The seams are the edges that are not crossed by a spanning tree of
+// the faces, where seams that end in the interior are removed. These
+// seams connect boundary loops and cut handles open. Since no seams
+// remain for closed meshes without handles, they are cut along a path
+// between two distant vertices.
+func (bm *BufferedMesh) CutSeams() error {
+	tm := NewTriangleMesh(bm)
+	if err := checkManifoldEdges(tm); err != nil {
+		return err
+	}
+	if _, n := tm.ConnectedComponents(); n != 1 {
+		return fmt.Errorf("%w: %d connected components", ErrNotDisk, n)
+	}
+
+	// Faces are connected through a breadth first spanning tree, and
+	// the remaining interior edges are seams.
+	ne, nf := tm.NumEdges(), tm.NumFaces()
+	tree := make([]bool, ne)
+	visited := make([]bool, nf)
+	visited[0] = true
+	queue := []int{0}
+	for len(queue) > 0 {
+		f := queue[0]
+		queue = queue[1:]
+		fe := tm.FaceEdges(f)
+		tm.FaceNeighbors(f, func(k, g int) bool {
+			if !visited[g] {
+				visited[g] = true
+				tree[fe[k]] = true
+				queue = append(queue, g)
+			}
+			return true
+		})
+	}
+	cut := make([]bool, ne)
+	degree := make([]int, tm.NumVertices())
+	boundary := false
+	for e := 0; e < ne; e++ {
+		if tm.IsBoundaryEdge(e) {
+			boundary = true
+		} else if tree[e] {
+			continue
+		} else {
+			cut[e] = true
+		}
+		degree[tm.Edge(e)[0]]++
+		degree[tm.Edge(e)[1]]++
+	}
+
+	// Seams that end in the interior are removed, which leaves the seams
+	// between boundaries and around handles.
+	var leaves []int
+	for v, d := range degree {
+		if d == 1 {
+			leaves = append(leaves, v)
+		}
+	}
+	for len(leaves) > 0 {
+		v := leaves[len(leaves)-1]
+		leaves = leaves[:len(leaves)-1]
+		tm.VertexNeighbors(v, func(u int) bool {
+			e := tm.edgeIndex(v, u)
+			if !cut[e] {
+				return true
+			}
+			cut[e] = false
+			degree[v]--
+			degree[u]--
+			if degree[u] == 1 {
+				leaves = append(leaves, u)
+			}
+			return false
+		})
+	}
+
+	seams := 0
+	for _, c := range cut {
+		if c {
+			seams++
+		}
+	}
+	if seams == 0 && !boundary {
+		for _, e := range longestPath(tm) {
+			cut[e] = true
+			seams++
+		}
+	}
+	if seams == 0 {
+		return nil
+	}
+	splitSeams(bm, tm, cut)
+	return nil
+}
+
+// checkManifoldEdges reports an error if an edge of the triangle mesh
+// belongs to more than two faces.
+func checkManifoldEdges(tm *TriangleMesh) error {
+	var err error
+	tm.Edges(func(i int, e [2]int) bool {
+		n := 0
+		tm.EdgeFaces(i, func(f int) bool {
+			n++
+			return true
+		})
+		if n > 2 {
+			err = fmt.Errorf("%w: edge (%d, %d) belongs to %d faces", ErrNonManifold, e[0], e[1], n)
+			return false
+		}
+		return true
+	})
+	return err
+}
+
+// edgeIndex returns the index of the edge (a, b), or -1 if there is no
+// such edge.
+func (tm *TriangleMesh) edgeIndex(a, b int) int {
+	adj := tm.adjacency()
+	for _, e := range adj.veItems[adj.veStart[a]:adj.veStart[a+1]] {
+		if vs := adj.edges[e]; vs[0] == b || vs[1] == b {
+			return e
+		}
+	}
+	return -1
+}
+
+// boundaryLoop returns the vertices of the boundary loop of a mesh of
+// disk topology in the order of the faces.
+func boundaryLoop(tm *TriangleMesh) ([]int, error) {
+	next := map[int]int{}
+	tm.Edges(func(e int, _ [2]int) bool {
+		if !tm.IsBoundaryEdge(e) {
+			return true
+		}
+		tm.EdgeFaces(e, func(f int) bool {
+			vs, fe := tm.Face(f), tm.FaceEdges(f)
+			for k := 0; k < 3; k++ {
+				if fe[k] == e {
+					next[vs[k]] = vs[(k+1)%3]
+				}
+			}
+			return false
+		})
+		return true
+	})
+	if len(next) == 0 {
+		return nil, fmt.Errorf("%w: mesh is closed", ErrNotDisk)
+	}
+
+	var start int
+	for v := range next {
+		start = v
+		break
+	}
+	loop := []int{start}
+	for v := next[start]; v != start; v = next[v] {
+		loop = append(loop, v)
+		if len(loop) > len(next) {
+			return nil, fmt.Errorf("%w: boundary vertices are not manifold", ErrNonManifold)
+		}
+	}
+	if len(loop) != len(next) {
+		return nil, fmt.Errorf("%w: mesh has several boundary loops", ErrNotDisk)
+	}
+
+	// A disk has the Euler characteristic one.
+	used := map[uint64]bool{}
+	for _, v := range tm.vertIdx {
+		used[v] = true
+	}
+	if chi := len(used) - tm.NumEdges() + tm.NumFaces(); chi != 1 {
+		return nil, fmt.Errorf("%w: mesh has handles", ErrNotDisk)
+	}
+	return loop, nil
+}
+
+// longestPath returns the edges of a path between two distant vertices
+// of the triangle mesh, which are found by two breadth first searches.
+func longestPath(tm *TriangleMesh) []int {
+	bfs := func(s int) (far int, prev []int) {
+		prev = make([]int, tm.NumVertices())
+		for i := range prev {
+			prev[i] = -1
+		}
+		prev[s] = s
+		queue := []int{s}
+		for len(queue) > 0 {
+			far = queue[0]
+			queue = queue[1:]
+			tm.VertexNeighbors(far, func(u int) bool {
+				if prev[u] < 0 {
+					prev[u] = far
+					queue = append(queue, u)
+				}
+				return true
+			})
+		}
+		return far, prev
+	}
+	a, _ := bfs(tm.Face(0)[0])
+	b, prev := bfs(a)
+	var path []int
+	for v := b; v != a; v = prev[v] {
+		path = append(path, tm.edgeIndex(v, prev[v]))
+	}
+	return path
+}
+
+// splitSeams duplicates the vertices along the cut edges, such that the
+// faces on both sides of a cut edge use different vertices.
+func splitSeams(bm *BufferedMesh, tm *TriangleMesh, cut []bool) {
+	// Corners of a vertex are joined across the edges that are not cut,
+	// and each group of corners becomes a vertex.
+	parent := make([]int, len(bm.vertIdx))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(i int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+	corner := func(f, v int) int {
+		vs := tm.Face(f)
+		for k := 0; k < 3; k++ {
+			if vs[k] == v {
+				return 3*f + k
+			}
+		}
+		return -1
+	}
+	tm.Edges(func(e int, vs [2]int) bool {
+		if cut[e] || tm.IsBoundaryEdge(e) {
+			return true
+		}
+		var fs []int
+		tm.EdgeFaces(e, func(f int) bool {
+			fs = append(fs, f)
+			return true
+		})
+		for _, v := range vs {
+			parent[find(corner(fs[0], v))] = find(corner(fs[1], v))
+		}
+		return true
+	})
+
+	group := make([]int, len(bm.vertIdx))
+	for i := range group {
+		group[i] = find(i)
+	}
+	bm.splitVertices(group)
+}
+
+// parameterizeFixed maps the boundary loop to a circle by arc length,
+// and solves the interior vertices of a harmonic map with cotangent
+// weights, or of a Tutte embedding with uniform weights.
+func parameterizeFixed(tm *TriangleMesh, loop []int, cotan bool) []float64 {
+	n := tm.NumVertices()
+	pos := tm.GetAttribute(AttributePos)
+	p := func(i int) math.Vec3 {
+		return math.NewVec3(pos.Values[pos.Stride*i], pos.Values[pos.Stride*i+1], pos.Values[pos.Stride*i+2])
+	}
+
+	uv := make([]float64, 2*n)
+	fixed := make([]bool, n)
+	total := 0.0
+	for k, v := range loop {
+		total += p(loop[(k+1)%len(loop)]).Sub(p(v)).Len()
+	}
+	arc := 0.0
+	for k, v := range loop {
+		a := 2 * math.Pi * arc / total
+		uv[2*v], uv[2*v+1] = math.Cos(a), math.Sin(a)
+		fixed[v] = true
+		arc += p(loop[(k+1)%len(loop)]).Sub(p(v)).Len()
+	}
+
+	// The weights of each edge, which are the sums of the cotangents of
+	// the opposite angles for harmonic maps.
+	weights := make([]float64, tm.NumEdges())
+	for e := range weights {
+		if !cotan {
+			weights[e] = 1
+			continue
+		}
+		a, b := p(tm.Edge(e)[0]), p(tm.Edge(e)[1])
+		tm.EdgeFaces(e, func(f int) bool {
+			for _, c := range tm.Face(f) {
+				if c != tm.Edge(e)[0] && c != tm.Edge(e)[1] {
+					u, v := a.Sub(p(c)), b.Sub(p(c))
+					if l := u.Cross(v).Len(); l > 0 {
+						weights[e] += u.Dot(v) / l / 2
+					}
+				}
+			}
+			return true
+		})
+	}
+
+	// Interior vertices are numbered, and the Laplacian of the interior
+	// is solved for each coordinate.
+	index := make([]int, n)
+	var interior []int
+	for v := 0; v < n; v++ {
+		index[v] = -1
+		used := false
+		tm.VertexFaces(v, func(int) bool {
+			used = true
+			return false
+		})
+		if used && !fixed[v] {
+			index[v] = len(interior)
+			interior = append(interior, v)
+		}
+	}
+	m := &sparse{cols: len(interior)}
+	b := [2][]float64{make([]float64, len(interior)), make([]float64, len(interior))}
+	for i, v := range interior {
+		var row []sparseEntry
+		diag := 0.0
+		tm.VertexNeighbors(v, func(u int) bool {
+			w := weights[tm.edgeIndex(v, u)]
+			diag += w
+			if fixed[u] {
+				b[0][i] += w * uv[2*u]
+				b[1][i] += w * uv[2*u+1]
+			} else if index[u] >= 0 {
+				row = append(row, sparseEntry{index[u], -w})
+			}
+			return true
+		})
+		m.rows = append(m.rows, append(row, sparseEntry{i, diag}))
+	}
+	for c := 0; c < 2; c++ {
+		x := make([]float64, len(interior))
+		conjugateGradient(m, b[c], x)
+		for i, v := range interior {
+			uv[2*v+c] = x[i]
+		}
+	}
+	return uv
+}
+
+// parameterizeLSCM computes a least squares conformal map, where two
+// distant vertices of the boundary loop are pinned.
+func parameterizeLSCM(tm *TriangleMesh, loop []int) []float64 {
+	n := tm.NumVertices()
+	pos := tm.GetAttribute(AttributePos)
+	p := func(i int) math.Vec3 {
+		return math.NewVec3(pos.Values[pos.Stride*i], pos.Values[pos.Stride*i+1], pos.Values[pos.Stride*i+2])
+	}
+
+	// The pinned vertices are the first vertex of the boundary loop and
+	// the boundary vertex that is farthest from it.
+	pin0, pin1 := loop[0], loop[0]
+	for _, v := range loop {
+		if p(v).Sub(p(pin0)).Len() > p(pin1).Sub(p(pin0)).Len() {
+			pin1 = v
+		}
+	}
+	uv := make([]float64, 2*n)
+	uv[2*pin1] = p(pin1).Sub(p(pin0)).Len()
+
+	// Unknowns are the u and v of the free vertices.
+	index := make([]int, n)
+	cols := 0
+	for v := 0; v < n; v++ {
+		index[v] = -1
+		if v != pin0 && v != pin1 {
+			index[v] = cols
+			cols += 2
+		}
+	}
+
+	// Each triangle contributes two rows, which are the area weighted
+	// deviations of the gradients of u and v from the Cauchy-Riemann
+	// equations in a local frame of the triangle.
+	m := &sparse{cols: cols}
+	var b []float64
+	for f := 0; f < tm.NumFaces(); f++ {
+		vs := tm.Face(f)
+		p0, p1, p2 := p(vs[0]), p(vs[1]), p(vs[2])
+		e1, e2 := p1.Sub(p0), p2.Sub(p0)
+		nor := e1.Cross(e2)
+		area := nor.Len() / 2
+		if area == 0 || e1.IsZero() {
+			continue
+		}
+		x := e1.Unit()
+		y := nor.Unit().Cross(x)
+		q := [3][2]float64{{0, 0}, {e1.Len(), 0}, {e2.Dot(x), e2.Dot(y)}}
+		s := 1 / (2 * math.Sqrt(area))
+
+		var rx, ry []sparseEntry
+		bx, by := 0.0, 0.0
+		for k := 0; k < 3; k++ {
+			// The edge opposite to the k-th vertex.
+			ex := (q[(k+2)%3][0] - q[(k+1)%3][0]) * s
+			ey := (q[(k+2)%3][1] - q[(k+1)%3][1]) * s
+			v := vs[k]
+			if i := index[v]; i >= 0 {
+				rx = append(rx, sparseEntry{i, ex}, sparseEntry{i + 1, -ey})
+				ry = append(ry, sparseEntry{i, ey}, sparseEntry{i + 1, ex})
+				continue
+			}
+			bx -= uv[2*v]*ex - uv[2*v+1]*ey
+			by -= uv[2*v]*ey + uv[2*v+1]*ex
+		}
+		m.rows = append(m.rows, rx, ry)
+		b = append(b, bx, by)
+	}
+
+	x := make([]float64, cols)
+	leastSquares(m, b, x)
+	for v := 0; v < n; v++ {
+		if i := index[v]; i >= 0 {
+			uv[2*v], uv[2*v+1] = x[i], x[i+1]
+		}
+	}
+	return uv
+}
+
+// normalizeUV translates and uniformly scales the texture coordinates
+// of the used vertices into the unit square.
+func normalizeUV(tm *TriangleMesh, uv []float64) {
+	min := [2]float64{math.Inf(1), math.Inf(1)}
+	max := [2]float64{math.Inf(-1), math.Inf(-1)}
+	for _, v := range tm.vertIdx {
+		for c := 0; c < 2; c++ {
+			min[c] = math.Min(min[c], uv[2*v+uint64(c)])
+			max[c] = math.Max(max[c], uv[2*v+uint64(c)])
+		}
+	}
+	size := math.Max(max[0]-min[0], max[1]-min[1])
+	if size <= 0 {
+		return
+	}
+	for i := 0; i < len(uv); i += 2 {
+		uv[i] = (uv[i] - min[0]) / size
+		uv[i+1] = (uv[i+1] - min[1]) / size
+	}
+}
+
+// Distortion reports the distortion of the texture coordinates of a
+// mesh. Texture coordinates are uniformly scaled to the surface area of
+// the mesh, and each measure is averaged over the surface area, where
+// one is free of distortion.
+type Distortion struct {
+	// Conformal is the ratio of the largest to the smallest stretch of
+	// the map, which is one for angle preserving maps.
+	Conformal float64
+	// MaxConformal is the largest conformal distortion of a triangle.
+	MaxConformal float64
+	// Area is the ratio of the larger to the smaller area of the
+	// triangle in space and in texture space, which is one for area
+	// preserving maps.
+	Area float64
+	// Stretch is the L2 stretch of Sander et al., which is one for
+	// isometric maps and grows with the undersampling of triangles
+	// whose texture area is small relative to their surface area.
+	Stretch float64
+	// Flipped is the number of triangles that are flipped or degenerate
+	// in texture space, which are excluded from the averages.
+	Flipped int
+}
+
+// UVDistortion measures the distortion of the texture coordinates of
+// the buffered mesh.
+func (bm *BufferedMesh) UVDistortion() (*Distortion, error) {
+	pos := bm.GetAttribute(AttributePos)
+	attrUV := bm.GetAttribute(AttributeUV)
+	if pos == nil || attrUV == nil {
+		return nil, errors.New("geometry: distortion requires positions and texture coordinates")
+	}
+	p := func(i uint64) math.Vec3 {
+		return math.NewVec3(pos.Values[pos.Stride*int(i)], pos.Values[pos.Stride*int(i)+1], pos.Values[pos.Stride*int(i)+2])
+	}
+	t := func(i uint64) [2]float64 {
+		return [2]float64{attrUV.Values[attrUV.Stride*int(i)], attrUV.Values[attrUV.Stride*int(i)+1]}
+	}
+
+	// The Jacobian of each triangle maps its local frame to texture
+	// space.
+	type triangle struct {
+		area, uvArea float64
+		j            [4]float64
+	}
+	var (
+		ts           []triangle
+		area, uvArea float64
+		d            = &Distortion{}
+	)
+	for i := 0; i+2 < len(bm.vertIdx); i += 3 {
+		v0, v1, v2 := bm.vertIdx[i], bm.vertIdx[i+1], bm.vertIdx[i+2]
+		e1, e2 := p(v1).Sub(p(v0)), p(v2).Sub(p(v0))
+		nor := e1.Cross(e2)
+		a := nor.Len() / 2
+		if a == 0 {
+			continue
+		}
+		x := e1.Unit()
+		y := nor.Unit().Cross(x)
+		q1x, q2x, q2y := e1.Len(), e2.Dot(x), e2.Dot(y)
+
+		w0, w1, w2 := t(v0), t(v1), t(v2)
+		du1, dv1 := w1[0]-w0[0], w1[1]-w0[1]
+		du2, dv2 := w2[0]-w0[0], w2[1]-w0[1]
+		uvA := (du1*dv2 - du2*dv1) / 2
+		if uvA <= 0 {
+			d.Flipped++
+			continue
+		}
+		// J = [w1-w0, w2-w0] [q1, q2]^-1, where q1 = (q1x, 0).
+		det := q1x * q2y
+		ts = append(ts, triangle{a, uvA, [4]float64{
+			du1 / q1x, (du2*q1x - du1*q2x) / det,
+			dv1 / q1x, (dv2*q1x - dv1*q2x) / det,
+		}})
+		area += a
+		uvArea += uvA
+	}
+	if len(ts) == 0 {
+		return d, nil
+	}
+
+	// Singular values of the Jacobians after scaling the texture area
+	// to the surface area.
+	scale := area / uvArea
+	var conformal, areaRatio, stretch float64
+	for _, tr := range ts {
+		frob := (tr.j[0]*tr.j[0] + tr.j[1]*tr.j[1] + tr.j[2]*tr.j[2] + tr.j[3]*tr.j[3]) * scale
+		det := (tr.j[0]*tr.j[3] - tr.j[1]*tr.j[2]) * scale
+		root := math.Sqrt(math.Max(frob*frob-4*det*det, 0))
+		s1 := math.Sqrt((frob + root) / 2)
+		s2 := math.Sqrt(math.Max((frob-root)/2, 0))
+
+		c := math.Inf(1)
+		if s2 > 0 {
+			c = s1 / s2
+		}
+		conformal += tr.area * c
+		d.MaxConformal = math.Max(d.MaxConformal, c)
+		areaRatio += tr.area * math.Max(det, 1/det)
+		// The L2 stretch uses the singular values of the inverse map
+		// from texture to surface, 1/s1 and 1/s2, where
+		// 1/s1^2 + 1/s2^2 = (s1^2 + s2^2) / (s1 s2)^2.
+		stretch += tr.area * frob / (2 * det * det)
+	}
+	d.Conformal = conformal / area
+	d.Area = areaRatio / area
+	d.Stretch = math.Sqrt(stretch / area)
+	return d, nil
+}
+
+// sparse is a sparse matrix of rows of entries.
+type sparse struct {
+	rows [][]sparseEntry
+	cols int
+}
+
+type sparseEntry struct {
+	col int
+	val float64
+}
+
+// mul computes out = m x.
+func (m *sparse) mul(x, out []float64) {
+	for i, row := range m.rows {
+		s := 0.0
+		for _, e := range row {
+			s += e.val * x[e.col]
+		}
+		out[i] = s
+	}
+}
+
+// mulT computes out = m^T x.
+func (m *sparse) mulT(x, out []float64) {
+	for i := range out {
+		out[i] = 0
+	}
+	for i, row := range m.rows {
+		for _, e := range row {
+			out[e.col] += e.val * x[i]
+		}
+	}
+}
+
+func dot(a, b []float64) float64 {
+	s := 0.0
+	for i := range a {
+		s += a[i] * b[i]
+	}
+	return s
+}
+
+// conjugateGradient solves m x = b for a symmetric positive definite
+// matrix, starting from the given x.
+func conjugateGradient(m *sparse, b, x []float64) {
+	n := len(x)
+	r := make([]float64, n)
+	q := make([]float64, n)
+	m.mul(x, r)
+	for i := range r {
+		r[i] = b[i] - r[i]
+	}
+	p := append([]float64(nil), r...)
+	rr := dot(r, r)
+	tol := 1e-20 * math.Max(dot(b, b), 1)
+	for it := 0; it < 10*n+10 && rr > tol; it++ {
+		m.mul(p, q)
+		alpha := rr / dot(p, q)
+		axpy(x, alpha, p)
+		axpy(r, -alpha, q)
+		next := dot(r, r)
+		beta := next / rr
+		rr = next
+		for i := range p {
+			p[i] = r[i] + beta*p[i]
+		}
+	}
+}
+
+// leastSquares minimizes |m x - b| by conjugate gradients on the normal
+// equations, starting from the given x.
+func leastSquares(m *sparse, b, x []float64) {
+	r := make([]float64, len(b))
+	q := make([]float64, len(b))
+	s := make([]float64, len(x))
+	m.mul(x, r)
+	for i := range r {
+		r[i] = b[i] - r[i]
+	}
+	m.mulT(r, s)
+	p := append([]float64(nil), s...)
+	ss := dot(s, s)
+	tol := 1e-24 * math.Max(ss, 1)
+	for it := 0; it < 10*len(x)+10 && ss > tol; it++ {
+		m.mul(p, q)
+		alpha := ss / dot(q, q)
+		axpy(x, alpha, p)
+		axpy(r, -alpha, q)
+		m.mulT(r, s)
+		next := dot(s, s)
+		beta := next / ss
+		ss = next
+		for i := range p {
+			p[i] = s[i] + beta*p[i]
+		}
+	}
+}
@@ -0,0 +1,221 @@
+// Copyright 2021 Changkun Ou <changkun.de>. All rights reserved.
+// Use of this source code is governed by a GPLv3 license that
+// can be found in the LICENSE file.
+
+package geometry_test
+
+import (
+	"errors"
+	"testing"
+
+	"poly.red/geometry"
+	"poly.red/math"
+)
+
+// torus returns a closed torus with the radii 2 and 0.5, which has m
+// vertices around the axis and n vertices around the tube.
+func torus(m, n int) *geometry.BufferedMesh {
+	var (
+		pos []float64
+		idx []uint64
+	)
+	for i := 0; i < m; i++ {
+		a := 2 * math.Pi * float64(i) / float64(m)
+		for j := 0; j < n; j++ {
+			b := 2 * math.Pi * float64(j) / float64(n)
+			r := 2 + 0.5*math.Cos(b)
+			pos = append(pos, r*math.Cos(a), r*math.Sin(a), 0.5*math.Sin(b))
+		}
+	}
+	for i := 0; i < m; i++ {
+		for j := 0; j < n; j++ {
+			a, b := uint64(i*n+j), uint64(((i+1)%m)*n+j)
+			c, d := uint64(((i+1)%m)*n+(j+1)%n), uint64(i*n+(j+1)%n)
+			idx = append(idx, a, b, c, a, c, d)
+		}
+	}
+	bm := geometry.NewBufferedMesh()
+	bm.SetAttribute(geometry.AttributePos, geometry.NewBufferAttribute(3, pos))
+	bm.SetVertexIndex(idx)
+	return bm
+}
+
+// checkUV checks that the texture coordinates are in the unit square
+// and that no triangle is flipped.
+func checkUV(t *testing.T, bm *geometry.BufferedMesh) *geometry.Distortion {
+	t.Helper()
+	uv := bm.GetAttribute(geometry.AttributeUV)
+	if uv == nil || len(uv.Values) != 2*bm.NumVertices() {
+		t.Fatalf("expect texture coordinates of each vertex, got %v", uv)
+	}
+	for _, x := range uv.Values {
+		if x < -1e-9 || x > 1+1e-9 {
+			t.Fatalf("texture coordinate %v is outside of the unit square", x)
+		}
+	}
+	d, err := bm.UVDistortion()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Flipped != 0 {
+		t.Fatalf("expect no flipped triangles, got %d", d.Flipped)
+	}
+	return d
+}
+
+func TestBufferedMesh_UVDistortion(t *testing.T) {
+	bm := grid(4, false)
+	d, err := bm.UVDistortion()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !math.ApproxEq(d.Conformal, 1, 1e-9) || !math.ApproxEq(d.MaxConformal, 1, 1e-9) ||
+		!math.ApproxEq(d.Area, 1, 1e-9) || !math.ApproxEq(d.Stretch, 1, 1e-9) || d.Flipped != 0 {
+		t.Fatalf("expect no distortion of an isometric map, got %+v", d)
+	}
+
+	// Stretching u by two keeps the areas after scaling, but not the
+	// angles.
+	uv := bm.GetAttribute(geometry.AttributeUV)
+	for i := 0; i < len(uv.Values); i += 2 {
+		uv.Values[i] *= 2
+	}
+	d, _ = bm.UVDistortion()
+	if !math.ApproxEq(d.Conformal, 2, 1e-9) || !math.ApproxEq(d.Area, 1, 1e-9) {
+		t.Fatalf("expect a conformal distortion of two, got %+v", d)
+	}
+
+	// Mirroring flips all triangles.
+	for i := 0; i < len(uv.Values); i += 2 {
+		uv.Values[i] *= -1
+	}
+	d, _ = bm.UVDistortion()
+	if d.Flipped != 32 {
+		t.Fatalf("expect all 32 triangles to be flipped, got %d", d.Flipped)
+	}
+
+	// Two triangles of equal surface area, whose texture areas differ
+	// by four. After scaling the texture area to the surface area, the
+	// squared singular values are 0.4 and 1.6, and the stretch of the
+	// inverse map is sqrt((1/0.4 + 1/1.6) / 2) = 1.25.
+	bm = geometry.NewBufferedMesh()
+	bm.SetAttribute(geometry.AttributePos, geometry.NewBufferAttribute(3, []float64{
+		0, 0, 0, 1, 0, 0, 0, 1, 0,
+		2, 0, 0, 3, 0, 0, 2, 1, 0,
+	}))
+	bm.SetAttribute(geometry.AttributeUV, geometry.NewBufferAttribute(2, []float64{
+		0, 0, 1, 0, 0, 1,
+		0, 0, 2, 0, 0, 2,
+	}))
+	bm.SetVertexIndex([]uint64{0, 1, 2, 3, 4, 5})
+	d, _ = bm.UVDistortion()
+	if !math.ApproxEq(d.Stretch, 1.25, 1e-9) || !math.ApproxEq(d.Conformal, 1, 1e-9) {
+		t.Fatalf("expect a stretch of 1.25, got %+v", d)
+	}
+
+	if _, err := geometry.NewBufferedMesh().UVDistortion(); err == nil {
+		t.Fatalf("expect an error without texture coordinates")
+	}
+}
+
+func TestBufferedMesh_Parameterize(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		method geometry.ParameterizationMethod
+	}{
+		{"lscm", geometry.ParameterizeLSCM},
+		{"harmonic", geometry.ParameterizeHarmonic},
+		{"tutte", geometry.ParameterizeTutte},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			bm := grid(8, false)
+			if err := bm.Parameterize(geometry.WithParameterization(tt.method)); err != nil {
+				t.Fatal(err)
+			}
+			d := checkUV(t, bm)
+			if tt.method != geometry.ParameterizeLSCM {
+				return
+			}
+
+			// A flat disk is mapped isometrically up to scaling.
+			if !math.ApproxEq(d.Conformal, 1, 1e-6) || !math.ApproxEq(d.Area, 1, 1e-6) {
+				t.Fatalf("expect no distortion of a flat mesh, got %+v", d)
+			}
+		})
+	}
+
+	// The harmonic map of a curved patch preserves angles better than
+	// the Tutte embedding.
+	patch := func(method geometry.ParameterizationMethod) *geometry.Distortion {
+		bm := grid(8, false)
+		pos := bm.GetAttribute(geometry.AttributePos)
+		for i := 0; i < len(pos.Values); i += 3 {
+			x, y := pos.Values[i]-0.5, pos.Values[i+1]-0.5
+			pos.Values[i+2] = x*x - y*y
+		}
+		if err := bm.Parameterize(geometry.WithParameterization(method)); err != nil {
+			t.Fatal(err)
+		}
+		return checkUV(t, bm)
+	}
+	tutte, harmonic := patch(geometry.ParameterizeTutte), patch(geometry.ParameterizeHarmonic)
+	lscm := patch(geometry.ParameterizeLSCM)
+	if harmonic.Conformal > tutte.Conformal || lscm.Conformal > harmonic.Conformal {
+		t.Fatalf("expect LSCM < harmonic < Tutte, got %v, %v, %v",
+			lscm.Conformal, harmonic.Conformal, tutte.Conformal)
+	}
+
+	for _, bm := range []*geometry.BufferedMesh{icosphere(1), cylinder(8, 4), torus(12, 6)} {
+		if err := bm.Parameterize(); !errors.Is(err, geometry.ErrNotDisk) {
+			t.Fatalf("expect ErrNotDisk, got %v", err)
+		}
+	}
+}
+
+func TestBufferedMesh_CutSeams(t *testing.T) {
+	for _, tt := range []struct {
+		name  string
+		mesh  *geometry.BufferedMesh
+		added bool
+	}{
+		{"disk", grid(4, false), false},
+		{"sphere", icosphere(2), true},
+		{"box", box(3), true},
+		{"cylinder", cylinder(12, 5), true},
+		{"torus", torus(16, 8), true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			bm := tt.mesh
+			n, faces := bm.NumVertices(), bm.NumTriangles()
+			if err := bm.CutSeams(); err != nil {
+				t.Fatal(err)
+			}
+			if got := bm.NumVertices() > n; got != tt.added {
+				t.Fatalf("expect vertices to be added: %v, got %d -> %d", tt.added, n, bm.NumVertices())
+			}
+			if bm.NumTriangles() != faces {
+				t.Fatalf("expect %d triangles, got %d", faces, bm.NumTriangles())
+			}
+			if err := bm.Parameterize(geometry.WithParameterization(geometry.ParameterizeTutte)); err != nil {
+				t.Fatal(err)
+			}
+			checkUV(t, bm)
+			if err := bm.Parameterize(); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+
+	// Duplicated vertices keep their positions.
+	bm := icosphere(1)
+	if err := bm.CutSeams(); err != nil {
+		t.Fatal(err)
+	}
+	pos := bm.GetAttribute(geometry.AttributePos)
+	for i := 0; i < bm.NumVertices(); i++ {
+		p := math.NewVec3(pos.Values[3*i], pos.Values[3*i+1], pos.Values[3*i+2])
+		if !math.ApproxEq(p.Len(), 1, 1e-9) {
+			t.Fatalf("vertex %d is not on the sphere: %v", i, p)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+// Copyright 2021 Changkun Ou <changkun.de>. All rights reserved.
+// Use of this source code is governed by a GPLv3 license that
+// can be found in the LICENSE file.
+
+package geometry
+
+import (
+	"image/color"
+
+	"poly.red/geometry/primitive"
+	"poly.red/math"
+	"poly.red/object"
+)
+
+var _ object.Object = &PointCloud{}
+
+// PointCloud is a set of points without connectivity, e.g. a LiDAR
+// scan. Each point has a position, and optionally a normal and a color.
+type PointCloud struct {
+	pos []math.Vec3
+	nor []math.Vec3
+	col []color.RGBA
+	// aabb is in model space and must be transformed when applying
+	// the context.
+	aabb *primitive.AABB
+
+	math.TransformContext
+}
+
+// NewPointCloud returns a point cloud of the given positions.
+func NewPointCloud(pos []math.Vec3) *PointCloud {
+	pc := &PointCloud{pos: pos}
+	pc.ResetContext()
+	return pc
+}
+
+func (pc *PointCloud) Type() object.Type {
+	return object.TypePointCloud
+}
+
+// NumPoints returns the number of points.
+func (pc *PointCloud) NumPoints() int {
+	return len(pc.pos)
+}
+
+// Positions returns the positions of all points in model space.
+func (pc *PointCloud) Positions() []math.Vec3 {
+	return pc.pos
+}
+
+// Normals returns the normals of all points, or nil if the point cloud
+// does not have normals.
+func (pc *PointCloud) Normals() []math.Vec3 {
+	return pc.nor
+}
+
+// Colors returns the colors of all points, or nil if the point cloud
+// does not have colors.
+func (pc *PointCloud) Colors() []color.RGBA {
+	return pc.col
+}
+
+// SetNormals sets the normals of the point cloud, the i-th normal
+// belongs to the i-th point. A nil slice removes the normals.
+func (pc *PointCloud) SetNormals(nor []math.Vec3) {
+	if nor != nil && len(nor) != len(pc.pos) {
+		panic("geometry: number of normals does not match number of points")
+	}
+	pc.nor = nor
+}
+
+// SetColors sets the colors of the point cloud, the i-th color belongs
+// to the i-th point. A nil slice removes the colors.
+func (pc *PointCloud) SetColors(col []color.RGBA) {
+	if col != nil && len(col) != len(pc.pos) {
+		panic("geometry: number of colors does not match number of points")
+	}
+	pc.col = col
+}
+
+// AABB returns the axis aligned bounding box of the transformed points.
+func (pc *PointCloud) AABB() primitive.AABB {
+	if pc.aabb == nil {
+		aabb := primitive.NewAABB(pc.pos...)
+		pc.aabb = &aabb
+	}
+
+	// The corners of the box are transformed, which bounds the points
+	// under rotation as well.
+	min, max := pc.aabb.Min, pc.aabb.Max
+	m := pc.ModelMatrix()
+	corners := make([]math.Vec3, 0, 8)
+	for _, x := range []float64{min.X, max.X} {
+		for _, y := range []float64{min.Y, max.Y} {
+			for _, z := range []float64{min.Z, max.Z} {
+				corners = append(corners, math.NewVec4(x, y, z, 1).Apply(m).ToVec3())
+			}
+		}
+	}
+	return primitive.NewAABB(corners...)
+}
+
+// Normalize rescales the point cloud to the unit sphere centered at the
+// origin, and applies the transformation to the points.
+func (pc *PointCloud) Normalize() {
+	if len(pc.pos) == 0 {
+		return
+	}
+
+	m := pc.ModelMatrix()
+	for i := range pc.pos {
+		pc.pos[i] = pc.pos[i].ToVec4(1).Apply(m).ToVec3()
+	}
+	if pc.nor != nil {
+		n := m.Inv().T()
+		for i := range pc.nor {
+			pc.nor[i] = pc.nor[i].ToVec4(0).Apply(n).ToVec3().Unit()
+		}
+	}
+	pc.ResetContext()
+
+	aabb := primitive.NewAABB(pc.pos...)
+	center := aabb.Min.Add(aabb.Max).Scale(0.5, 0.5, 0.5)
+	radius := aabb.Max.Sub(aabb.Min).Len() / 2
+	fac := 1.0
+	if radius > 0 {
+		fac = 1 / radius
+	}
+	for i := range pc.pos {
+		pc.pos[i] = pc.pos[i].Translate(-center.X, -center.Y, -center.Z).Scale(fac, fac, fac)
+	}
+	min := aabb.Min.Translate(-center.X, -center.Y, -center.Z).Scale(fac, fac, fac)
+	max := aabb.Max.Translate(-center.X, -center.Y, -center.Z).Scale(fac, fac, fac)
+	pc.aabb = &primitive.AABB{Min: min, Max: max}
+}
@@ -0,0 +1,56 @@
+// Copyright 2021 Changkun Ou <changkun.de>. All rights reserved.
+// Use of this source code is governed by a GPLv3 license that
+// can be found in the LICENSE file.
+
+package geometry_test
+
+import (
+	"image/color"
+	"testing"
+
+	"poly.red/geometry"
+	"poly.red/math"
+	"poly.red/object"
+)
+
+func TestPointCloud(t *testing.T) {
+	pc := geometry.NewPointCloud([]math.Vec3{
+		math.NewVec3(0, 0, 0),
+		math.NewVec3(2, 0, 0),
+		math.NewVec3(0, 4, 2),
+	})
+	if pc.Type() != object.TypePointCloud {
+		t.Fatalf("unexpected type: %v", pc.Type())
+	}
+	pc.SetNormals([]math.Vec3{
+		math.NewVec3(0, 0, 1),
+		math.NewVec3(0, 0, 1),
+		math.NewVec3(1, 0, 0),
+	})
+	pc.SetColors([]color.RGBA{{255, 0, 0, 255}, {0, 255, 0, 255}, {0, 0, 255, 255}})
+
+	pc.Translate(1, 1, 1)
+	aabb := pc.AABB()
+	if !aabb.Min.Eq(math.NewVec3(1, 1, 1)) || !aabb.Max.Eq(math.NewVec3(3, 5, 3)) {
+		t.Fatalf("unexpected aabb: %v, %v", aabb.Min, aabb.Max)
+	}
+
+	pc.Normalize()
+	aabb = pc.AABB()
+	if !aabb.Min.Add(aabb.Max).Eq(math.NewVec3(0, 0, 0)) {
+		t.Fatalf("normalized point cloud is not centered: %v, %v", aabb.Min, aabb.Max)
+	}
+	if r := aabb.Max.Sub(aabb.Min).Len() / 2; !math.ApproxEq(r, 1, 1e-7) {
+		t.Fatalf("expect unit radius, got %v", r)
+	}
+	if !pc.Normals()[2].Eq(math.NewVec3(1, 0, 0)) {
+		t.Fatalf("unexpected normal: %v", pc.Normals()[2])
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatalf("expect a panic for mismatched colors")
+		}
+	}()
+	pc.SetColors(make([]color.RGBA, 2))
+}
@@ -41,3 +41,46 @@ func (he *Halfedge) Cotan() float64 {
 	v := he.next.Vec().Scale(-1, -1, -1, 1)
 	return u.Dot(v) / u.Cross(v).Len()
 }
+
+// NewHalfedge returns a halfedge that starts at the given vertex and
+// belongs to the given face. A halfedge without a face is on the
+// boundary of a mesh. The halfedge is linked to its neighbors using
+// SetNext and SetTwin.
+func NewHalfedge(v *Vertex, f Face, idx int64) *Halfedge {
+	return &Halfedge{v: v, f: f, idx: idx, onBoundary: f == nil}
+}
+
+// Vertex returns the vertex where the halfedge starts.
+func (he *Halfedge) Vertex() *Vertex { return he.v }
+
+// Face returns the face of the halfedge, or nil if the halfedge is on
+// the boundary.
+func (he *Halfedge) Face() Face { return he.f }
+
+// Prev returns the previous halfedge of the same face or boundary loop.
+func (he *Halfedge) Prev() *Halfedge { return he.prev }
+
+// Next returns the next halfedge of the same face or boundary loop.
+func (he *Halfedge) Next() *Halfedge { return he.next }
+
+// Twin returns the opposite halfedge of the same edge.
+func (he *Halfedge) Twin() *Halfedge { return he.twin }
+
+// Index returns the index of the halfedge.
+func (he *Halfedge) Index() int64 { return he.idx }
+
+// OnBoundary reports whether the halfedge has no face.
+func (he *Halfedge) OnBoundary() bool { return he.onBoundary }
+
+// SetNext links the given halfedge as the next halfedge of he, and he
+// as the previous halfedge of next.
+func (he *Halfedge) SetNext(next *Halfedge) {
+	he.next = next
+	next.prev = he
+}
+
+// SetTwin links he and the given halfedge as twins.
+func (he *Halfedge) SetTwin(twin *Halfedge) {
+	he.twin = twin
+	twin.twin = he
+}
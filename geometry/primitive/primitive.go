@@ -16,6 +16,7 @@ type Vertex struct {
 	Pos        math.Vec4
 	UV         math.Vec4
 	Nor        math.Vec4
+	Tan        math.Vec4 // tangent, where W is the handedness of the bitangent
 	Col        color.RGBA
 	AttrSmooth map[string]interface{}
 	AttrFlat   map[string]interface{}
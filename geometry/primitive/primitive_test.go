@@ -8,6 +8,7 @@ import (
 	"testing"
 
 	"poly.red/geometry/primitive"
+	"poly.red/math"
 )
 
 func TestVertex_AABB(t *testing.T) {
@@ -100,3 +101,27 @@ func BenchmarkTriangle_FaceNormal(b *testing.B) {
 		}
 	})
 }
+
+func TestQuad(t *testing.T) {
+	v1 := &primitive.Vertex{Pos: math.NewVec4(0, 0, 0, 1)}
+	v2 := &primitive.Vertex{Pos: math.NewVec4(1, 0, 0, 1)}
+	v3 := &primitive.Vertex{Pos: math.NewVec4(1, 1, 0, 1)}
+	v4 := &primitive.Vertex{Pos: math.NewVec4(0, 1, 0, 1)}
+
+	q := primitive.NewQuad(v1, v2, v3, v4)
+	if !q.Normal().Eq(math.NewVec4(0, 0, 1, 0)) {
+		t.Errorf("unexpected quad normal: %v", q.Normal())
+	}
+
+	n := 0
+	q.Triangles(func(tri *primitive.Triangle) bool {
+		if !tri.Normal().Eq(q.Normal()) {
+			t.Errorf("unexpected triangle normal: %v", tri.Normal())
+		}
+		n++
+		return false
+	})
+	if n != 1 {
+		t.Errorf("expect the iteration to stop after 1 triangle, got %d", n)
+	}
+}
@@ -0,0 +1,289 @@
+// Copyright 2021 Changkun Ou <changkun.de>. All rights reserved.
+// Use of this source code is governed by a GPLv3 license that
+// can be found in the LICENSE file.
+
+package geometry
+
+import (
+	"sort"
+	"sync"
+
+	"poly.red/geometry/primitive"
+	"poly.red/material"
+	"poly.red/math"
+)
+
+var _ Mesh = &ProgressiveMesh{}
+
+// Collapse is a step of a progressive mesh, which collapses a vertex
+// position into a neighboring one. Since a position may be shared by
+// several buffer vertices, e.g. along texture seams, Vertices holds the
+// pairs of each removed buffer vertex and the buffer vertex that
+// replaces it.
+type Collapse struct {
+	Vertices [][2]int
+	Cost     float64
+}
+
+// ProgressiveMesh is a buffered mesh with continuous level of detail.
+// It holds an ordered sequence of vertex collapses, and the level of
+// detail is the number of collapses that are applied, thus level zero
+// is the full detail and the last level is the coarsest. The faces of
+// the progressive mesh are the faces of the current level.
+type ProgressiveMesh struct {
+	BufferedMesh
+
+	full      []uint64 // vertex index of the full detail
+	collapses []Collapse
+	step      []int    // collapse that removes each buffer vertex
+	target    []int    // buffer vertex that replaces each buffer vertex
+	triangles []uint64 // number of triangles of each level
+	level     int
+
+	mu    sync.Mutex
+	cache struct {
+		level   int
+		vertIdx []uint64
+	}
+}
+
+// NewProgressiveMesh returns a progressive mesh of a copy of the given
+// buffered mesh.
+//
+// The collapse sequence follows the simplification of Melax: the cost
+// of collapsing a vertex into a neighbor is the length of their edge
+// times the curvature around the vertex, where the curvature is the
+// largest difference between the normals of the faces of the vertex
+// and the faces of the edge. Hence flat regions collapse before edges
+// and corners. Like Simplify, vertices keep their positions and
+// attributes, seams and boundaries are preserved, and collapses that
+// flip faces or change the topology are not part of the sequence.
+func NewProgressiveMesh(bm *BufferedMesh) *ProgressiveMesh {
+	pm := &ProgressiveMesh{BufferedMesh: *bm.clone()}
+	pm.build()
+	return pm
+}
+
+// build builds the collapse sequence of the vertex index, which becomes
+// the full detail, and keeps the current level if it is available.
+func (pm *ProgressiveMesh) build() {
+	n := pm.BufferedMesh.NumVertices()
+	pm.full = append([]uint64(nil), pm.vertIdx...)
+	pm.collapses = nil
+	pm.step = make([]int, n)
+	pm.target = make([]int, n)
+	for i := range pm.step {
+		pm.step[i] = -1
+	}
+
+	s := newSimplifier(&pm.BufferedMesh)
+	s.cost = s.melaxCost
+	s.refresh = true
+	pm.triangles = []uint64{uint64(s.count)}
+	s.record = func(c collapse, remap map[int]int, faces int) {
+		vs := make([][2]int, 0, len(remap))
+		for a, b := range remap {
+			pm.step[a] = len(pm.collapses)
+			pm.target[a] = b
+			vs = append(vs, [2]int{a, b})
+		}
+		sort.Slice(vs, func(i, j int) bool { return vs[i][0] < vs[j][0] })
+		pm.collapses = append(pm.collapses, Collapse{Vertices: vs, Cost: c.cost})
+		pm.triangles = append(pm.triangles, pm.triangles[len(pm.triangles)-1]-uint64(faces))
+	}
+	s.run(0, math.Inf(1))
+
+	pm.cache.level = -1
+	pm.SetLevel(pm.level)
+}
+
+// Collapses returns the ordered collapse sequence of the progressive
+// mesh, where the i-th collapse leads from level i to level i+1.
+func (pm *ProgressiveMesh) Collapses() []Collapse {
+	return pm.collapses
+}
+
+// NumLevels returns the number of levels of detail, which is the number
+// of collapses plus one.
+func (pm *ProgressiveMesh) NumLevels() int {
+	return len(pm.collapses) + 1
+}
+
+// Level returns the current level of detail.
+func (pm *ProgressiveMesh) Level() int {
+	return pm.level
+}
+
+// SetLevel sets the current level of detail, which is clamped to the
+// available levels.
+func (pm *ProgressiveMesh) SetLevel(level int) {
+	level = pm.clampLevel(level)
+	pm.level = level
+	pm.vertIdx = pm.levelIndex(level)
+}
+
+// LevelTriangles returns the number of triangles of the given level.
+func (pm *ProgressiveMesh) LevelTriangles(level int) uint64 {
+	return pm.triangles[pm.clampLevel(level)]
+}
+
+// LevelForTriangles returns the finest level of detail that has at most
+// the given number of triangles, or the coarsest level if there is no
+// such level.
+func (pm *ProgressiveMesh) LevelForTriangles(n uint64) int {
+	return sort.Search(len(pm.triangles)-1, func(i int) bool {
+		return pm.triangles[i] <= n
+	})
+}
+
+// LevelFaces iterates over the faces of the given level of detail
+// without changing the current level.
+func (pm *ProgressiveMesh) LevelFaces(level int, iter func(primitive.Face, material.Material) bool) {
+	pm.faces(pm.levelIndex(pm.clampLevel(level)), iter)
+}
+
+// Normalize normalizes the vertices of all levels of detail.
+func (pm *ProgressiveMesh) Normalize() {
+	pm.update(func(bm *BufferedMesh) error {
+		bm.Normalize()
+		return nil
+	})
+}
+
+// SetVertexIndex sets the vertex index of the full detail, which
+// rebuilds the collapse sequence.
+func (pm *ProgressiveMesh) SetVertexIndex(vertIdx []uint64) {
+	pm.BufferedMesh.SetVertexIndex(vertIdx)
+	pm.build()
+}
+
+// ComputeNormals computes the normals of the full detail, see
+// BufferedMesh.ComputeNormals.
+func (pm *ProgressiveMesh) ComputeNormals(opts ...ComputeNormalOption) {
+	pm.update(func(bm *BufferedMesh) error {
+		bm.ComputeNormals(opts...)
+		return nil
+	})
+}
+
+// ComputeTangents computes the tangents of the full detail, see
+// BufferedMesh.ComputeTangents.
+func (pm *ProgressiveMesh) ComputeTangents() error {
+	return pm.update((*BufferedMesh).ComputeTangents)
+}
+
+// ComputeCurvature estimates the curvatures of the full detail, see
+// BufferedMesh.ComputeCurvature.
+func (pm *ProgressiveMesh) ComputeCurvature() error {
+	return pm.update((*BufferedMesh).ComputeCurvature)
+}
+
+// CutSeams cuts the full detail into a topological disk, see
+// BufferedMesh.CutSeams.
+func (pm *ProgressiveMesh) CutSeams() error {
+	return pm.update((*BufferedMesh).CutSeams)
+}
+
+// Parameterize computes the texture coordinates of the full detail,
+// see BufferedMesh.Parameterize.
+func (pm *ProgressiveMesh) Parameterize(opts ...ParameterizeOption) error {
+	return pm.update(func(bm *BufferedMesh) error {
+		return bm.Parameterize(opts...)
+	})
+}
+
+// update applies the given change to the full detail. Changes that
+// rewrite the vertex index, e.g. by splitting vertices, rebuild the
+// collapse sequence, otherwise the current level is restored.
+func (pm *ProgressiveMesh) update(change func(bm *BufferedMesh) error) error {
+	pm.vertIdx = pm.full
+	err := change(&pm.BufferedMesh)
+	if !equalIndex(pm.vertIdx, pm.full) {
+		pm.build()
+		return err
+	}
+	pm.vertIdx = pm.levelIndex(pm.level)
+	return err
+}
+
+func equalIndex(a, b []uint64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func (pm *ProgressiveMesh) clampLevel(level int) int {
+	if level < 0 {
+		return 0
+	}
+	if level > len(pm.collapses) {
+		return len(pm.collapses)
+	}
+	return level
+}
+
+// levelIndex returns the vertex index of the given level, where the
+// vertices of each face are replaced until they are not removed by the
+// first level collapses, and faces of replaced vertices degenerate.
+// The index of the last requested level is cached.
+func (pm *ProgressiveMesh) levelIndex(level int) []uint64 {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	if pm.cache.level == level {
+		return pm.cache.vertIdx
+	}
+
+	idx := make([]uint64, 0, 3*pm.triangles[level])
+	for i := 0; i < len(pm.full); i += 3 {
+		var vs [3]uint64
+		for k := 0; k < 3; k++ {
+			v := int(pm.full[i+k])
+			for pm.step[v] >= 0 && pm.step[v] < level {
+				v = pm.target[v]
+			}
+			vs[k] = uint64(v)
+		}
+		if vs[0] == vs[1] || vs[1] == vs[2] || vs[2] == vs[0] {
+			continue
+		}
+		idx = append(idx, vs[0], vs[1], vs[2])
+	}
+	pm.cache.level = level
+	pm.cache.vertIdx = idx
+	return idx
+}
+
+// melaxCost returns the cost of collapsing u into v, which is the
+// length of the edge times the curvature of u along the edge.
+func (s *simplifier) melaxCost(u, v int) float64 {
+	var sides []math.Vec3
+	for _, f := range s.edgeFaces(u, v) {
+		if n := s.faceNormal(f, -1, math.Vec3{}); !n.IsZero() {
+			sides = append(sides, n.Unit())
+		}
+	}
+
+	curvature := 0.0
+	for _, f := range s.faces[u] {
+		if !s.alive[f] {
+			continue
+		}
+		n := s.faceNormal(f, -1, math.Vec3{})
+		if n.IsZero() {
+			continue
+		}
+		n = n.Unit()
+		c := 1.0
+		for _, m := range sides {
+			c = math.Min(c, (1-n.Dot(m))/2)
+		}
+		curvature = math.Max(curvature, c)
+	}
+	return s.pos[u].Sub(s.pos[v]).Len() * curvature
+}
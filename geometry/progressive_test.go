@@ -0,0 +1,132 @@
+// Copyright 2021 Changkun Ou <changkun.de>. All rights reserved.
+// Use of this source code is governed by a GPLv3 license that
+// can be found in the LICENSE file.
+
+package geometry_test
+
+import (
+	"testing"
+
+	"poly.red/geometry"
+	"poly.red/geometry/primitive"
+	"poly.red/material"
+	"poly.red/math"
+)
+
+func TestProgressiveMesh(t *testing.T) {
+	bm := box(6)
+	pm := geometry.NewProgressiveMesh(bm)
+	if pm.NumTriangles() != bm.NumTriangles() || pm.Level() != 0 {
+		t.Fatalf("expect the full detail by default, got %d triangles", pm.NumTriangles())
+	}
+	if pm.NumLevels() != len(pm.Collapses())+1 || pm.NumLevels() < 2 {
+		t.Fatalf("unexpected number of levels: %d", pm.NumLevels())
+	}
+
+	// The flat sides collapse before the edges of the box.
+	var costs []float64
+	for _, c := range pm.Collapses() {
+		costs = append(costs, c.Cost)
+		if len(c.Vertices) == 0 {
+			t.Fatalf("collapse without vertices")
+		}
+	}
+	if costs[0] != 0 || costs[len(costs)-1] == 0 {
+		t.Fatalf("unexpected collapse costs: %v", costs)
+	}
+
+	for level := 0; level < pm.NumLevels(); level++ {
+		n := uint64(0)
+		pm.LevelFaces(level, func(primitive.Face, material.Material) bool {
+			n++
+			return true
+		})
+		if n != pm.LevelTriangles(level) {
+			t.Fatalf("level %d: expect %d triangles, got %d", level, pm.LevelTriangles(level), n)
+		}
+		if level > 0 && n > pm.LevelTriangles(level-1) {
+			t.Fatalf("level %d: more triangles than the finer level", level)
+		}
+	}
+
+	last := pm.NumLevels() - 1
+	pm.SetLevel(last + 10)
+	if pm.Level() != last || pm.NumTriangles() != pm.LevelTriangles(last) {
+		t.Fatalf("expect the coarsest level, got %d", pm.Level())
+	}
+	tm := geometry.NewTriangleMesh(&pm.BufferedMesh)
+	tm.Edges(func(i int, e [2]int) bool {
+		if tm.IsBoundaryEdge(i) {
+			t.Fatalf("coarsest level is not closed at edge %v", e)
+		}
+		return true
+	})
+	if aabb := pm.AABB(); !aabb.Min.Eq(math.NewVec3(-1, -1, -1)) || !aabb.Max.Eq(math.NewVec3(1, 1, 1)) {
+		t.Fatalf("box is not preserved: %v", aabb)
+	}
+
+	level := pm.LevelForTriangles(100)
+	if pm.LevelTriangles(level) > 100 || level > 0 && pm.LevelTriangles(level-1) <= 100 {
+		t.Fatalf("level %d is not the finest level of at most 100 triangles", level)
+	}
+	if pm.LevelForTriangles(0) != last {
+		t.Fatalf("expect the coarsest level for no triangles")
+	}
+}
+
+func TestProgressiveMesh_Seam(t *testing.T) {
+	pm := geometry.NewProgressiveMesh(grid(8, true))
+	for _, level := range []int{pm.NumLevels() / 2, pm.NumLevels() - 1} {
+		pm.LevelFaces(level, func(f primitive.Face, _ material.Material) bool {
+			var offsets []float64
+			f.Vertices(func(v *primitive.Vertex) bool {
+				offsets = append(offsets, math.Round(v.UV.X-v.Pos.X))
+				return true
+			})
+			if offsets[0] != offsets[1] || offsets[0] != offsets[2] {
+				t.Fatalf("level %d: face crosses the seam: %v", level, offsets)
+			}
+			if !f.Normal().Eq(math.NewVec4(0, 0, 1, 0)) {
+				t.Fatalf("level %d: face is flipped: %v", level, f.Normal())
+			}
+			return true
+		})
+	}
+}
+
+func TestProgressiveMesh_Mutators(t *testing.T) {
+	bm := box(4)
+	pm := geometry.NewProgressiveMesh(bm)
+	pm.SetLevel(pm.NumLevels() / 2)
+	level := pm.Level()
+
+	// The crease angle splits the vertices at the edges of the box, and
+	// the levels are rebuilt from the split vertices.
+	pm.ComputeNormals(geometry.WithCreaseAngle(60))
+	if bm.GetAttribute(geometry.AttributeNor) != nil {
+		t.Fatalf("expect the source mesh to remain unchanged")
+	}
+	if pm.NumVertices() <= bm.NumVertices() || pm.LevelTriangles(0) != bm.NumTriangles() {
+		t.Fatalf("expect split vertices of the full detail, got %d vertices and %d triangles",
+			pm.NumVertices(), pm.LevelTriangles(0))
+	}
+	if pm.Level() != level {
+		t.Fatalf("expect the level %d to be kept, got %d", level, pm.Level())
+	}
+	for _, l := range []int{0, pm.NumLevels() - 1} {
+		pm.SetLevel(l)
+		pm.Faces(func(f primitive.Face, _ material.Material) bool {
+			tri := f.(*primitive.Triangle)
+			if !tri.V1.Nor.ToVec3().Eq(tri.Normal().ToVec3()) {
+				t.Fatalf("level %d: expect flat normals, got %v for %v", l, tri.V1.Nor, tri.Normal())
+			}
+			return true
+		})
+	}
+
+	// The vertex index of the full detail is replaced.
+	pm.SetVertexIndex(bm.GetVertexIndex()[:6])
+	if pm.LevelTriangles(0) != 2 {
+		t.Fatalf("expect 2 triangles of the full detail, got %d", pm.LevelTriangles(0))
+	}
+}
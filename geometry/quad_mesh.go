@@ -4,6 +4,144 @@
 
 package geometry
 
+import (
+	"poly.red/geometry/primitive"
+	"poly.red/material"
+	"poly.red/math"
+	"poly.red/object"
+)
+
+var (
+	_ Mesh = &QuadMesh{}
+)
+
+// QuadMesh implements a quad dominant mesh, which consists of quads and
+// triangles. Quads are kept as a whole and only split into triangles
+// when they are drawn.
 type QuadMesh struct {
-	// TODO:
+	// all faces of the quad mesh, either quads or triangles.
+	faces []primitive.Face
+	// the number of quads of the quad mesh.
+	numQuads int
+	// the corresponding material of the quad mesh.
+	material material.Material
+	// optional per-face materials, a nil entry falls back to material.
+	faceMaterials []material.Material
+	// aabb must be transformed when applying the context.
+	aabb *primitive.AABB
+
+	math.TransformContext
+}
+
+// NewQuadMesh returns a quad mesh of the given faces, where each face
+// is either a *primitive.Quad or a *primitive.Triangle.
+func NewQuadMesh(fs []primitive.Face) *QuadMesh {
+	ret := &QuadMesh{faces: fs}
+	for _, f := range fs {
+		switch f.(type) {
+		case *primitive.Quad:
+			ret.numQuads++
+		case *primitive.Triangle:
+		default:
+			panic("geometry: faces of a quad mesh must be quads or triangles")
+		}
+	}
+	ret.ResetContext()
+	return ret
+}
+
+func (m *QuadMesh) Type() object.Type {
+	return object.TypeMesh
+}
+
+// NumFaces returns the number of faces of the quad mesh.
+func (m *QuadMesh) NumFaces() int {
+	return len(m.faces)
+}
+
+// NumQuads returns the number of quads of the quad mesh.
+func (m *QuadMesh) NumQuads() int {
+	return m.numQuads
+}
+
+// NumTriangles returns the number of triangles that are drawn, where
+// each quad contributes two triangles.
+func (m *QuadMesh) NumTriangles() uint64 {
+	return uint64(len(m.faces) + m.numQuads)
+}
+
+func (m *QuadMesh) Faces(iter func(primitive.Face, material.Material) bool) {
+	for i := range m.faces {
+		mat := m.material
+		if m.faceMaterials != nil && m.faceMaterials[i] != nil {
+			mat = m.faceMaterials[i]
+		}
+		if !iter(m.faces[i], mat) {
+			return
+		}
+	}
+}
+
+func (m *QuadMesh) GetMaterial() material.Material {
+	return m.material
+}
+
+// SetMaterial sets the material of the quad mesh. The given material
+// applies to all faces and discards any per-face materials.
+func (m *QuadMesh) SetMaterial(mat material.Material) {
+	m.material = mat
+	m.faceMaterials = nil
+}
+
+// SetFaceMaterials assigns materials to the faces of the quad mesh, the
+// i-th material is used by the i-th face. A nil entry falls back to the
+// material of the quad mesh.
+func (m *QuadMesh) SetFaceMaterials(mats []material.Material) {
+	if len(mats) != len(m.faces) {
+		panic("geometry: number of materials does not match number of faces")
+	}
+	m.faceMaterials = mats
+}
+
+func (m *QuadMesh) AABB() primitive.AABB {
+	if m.aabb == nil {
+		aabb := m.faces[0].AABB()
+		for i := 1; i < len(m.faces); i++ {
+			aabb.Add(m.faces[i].AABB())
+		}
+		m.aabb = &aabb
+	}
+
+	min := m.aabb.Min.ToVec4(1).Apply(m.ModelMatrix()).ToVec3()
+	max := m.aabb.Max.ToVec4(1).Apply(m.ModelMatrix()).ToVec3()
+	return primitive.AABB{Min: min, Max: max}
+}
+
+// Normalize rescales the mesh to the unit sphere centered at the origin.
+func (m *QuadMesh) Normalize() {
+	aabb := m.AABB()
+	center := aabb.Min.Add(aabb.Max).Scale(0.5, 0.5, 0.5)
+	radius := aabb.Max.Sub(aabb.Min).Len() / 2
+	fac := 1 / radius
+
+	// Faces are recreated from the scaled vertices, because faces cache
+	// their normals and bounding boxes.
+	scale := func(v primitive.Vertex) *primitive.Vertex {
+		v.Pos = v.Pos.Apply(m.ModelMatrix()).Translate(-center.X, -center.Y, -center.Z).Scale(fac, fac, fac, 1)
+		return &v
+	}
+	for i, f := range m.faces {
+		switch f := f.(type) {
+		case *primitive.Quad:
+			m.faces[i] = primitive.NewQuad(scale(f.V1), scale(f.V2), scale(f.V3), scale(f.V4))
+		case *primitive.Triangle:
+			m.faces[i] = primitive.NewTriangle(scale(f.V1), scale(f.V2), scale(f.V3))
+		}
+	}
+
+	// update AABB after scaling
+	min := aabb.Min.Translate(-center.X, -center.Y, -center.Z).Scale(fac, fac, fac)
+	max := aabb.Max.Translate(-center.X, -center.Y, -center.Z).Scale(fac, fac, fac)
+	m.aabb = &primitive.AABB{Min: min, Max: max}
+	m.ResetContext()
 }
@@ -0,0 +1,72 @@
+// Copyright 2021 Changkun Ou <changkun.de>. All rights reserved.
+// Use of this source code is governed by a GPLv3 license that
+// can be found in the LICENSE file.
+
+package geometry_test
+
+import (
+	"testing"
+
+	"poly.red/geometry"
+	"poly.red/geometry/primitive"
+	"poly.red/material"
+	"poly.red/math"
+)
+
+func TestQuadMesh(t *testing.T) {
+	vs := vertices(
+		math.NewVec3(0, 0, 0),
+		math.NewVec3(2, 0, 0),
+		math.NewVec3(2, 2, 0),
+		math.NewVec3(0, 2, 0),
+		math.NewVec3(4, 0, 0),
+	)
+	m := geometry.NewQuadMesh([]primitive.Face{
+		primitive.NewQuad(vs[0], vs[1], vs[2], vs[3]),
+		primitive.NewTriangle(vs[1], vs[4], vs[2]),
+	})
+	if m.NumFaces() != 2 || m.NumQuads() != 1 || m.NumTriangles() != 3 {
+		t.Fatalf("unexpected faces: %d faces, %d quads, %d triangles",
+			m.NumFaces(), m.NumQuads(), m.NumTriangles())
+	}
+
+	// Faces keep quads, and quads are split into triangles on demand.
+	tris := 0
+	m.Faces(func(f primitive.Face, _ material.Material) bool {
+		if !f.Normal().Eq(math.NewVec4(0, 0, 1, 0)) {
+			t.Fatalf("unexpected face normal: %v", f.Normal())
+		}
+		f.Triangles(func(tri *primitive.Triangle) bool {
+			tris++
+			return true
+		})
+		return true
+	})
+	if uint64(tris) != m.NumTriangles() {
+		t.Fatalf("expect %d triangles, got %d", m.NumTriangles(), tris)
+	}
+
+	m.Translate(1, 0, 0)
+	aabb := m.AABB()
+	if !aabb.Min.Eq(math.NewVec3(1, 0, 0)) || !aabb.Max.Eq(math.NewVec3(5, 2, 0)) {
+		t.Fatalf("unexpected aabb: %v", aabb)
+	}
+	m.Normalize()
+	aabb = m.AABB()
+	if !aabb.Min.Add(aabb.Max).Eq(math.NewVec3(0, 0, 0)) {
+		t.Fatalf("normalized mesh is not centered: %v", aabb)
+	}
+	m.Faces(func(f primitive.Face, _ material.Material) bool {
+		if a := f.AABB(); a.Min.X < aabb.Min.X-1e-9 || a.Max.X > aabb.Max.X+1e-9 {
+			t.Fatalf("face is not normalized: %v", a)
+		}
+		return true
+	})
+
+	defer func() {
+		if recover() == nil {
+			t.Fatalf("expect a panic for unsupported faces")
+		}
+	}()
+	geometry.NewQuadMesh([]primitive.Face{&geometry.HalfedgeFace{}})
+}
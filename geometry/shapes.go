@@ -53,16 +53,15 @@ func NewPlane(width, height float64) Mesh {
 // NewRandomTriangleSoup returns a mesh with given number of
 // random triangles.
 func NewRandomTriangleSoup(numTri int) Mesh {
-	idx := make([]uint64, numTri*3)
-	pos := make([]float64, numTri*3)
-	nor := make([]float64, numTri*3)
-	uv := make([]float64, numTri*2)
-	col := make([]float64, numTri*3)
+	numVert := numTri * 3
+	idx := make([]uint64, numVert)
+	pos := make([]float64, numVert*3)
+	nor := make([]float64, numVert*3)
+	uv := make([]float64, numVert*2)
+	col := make([]float64, numVert*3)
 
-	for i := uint64(0); i < uint64(numTri); i++ {
-		idx[3*i] = i
-		idx[3*i+1] = i + 1
-		idx[3*i+2] = i + 2
+	for i := uint64(0); i < uint64(numVert); i++ {
+		idx[i] = i
 
 		pos[3*i] = rand.Float64()*2 - 1
 		pos[3*i+1] = rand.Float64()*2 - 1
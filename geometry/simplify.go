@@ -0,0 +1,525 @@
+// Copyright 2021 Changkun Ou <changkun.de>. All rights reserved.
+// Use of this source code is governed by a GPLv3 license that
+// can be found in the LICENSE file.
+
+package geometry
+
+import (
+	"container/heap"
+
+	"poly.red/math"
+)
+
+// SimplificationOption offers custom configurations for simplifying a
+// mesh.
+type SimplificationOption struct {
+	targetTriangles int
+	maxError        float64
+	hasTarget       bool
+	hasMaxError     bool
+}
+
+type SimplifyOption func(o *SimplificationOption)
+
+// WithTargetTriangles sets the number of triangles where the
+// simplification stops. The default is half of the triangles, or no
+// target if only a maximum error is given by WithMaxError.
+func WithTargetTriangles(n int) SimplifyOption {
+	return func(o *SimplificationOption) {
+		o.targetTriangles = n
+		o.hasTarget = true
+	}
+}
+
+// WithMaxError sets the largest error of an edge collapse, which is
+// the root mean square distance of the collapsed vertex to the planes
+// of its original faces, in model space units. The simplification stops
+// before the error is exceeded, even if the target number of triangles
+// is not reached. The error is unbounded by default.
+func WithMaxError(e float64) SimplifyOption {
+	return func(o *SimplificationOption) {
+		o.maxError = e
+		o.hasMaxError = true
+	}
+}
+
+// Weights of the quadrics that keep boundaries and seams in place,
+// relative to the quadrics of faces.
+const (
+	simplifyBoundaryWeight = 10
+	simplifySeamWeight     = 1
+)
+
+// Simplify returns a simplified copy of the buffered mesh using the
+// quadric error metric of Garland and Heckbert. Edges are collapsed in
+// the order of the least error until the target number of triangles is
+// reached or the maximum error is exceeded.
+//
+// Edges are collapsed into one of their vertices, hence the surviving
+// vertices keep their positions and attributes, e.g. normals and
+// texture coordinates. Copies of a vertex at one position form a seam,
+// e.g. a texture seam, and may only move along the seam. Likewise,
+// boundary vertices may only move along the boundary. Collapses that
+// flip faces or change the topology of the mesh are rejected.
+func (bm *BufferedMesh) Simplify(opts ...SimplifyOption) *BufferedMesh {
+	o := &SimplificationOption{
+		maxError: math.Inf(1),
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if !o.hasTarget && !o.hasMaxError {
+		o.targetTriangles = len(bm.vertIdx) / 6
+	}
+
+	s := newSimplifier(bm)
+	s.run(o.targetTriangles, o.maxError*o.maxError)
+	return s.result()
+}
+
+// quadric is the sum of weighted squared distances to planes, stored
+// as the upper triangle of a symmetric 4x4 matrix.
+type quadric struct {
+	a [10]float64
+	w float64 // sum of face weights
+}
+
+// planeQuadric returns the quadric of the plane n·p + d = 0 of the
+// given weight.
+func planeQuadric(n math.Vec3, d, w float64) quadric {
+	return quadric{a: [10]float64{
+		w * n.X * n.X, w * n.X * n.Y, w * n.X * n.Z, w * n.X * d,
+		w * n.Y * n.Y, w * n.Y * n.Z, w * n.Y * d,
+		w * n.Z * n.Z, w * n.Z * d,
+		w * d * d,
+	}}
+}
+
+func (q *quadric) add(r *quadric) {
+	for i := range q.a {
+		q.a[i] += r.a[i]
+	}
+	q.w += r.w
+}
+
+// eval returns the weighted squared distance of p to the planes.
+func (q *quadric) eval(p math.Vec3) float64 {
+	a := &q.a
+	x, y, z := p.X, p.Y, p.Z
+	return x*x*a[0] + 2*x*y*a[1] + 2*x*z*a[2] + 2*x*a[3] +
+		y*y*a[4] + 2*y*z*a[5] + 2*y*a[6] +
+		z*z*a[7] + 2*z*a[8] + a[9]
+}
+
+// collapse is a candidate collapse of the vertex u into the vertex v.
+type collapse struct {
+	cost       float64
+	u, v       int
+	ver1, ver2 int // versions of u and v when the candidate was created
+}
+
+type collapseQueue []collapse
+
+func (q collapseQueue) Len() int            { return len(q) }
+func (q collapseQueue) Less(i, j int) bool  { return q[i].cost < q[j].cost }
+func (q collapseQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *collapseQueue) Push(x interface{}) { *q = append(*q, x.(collapse)) }
+func (q *collapseQueue) Pop() interface{} {
+	old := *q
+	c := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return c
+}
+
+// simplifier collapses edges of a mesh. Vertices of the buffer are
+// welded by position, collapses operate on the welded vertices, and
+// the faces keep referencing the vertices of the buffer.
+type simplifier struct {
+	bm      *BufferedMesh
+	idx     []int       // buffer vertex of each corner
+	alive   []bool      // faces that are not collapsed
+	weld    []int       // welded vertex of each buffer vertex
+	pos     []math.Vec3 // position of each welded vertex
+	faces   [][]int     // faces of each welded vertex
+	quadric []quadric   // quadric of each welded vertex
+	version []int       // incremented when a welded vertex changes
+	removed []bool      // welded vertices that are collapsed
+	queue   collapseQueue
+	count   int // number of alive faces
+
+	// cost returns the cost of collapsing u into v, which is the
+	// quadric error by default.
+	cost func(u, v int) float64
+	// refresh requeues the edges around a collapse, which is required
+	// if the cost depends on the neighborhood of an edge.
+	refresh bool
+	// record is called after each collapse with the buffer vertices
+	// that are replaced and the number of removed faces.
+	record func(c collapse, remap map[int]int, faces int)
+}
+
+func newSimplifier(bm *BufferedMesh) *simplifier {
+	s := &simplifier{
+		bm:    bm,
+		idx:   make([]int, len(bm.vertIdx)),
+		alive: make([]bool, len(bm.vertIdx)/3),
+		count: len(bm.vertIdx) / 3,
+	}
+	s.cost = s.quadricCost
+	s.weld, s.pos = weldPositions(bm.positions())
+	n := len(s.pos)
+	s.faces = make([][]int, n)
+	s.quadric = make([]quadric, n)
+	s.version = make([]int, n)
+	s.removed = make([]bool, n)
+
+	for f := range s.alive {
+		for k := 0; k < 3; k++ {
+			s.idx[3*f+k] = int(bm.vertIdx[3*f+k])
+		}
+		// Faces of repeated vertices are dropped.
+		a, b, c := s.corner(f, 0), s.corner(f, 1), s.corner(f, 2)
+		if a == b || b == c || c == a {
+			s.count--
+			continue
+		}
+		s.alive[f] = true
+		s.faces[a] = append(s.faces[a], f)
+		s.faces[b] = append(s.faces[b], f)
+		s.faces[c] = append(s.faces[c], f)
+
+		// Faces contribute area weighted planes to their vertices.
+		p0, p1, p2 := s.pos[a], s.pos[b], s.pos[c]
+		cross := p1.Sub(p0).Cross(p2.Sub(p0))
+		area := cross.Len() / 2
+		if area == 0 {
+			continue
+		}
+		nor := cross.Unit()
+		q := planeQuadric(nor, -nor.Dot(p0), area)
+		q.w = area
+		s.quadric[a].add(&q)
+		s.quadric[b].add(&q)
+		s.quadric[c].add(&q)
+	}
+
+	// Boundary and seam edges contribute planes that are perpendicular
+	// to their faces, which keep them from moving sideways.
+	for f, alive := range s.alive {
+		if !alive {
+			continue
+		}
+		for k := 0; k < 3; k++ {
+			a, b := s.corner(f, k), s.corner(f, (k+1)%3)
+			var weight float64
+			switch other := s.edgeFaces(a, b); {
+			case len(other) == 1:
+				weight = simplifyBoundaryWeight
+			case len(other) == 2 && s.isSeam(other, a, b):
+				weight = simplifySeamWeight
+			default:
+				continue
+			}
+			pa, pb := s.pos[a], s.pos[b]
+			e := pb.Sub(pa)
+			nor := s.faceNormal(f, -1, pa).Cross(e)
+			if nor.IsZero() {
+				continue
+			}
+			nor = nor.Unit()
+			l := e.Dot(e)
+			q := planeQuadric(nor, -nor.Dot(pa), weight*l)
+			s.quadric[a].add(&q)
+			s.quadric[b].add(&q)
+		}
+	}
+
+	for w := range s.pos {
+		for _, n := range s.neighbors(w) {
+			if w < n {
+				s.push(w, n)
+				s.push(n, w)
+			}
+		}
+	}
+	return s
+}
+
+// corner returns the welded vertex of the k-th corner of the face f.
+func (s *simplifier) corner(f, k int) int {
+	return s.weld[s.idx[3*f+k]]
+}
+
+// edgeFaces returns the alive faces of the welded edge (a, b).
+func (s *simplifier) edgeFaces(a, b int) []int {
+	var fs []int
+	for _, f := range s.faces[a] {
+		if !s.alive[f] {
+			continue
+		}
+		for k := 0; k < 3; k++ {
+			if s.corner(f, k) == b {
+				fs = append(fs, f)
+				break
+			}
+		}
+	}
+	return fs
+}
+
+// bufferVertex returns the buffer vertex of the face f at the welded
+// vertex w.
+func (s *simplifier) bufferVertex(f, w int) int {
+	for k := 0; k < 3; k++ {
+		if s.corner(f, k) == w {
+			return s.idx[3*f+k]
+		}
+	}
+	return -1
+}
+
+// isSeam reports whether the two faces of the welded edge (a, b) use
+// different buffer vertices.
+func (s *simplifier) isSeam(fs []int, a, b int) bool {
+	return s.bufferVertex(fs[0], a) != s.bufferVertex(fs[1], a) ||
+		s.bufferVertex(fs[0], b) != s.bufferVertex(fs[1], b)
+}
+
+// faceNormal returns the unnormalized normal of the face f, where the
+// welded vertex w is moved to p.
+func (s *simplifier) faceNormal(f, w int, p math.Vec3) math.Vec3 {
+	var ps [3]math.Vec3
+	for k := 0; k < 3; k++ {
+		c := s.corner(f, k)
+		if c == w {
+			ps[k] = p
+		} else {
+			ps[k] = s.pos[c]
+		}
+	}
+	return ps[1].Sub(ps[0]).Cross(ps[2].Sub(ps[0]))
+}
+
+// neighbors returns the welded vertices that share a face with w.
+func (s *simplifier) neighbors(w int) []int {
+	var ns []int
+	for _, f := range s.faces[w] {
+		if !s.alive[f] {
+			continue
+		}
+		for k := 0; k < 3; k++ {
+			c := s.corner(f, k)
+			if c == w {
+				continue
+			}
+			found := false
+			for _, n := range ns {
+				if n == c {
+					found = true
+					break
+				}
+			}
+			if !found {
+				ns = append(ns, c)
+			}
+		}
+	}
+	return ns
+}
+
+// pushEdges queues the collapses of the edges of w in both directions.
+func (s *simplifier) pushEdges(w int) {
+	for _, n := range s.neighbors(w) {
+		s.push(w, n)
+		s.push(n, w)
+	}
+}
+
+func (s *simplifier) push(u, v int) {
+	heap.Push(&s.queue, collapse{s.cost(u, v), u, v, s.version[u], s.version[v]})
+}
+
+// quadricCost returns the mean squared distance of v to the planes of
+// the quadrics of u and v.
+func (s *simplifier) quadricCost(u, v int) float64 {
+	q := s.quadric[u]
+	q.add(&s.quadric[v])
+	if q.w == 0 {
+		return 0
+	}
+	return math.Max(q.eval(s.pos[v])/q.w, 0)
+}
+
+func (s *simplifier) run(target int, maxCost float64) {
+	for s.count > target && s.queue.Len() > 0 {
+		c := heap.Pop(&s.queue).(collapse)
+		if s.removed[c.u] || s.removed[c.v] ||
+			c.ver1 != s.version[c.u] || c.ver2 != s.version[c.v] {
+			continue
+		}
+		if c.cost > maxCost {
+			return
+		}
+		count := s.count
+		if remap := s.collapse(c.u, c.v); remap != nil && s.record != nil {
+			s.record(c, remap, count-s.count)
+		}
+	}
+}
+
+// collapse collapses the welded vertex u into v if the collapse keeps
+// the boundaries, seams and the topology of the mesh. It returns the
+// buffer vertices of u and their replacements, or nil if the collapse
+// is rejected.
+func (s *simplifier) collapse(u, v int) map[int]int {
+	edge := s.edgeFaces(u, v)
+	if len(edge) == 0 || len(edge) > 2 {
+		return nil
+	}
+
+	// Vertices on a boundary or a seam may only move along it.
+	boundary, seam := false, false
+	for _, n := range s.neighbors(u) {
+		fs := s.edgeFaces(u, n)
+		switch {
+		case len(fs) == 1:
+			boundary = true
+		case len(fs) > 2:
+			return nil
+		case s.isSeam(fs, u, n):
+			seam = true
+		}
+	}
+	switch {
+	case boundary && seam:
+		return nil
+	case boundary && len(edge) != 1:
+		return nil
+	case seam && (len(edge) != 2 || !s.isSeam(edge, u, v)):
+		return nil
+	case !boundary && len(edge) != 2:
+		return nil
+	}
+
+	// The link condition: u and v share no neighbors besides the
+	// opposite vertices of their edge, otherwise the collapse creates
+	// non-manifold edges.
+	common := 0
+	vn := s.neighbors(v)
+	for _, n := range s.neighbors(u) {
+		for _, m := range vn {
+			if n == m {
+				common++
+			}
+		}
+	}
+	if common != len(edge) {
+		return nil
+	}
+
+	// Each buffer vertex of u is replaced by the buffer vertex of v
+	// across the collapsed edge.
+	remap := map[int]int{}
+	for _, f := range edge {
+		a, b := s.bufferVertex(f, u), s.bufferVertex(f, v)
+		if r, ok := remap[a]; ok && r != b {
+			return nil
+		}
+		remap[a] = b
+	}
+
+	// Faces must not flip or degenerate.
+	for _, f := range s.faces[u] {
+		if !s.alive[f] || contains(edge, f) {
+			continue
+		}
+		before := s.faceNormal(f, -1, math.Vec3{})
+		after := s.faceNormal(f, u, s.pos[v])
+		if _, ok := remap[s.bufferVertex(f, u)]; !ok || after.Dot(before) <= 0 {
+			return nil
+		}
+	}
+
+	for _, f := range edge {
+		s.alive[f] = false
+		s.count--
+	}
+	faces := s.faces[v][:0]
+	for _, f := range s.faces[v] {
+		if s.alive[f] {
+			faces = append(faces, f)
+		}
+	}
+	for _, f := range s.faces[u] {
+		if !s.alive[f] {
+			continue
+		}
+		for k := 0; k < 3; k++ {
+			if s.corner(f, k) == u {
+				s.idx[3*f+k] = remap[s.idx[3*f+k]]
+			}
+		}
+		faces = append(faces, f)
+	}
+	s.faces[v] = faces
+	s.faces[u] = nil
+	s.removed[u] = true
+	s.quadric[v].add(&s.quadric[u])
+	s.version[v]++
+	s.pushEdges(v)
+	if s.refresh {
+		for _, n := range s.neighbors(v) {
+			s.version[n]++
+			s.pushEdges(n)
+		}
+	}
+	return remap
+}
+
+func contains(fs []int, f int) bool {
+	for _, g := range fs {
+		if g == f {
+			return true
+		}
+	}
+	return false
+}
+
+// result returns a buffered mesh of the alive faces, which keeps the
+// attributes of the used vertices.
+func (s *simplifier) result() *BufferedMesh {
+	index := make([]int, s.bm.NumVertices())
+	for i := range index {
+		index[i] = -1
+	}
+	var (
+		idx  []uint64
+		used []int
+	)
+	for f, alive := range s.alive {
+		if !alive {
+			continue
+		}
+		for k := 0; k < 3; k++ {
+			i := s.idx[3*f+k]
+			if index[i] < 0 {
+				index[i] = len(used)
+				used = append(used, i)
+			}
+			idx = append(idx, uint64(index[i]))
+		}
+	}
+
+	ret := NewBufferedMesh()
+	for _, name := range s.bm.AttributeNames() {
+		attr := s.bm.GetAttribute(name)
+		values := make([]float64, 0, attr.Stride*len(used))
+		for _, i := range used {
+			values = append(values, attr.Values[attr.Stride*i:attr.Stride*(i+1)]...)
+		}
+		ret.SetAttribute(name, NewBufferAttribute(attr.Stride, values))
+	}
+	ret.SetVertexIndex(idx)
+	ret.SetMaterial(s.bm.GetMaterial())
+	return ret
+}
@@ -0,0 +1,175 @@
+// Copyright 2021 Changkun Ou <changkun.de>. All rights reserved.
+// Use of this source code is governed by a GPLv3 license that
+// can be found in the LICENSE file.
+
+package geometry_test
+
+import (
+	"testing"
+
+	"poly.red/geometry"
+	"poly.red/geometry/primitive"
+	"poly.red/material"
+	"poly.red/math"
+)
+
+// grid returns a n x n grid of the unit square in the xy plane. If seam
+// is true, the vertices at x = 0.5 are duplicated, and the texture
+// coordinates of the right half are offset by one.
+func grid(n int, seam bool) *geometry.BufferedMesh {
+	var (
+		pos, uv []float64
+		idx     []uint64
+		index   = map[[3]int]uint64{}
+	)
+	vertex := func(i, j, side int) uint64 {
+		if !seam || 2*i != n {
+			side = 0
+		}
+		k := [3]int{i, j, side}
+		if seam && 2*i > n {
+			side = 1
+		}
+		if v, ok := index[k]; ok {
+			return v
+		}
+		v := uint64(len(pos) / 3)
+		index[k] = v
+		x, y := float64(i)/float64(n), float64(j)/float64(n)
+		pos = append(pos, x, y, 0)
+		uv = append(uv, x+float64(side), y)
+		return v
+	}
+	for i := 0; i < n; i++ {
+		for j := 0; j < n; j++ {
+			side := 0
+			if seam && 2*i >= n {
+				side = 1
+			}
+			a, b := vertex(i, j, side), vertex(i+1, j, side)
+			c, d := vertex(i+1, j+1, side), vertex(i, j+1, side)
+			idx = append(idx, a, b, c, a, c, d)
+		}
+	}
+	bm := geometry.NewBufferedMesh()
+	bm.SetAttribute(geometry.AttributePos, geometry.NewBufferAttribute(3, pos))
+	bm.SetAttribute(geometry.AttributeUV, geometry.NewBufferAttribute(2, uv))
+	bm.SetVertexIndex(idx)
+	return bm
+}
+
+// box returns a closed box of [-1, 1]^3, where each side is a n x n
+// grid.
+func box(n int) *geometry.BufferedMesh {
+	bm := geometry.NewBufferedMesh()
+	var (
+		pos   []float64
+		idx   []uint64
+		index = map[math.Vec3]uint64{}
+	)
+	vertex := func(p math.Vec3) uint64 {
+		if v, ok := index[p]; ok {
+			return v
+		}
+		v := uint64(len(pos) / 3)
+		index[p] = v
+		pos = append(pos, p.X, p.Y, p.Z)
+		return v
+	}
+	axes := [3]math.Vec3{math.NewVec3(1, 0, 0), math.NewVec3(0, 1, 0), math.NewVec3(0, 0, 1)}
+	for a := 0; a < 3; a++ {
+		for _, sign := range []float64{-1, 1} {
+			nor := axes[a].Scale(sign, sign, sign)
+			u, v := axes[(a+1)%3], axes[(a+2)%3]
+			if sign < 0 {
+				u, v = v, u
+			}
+			at := func(i, j int) uint64 {
+				x, y := 2*float64(i)/float64(n)-1, 2*float64(j)/float64(n)-1
+				return vertex(nor.Add(u.Scale(x, x, x)).Add(v.Scale(y, y, y)))
+			}
+			for i := 0; i < n; i++ {
+				for j := 0; j < n; j++ {
+					idx = append(idx, at(i, j), at(i+1, j), at(i+1, j+1), at(i, j), at(i+1, j+1), at(i, j+1))
+				}
+			}
+		}
+	}
+	bm.SetAttribute(geometry.AttributePos, geometry.NewBufferAttribute(3, pos))
+	bm.SetVertexIndex(idx)
+	return bm
+}
+
+func TestBufferedMesh_Simplify(t *testing.T) {
+	bm := grid(8, false)
+	s := bm.Simplify(geometry.WithTargetTriangles(0), geometry.WithMaxError(1e-9))
+	if s.NumTriangles() >= 16 {
+		t.Fatalf("expect a flat grid to be simplified, got %d triangles", s.NumTriangles())
+	}
+	if aabb := s.AABB(); !aabb.Min.Eq(math.NewVec3(0, 0, 0)) || !aabb.Max.Eq(math.NewVec3(1, 1, 0)) {
+		t.Fatalf("boundary is not preserved: %v", aabb)
+	}
+	// A maximum error alone does not stop at half of the triangles.
+	if n := bm.Simplify(geometry.WithMaxError(1e-9)).NumTriangles(); n != s.NumTriangles() {
+		t.Fatalf("expect %d triangles without a target, got %d", s.NumTriangles(), n)
+	}
+	area := 0.0
+	s.Faces(func(f primitive.Face, _ material.Material) bool {
+		tri := f.(*primitive.Triangle)
+		if !tri.Normal().Eq(math.NewVec4(0, 0, 1, 0)) {
+			t.Fatalf("face is flipped: %v", tri.Normal())
+		}
+		area += tri.Area()
+		return true
+	})
+	if !math.ApproxEq(area, 1, 1e-9) {
+		t.Fatalf("expect the area of the grid, got %v", area)
+	}
+
+	// Vertices of a texture seam stay on the seam, thus faces do not
+	// mix texture coordinates of both sides.
+	bm = grid(8, true)
+	s = bm.Simplify(geometry.WithTargetTriangles(8))
+	if s.NumTriangles() > 8 {
+		t.Fatalf("expect at most 8 triangles, got %d", s.NumTriangles())
+	}
+	s.Faces(func(f primitive.Face, _ material.Material) bool {
+		var offsets []float64
+		f.Vertices(func(v *primitive.Vertex) bool {
+			offsets = append(offsets, math.Round(v.UV.X-v.Pos.X))
+			return true
+		})
+		if offsets[0] != offsets[1] || offsets[0] != offsets[2] {
+			t.Fatalf("face crosses the seam: %v", offsets)
+		}
+		return true
+	})
+}
+
+func TestBufferedMesh_SimplifyClosed(t *testing.T) {
+	bm := box(6)
+	s := bm.Simplify(geometry.WithTargetTriangles(100))
+	if s.NumTriangles() > 100 || s.NumTriangles() < 90 {
+		t.Fatalf("expect about 100 triangles, got %d", s.NumTriangles())
+	}
+	tm := geometry.NewTriangleMesh(s)
+	tm.Edges(func(i int, e [2]int) bool {
+		if tm.IsBoundaryEdge(i) {
+			t.Fatalf("simplified box is not closed at edge %v", e)
+		}
+		return true
+	})
+	if _, n := tm.ConnectedComponents(); n != 1 {
+		t.Fatalf("expect 1 component, got %d", n)
+	}
+
+	// The box is planar except at its edges, hence it collapses to few
+	// triangles without error.
+	s = bm.Simplify(geometry.WithTargetTriangles(0), geometry.WithMaxError(1e-9))
+	if s.NumTriangles() > 24 {
+		t.Fatalf("expect a simplified box, got %d triangles", s.NumTriangles())
+	}
+	if aabb := s.AABB(); !aabb.Min.Eq(math.NewVec3(-1, -1, -1)) || !aabb.Max.Eq(math.NewVec3(1, 1, 1)) {
+		t.Fatalf("box is not preserved: %v", aabb)
+	}
+}
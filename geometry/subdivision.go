@@ -0,0 +1,611 @@
+// Copyright 2021 Changkun Ou <changkun.de>. All rights reserved.
+// Use of this source code is governed by a GPLv3 license that
+// can be found in the LICENSE file.
+
+package geometry
+
+import (
+	"image/color"
+
+	"poly.red/geometry/primitive"
+	"poly.red/material"
+	"poly.red/math"
+)
+
+// SubdivisionOption offers custom configurations for subdividing a
+// mesh.
+type SubdivisionOption struct {
+	levels     int
+	sharpAngle float64
+}
+
+type SubdivideOption func(o *SubdivisionOption)
+
+// WithSubdivisionLevels sets the number of subdivision steps. The
+// default is one step.
+func WithSubdivisionLevels(n int) SubdivideOption {
+	return func(o *SubdivisionOption) {
+		o.levels = n
+	}
+}
+
+// WithSharpAngle sets the angle in degrees between the normals of two
+// faces above which their shared edge is a crease. Creases are kept
+// sharp and subdivided as curves, like boundaries. The default is 180
+// degrees, thus only boundaries are sharp.
+func WithSharpAngle(deg float64) SubdivideOption {
+	return func(o *SubdivisionOption) {
+		o.sharpAngle = deg
+	}
+}
+
+func newSubdivisionOption(opts ...SubdivideOption) *SubdivisionOption {
+	o := &SubdivisionOption{
+		levels:     1,
+		sharpAngle: 180,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// SubdivideLoop returns the triangle mesh refined by Loop subdivision,
+// where each step splits each triangle into four triangles and smooths
+// the positions of all vertices.
+//
+// Boundaries and creases follow the cubic B-spline rules of curves, and
+// vertices of more than two creases are corners that keep their
+// positions. Vertices that share a position, such as along texture
+// seams, are subdivided as one vertex, whereas their other attributes
+// are subdivided on each side of the seam. Normals and tangents are
+// normalized after interpolation. Face attributes are inherited by the
+// refined faces.
+func (tm *TriangleMesh) SubdivideLoop(opts ...SubdivideOption) *TriangleMesh {
+	o := newSubdivisionOption(opts...)
+
+	// Attributes other than positions are concatenated per vertex.
+	names := []AttributeName{}
+	strides := []int{}
+	stride := 0
+	for _, name := range tm.AttributeNames() {
+		if name == AttributePos {
+			continue
+		}
+		names = append(names, name)
+		strides = append(strides, tm.GetAttribute(name).Stride)
+		stride += tm.GetAttribute(name).Stride
+	}
+	pos := tm.positions()
+	attr := make([]float64, 0, stride*len(pos))
+	for i := range pos {
+		for _, name := range names {
+			a := tm.GetAttribute(name)
+			attr = append(attr, a.Values[a.Stride*i:a.Stride*(i+1)]...)
+		}
+	}
+	faces := make([][]int, tm.NumFaces())
+	for i := range faces {
+		f := tm.Face(i)
+		faces[i] = f[:]
+	}
+
+	sm := newSubdivMesh(faces, pos, attr, stride, o.sharpAngle)
+	parent := make([]int, len(faces)) // original face of each face
+	for i := range parent {
+		parent[i] = i
+	}
+	for l := 0; l < o.levels; l++ {
+		sm = sm.loop()
+		next := make([]int, 0, 4*len(parent))
+		for _, p := range parent {
+			next = append(next, p, p, p, p)
+		}
+		parent = next
+	}
+
+	// Split the concatenated attributes.
+	nw := len(sm.weld)
+	values := make([][]float64, len(names))
+	for i := range values {
+		values[i] = make([]float64, 0, strides[i]*nw)
+	}
+	ps := make([]float64, 0, 3*nw)
+	for w := 0; w < nw; w++ {
+		p := sm.pos[sm.weld[w]]
+		ps = append(ps, p.X, p.Y, p.Z)
+		a := sm.attr[stride*w : stride*(w+1)]
+		for i, name := range names {
+			v := a[:strides[i]]
+			a = a[strides[i]:]
+			if name == AttributeNor || name == AttributeTan {
+				normalize3(v)
+			}
+			values[i] = append(values[i], v...)
+		}
+	}
+	idx := make([]uint64, 0, 3*len(sm.faces))
+	for _, f := range sm.faces {
+		idx = append(idx, uint64(f[0]), uint64(f[1]), uint64(f[2]))
+	}
+
+	bm := NewBufferedMesh()
+	bm.SetAttribute(AttributePos, NewBufferAttribute(3, ps))
+	for i, name := range names {
+		bm.SetAttribute(name, NewBufferAttribute(strides[i], values[i]))
+	}
+	bm.SetVertexIndex(idx)
+	bm.SetMaterial(tm.GetMaterial())
+	ret := NewTriangleMesh(bm)
+	for _, name := range tm.FaceAttributeNames() {
+		a := tm.GetFaceAttribute(name)
+		v := make([]float64, 0, a.Stride*len(parent))
+		for _, p := range parent {
+			v = append(v, a.Values[a.Stride*p:a.Stride*(p+1)]...)
+		}
+		ret.SetFaceAttribute(name, NewBufferAttribute(a.Stride, v))
+	}
+	return ret
+}
+
+// SubdivideCatmullClark returns the quad mesh refined by Catmull-Clark
+// subdivision, where each step splits each face of n vertices into n
+// quads and smooths the positions of all vertices. Hence the result
+// consists of quads only.
+//
+// Boundaries and creases follow the cubic B-spline rules of curves, and
+// vertices of more than two creases are corners that keep their
+// positions. Vertices of the same position are subdivided as one
+// vertex, while texture coordinates, normals, tangents and colors are
+// subdivided on each side of seams where they differ. Faces keep the
+// materials of their original faces.
+func (m *QuadMesh) SubdivideCatmullClark(opts ...SubdivideOption) *QuadMesh {
+	o := newSubdivisionOption(opts...)
+
+	// Vertices are shared by faces if all their attributes are equal.
+	type key struct {
+		pos, uv, nor, tan math.Vec4
+		col               color.RGBA
+	}
+	const stride = 13 // uv, normal, tangent and color
+	var (
+		index = map[key]int{}
+		pos   []math.Vec3
+		attr  []float64
+		faces = make([][]int, len(m.faces))
+	)
+	for i, f := range m.faces {
+		f.Vertices(func(v *primitive.Vertex) bool {
+			k := key{v.Pos, v.UV, v.Nor, v.Tan, v.Col}
+			w, ok := index[k]
+			if !ok {
+				w = len(pos)
+				index[k] = w
+				pos = append(pos, v.Pos.ToVec3())
+				attr = append(attr,
+					v.UV.X, v.UV.Y,
+					v.Nor.X, v.Nor.Y, v.Nor.Z,
+					v.Tan.X, v.Tan.Y, v.Tan.Z, v.Tan.W,
+					float64(v.Col.R), float64(v.Col.G), float64(v.Col.B), float64(v.Col.A),
+				)
+			}
+			faces[i] = append(faces[i], w)
+			return true
+		})
+	}
+
+	sm := newSubdivMesh(faces, pos, attr, stride, o.sharpAngle)
+	parent := make([]int, len(faces))
+	for i := range parent {
+		parent[i] = i
+	}
+	for l := 0; l < o.levels; l++ {
+		next := make([]int, 0, 4*len(parent))
+		for i, f := range sm.faces {
+			for range f {
+				next = append(next, parent[i])
+			}
+		}
+		sm = sm.catmullClark()
+		parent = next
+	}
+
+	vs := make([]primitive.Vertex, len(sm.weld))
+	for w := range vs {
+		a := sm.attr[stride*w : stride*(w+1)]
+		normalize3(a[2:5])
+		normalize3(a[5:8])
+		vs[w] = primitive.Vertex{
+			Pos: sm.pos[sm.weld[w]].ToVec4(1),
+			UV:  math.NewVec4(a[0], a[1], 0, 1),
+			Nor: math.NewVec4(a[2], a[3], a[4], 0),
+			Tan: math.NewVec4(a[5], a[6], a[7], a[8]),
+			Col: color.RGBA{
+				uint8(math.Clamp(math.Round(a[9]), 0, 255)),
+				uint8(math.Clamp(math.Round(a[10]), 0, 255)),
+				uint8(math.Clamp(math.Round(a[11]), 0, 255)),
+				uint8(math.Clamp(math.Round(a[12]), 0, 255)),
+			},
+		}
+	}
+	fs := make([]primitive.Face, len(sm.faces))
+	for i, f := range sm.faces {
+		v1, v2, v3, v4 := vs[f[0]], vs[f[1]], vs[f[2]], vs[f[3]]
+		fs[i] = primitive.NewQuad(&v1, &v2, &v3, &v4)
+	}
+	ret := NewQuadMesh(fs)
+	ret.material = m.material
+	if m.faceMaterials != nil {
+		mats := make([]material.Material, len(parent))
+		for i, p := range parent {
+			mats[i] = m.faceMaterials[p]
+		}
+		ret.faceMaterials = mats
+	}
+	return ret
+}
+
+// normalize3 normalizes the first three values of v, if they are not
+// zero.
+func normalize3(v []float64) {
+	l := math.Sqrt(v[0]*v[0] + v[1]*v[1] + v[2]*v[2])
+	if l == 0 {
+		return
+	}
+	v[0], v[1], v[2] = v[0]/l, v[1]/l, v[2]/l
+}
+
+// subdivMesh is a polygon mesh for subdivision. Faces consist of
+// wedges, which are the vertices of the buffer. Wedges of the same
+// position share a welded vertex, which holds the position, while the
+// other attributes belong to the wedges. Hence positions are subdivided
+// on the welded surface, and attributes are subdivided separately on
+// both sides of seams.
+type subdivMesh struct {
+	faces  [][]int         // wedges of each face
+	weld   []int           // welded vertex of each wedge
+	pos    []math.Vec3     // position of each welded vertex
+	attr   []float64       // attributes of each wedge
+	stride int             // number of attributes per wedge
+	sharp  map[[2]int]bool // creases between welded vertices
+}
+
+// newSubdivMesh welds the wedges of the given faces by their positions,
+// and marks the edges between faces of a larger angle than sharpAngle
+// as creases.
+func newSubdivMesh(faces [][]int, pos []math.Vec3, attr []float64, stride int, sharpAngle float64) *subdivMesh {
+	sm := &subdivMesh{
+		faces:  faces,
+		attr:   attr,
+		stride: stride,
+		sharp:  map[[2]int]bool{},
+	}
+	sm.weld, sm.pos = weldPositions(pos)
+	if sharpAngle >= 180 {
+		return sm
+	}
+
+	nors := make([]math.Vec3, len(faces))
+	for i, f := range faces {
+		// Newell's method for polygons.
+		var n math.Vec3
+		for k := range f {
+			p, q := sm.pos[sm.weld[f[k]]], sm.pos[sm.weld[f[(k+1)%len(f)]]]
+			n = n.Add(math.NewVec3(
+				(p.Y-q.Y)*(p.Z+q.Z),
+				(p.Z-q.Z)*(p.X+q.X),
+				(p.X-q.X)*(p.Y+q.Y),
+			))
+		}
+		if !n.IsZero() {
+			nors[i] = n.Unit()
+		}
+	}
+	t := newSubdivTopology(sm.weldedFaces(), len(sm.pos), nil)
+	cosSharp := math.Cos(math.DegToRad(sharpAngle))
+	for e, fs := range t.edgeFaces {
+		if len(fs) == 2 && nors[fs[0]].Dot(nors[fs[1]]) < cosSharp {
+			sm.sharp[t.edges[e]] = true
+		}
+	}
+	return sm
+}
+
+// weldedFaces returns the faces of welded vertices.
+func (sm *subdivMesh) weldedFaces() [][]int {
+	faces := make([][]int, len(sm.faces))
+	for i, f := range sm.faces {
+		faces[i] = make([]int, len(f))
+		for k, w := range f {
+			faces[i][k] = sm.weld[w]
+		}
+	}
+	return faces
+}
+
+// topologies returns the topology of the welded vertices and the
+// topology of the wedges, where edges between wedges are sharp if their
+// welded edge is sharp.
+func (sm *subdivMesh) topologies() (welded, wedges *subdivTopology) {
+	welded = newSubdivTopology(sm.weldedFaces(), len(sm.pos), func(a, b int) bool {
+		return sm.sharp[edgeKey(a, b)]
+	})
+	wedges = newSubdivTopology(sm.faces, len(sm.weld), func(a, b int) bool {
+		return sm.sharp[edgeKey(sm.weld[a], sm.weld[b])]
+	})
+	return welded, wedges
+}
+
+// loop returns the mesh after a Loop subdivision step, which requires
+// triangles.
+func (sm *subdivMesh) loop() *subdivMesh {
+	welded, wedges := sm.topologies()
+	posVerts, posEdges := welded.loop(vec3Values(sm.pos), 3)
+	attrVerts, attrEdges := wedges.loop(sm.attr, sm.stride)
+
+	next := sm.refined(welded, wedges, posVerts, posEdges, nil, attrVerts, attrEdges, nil)
+	nw := len(sm.weld)
+	for _, f := range sm.faces {
+		a, b, c := f[0], f[1], f[2]
+		ab := nw + wedges.edge(a, b)
+		bc := nw + wedges.edge(b, c)
+		ca := nw + wedges.edge(c, a)
+		next.faces = append(next.faces,
+			[]int{a, ab, ca}, []int{ab, b, bc}, []int{ca, bc, c}, []int{ab, bc, ca})
+	}
+	return next
+}
+
+// catmullClark returns the mesh after a Catmull-Clark subdivision step.
+func (sm *subdivMesh) catmullClark() *subdivMesh {
+	welded, wedges := sm.topologies()
+	posVerts, posEdges, posFaces := welded.catmullClark(vec3Values(sm.pos), 3)
+	attrVerts, attrEdges, attrFaces := wedges.catmullClark(sm.attr, sm.stride)
+
+	next := sm.refined(welded, wedges, posVerts, posEdges, posFaces, attrVerts, attrEdges, attrFaces)
+	nw, ne := len(sm.weld), len(wedges.edges)
+	for i, f := range sm.faces {
+		c := nw + ne + i
+		for k := range f {
+			prev, v, succ := f[(k+len(f)-1)%len(f)], f[k], f[(k+1)%len(f)]
+			next.faces = append(next.faces,
+				[]int{v, nw + wedges.edge(v, succ), c, nw + wedges.edge(prev, v)})
+		}
+	}
+	return next
+}
+
+// refined returns the refined mesh without faces, whose wedges are the
+// original wedges, followed by the wedges of edges and faces. Welded
+// vertices are ordered alike, and creases are split at their edge
+// vertices.
+func (sm *subdivMesh) refined(welded, wedges *subdivTopology,
+	posVerts, posEdges, posFaces, attrVerts, attrEdges, attrFaces []float64) *subdivMesh {
+	nw, ne := len(sm.pos), len(welded.edges)
+	next := &subdivMesh{
+		stride: sm.stride,
+		sharp:  map[[2]int]bool{},
+	}
+	for _, p := range [][]float64{posVerts, posEdges, posFaces} {
+		for i := 0; i+3 <= len(p); i += 3 {
+			next.pos = append(next.pos, math.NewVec3(p[i], p[i+1], p[i+2]))
+		}
+	}
+	next.attr = make([]float64, 0, len(attrVerts)+len(attrEdges)+len(attrFaces))
+	next.attr = append(append(append(next.attr, attrVerts...), attrEdges...), attrFaces...)
+
+	next.weld = append(next.weld, sm.weld...)
+	for _, e := range wedges.edges {
+		next.weld = append(next.weld, nw+welded.edge(sm.weld[e[0]], sm.weld[e[1]]))
+	}
+	if posFaces != nil {
+		for i := range sm.faces {
+			next.weld = append(next.weld, nw+ne+i)
+		}
+	}
+	for e := range sm.sharp {
+		m := nw + welded.edge(e[0], e[1])
+		next.sharp[edgeKey(e[0], m)] = true
+		next.sharp[edgeKey(m, e[1])] = true
+	}
+	return next
+}
+
+func vec3Values(vs []math.Vec3) []float64 {
+	values := make([]float64, 0, 3*len(vs))
+	for _, v := range vs {
+		values = append(values, v.X, v.Y, v.Z)
+	}
+	return values
+}
+
+func edgeKey(a, b int) [2]int {
+	if a > b {
+		a, b = b, a
+	}
+	return [2]int{a, b}
+}
+
+// subdivTopology is the edge topology of a polygon mesh.
+type subdivTopology struct {
+	faces     [][]int
+	edges     [][2]int // vertices of each edge, the first is smaller
+	index     map[[2]int]int
+	edgeFaces [][]int
+	vertEdges [][]int
+	vertFaces [][]int
+	sharp     []bool // boundaries, non-manifold edges and creases
+}
+
+// newSubdivTopology returns the topology of the faces of n vertices,
+// where sharp reports creases and may be nil.
+func newSubdivTopology(faces [][]int, n int, sharp func(a, b int) bool) *subdivTopology {
+	t := &subdivTopology{
+		faces:     faces,
+		index:     map[[2]int]int{},
+		vertEdges: make([][]int, n),
+		vertFaces: make([][]int, n),
+	}
+	for i, f := range faces {
+		for k := range f {
+			t.vertFaces[f[k]] = append(t.vertFaces[f[k]], i)
+			e := edgeKey(f[k], f[(k+1)%len(f)])
+			j, ok := t.index[e]
+			if !ok {
+				j = len(t.edges)
+				t.index[e] = j
+				t.edges = append(t.edges, e)
+				t.edgeFaces = append(t.edgeFaces, nil)
+				t.vertEdges[e[0]] = append(t.vertEdges[e[0]], j)
+				t.vertEdges[e[1]] = append(t.vertEdges[e[1]], j)
+			}
+			t.edgeFaces[j] = append(t.edgeFaces[j], i)
+		}
+	}
+	t.sharp = make([]bool, len(t.edges))
+	for j, e := range t.edges {
+		t.sharp[j] = len(t.edgeFaces[j]) != 2 || sharp != nil && sharp(e[0], e[1])
+	}
+	return t
+}
+
+// edge returns the index of the edge (a, b).
+func (t *subdivTopology) edge(a, b int) int {
+	return t.index[edgeKey(a, b)]
+}
+
+// other returns the other vertex of the j-th edge.
+func (t *subdivTopology) other(j, v int) int {
+	if t.edges[j][0] == v {
+		return t.edges[j][1]
+	}
+	return t.edges[j][0]
+}
+
+// sharpNeighbors returns the vertices of the sharp edges of v.
+func (t *subdivTopology) sharpNeighbors(v int) []int {
+	var ns []int
+	for _, j := range t.vertEdges[v] {
+		if t.sharp[j] {
+			ns = append(ns, t.other(j, v))
+		}
+	}
+	return ns
+}
+
+// vertexRule computes the refined value of a vertex of sharp edges,
+// which is a crease vertex for two sharp edges and a corner for more.
+// It reports false for smooth vertices.
+func (t *subdivTopology) vertexRule(v int, values []float64, stride int, out []float64) bool {
+	ns := t.sharpNeighbors(v)
+	switch {
+	case len(ns) == 2:
+		axpy(out, 0.75, values[stride*v:stride*(v+1)])
+		axpy(out, 0.125, values[stride*ns[0]:stride*(ns[0]+1)])
+		axpy(out, 0.125, values[stride*ns[1]:stride*(ns[1]+1)])
+		return true
+	case len(ns) > 2 || len(t.vertEdges[v]) == 0:
+		copy(out, values[stride*v:stride*(v+1)])
+		return true
+	}
+	return false
+}
+
+// loop computes the refined values of the vertices and the edges of a
+// triangle mesh with the weights of Loop.
+func (t *subdivTopology) loop(values []float64, stride int) (verts, edges []float64) {
+	n := len(t.vertEdges)
+	verts = make([]float64, stride*n)
+	for v := 0; v < n; v++ {
+		out := verts[stride*v : stride*(v+1)]
+		if t.vertexRule(v, values, stride, out) {
+			continue
+		}
+		k := float64(len(t.vertEdges[v]))
+		c := 3.0/8 + math.Cos(2*math.Pi/k)/4
+		beta := (5.0/8 - c*c) / k
+		axpy(out, 1-k*beta, values[stride*v:stride*(v+1)])
+		for _, j := range t.vertEdges[v] {
+			u := t.other(j, v)
+			axpy(out, beta, values[stride*u:stride*(u+1)])
+		}
+	}
+
+	edges = make([]float64, stride*len(t.edges))
+	for j, e := range t.edges {
+		out := edges[stride*j : stride*(j+1)]
+		if t.sharp[j] {
+			axpy(out, 0.5, values[stride*e[0]:stride*(e[0]+1)])
+			axpy(out, 0.5, values[stride*e[1]:stride*(e[1]+1)])
+			continue
+		}
+		axpy(out, 0.375, values[stride*e[0]:stride*(e[0]+1)])
+		axpy(out, 0.375, values[stride*e[1]:stride*(e[1]+1)])
+		for _, f := range t.edgeFaces[j] {
+			for _, u := range t.faces[f] {
+				if u != e[0] && u != e[1] {
+					axpy(out, 0.125, values[stride*u:stride*(u+1)])
+				}
+			}
+		}
+	}
+	return verts, edges
+}
+
+// catmullClark computes the refined values of the vertices, the edges
+// and the faces of a polygon mesh with the weights of Catmull and
+// Clark.
+func (t *subdivTopology) catmullClark(values []float64, stride int) (verts, edges, faces []float64) {
+	faces = make([]float64, stride*len(t.faces))
+	for i, f := range t.faces {
+		out := faces[stride*i : stride*(i+1)]
+		for _, v := range f {
+			axpy(out, 1/float64(len(f)), values[stride*v:stride*(v+1)])
+		}
+	}
+
+	edges = make([]float64, stride*len(t.edges))
+	for j, e := range t.edges {
+		out := edges[stride*j : stride*(j+1)]
+		if t.sharp[j] {
+			axpy(out, 0.5, values[stride*e[0]:stride*(e[0]+1)])
+			axpy(out, 0.5, values[stride*e[1]:stride*(e[1]+1)])
+			continue
+		}
+		axpy(out, 0.25, values[stride*e[0]:stride*(e[0]+1)])
+		axpy(out, 0.25, values[stride*e[1]:stride*(e[1]+1)])
+		for _, f := range t.edgeFaces[j] {
+			axpy(out, 0.25, faces[stride*f:stride*(f+1)])
+		}
+	}
+
+	// Smooth vertices move to (F + 2R + (n-3)P)/n, where F is the
+	// average of the face points, R the average of the edge midpoints
+	// and n the valence.
+	n := len(t.vertEdges)
+	verts = make([]float64, stride*n)
+	for v := 0; v < n; v++ {
+		out := verts[stride*v : stride*(v+1)]
+		if t.vertexRule(v, values, stride, out) {
+			continue
+		}
+		k := float64(len(t.vertEdges[v]))
+		for _, f := range t.vertFaces[v] {
+			axpy(out, 1/(k*float64(len(t.vertFaces[v]))), faces[stride*f:stride*(f+1)])
+		}
+		for _, j := range t.vertEdges[v] {
+			u := t.other(j, v)
+			axpy(out, 1/(k*k), values[stride*v:stride*(v+1)])
+			axpy(out, 1/(k*k), values[stride*u:stride*(u+1)])
+		}
+		axpy(out, (k-3)/k, values[stride*v:stride*(v+1)])
+	}
+	return verts, edges, faces
+}
+
+// axpy adds a*x to y.
+func axpy(y []float64, a float64, x []float64) {
+	for i := range y {
+		y[i] += a * x[i]
+	}
+}
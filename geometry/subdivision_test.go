@@ -0,0 +1,197 @@
+// Copyright 2021 Changkun Ou <changkun.de>. All rights reserved.
+// Use of this source code is governed by a GPLv3 license that
+// can be found in the LICENSE file.
+
+package geometry_test
+
+import (
+	"testing"
+
+	"poly.red/geometry"
+	"poly.red/geometry/primitive"
+	"poly.red/material"
+	"poly.red/math"
+)
+
+// onCube reports whether p is on the surface of the cube [-1, 1]^3.
+func onCube(p math.Vec3) bool {
+	return math.ApproxEq(math.Max(math.Abs(p.X), math.Abs(p.Y), math.Abs(p.Z)), 1, 1e-9)
+}
+
+func TestTriangleMesh_SubdivideLoop(t *testing.T) {
+	tm := geometry.NewTriangleMesh(cube())
+	tm.SetFaceAttribute("id", geometry.NewBufferAttribute(1, []float64{
+		0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11,
+	}))
+
+	s := tm.SubdivideLoop(geometry.WithSubdivisionLevels(2))
+	if s.NumFaces() != 16*12 || s.NumVertices() != 98 {
+		t.Fatalf("unexpected refinement: %d faces, %d vertices", s.NumFaces(), s.NumVertices())
+	}
+	if id := s.GetFaceAttribute("id"); id == nil || id.Values[16*5] != 5 {
+		t.Fatalf("face attributes are not inherited")
+	}
+	inside := false
+	s.Faces(func(f primitive.Face, _ material.Material) bool {
+		f.Vertices(func(v *primitive.Vertex) bool {
+			inside = inside || !onCube(v.Pos.ToVec3())
+			return true
+		})
+		return true
+	})
+	if !inside {
+		t.Fatalf("expect a smooth surface inside of the cube")
+	}
+	s.Edges(func(i int, e [2]int) bool {
+		if s.IsBoundaryEdge(i) {
+			t.Fatalf("refined cube is not closed at edge %v", e)
+		}
+		return true
+	})
+
+	// Creases keep the cube.
+	s = tm.SubdivideLoop(geometry.WithSubdivisionLevels(2), geometry.WithSharpAngle(60))
+	s.Faces(func(f primitive.Face, _ material.Material) bool {
+		f.Vertices(func(v *primitive.Vertex) bool {
+			if !onCube(v.Pos.ToVec3()) {
+				t.Fatalf("vertex leaves the creased cube: %v", v.Pos)
+			}
+			return true
+		})
+		return true
+	})
+	aabb := s.AABB()
+	if !aabb.Min.Eq(math.NewVec3(-1, -1, -1)) || !aabb.Max.Eq(math.NewVec3(1, 1, 1)) {
+		t.Fatalf("corners are not kept: %v", aabb)
+	}
+}
+
+func TestTriangleMesh_SubdivideLoopAttributes(t *testing.T) {
+	// Texture coordinates follow the positions of a flat grid.
+	s := geometry.NewTriangleMesh(grid(4, false)).SubdivideLoop()
+	s.Faces(func(f primitive.Face, _ material.Material) bool {
+		f.Vertices(func(v *primitive.Vertex) bool {
+			if !math.ApproxEq(v.UV.X, v.Pos.X, 1e-9) || !math.ApproxEq(v.UV.Y, v.Pos.Y, 1e-9) || v.Pos.Z != 0 {
+				t.Fatalf("texture coordinates do not follow positions: %v, %v", v.UV, v.Pos)
+			}
+			return true
+		})
+		return true
+	})
+
+	// Texture coordinates of both sides of a seam are not mixed.
+	s = geometry.NewTriangleMesh(grid(4, true)).SubdivideLoop(geometry.WithSubdivisionLevels(2))
+	s.Faces(func(f primitive.Face, _ material.Material) bool {
+		left, right := 0, 0
+		f.Vertices(func(v *primitive.Vertex) bool {
+			switch {
+			case v.UV.X <= 0.5+1e-9:
+				left++
+			case v.UV.X >= 1.5-1e-9:
+				right++
+			}
+			return true
+		})
+		if left != 3 && right != 3 {
+			t.Fatalf("face mixes both sides of the seam")
+		}
+		return true
+	})
+}
+
+func TestQuadMesh_SubdivideCatmullClark(t *testing.T) {
+	vs := vertices(
+		math.NewVec3(-1, -1, -1),
+		math.NewVec3(1, -1, -1),
+		math.NewVec3(1, 1, -1),
+		math.NewVec3(-1, 1, -1),
+		math.NewVec3(-1, -1, 1),
+		math.NewVec3(1, -1, 1),
+		math.NewVec3(1, 1, 1),
+		math.NewVec3(-1, 1, 1),
+	)
+	faces := [][4]int{
+		{0, 3, 2, 1}, {4, 5, 6, 7}, {0, 1, 5, 4},
+		{3, 7, 6, 2}, {0, 4, 7, 3}, {1, 2, 6, 5},
+	}
+	fs := make([]primitive.Face, len(faces))
+	for i, f := range faces {
+		fs[i] = primitive.NewQuad(vs[f[0]], vs[f[1]], vs[f[2]], vs[f[3]])
+	}
+	m := geometry.NewQuadMesh(fs)
+	mats := make([]material.Material, len(fs))
+	mats[1] = material.NewBlinnPhong()
+	m.SetFaceMaterials(mats)
+
+	// The corners of the cube move to 5/9 after one step.
+	s := m.SubdivideCatmullClark()
+	if s.NumFaces() != 24 || s.NumQuads() != 24 {
+		t.Fatalf("unexpected refinement: %d faces, %d quads", s.NumFaces(), s.NumQuads())
+	}
+	i := 0
+	s.Faces(func(f primitive.Face, mat material.Material) bool {
+		if (mat != nil) != (i/4 == 1) {
+			t.Fatalf("face %d does not keep its material", i)
+		}
+		// The first vertex of each quad is a corner of the cube.
+		corner := f.(*primitive.Quad).V1.Pos
+		if !math.ApproxEq(math.Abs(corner.X), 5.0/9, 1e-9) ||
+			!math.ApproxEq(math.Abs(corner.Y), 5.0/9, 1e-9) ||
+			!math.ApproxEq(math.Abs(corner.Z), 5.0/9, 1e-9) {
+			t.Fatalf("unexpected corner: %v", corner)
+		}
+		if f.Normal().Dot(corner.ToVec3().ToVec4(0)) <= 0 {
+			t.Fatalf("face %d is flipped", i)
+		}
+		i++
+		return true
+	})
+
+	// Creases keep the cube.
+	s = m.SubdivideCatmullClark(geometry.WithSubdivisionLevels(2), geometry.WithSharpAngle(60))
+	if s.NumFaces() != 6*16 {
+		t.Fatalf("expect %d faces, got %d", 6*16, s.NumFaces())
+	}
+	s.Faces(func(f primitive.Face, _ material.Material) bool {
+		f.Vertices(func(v *primitive.Vertex) bool {
+			if !onCube(v.Pos.ToVec3()) {
+				t.Fatalf("vertex leaves the creased cube: %v", v.Pos)
+			}
+			return true
+		})
+		return true
+	})
+	if aabb := s.AABB(); !aabb.Min.Eq(math.NewVec3(-1, -1, -1)) || !aabb.Max.Eq(math.NewVec3(1, 1, 1)) {
+		t.Fatalf("corners are not kept: %v", aabb)
+	}
+
+	// Triangles of mixed meshes are split into three quads, and texture
+	// coordinates are interpolated.
+	vs = vertices(
+		math.NewVec3(0, 0, 0),
+		math.NewVec3(1, 0, 0),
+		math.NewVec3(1, 1, 0),
+		math.NewVec3(0, 1, 0),
+		math.NewVec3(2, 0, 0),
+	)
+	for _, v := range vs {
+		v.UV = math.NewVec4(v.Pos.X, v.Pos.Y, 0, 1)
+	}
+	m = geometry.NewQuadMesh([]primitive.Face{
+		primitive.NewQuad(vs[0], vs[1], vs[2], vs[3]),
+		primitive.NewTriangle(vs[1], vs[4], vs[2]),
+	})
+	s = m.SubdivideCatmullClark()
+	if s.NumFaces() != 7 || s.NumQuads() != 7 {
+		t.Fatalf("unexpected refinement: %d faces, %d quads", s.NumFaces(), s.NumQuads())
+	}
+	s.Faces(func(f primitive.Face, _ material.Material) bool {
+		f.Vertices(func(v *primitive.Vertex) bool {
+			if !math.ApproxEq(v.UV.X, v.Pos.X, 1e-9) || !math.ApproxEq(v.UV.Y, v.Pos.Y, 1e-9) {
+				t.Fatalf("texture coordinates do not follow positions: %v, %v", v.UV, v.Pos)
+			}
+			return true
+		})
+		return true
+	})
+}
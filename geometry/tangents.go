@@ -0,0 +1,171 @@
+// Copyright 2021 Changkun Ou <changkun.de>. All rights reserved.
+// Use of this source code is governed by a GPLv3 license that
+// can be found in the LICENSE file.
+
+package geometry
+
+import (
+	"errors"
+
+	"poly.red/math"
+)
+
+// ComputeTangents computes the tangent attribute of the buffered mesh
+// for tangent space normal mapping, which requires the normal and the
+// texture coordinate attributes. Each tangent holds the handedness of
+// the bitangent as the fourth value, such that the bitangent is
+// W * cross(normal, tangent).
+//
+// The tangent space follows MikkTSpace, the convention of most normal
+// map bakers: the texture derivatives of each face are projected to the
+// tangent plane of each vertex, and the tangents of the faces around a
+// vertex are averaged by the angles of the faces at the vertex. Faces
+// of mirrored texture coordinates do not share tangents, thus a vertex
+// shared by mirrored and unmirrored faces is split the same way as by
+// ComputeNormals. Faces of zero texture area do not contribute to
+// tangents and share the tangents of their vertices.
+func (bm *BufferedMesh) ComputeTangents() error {
+	attrPos := bm.GetAttribute(AttributePos)
+	attrNor := bm.GetAttribute(AttributeNor)
+	attrUV := bm.GetAttribute(AttributeUV)
+	if attrPos == nil || attrNor == nil || attrUV == nil {
+		return errors.New("geometry: tangents require positions, normals and texture coordinates")
+	}
+	get := func(attr *BufferAttribute, i int) math.Vec3 {
+		v := int(bm.vertIdx[i])
+		if attr.Stride == 2 {
+			return math.NewVec3(attr.Values[2*v], attr.Values[2*v+1], 0)
+		}
+		return math.NewVec3(
+			attr.Values[attr.Stride*v+0],
+			attr.Values[attr.Stride*v+1],
+			attr.Values[attr.Stride*v+2],
+		)
+	}
+
+	// The corners of a vertex are grouped by the orientation of the
+	// texture coordinates of their faces. Faces of zero texture area
+	// have no orientation and join an existing group of each vertex
+	// after all other faces are grouped.
+	type group struct {
+		v      int
+		orient bool
+	}
+	var (
+		nf     = len(bm.vertIdx) / 3
+		groups = map[group]int{}
+		keys   []group
+		corner = make([]int, 3*nf) // group of each corner
+		first  []int               // first corner of each group
+		tans   []math.Vec3
+		flat   []int // faces of zero texture area
+	)
+	join := func(g group, i int) int {
+		gi, ok := groups[g]
+		if !ok {
+			gi = len(keys)
+			groups[g] = gi
+			keys = append(keys, g)
+			first = append(first, i)
+			tans = append(tans, math.Vec3{})
+		}
+		corner[i] = gi
+		return gi
+	}
+	for f := 0; f < nf; f++ {
+		p := [3]math.Vec3{get(attrPos, 3*f), get(attrPos, 3*f+1), get(attrPos, 3*f+2)}
+		uv := [3]math.Vec3{get(attrUV, 3*f), get(attrUV, 3*f+1), get(attrUV, 3*f+2)}
+
+		// The derivative of the position along u, which is scaled by the
+		// absolute texture area of the face.
+		d1, d2 := p[1].Sub(p[0]), p[2].Sub(p[0])
+		t21, t31 := uv[1].Sub(uv[0]), uv[2].Sub(uv[0])
+		area := t21.X*t31.Y - t21.Y*t31.X
+		if area == 0 {
+			flat = append(flat, f)
+			continue
+		}
+		ds := d1.Scale(t31.Y, t31.Y, t31.Y).Sub(d2.Scale(t21.Y, t21.Y, t21.Y))
+		if area < 0 {
+			ds = ds.Scale(-1, -1, -1)
+		}
+		orient := area > 0
+
+		for k := 0; k < 3; k++ {
+			i := 3*f + k
+			gi := join(group{int(bm.vertIdx[i]), orient}, i)
+
+			// Project the derivative and the edges to the tangent plane
+			// of the vertex, and weight it by the angle at the vertex.
+			n := get(attrNor, i)
+			if !n.IsZero() {
+				n = n.Unit()
+			}
+			project := func(v math.Vec3) math.Vec3 {
+				d := n.Dot(v)
+				return v.Sub(n.Scale(d, d, d))
+			}
+			t := project(ds)
+			if t.IsZero() {
+				continue
+			}
+			t = t.Unit()
+			e1 := project(p[(k+1)%3].Sub(p[k]))
+			e2 := project(p[(k+2)%3].Sub(p[k]))
+			if e1.IsZero() || e2.IsZero() {
+				continue
+			}
+			cos := math.Clamp(e1.Unit().Dot(e2.Unit()), -1, 1)
+			a := math.Acos(cos)
+			tans[gi] = tans[gi].Add(t.Scale(a, a, a))
+		}
+	}
+	for _, f := range flat {
+		for k := 0; k < 3; k++ {
+			i := 3*f + k
+			v := int(bm.vertIdx[i])
+			g := group{v, true}
+			if _, ok := groups[g]; !ok {
+				if _, ok := groups[group{v, false}]; ok {
+					g.orient = false
+				}
+			}
+			join(g, i)
+		}
+	}
+
+	// Groups without a valid derivative receive an arbitrary tangent
+	// of the tangent plane.
+	for gi, t := range tans {
+		if t.IsZero() {
+			t = orthogonal(get(attrNor, first[gi]))
+		}
+		tans[gi] = t.Unit()
+	}
+
+	bm.splitVertices(corner)
+	tan := make([]float64, 4*bm.NumVertices())
+	for i, gi := range corner {
+		v, t := bm.vertIdx[i], tans[gi]
+		w := -1.0
+		if keys[gi].orient {
+			w = 1
+		}
+		tan[4*v], tan[4*v+1], tan[4*v+2], tan[4*v+3] = t.X, t.Y, t.Z, w
+	}
+	bm.SetAttribute(AttributeTan, NewBufferAttribute(4, tan))
+	return nil
+}
+
+// orthogonal returns a unit vector that is orthogonal to the given
+// vector.
+func orthogonal(n math.Vec3) math.Vec3 {
+	if n.IsZero() {
+		return math.NewVec3(1, 0, 0)
+	}
+	a := math.NewVec3(1, 0, 0)
+	if math.Abs(n.X) > math.Abs(n.Z) {
+		a = math.NewVec3(0, 0, 1)
+	}
+	return n.Cross(a).Unit()
+}
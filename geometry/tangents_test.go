@@ -0,0 +1,98 @@
+// Copyright 2021 Changkun Ou <changkun.de>. All rights reserved.
+// Use of this source code is governed by a GPLv3 license that
+// can be found in the LICENSE file.
+
+package geometry_test
+
+import (
+	"testing"
+
+	"poly.red/geometry"
+	"poly.red/geometry/primitive"
+	"poly.red/material"
+	"poly.red/math"
+)
+
+func TestBufferedMesh_ComputeTangents(t *testing.T) {
+	// Two quads of the xy plane that share the edge x = 1. The texture
+	// of the right quad is mirrored.
+	bm := geometry.NewBufferedMesh()
+	bm.SetAttribute(geometry.AttributePos, geometry.NewBufferAttribute(3, []float64{
+		0, 0, 0,
+		1, 0, 0,
+		1, 1, 0,
+		0, 1, 0,
+		2, 0, 0,
+		2, 1, 0,
+	}))
+	bm.SetAttribute(geometry.AttributeNor, geometry.NewBufferAttribute(3, []float64{
+		0, 0, 1, 0, 0, 1, 0, 0, 1, 0, 0, 1, 0, 0, 1, 0, 0, 1,
+	}))
+	bm.SetAttribute(geometry.AttributeUV, geometry.NewBufferAttribute(2, []float64{
+		0, 0, 1, 0, 1, 1, 0, 1, 0, 0, 0, 1,
+	}))
+	bm.SetVertexIndex([]uint64{0, 1, 2, 0, 2, 3, 1, 4, 5, 1, 5, 2})
+
+	if err := bm.ComputeTangents(); err != nil {
+		t.Fatalf("cannot compute tangents: %v", err)
+	}
+	// The vertices of the shared edge are split.
+	if bm.NumVertices() != 8 {
+		t.Fatalf("expect 8 vertices, got %d", bm.NumVertices())
+	}
+
+	i := 0
+	bm.Faces(func(f primitive.Face, _ material.Material) bool {
+		want := math.NewVec4(1, 0, 0, 1)
+		if i >= 2 {
+			want = math.NewVec4(-1, 0, 0, -1)
+		}
+		f.Vertices(func(v *primitive.Vertex) bool {
+			if !v.Tan.Eq(want) {
+				t.Fatalf("face %d: expect tangent %v, got %v", i, want, v.Tan)
+			}
+			// The bitangent follows the v direction of the texture.
+			b := v.Nor.Cross(v.Tan).Scale(v.Tan.W, v.Tan.W, v.Tan.W, 0)
+			if !b.Eq(math.NewVec4(0, 1, 0, 0)) {
+				t.Fatalf("face %d: unexpected bitangent %v", i, b)
+			}
+			return true
+		})
+		i++
+		return true
+	})
+
+	// A face whose texture coordinates collapse to a line has no
+	// orientation and must not split the vertices it shares.
+	bm = geometry.NewBufferedMesh()
+	bm.SetAttribute(geometry.AttributePos, geometry.NewBufferAttribute(3, []float64{
+		0, 0, 0,
+		1, 0, 0,
+		1, 1, 0,
+		0, 1, 0,
+	}))
+	bm.SetAttribute(geometry.AttributeNor, geometry.NewBufferAttribute(3, []float64{
+		0, 0, 1, 0, 0, 1, 0, 0, 1, 0, 0, 1,
+	}))
+	bm.SetAttribute(geometry.AttributeUV, geometry.NewBufferAttribute(2, []float64{
+		0, 0, 1, 0, 1, 1, 0.5, 0.5,
+	}))
+	bm.SetVertexIndex([]uint64{0, 1, 2, 0, 2, 3})
+	if err := bm.ComputeTangents(); err != nil {
+		t.Fatalf("cannot compute tangents: %v", err)
+	}
+	if bm.NumVertices() != 4 {
+		t.Fatalf("expect 4 vertices, got %d", bm.NumVertices())
+	}
+	tan := bm.GetAttribute(geometry.AttributeTan)
+	for v := 0; v < 3; v++ {
+		got := math.NewVec4(tan.Values[4*v], tan.Values[4*v+1], tan.Values[4*v+2], tan.Values[4*v+3])
+		if !got.Eq(math.NewVec4(1, 0, 0, 1)) {
+			t.Fatalf("vertex %d: unexpected tangent %v", v, got)
+		}
+	}
+
+	if err := geometry.NewBufferedMesh().ComputeTangents(); err == nil {
+		t.Fatalf("expect an error without texture coordinates")
+	}
+}
@@ -4,7 +4,317 @@
 
 package geometry
 
-// TriangleMesh represents a triangulated mesh
+import "sort"
+
+var _ Mesh = &TriangleMesh{}
+
+// TriangleMesh represents an indexed triangulated mesh. In addition to
+// the buffered mesh, it offers per-face attributes and adjacency queries
+// between vertices, edges and faces. The adjacency is built on the first
+// query and kept until the vertex index changes.
+//
+// Unlike HalfedgeMesh, a triangle mesh does not require the surface to
+// be a manifold, an edge may be shared by any number of faces.
 type TriangleMesh struct {
 	BufferedMesh
+
+	faceAttributes map[AttributeName]*BufferAttribute
+	adj            *triangleAdjacency
+}
+
+// triangleAdjacency holds the adjacency of a triangle mesh. Lists of
+// varying length are stored in the compressed sparse row format, i.e.
+// the list of the i-th element is items[start[i]:start[i+1]].
+type triangleAdjacency struct {
+	version     int      // version of the vertex index
+	edges       [][2]int // vertex indices of each edge, the first is smaller
+	faceEdges   []int    // edge indices of each face, edge k is (v_k, v_k+1)
+	vfStart     []int    // faces of each vertex
+	vfItems     []int
+	veStart     []int // edges of each vertex
+	veItems     []int
+	efStart     []int // faces of each edge
+	efItems     []int
+	numVertices int
+}
+
+// NewTriangleMesh returns a triangle mesh of the given buffered mesh,
+// which shares the attribute values of the buffered mesh. Attributes
+// that are set later on either mesh are not shared.
+func NewTriangleMesh(bm *BufferedMesh) *TriangleMesh {
+	if len(bm.vertIdx)%3 != 0 {
+		panic("geometry: number of vertex indices is not a multiple of three")
+	}
+	tm := &TriangleMesh{
+		BufferedMesh:   *bm,
+		faceAttributes: map[AttributeName]*BufferAttribute{},
+	}
+	tm.attributes = make(map[AttributeName]*BufferAttribute, len(bm.attributes))
+	for name, attr := range bm.attributes {
+		tm.attributes[name] = attr
+	}
+	return tm
+}
+
+// SetVertexIndex sets the vertex index of the triangle mesh, which
+// discards the adjacency and the face attributes whose number of faces
+// no longer matches.
+func (tm *TriangleMesh) SetVertexIndex(vertIdx []uint64) {
+	if len(vertIdx)%3 != 0 {
+		panic("geometry: number of vertex indices is not a multiple of three")
+	}
+	tm.BufferedMesh.SetVertexIndex(vertIdx)
+	tm.adj = nil
+	for name, attr := range tm.faceAttributes {
+		if len(attr.Values) != attr.Stride*tm.NumFaces() {
+			delete(tm.faceAttributes, name)
+		}
+	}
+}
+
+// NumFaces returns the number of faces of the triangle mesh.
+func (tm *TriangleMesh) NumFaces() int {
+	return len(tm.vertIdx) / 3
+}
+
+// Face returns the vertex indices of the i-th face.
+func (tm *TriangleMesh) Face(i int) [3]int {
+	return [3]int{int(tm.vertIdx[3*i]), int(tm.vertIdx[3*i+1]), int(tm.vertIdx[3*i+2])}
+}
+
+// SetFaceAttribute sets an attribute that holds stride values per face.
+// A nil attribute removes the attribute.
+func (tm *TriangleMesh) SetFaceAttribute(name AttributeName, attribute *BufferAttribute) {
+	if attribute == nil {
+		delete(tm.faceAttributes, name)
+		return
+	}
+	if attribute.Stride <= 0 || len(attribute.Values) != attribute.Stride*tm.NumFaces() {
+		panic("geometry: number of face attribute values does not match number of faces")
+	}
+	tm.faceAttributes[name] = attribute
+}
+
+// GetFaceAttribute returns the face attribute of the given name, or nil
+// if the attribute is not set.
+func (tm *TriangleMesh) GetFaceAttribute(name AttributeName) *BufferAttribute {
+	return tm.faceAttributes[name]
+}
+
+// FaceAttributeNames returns the sorted names of all face attributes.
+func (tm *TriangleMesh) FaceAttributeNames() []AttributeName {
+	names := make([]AttributeName, 0, len(tm.faceAttributes))
+	for name := range tm.faceAttributes {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool { return names[i] < names[j] })
+	return names
+}
+
+// NumEdges returns the number of edges of the triangle mesh.
+func (tm *TriangleMesh) NumEdges() int {
+	return len(tm.adjacency().edges)
+}
+
+// Edge returns the vertex indices of the i-th edge, where the first
+// index is the smaller one.
+func (tm *TriangleMesh) Edge(i int) [2]int {
+	return tm.adjacency().edges[i]
+}
+
+// Edges iterates over all edges and their vertex indices.
+func (tm *TriangleMesh) Edges(iter func(i int, e [2]int) bool) {
+	for i, e := range tm.adjacency().edges {
+		if !iter(i, e) {
+			return
+		}
+	}
+}
+
+// FaceEdges returns the edge indices of the i-th face, where the k-th
+// edge connects the k-th and the next vertex of the face.
+func (tm *TriangleMesh) FaceEdges(i int) [3]int {
+	fe := tm.adjacency().faceEdges[3*i : 3*i+3]
+	return [3]int{fe[0], fe[1], fe[2]}
+}
+
+// IsBoundaryEdge reports whether the i-th edge belongs to a single face.
+func (tm *TriangleMesh) IsBoundaryEdge(i int) bool {
+	adj := tm.adjacency()
+	return adj.efStart[i+1]-adj.efStart[i] == 1
+}
+
+// EdgeFaces iterates over the faces of the i-th edge.
+func (tm *TriangleMesh) EdgeFaces(i int, iter func(f int) bool) {
+	adj := tm.adjacency()
+	for _, f := range adj.efItems[adj.efStart[i]:adj.efStart[i+1]] {
+		if !iter(f) {
+			return
+		}
+	}
+}
+
+// VertexFaces iterates over the faces of the i-th vertex.
+func (tm *TriangleMesh) VertexFaces(i int, iter func(f int) bool) {
+	adj := tm.adjacency()
+	for _, f := range adj.vfItems[adj.vfStart[i]:adj.vfStart[i+1]] {
+		if !iter(f) {
+			return
+		}
+	}
+}
+
+// VertexNeighbors iterates over the vertices that share an edge with the
+// i-th vertex.
+func (tm *TriangleMesh) VertexNeighbors(i int, iter func(j int) bool) {
+	adj := tm.adjacency()
+	for _, e := range adj.veItems[adj.veStart[i]:adj.veStart[i+1]] {
+		j := adj.edges[e][0]
+		if j == i {
+			j = adj.edges[e][1]
+		}
+		if !iter(j) {
+			return
+		}
+	}
+}
+
+// FaceNeighbors iterates over the faces that share an edge with the i-th
+// face, together with the local index k of the shared edge as in
+// FaceEdges.
+func (tm *TriangleMesh) FaceNeighbors(i int, iter func(k, f int) bool) {
+	adj := tm.adjacency()
+	for k, e := range adj.faceEdges[3*i : 3*i+3] {
+		for _, f := range adj.efItems[adj.efStart[e]:adj.efStart[e+1]] {
+			if f != i && !iter(k, f) {
+				return
+			}
+		}
+	}
+}
+
+// ConnectedComponents labels the faces by the connected components of
+// the triangle mesh, where faces are connected if they share an edge.
+// It returns the component of each face and the number of components,
+// which are numbered in the order of their first face.
+func (tm *TriangleMesh) ConnectedComponents() ([]int, int) {
+	n := tm.NumFaces()
+	labels := make([]int, n)
+	for i := range labels {
+		labels[i] = -1
+	}
+
+	count := 0
+	var stack []int
+	for i := 0; i < n; i++ {
+		if labels[i] >= 0 {
+			continue
+		}
+		labels[i] = count
+		stack = append(stack[:0], i)
+		for len(stack) > 0 {
+			f := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			tm.FaceNeighbors(f, func(_, g int) bool {
+				if labels[g] < 0 {
+					labels[g] = count
+					stack = append(stack, g)
+				}
+				return true
+			})
+		}
+		count++
+	}
+	return labels, count
+}
+
+// adjacency returns the adjacency of the triangle mesh, which is built
+// on demand, and rebuilt if the vertex index or the number of vertices
+// has changed.
+func (tm *TriangleMesh) adjacency() *triangleAdjacency {
+	if tm.adj != nil && tm.adj.version == tm.version && tm.adj.numVertices == tm.NumVertices() {
+		return tm.adj
+	}
+
+	nv, nf := tm.NumVertices(), tm.NumFaces()
+	for _, v := range tm.vertIdx {
+		if int(v) >= nv {
+			nv = int(v) + 1
+		}
+	}
+	adj := &triangleAdjacency{
+		faceEdges:   make([]int, 3*nf),
+		numVertices: tm.NumVertices(),
+		version:     tm.version,
+	}
+
+	index := make(map[[2]int]int, 3*nf/2)
+	for f := 0; f < nf; f++ {
+		vs := tm.Face(f)
+		for k := 0; k < 3; k++ {
+			e := [2]int{vs[k], vs[(k+1)%3]}
+			if e[0] > e[1] {
+				e[0], e[1] = e[1], e[0]
+			}
+			i, ok := index[e]
+			if !ok {
+				i = len(adj.edges)
+				index[e] = i
+				adj.edges = append(adj.edges, e)
+			}
+			adj.faceEdges[3*f+k] = i
+		}
+	}
+
+	// Each list is filled in two passes, which count the items of each
+	// element and place them after the prefix sum of the counts.
+	csr := func(n int, each func(add func(i, item int))) ([]int, []int) {
+		start := make([]int, n+1)
+		each(func(i, _ int) { start[i+1]++ })
+		for i := 0; i < n; i++ {
+			start[i+1] += start[i]
+		}
+		items := make([]int, start[n])
+		next := append([]int(nil), start[:n]...)
+		each(func(i, item int) {
+			items[next[i]] = item
+			next[i]++
+		})
+		return start, items
+	}
+	adj.vfStart, adj.vfItems = csr(nv, func(add func(i, item int)) {
+		for f := 0; f < nf; f++ {
+			vs := tm.Face(f)
+			add(vs[0], f)
+			if vs[1] != vs[0] {
+				add(vs[1], f)
+			}
+			if vs[2] != vs[0] && vs[2] != vs[1] {
+				add(vs[2], f)
+			}
+		}
+	})
+	adj.veStart, adj.veItems = csr(nv, func(add func(i, item int)) {
+		for e, vs := range adj.edges {
+			add(vs[0], e)
+			if vs[1] != vs[0] {
+				add(vs[1], e)
+			}
+		}
+	})
+	adj.efStart, adj.efItems = csr(len(adj.edges), func(add func(i, item int)) {
+		for f := 0; f < nf; f++ {
+			fe := adj.faceEdges[3*f : 3*f+3]
+			add(fe[0], f)
+			if fe[1] != fe[0] {
+				add(fe[1], f)
+			}
+			if fe[2] != fe[0] && fe[2] != fe[1] {
+				add(fe[2], f)
+			}
+		}
+	})
+
+	tm.adj = adj
+	return adj
 }
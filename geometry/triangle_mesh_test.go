@@ -0,0 +1,130 @@
+// Copyright 2021 Changkun Ou <changkun.de>. All rights reserved.
+// Use of this source code is governed by a GPLv3 license that
+// can be found in the LICENSE file.
+
+package geometry_test
+
+import (
+	"testing"
+
+	"poly.red/geometry"
+)
+
+func TestTriangleMesh(t *testing.T) {
+	// Two triangles that share the edge (1, 2), and a separate triangle.
+	bm := geometry.NewBufferedMesh()
+	bm.SetAttribute(geometry.AttributePos, geometry.NewBufferAttribute(3, []float64{
+		0, 0, 0,
+		1, 0, 0,
+		0, 1, 0,
+		1, 1, 0,
+		5, 0, 0,
+		6, 0, 0,
+		5, 1, 0,
+	}))
+	bm.SetVertexIndex([]uint64{0, 1, 2, 2, 1, 3, 4, 5, 6})
+	tm := geometry.NewTriangleMesh(bm)
+
+	if tm.NumFaces() != 3 || tm.NumEdges() != 8 {
+		t.Fatalf("unexpected size: %d faces, %d edges", tm.NumFaces(), tm.NumEdges())
+	}
+	fe := tm.FaceEdges(1)
+	if e := tm.Edge(fe[0]); e != [2]int{1, 2} || tm.IsBoundaryEdge(fe[0]) {
+		t.Fatalf("unexpected shared edge: %v", e)
+	}
+	if !tm.IsBoundaryEdge(fe[1]) {
+		t.Fatalf("edge %v is not on the boundary", tm.Edge(fe[1]))
+	}
+	faces := 0
+	tm.EdgeFaces(fe[0], func(f int) bool {
+		faces++
+		return true
+	})
+	if faces != 2 {
+		t.Fatalf("expect 2 faces of the shared edge, got %d", faces)
+	}
+
+	var vf, nb []int
+	tm.VertexFaces(2, func(f int) bool {
+		vf = append(vf, f)
+		return true
+	})
+	tm.VertexNeighbors(2, func(j int) bool {
+		nb = append(nb, j)
+		return true
+	})
+	if len(vf) != 2 || vf[0] != 0 || vf[1] != 1 || len(nb) != 3 {
+		t.Fatalf("unexpected neighborhood of vertex 2: faces %v, vertices %v", vf, nb)
+	}
+
+	var ff []int
+	tm.FaceNeighbors(0, func(k, f int) bool {
+		if k != 1 {
+			t.Fatalf("expect the neighbor across edge 1, got %d", k)
+		}
+		ff = append(ff, f)
+		return true
+	})
+	if len(ff) != 1 || ff[0] != 1 {
+		t.Fatalf("unexpected face neighbors: %v", ff)
+	}
+
+	labels, n := tm.ConnectedComponents()
+	if n != 2 || labels[0] != 0 || labels[1] != 0 || labels[2] != 1 {
+		t.Fatalf("unexpected components: %v, %d", labels, n)
+	}
+
+	tm.SetFaceAttribute("component", geometry.NewBufferAttribute(1, []float64{0, 0, 1}))
+	if attr := tm.GetFaceAttribute("component"); attr == nil || attr.Values[2] != 1 {
+		t.Fatalf("unexpected face attribute: %v", attr)
+	}
+	if names := tm.FaceAttributeNames(); len(names) != 1 {
+		t.Fatalf("unexpected face attributes: %v", names)
+	}
+
+	// Changing the vertex index rebuilds the adjacency, and drops face
+	// attributes of a different number of faces.
+	tm.SetVertexIndex([]uint64{0, 1, 2, 2, 1, 3})
+	if tm.NumEdges() != 5 || tm.GetFaceAttribute("component") != nil {
+		t.Fatalf("unexpected mesh after changing the vertex index")
+	}
+	if _, n := tm.ConnectedComponents(); n != 1 {
+		t.Fatalf("expect 1 component, got %d", n)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatalf("expect a panic for mismatched face attributes")
+		}
+	}()
+	tm.SetFaceAttribute("component", geometry.NewBufferAttribute(1, []float64{0}))
+}
+
+func TestTriangleMesh_IndexChanges(t *testing.T) {
+	bm := box(2)
+	tm := geometry.NewTriangleMesh(bm)
+	if _, n := tm.ConnectedComponents(); n != 1 {
+		t.Fatalf("expect a connected box, got %d components", n)
+	}
+
+	// Attributes that are set on the triangle mesh are not set on the
+	// buffered mesh.
+	tm.SetAttribute(geometry.AttributeUV, geometry.NewBufferAttribute(2, make([]float64, 2*tm.NumVertices())))
+	if bm.GetAttribute(geometry.AttributeUV) != nil {
+		t.Fatalf("expect the attributes of the buffered mesh to remain unchanged")
+	}
+
+	// Normals split the sides of the box, which rewrites the vertex
+	// index without changing the number of faces.
+	tm.ComputeNormals(geometry.WithCreaseAngle(60))
+	if _, n := tm.ConnectedComponents(); n != 6 {
+		t.Fatalf("expect 6 sides after splitting, got %d components", n)
+	}
+
+	// A vertex index of the same size through the buffered mesh.
+	idx := append([]uint64(nil), bm.GetVertexIndex()...)
+	tm.BufferedMesh.SetVertexIndex(idx)
+	if _, n := tm.ConnectedComponents(); n != 1 {
+		t.Fatalf("expect a connected box again, got %d components", n)
+	}
+}
@@ -21,6 +21,8 @@ type TriangleSoup struct {
 	faces []*primitive.Triangle
 	// the corresponding material of the triangle mesh.
 	material material.Material
+	// optional per-face materials, a nil entry falls back to material.
+	faceMaterials []material.Material
 	// aabb must be transformed when applying the context.
 	aabb *primitive.AABB
 
@@ -37,7 +39,11 @@ func (f *TriangleSoup) NumTriangles() uint64 {
 
 func (f *TriangleSoup) Faces(iter func(primitive.Face, material.Material) bool) {
 	for i := range f.faces {
-		if !iter(f.faces[i], f.material) {
+		mat := f.material
+		if f.faceMaterials != nil && f.faceMaterials[i] != nil {
+			mat = f.faceMaterials[i]
+		}
+		if !iter(f.faces[i], mat) {
 			return
 		}
 	}
@@ -47,8 +53,21 @@ func (f *TriangleSoup) GetMaterial() material.Material {
 	return f.material
 }
 
+// SetMaterial sets the material of the triangle soup. The given material
+// applies to all faces and discards any per-face materials.
 func (t *TriangleSoup) SetMaterial(mat material.Material) {
 	t.material = mat
+	t.faceMaterials = nil
+}
+
+// SetFaceMaterials assigns materials to the faces of the triangle soup,
+// the i-th material is used by the i-th face. A nil entry falls back to
+// the material of the triangle soup.
+func (t *TriangleSoup) SetFaceMaterials(mats []material.Material) {
+	if len(mats) != len(t.faces) {
+		panic("geometry: number of materials does not match number of faces")
+	}
+	t.faceMaterials = mats
 }
 
 // NewTriangleSoup returns a triangular soup.
@@ -0,0 +1,146 @@
+// Copyright 2021 Changkun Ou <changkun.de>. All rights reserved.
+// Use of this source code is governed by a GPLv3 license that
+// can be found in the LICENSE file.
+
+package image
+
+import (
+	"image"
+	"image/color"
+
+	"poly.red/math"
+)
+
+// RGBAFloat is an in-memory image whose pixels are linear, non-premultiplied
+// RGBA values stored as float32. Unlike RGBA, the values are not limited
+// to [0, 1], which represents high dynamic range content such as
+// environment maps.
+type RGBAFloat struct {
+	// Pix holds the image's pixels, in R, G, B, A order. The pixel at
+	// (x, y) starts at Pix[(y-Rect.Min.Y)*Stride + (x-Rect.Min.X)*4].
+	Pix []float32
+	// Stride is the Pix stride (in elements) between two vertically
+	// adjacent pixels.
+	Stride int
+	// Rect is the image's bounds.
+	Rect image.Rectangle
+}
+
+// NewRGBAFloat returns a new RGBAFloat image with the given bounds.
+func NewRGBAFloat(r image.Rectangle) *RGBAFloat {
+	w, h := r.Dx(), r.Dy()
+	return &RGBAFloat{
+		Pix:    make([]float32, 4*w*h),
+		Stride: 4 * w,
+		Rect:   r,
+	}
+}
+
+func (p *RGBAFloat) ColorModel() color.Model { return color.RGBA64Model }
+
+func (p *RGBAFloat) Bounds() image.Rectangle { return p.Rect }
+
+// At returns the color of the pixel at (x, y), where the values are
+// clamped to [0, 1].
+func (p *RGBAFloat) At(x, y int) color.Color {
+	c := p.RGBAFloatAt(x, y)
+	r, g, b, a := clamp01(c.X), clamp01(c.Y), clamp01(c.Z), clamp01(c.W)
+	return color.RGBA64{
+		uint16(r*a*0xffff + 0.5),
+		uint16(g*a*0xffff + 0.5),
+		uint16(b*a*0xffff + 0.5),
+		uint16(a*0xffff + 0.5),
+	}
+}
+
+// PixOffset returns the index of the first element of Pix that
+// corresponds to the pixel at (x, y).
+func (p *RGBAFloat) PixOffset(x, y int) int {
+	return (y-p.Rect.Min.Y)*p.Stride + (x-p.Rect.Min.X)*4
+}
+
+// RGBAFloatAt returns the unclamped color of the pixel at (x, y), and
+// zero if (x, y) is out of bounds.
+func (p *RGBAFloat) RGBAFloatAt(x, y int) math.Vec4 {
+	if !(image.Point{x, y}.In(p.Rect)) {
+		return math.Vec4{}
+	}
+	i := p.PixOffset(x, y)
+	s := p.Pix[i : i+4 : i+4]
+	return math.NewVec4(float64(s[0]), float64(s[1]), float64(s[2]), float64(s[3]))
+}
+
+// SetRGBAFloat sets the color of the pixel at (x, y).
+func (p *RGBAFloat) SetRGBAFloat(x, y int, c math.Vec4) {
+	if !(image.Point{x, y}.In(p.Rect)) {
+		return
+	}
+	i := p.PixOffset(x, y)
+	s := p.Pix[i : i+4 : i+4]
+	s[0], s[1], s[2], s[3] = float32(c.X), float32(c.Y), float32(c.Z), float32(c.W)
+}
+
+// ToRGBA converts the image to an 8-bit RGBA image. Values are clamped
+// to [0, 1] and stay in linear space.
+func (p *RGBAFloat) ToRGBA() *image.RGBA {
+	r := p.Rect
+	img := image.NewRGBA(image.Rect(0, 0, r.Dx(), r.Dy()))
+	for y := 0; y < r.Dy(); y++ {
+		for x := 0; x < r.Dx(); x++ {
+			i := p.PixOffset(r.Min.X+x, r.Min.Y+y)
+			j := img.PixOffset(x, y)
+			for k := 0; k < 4; k++ {
+				img.Pix[j+k] = uint8(clamp01(float64(p.Pix[i+k]))*0xff + 0.5)
+			}
+		}
+	}
+	return img
+}
+
+// ResizeFloat resizes the given image to the given size using a box
+// filter, which averages all source pixels covered by a target pixel.
+// The given image is returned if it already has the given size.
+func ResizeFloat(width, height int, img *RGBAFloat) *RGBAFloat {
+	r := img.Rect
+	if width == r.Dx() && height == r.Dy() {
+		return img
+	}
+	if width < 1 {
+		width = 1
+	}
+	if height < 1 {
+		height = 1
+	}
+
+	dst := NewRGBAFloat(image.Rect(0, 0, width, height))
+	sx := float64(r.Dx()) / float64(width)
+	sy := float64(r.Dy()) / float64(height)
+	for y := 0; y < height; y++ {
+		y0 := int(float64(y) * sy)
+		y1 := int(math.Min(math.Max(float64(y0+1), math.Ceil(float64(y+1)*sy)), float64(r.Dy())))
+		for x := 0; x < width; x++ {
+			x0 := int(float64(x) * sx)
+			x1 := int(math.Min(math.Max(float64(x0+1), math.Ceil(float64(x+1)*sx)), float64(r.Dx())))
+
+			var sum [4]float64
+			for j := y0; j < y1; j++ {
+				for i := x0; i < x1; i++ {
+					o := img.PixOffset(r.Min.X+i, r.Min.Y+j)
+					for k := range sum {
+						sum[k] += float64(img.Pix[o+k])
+					}
+				}
+			}
+			n := float64((y1 - y0) * (x1 - x0))
+			o := dst.PixOffset(x, y)
+			for k := range sum {
+				dst.Pix[o+k] = float32(sum[k] / n)
+			}
+		}
+	}
+	return dst
+}
+
+func clamp01(v float64) float64 {
+	return math.Clamp(v, 0, 1)
+}
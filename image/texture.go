@@ -31,10 +31,13 @@ func NewColorTexture(c color.RGBA) *Texture {
 // Texture represents a power-of-two 2D texture. The power-of-two means
 // that the texture width and height must be a power of two. e.g. 1024x1024.
 type Texture struct {
-	useMipmap bool
-	mipmap    []*image.RGBA
-	image     *image.RGBA
-	debug     bool
+	useMipmap   bool
+	mipmap      []*image.RGBA
+	image       *image.RGBA
+	floatMipmap []*RGBAFloat
+	floatImage  *RGBAFloat
+	name        string
+	debug       bool
 }
 
 type TextureOption func(t *Texture)
@@ -48,6 +51,27 @@ func WithSource(data *image.RGBA) TextureOption {
 	}
 }
 
+// WithFloatSource uses the given high dynamic range image as the source
+// of the texture. The float values are preserved by QueryFloat, whereas
+// Query returns the values clamped to [0, 1].
+func WithFloatSource(data *RGBAFloat) TextureOption {
+	return func(t *Texture) {
+		if data.Bounds().Dx() < 1 || data.Bounds().Dy() < 1 {
+			panic("image width or height is less than 1!")
+		}
+		t.floatImage = data
+		t.image = data.ToRGBA()
+	}
+}
+
+// WithName names the texture, e.g. by the path of its source image,
+// such that writers can refer to the texture.
+func WithName(name string) TextureOption {
+	return func(t *Texture) {
+		t.name = name
+	}
+}
+
 func WithDebug(enable bool) TextureOption {
 	return func(t *Texture) {
 		t.debug = enable
@@ -74,17 +98,31 @@ func NewTexture(opts ...TextureOption) *Texture {
 	dy := t.image.Bounds().Dy()
 	if dx == 1 && dy == 1 {
 		t.mipmap = []*image.RGBA{t.image}
+		if t.floatImage != nil {
+			t.floatMipmap = []*RGBAFloat{t.floatImage}
+		}
 		return t
 	}
 
 	L := int(math.Log2(math.Max(float64(dx), float64(dy)))) + 1
 	t.mipmap = make([]*image.RGBA, L)
 	t.mipmap[0] = t.image
+	if t.floatImage != nil {
+		t.floatMipmap = make([]*RGBAFloat, L)
+		t.floatMipmap[0] = t.floatImage
+	}
 
 	for i := 1; i < L; i++ {
 		width := dx / int(math.Pow(2, float64(i)))
 		height := dy / int(math.Pow(2, float64(i)))
-		t.mipmap[i] = utils.Resize(width, height, t.image)
+		if t.floatImage != nil {
+			// The 8-bit levels are derived from the float levels,
+			// such that both are consistent.
+			t.floatMipmap[i] = ResizeFloat(width, height, t.floatMipmap[i-1])
+			t.mipmap[i] = t.floatMipmap[i].ToRGBA()
+		} else {
+			t.mipmap[i] = utils.Resize(width, height, t.image)
+		}
 		if t.debug {
 			utils.Save(t.mipmap[i], fmt.Sprintf("%d.png", i))
 		}
@@ -97,6 +135,23 @@ func (t *Texture) Size() int {
 	return t.image.Bounds().Dx()
 }
 
+// Image returns the source image of the texture.
+func (t *Texture) Image() *image.RGBA {
+	return t.image
+}
+
+// FloatImage returns the high dynamic range source image of the
+// texture, or nil if the texture is not created from a float source.
+func (t *Texture) FloatImage() *RGBAFloat {
+	return t.floatImage
+}
+
+// Name returns the name of the texture, or an empty string if the
+// texture is not named.
+func (t *Texture) Name() string {
+	return t.name
+}
+
 // UseMipmap checks if the texture activates mipmap.
 func (t *Texture) UseMipmap() bool {
 	return t.useMipmap
@@ -105,21 +160,7 @@ func (t *Texture) UseMipmap() bool {
 // Query fetches the color of at pixel (u, v). This function is a naive
 // mipmap implementation that does magnification and minification.
 func (t *Texture) Query(lod, u, v float64) color.RGBA {
-	iu, u := math.Modf(u)
-	if iu != 0 && u == 0 {
-		u = 1
-	}
-	if u < 0 {
-		u = 1 - u
-	}
-
-	iv, v := math.Modf(v)
-	if iv != 0 && v == 0 {
-		v = 1
-	}
-	if v < 0 {
-		v = 1 - v
-	}
+	u, v = wrap(u), wrap(v)
 
 	if !t.useMipmap {
 		return t.queryL0(u, v)
@@ -152,6 +193,78 @@ func (t *Texture) Query(lod, u, v float64) color.RGBA {
 	return t.queryTrilinear(h, l, p, u, v)
 }
 
+// QueryFloat fetches the linear color of at pixel (u, v) like Query,
+// but returns the unclamped values of a texture that is created from a
+// float source. The color of other textures is scaled to [0, 1].
+func (t *Texture) QueryFloat(lod, u, v float64) math.Vec4 {
+	if t.floatImage == nil {
+		c := t.Query(lod, u, v)
+		return math.NewVec4(float64(c.R), float64(c.G), float64(c.B), float64(c.A)).Scale(1.0/0xff, 1.0/0xff, 1.0/0xff, 1.0/0xff)
+	}
+	u, v = wrap(u), wrap(v)
+
+	if !t.useMipmap {
+		return t.queryFloatBilinear(0, u, v)
+	}
+
+	if lod < 0 {
+		lod = 0
+	} else if lod >= float64(len(t.floatMipmap)) {
+		lod = float64(len(t.floatMipmap) - 1)
+	}
+	if lod <= 1 {
+		return t.queryFloatBilinear(0, u, v)
+	}
+	lod -= 1
+
+	h := int(math.Floor(lod))
+	l := h + 1
+	if l >= len(t.floatMipmap) {
+		return t.queryFloatBilinear(h, u, v)
+	}
+	p := lod - float64(h)
+	if math.ApproxEq(p, 0, math.Epsilon) {
+		return t.queryFloatBilinear(h, u, v)
+	}
+	return math.LerpVec4(t.queryFloatBilinear(h, u, v), t.queryFloatBilinear(l, u, v), p)
+}
+
+func (t *Texture) queryFloatBilinear(lod int, u, v float64) math.Vec4 {
+	buf := t.floatMipmap[lod]
+	dx := buf.Bounds().Dx()
+	dy := buf.Bounds().Dy()
+	x := u * (float64(dx) - 1)
+	y := v * (float64(dy) - 1)
+	x0 := math.Floor(x)
+	y0 := math.Floor(y)
+	i := buf.Rect.Min.X + int(x0)
+	j := buf.Rect.Min.Y + int(y0)
+	i1 := i + 1
+	if int(x0) >= dx-1 {
+		i1 = i
+	}
+	j1 := j + 1
+	if int(y0) >= dy-1 {
+		j1 = j
+	}
+
+	interpo1 := math.LerpVec4(buf.RGBAFloatAt(i, j), buf.RGBAFloatAt(i1, j), x-x0)
+	interpo2 := math.LerpVec4(buf.RGBAFloatAt(i, j1), buf.RGBAFloatAt(i1, j1), x-x0)
+	return math.LerpVec4(interpo1, interpo2, y-y0)
+}
+
+// wrap wraps a texture coordinate to [0, 1].
+func wrap(u float64) float64 {
+	iu, u := math.Modf(u)
+	if iu != 0 && u == 0 {
+		u = 1
+	}
+	if u < 0 {
+		u = 1 - u
+	}
+	return u
+}
+
 func (t *Texture) queryL0(u, v float64) color.RGBA {
 	tex := t.mipmap[0]
 	dx := float64(tex.Bounds().Dx())
@@ -11,6 +11,7 @@ import (
 	"poly.red/color"
 	"poly.red/image"
 	"poly.red/io"
+	"poly.red/math"
 )
 
 func mustLoadTexture(path string) *image.Texture {
@@ -164,6 +165,45 @@ func TestQuery(t *testing.T) {
 	}
 }
 
+func TestQueryFloat(t *testing.T) {
+	// A 2x2 high dynamic range image whose values exceed 1.
+	img := image.NewRGBAFloat(image.Rect(0, 0, 2, 2))
+	img.SetRGBAFloat(0, 0, math.NewVec4(4, 0, 0, 1))
+	img.SetRGBAFloat(1, 0, math.NewVec4(0, 2, 0, 1))
+	img.SetRGBAFloat(0, 1, math.NewVec4(0, 0, 8, 1))
+	img.SetRGBAFloat(1, 1, math.NewVec4(2, 2, 2, 1))
+	tex := image.NewTexture(image.WithFloatSource(img), image.WithIsotropicMipMap(true))
+
+	tests := []struct {
+		u, v, lod float64
+		want      math.Vec4
+	}{
+		{0, 0, 0, math.NewVec4(4, 0, 0, 1)},
+		{1, 1, 0, math.NewVec4(2, 2, 2, 1)},
+		{0.5, 0.5, 0, math.NewVec4(1.5, 1, 2.5, 1)},
+		{0.5, 0.5, 2, math.NewVec4(1.5, 1, 2.5, 1)},
+	}
+	for _, tt := range tests {
+		if got := tex.QueryFloat(tt.lod, tt.u, tt.v); !got.Eq(tt.want) {
+			t.Fatalf("QueryFloat(%v, %v, %v), want %v, got %v", tt.lod, tt.u, tt.v, tt.want, got)
+		}
+	}
+
+	// The 8-bit query clamps the values.
+	if got := tex.Query(0, 0, 0); !color.Equal(got, color.RGBA{255, 0, 0, 255}) {
+		t.Fatalf("Query does not clamp, got %v", got)
+	}
+	if tex.FloatImage() != img {
+		t.Fatalf("float source is not kept")
+	}
+
+	// Textures without float source are scaled to [0, 1].
+	ldr := image.NewTexture(image.WithSource(data))
+	if got := ldr.QueryFloat(0, 0, 0); !got.Eq(math.NewVec4(1, 1, 1, 1)) {
+		t.Fatalf("unexpected value of an 8-bit texture: %v", got)
+	}
+}
+
 func BenchmarkQuery(b *testing.B) {
 	for i, tt := range tests {
 		ttt := tt
@@ -0,0 +1,106 @@
+// Copyright 2021 Changkun Ou <changkun.de>. All rights reserved.
+// Use of this source code is governed by a GPLv3 license that
+// can be found in the LICENSE file.
+
+package io
+
+import (
+	"errors"
+	"fmt"
+	"image"
+)
+
+// FrameWriter writes a sequence of frames, e.g. the results of
+// repeated Renderer.Render calls, as an animation or a video stream.
+// All frames must have the same size. Close must be called after the
+// last frame to complete the output, but it does not close the
+// underlying writer.
+type FrameWriter interface {
+	WriteFrame(img *image.RGBA) error
+	Close() error
+}
+
+// ErrFrameWriterClosed is returned when writing a frame to a closed
+// frame writer.
+var ErrFrameWriterClosed = errors.New("loader: frame writer is closed")
+
+// AnimationOption offers custom configurations for writing a sequence
+// of frames.
+type AnimationOption struct {
+	fps       int
+	loopCount int
+	dither    bool
+	chroma    Y4MChroma
+}
+
+type WriteAnimationOption func(o *AnimationOption)
+
+// WithFrameRate sets the number of frames per second. The default is 30
+// frames per second.
+func WithFrameRate(fps int) WriteAnimationOption {
+	return func(o *AnimationOption) {
+		o.fps = fps
+	}
+}
+
+// WithLoopCount sets how many times an animation is played, where zero
+// loops forever. Animations loop forever by default. Video streams do
+// not loop.
+func WithLoopCount(n int) WriteAnimationOption {
+	return func(o *AnimationOption) {
+		o.loopCount = n
+	}
+}
+
+// WithGIFDithering enables Floyd-Steinberg error diffusion when frames
+// are quantized to their palette, which reduces banding of smooth
+// gradients but increases the file size.
+func WithGIFDithering(enable bool) WriteAnimationOption {
+	return func(o *AnimationOption) {
+		o.dither = enable
+	}
+}
+
+// WithY4MChroma sets the chroma subsampling of a YUV4MPEG2 stream. The
+// default is Y4MChroma420.
+func WithY4MChroma(c Y4MChroma) WriteAnimationOption {
+	return func(o *AnimationOption) {
+		o.chroma = c
+	}
+}
+
+func newAnimationOption(opts ...WriteAnimationOption) (*AnimationOption, error) {
+	option := &AnimationOption{
+		fps:       30,
+		loopCount: 0,
+		dither:    false,
+		chroma:    Y4MChroma420,
+	}
+	for _, opt := range opts {
+		opt(option)
+	}
+	if option.fps <= 0 {
+		return nil, fmt.Errorf("loader: invalid frame rate %d", option.fps)
+	}
+	if option.loopCount < 0 {
+		return nil, fmt.Errorf("loader: invalid loop count %d", option.loopCount)
+	}
+	return option, nil
+}
+
+// frameSize checks that the given frame has the size of previous
+// frames, and records the size of the first frame.
+func frameSize(size *image.Point, img *image.RGBA) error {
+	s := img.Bounds().Size()
+	if s.X <= 0 || s.Y <= 0 {
+		return errors.New("loader: cannot write an empty frame")
+	}
+	if *size == (image.Point{}) {
+		*size = s
+		return nil
+	}
+	if s != *size {
+		return fmt.Errorf("loader: frame size %v does not match %v", s, *size)
+	}
+	return nil
+}
@@ -0,0 +1,275 @@
+// Copyright 2021 Changkun Ou <changkun.de>. All rights reserved.
+// Use of this source code is governed by a GPLv3 license that
+// can be found in the LICENSE file.
+
+package io_test
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"strings"
+	"testing"
+
+	"poly.red/io"
+)
+
+// turntable returns frames of a coarse gradient with a moving square.
+func turntable(n, w, h int) []*image.RGBA {
+	frames := make([]*image.RGBA, n)
+	for i := range frames {
+		img := image.NewRGBA(image.Rect(0, 0, w, h))
+		for y := 0; y < h; y++ {
+			for x := 0; x < w; x++ {
+				c := color.RGBA{uint8(x / 4 * 20), uint8(y / 4 * 40), 128, 255}
+				if x >= i*4 && x < i*4+4 && y < 4 {
+					c = color.RGBA{255, 0, 0, 255}
+				}
+				img.SetRGBA(x, y, c)
+			}
+		}
+		frames[i] = img
+	}
+	return frames
+}
+
+func writeFrames(t *testing.T, fw io.FrameWriter, err error, frames []*image.RGBA) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("cannot create frame writer: %v", err)
+	}
+	for _, f := range frames {
+		if err := fw.WriteFrame(f); err != nil {
+			t.Fatalf("cannot write frame: %v", err)
+		}
+	}
+	if err := fw.WriteFrame(image.NewRGBA(image.Rect(0, 0, 1, 1))); err == nil {
+		t.Fatalf("expect an error for a frame of a different size")
+	}
+	if err := fw.Close(); err != nil {
+		t.Fatalf("cannot close frame writer: %v", err)
+	}
+	if err := fw.WriteFrame(frames[0]); err != io.ErrFrameWriterClosed {
+		t.Fatalf("expect an error for a closed frame writer, got %v", err)
+	}
+}
+
+func TestGIFWriter(t *testing.T) {
+	frames := turntable(3, 40, 20)
+	for _, dither := range []bool{false, true} {
+		buf := &bytes.Buffer{}
+		fw, err := io.NewGIFWriter(buf, io.WithFrameRate(30), io.WithLoopCount(2), io.WithGIFDithering(dither))
+		writeFrames(t, fw, err, frames)
+
+		g, err := gif.DecodeAll(buf)
+		if err != nil {
+			t.Fatalf("cannot decode gif: %v", err)
+		}
+		if len(g.Image) != 3 || g.LoopCount != 1 {
+			t.Fatalf("unexpected gif: %d frames, loop count %d", len(g.Image), g.LoopCount)
+		}
+		if g.Delay[0]+g.Delay[1]+g.Delay[2] != 10 {
+			t.Fatalf("unexpected delays: %v", g.Delay)
+		}
+		for i, f := range frames {
+			maxDiff := 0
+			for y := 0; y < 20; y++ {
+				for x := 0; x < 40; x++ {
+					r, gg, b, _ := g.Image[i].At(x, y).RGBA()
+					want := f.RGBAAt(x, y)
+					for _, d := range []int{int(r>>8) - int(want.R), int(gg>>8) - int(want.G), int(b>>8) - int(want.B)} {
+						if d < 0 {
+							d = -d
+						}
+						if d > maxDiff {
+							maxDiff = d
+						}
+					}
+				}
+			}
+			// Less than 256 colors are kept exactly.
+			if !dither && maxDiff != 0 {
+				t.Fatalf("frame %d differs by %d", i, maxDiff)
+			}
+			if maxDiff > 16 {
+				t.Fatalf("dithered frame %d differs by %d", i, maxDiff)
+			}
+		}
+	}
+
+	// A frame of many colors is quantized to 256 colors.
+	img := image.NewRGBA(image.Rect(0, 0, 256, 256))
+	for y := 0; y < 256; y++ {
+		for x := 0; x < 256; x++ {
+			img.SetRGBA(x, y, color.RGBA{uint8(x), uint8(y), uint8(x ^ y), 255})
+		}
+	}
+	buf := &bytes.Buffer{}
+	fw, err := io.NewGIFWriter(buf)
+	writeFrames(t, fw, err, []*image.RGBA{img})
+	g, err := gif.DecodeAll(buf)
+	if err != nil {
+		t.Fatalf("cannot decode gif: %v", err)
+	}
+	if n := len(g.Image[0].Palette); n != 256 {
+		t.Fatalf("unexpected palette size %d", n)
+	}
+
+	if _, err := io.NewGIFWriter(buf, io.WithFrameRate(0)); err == nil {
+		t.Fatalf("expect an error for an invalid frame rate")
+	}
+}
+
+type pngChunk struct {
+	typ  string
+	data []byte
+}
+
+func readPNGChunks(t *testing.T, b []byte) []pngChunk {
+	t.Helper()
+	if !bytes.HasPrefix(b, []byte("\x89PNG\r\n\x1a\n")) {
+		t.Fatalf("invalid png signature")
+	}
+	var chunks []pngChunk
+	for b = b[8:]; len(b) > 0; {
+		n := binary.BigEndian.Uint32(b)
+		c := pngChunk{string(b[4:8]), b[8 : 8+n]}
+		if crc32.ChecksumIEEE(b[4:8+n]) != binary.BigEndian.Uint32(b[8+n:]) {
+			t.Fatalf("invalid checksum of chunk %s", c.typ)
+		}
+		chunks = append(chunks, c)
+		b = b[12+n:]
+	}
+	return chunks
+}
+
+func TestAPNGWriter(t *testing.T) {
+	frames := turntable(3, 40, 20)
+	buf := &bytes.Buffer{}
+	fw, err := io.NewAPNGWriter(buf, io.WithFrameRate(24))
+	writeFrames(t, fw, err, frames)
+	data := buf.Bytes()
+
+	// Decoders without animation support see the first frame.
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("cannot decode apng: %v", err)
+	}
+	for i, v := range img.(*image.NRGBA).Pix {
+		if v != frames[0].Pix[i] {
+			t.Fatalf("first frame differs at %d", i)
+		}
+	}
+
+	var (
+		ihdr   []byte
+		seq    uint32
+		frame  int
+		decode = func(fctl []byte, idat []byte) *image.NRGBA {
+			// A frame is a standalone png with the frame size.
+			b := &bytes.Buffer{}
+			b.WriteString("\x89PNG\r\n\x1a\n")
+			for _, c := range []pngChunk{{"IHDR", append(append([]byte{}, fctl[4:12]...), ihdr[8:]...)}, {"IDAT", idat}, {"IEND", nil}} {
+				binary.Write(b, binary.BigEndian, uint32(len(c.data)))
+				b.WriteString(c.typ)
+				b.Write(c.data)
+				binary.Write(b, binary.BigEndian, crc32.ChecksumIEEE(append([]byte(c.typ), c.data...)))
+			}
+			img, err := png.Decode(b)
+			if err != nil {
+				t.Fatalf("cannot decode frame: %v", err)
+			}
+			return img.(*image.NRGBA)
+		}
+		fctl []byte
+	)
+	chunks := readPNGChunks(t, data)
+	for _, c := range chunks {
+		switch c.typ {
+		case "IHDR":
+			ihdr = c.data
+		case "acTL":
+			if n := binary.BigEndian.Uint32(c.data); n != 3 {
+				t.Fatalf("unexpected number of frames %d", n)
+			}
+			if plays := binary.BigEndian.Uint32(c.data[4:]); plays != 0 {
+				t.Fatalf("unexpected number of plays %d", plays)
+			}
+		case "fcTL", "fdAT":
+			if s := binary.BigEndian.Uint32(c.data); s != seq {
+				t.Fatalf("unexpected sequence number %d, want %d", s, seq)
+			}
+			seq++
+			if c.typ == "fcTL" {
+				fctl = c.data
+				if num, den := binary.BigEndian.Uint16(c.data[20:]), binary.BigEndian.Uint16(c.data[22:]); num != 1 || den != 24 {
+					t.Fatalf("unexpected delay %d/%d", num, den)
+				}
+				continue
+			}
+			got := decode(fctl, c.data[4:])
+			frame++
+			for i, v := range got.Pix {
+				if v != frames[frame].Pix[i] {
+					t.Fatalf("frame %d differs at %d", frame, i)
+				}
+			}
+		}
+	}
+	if frame != 2 || seq != 5 || chunks[len(chunks)-1].typ != "IEND" {
+		t.Fatalf("unexpected chunks: %d frames, %d sequence numbers", frame+1, seq)
+	}
+}
+
+func TestY4MWriter(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 3, 2))
+	for i, c := range []color.RGBA{
+		{0, 0, 0, 255}, {255, 255, 255, 255}, {255, 0, 0, 255},
+		{0, 0, 255, 255}, {0, 255, 0, 255}, {128, 128, 128, 255},
+	} {
+		img.SetRGBA(i%3, i/3, c)
+	}
+
+	for _, tt := range []struct {
+		chroma io.Y4MChroma
+		name   string
+		cw, ch int
+		cb     []byte
+	}{
+		{io.Y4MChroma444, "C444", 3, 2, []byte{128, 128, 90, 240, 54, 128}},
+		{io.Y4MChroma420, "C420jpeg", 2, 1, []byte{137, 109}},
+	} {
+		buf := &bytes.Buffer{}
+		fw, err := io.NewY4MWriter(buf, io.WithFrameRate(25), io.WithY4MChroma(tt.chroma))
+		writeFrames(t, fw, err, []*image.RGBA{img, img})
+
+		r := bufio.NewReader(buf)
+		header, _ := r.ReadString('\n')
+		if !strings.HasPrefix(header, "YUV4MPEG2 W3 H2 F25:1 ") || !strings.Contains(header, " "+tt.name+" ") {
+			t.Fatalf("unexpected header %q", header)
+		}
+		for f := 0; f < 2; f++ {
+			if marker, _ := r.ReadString('\n'); marker != "FRAME\n" {
+				t.Fatalf("unexpected frame marker %q", marker)
+			}
+			planes := make([]byte, 6+2*tt.cw*tt.ch)
+			if _, err := r.Read(planes); err != nil {
+				t.Fatalf("cannot read frame: %v", err)
+			}
+			if want := []byte{16, 235, 82, 41, 144, 126}; !bytes.Equal(planes[:6], want) {
+				t.Fatalf("unexpected luma %v, want %v", planes[:6], want)
+			}
+			if cb := planes[6 : 6+tt.cw*tt.ch]; !bytes.Equal(cb, tt.cb) {
+				t.Fatalf("unexpected cb %v, want %v", cb, tt.cb)
+			}
+		}
+		if _, err := r.ReadByte(); err == nil {
+			t.Fatalf("unexpected trailing data")
+		}
+	}
+}
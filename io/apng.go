@@ -0,0 +1,201 @@
+// Copyright 2021 Changkun Ou <changkun.de>. All rights reserved.
+// Use of this source code is governed by a GPLv3 license that
+// can be found in the LICENSE file.
+
+package io
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"io"
+)
+
+const pngHeader = "\x89PNG\r\n\x1a\n"
+
+type apngWriter struct {
+	w      io.Writer
+	option *AnimationOption
+	size   image.Point
+	frames [][]byte // compressed image data of each frame
+	closed bool
+}
+
+// NewAPNGWriter returns a frame writer that writes an animated PNG.
+// Frames are stored losslessly as 8-bit RGBA, and the first frame is
+// also the default image for decoders that do not support animations.
+//
+// The compressed frames are kept in memory and written on Close,
+// because the animation control chunk in front of the image data holds
+// the number of frames.
+func NewAPNGWriter(w io.Writer, opts ...WriteAnimationOption) (FrameWriter, error) {
+	option, err := newAnimationOption(opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &apngWriter{w: w, option: option}, nil
+}
+
+func (a *apngWriter) WriteFrame(img *image.RGBA) error {
+	if a.closed {
+		return ErrFrameWriterClosed
+	}
+	if err := frameSize(&a.size, img); err != nil {
+		return err
+	}
+	a.frames = append(a.frames, compressPNGRows(img))
+	return nil
+}
+
+func (a *apngWriter) Close() error {
+	if a.closed {
+		return ErrFrameWriterClosed
+	}
+	a.closed = true
+	if len(a.frames) == 0 {
+		return errors.New("loader: cannot write an apng without frames")
+	}
+
+	buf := &bytes.Buffer{}
+	buf.WriteString(pngHeader)
+
+	var ihdr [13]byte
+	binary.BigEndian.PutUint32(ihdr[0:], uint32(a.size.X))
+	binary.BigEndian.PutUint32(ihdr[4:], uint32(a.size.Y))
+	ihdr[8] = 8  // bit depth
+	ihdr[9] = 6  // truecolor with alpha
+	ihdr[10] = 0 // deflate
+	ihdr[11] = 0 // adaptive filtering
+	ihdr[12] = 0 // no interlace
+	writePNGChunk(buf, "IHDR", ihdr[:])
+
+	var actl [8]byte
+	binary.BigEndian.PutUint32(actl[0:], uint32(len(a.frames)))
+	binary.BigEndian.PutUint32(actl[4:], uint32(a.option.loopCount))
+	writePNGChunk(buf, "acTL", actl[:])
+
+	// Frame control and frame data chunks share a sequence number.
+	seq := uint32(0)
+	for i, data := range a.frames {
+		var fctl [26]byte
+		binary.BigEndian.PutUint32(fctl[0:], seq)
+		binary.BigEndian.PutUint32(fctl[4:], uint32(a.size.X))
+		binary.BigEndian.PutUint32(fctl[8:], uint32(a.size.Y))
+		// The offsets are zero, the frame is shown for 1/fps seconds
+		// and replaces the previous frame.
+		binary.BigEndian.PutUint16(fctl[20:], 1)
+		binary.BigEndian.PutUint16(fctl[22:], uint16(a.option.fps))
+		writePNGChunk(buf, "fcTL", fctl[:])
+		seq++
+
+		if i == 0 {
+			writePNGChunk(buf, "IDAT", data)
+			continue
+		}
+		fdat := make([]byte, 4+len(data))
+		binary.BigEndian.PutUint32(fdat, seq)
+		copy(fdat[4:], data)
+		writePNGChunk(buf, "fdAT", fdat)
+		seq++
+	}
+	writePNGChunk(buf, "IEND", nil)
+
+	if _, err := a.w.Write(buf.Bytes()); err != nil {
+		return fmt.Errorf("loader: cannot write apng, err: %w", err)
+	}
+	return nil
+}
+
+// writePNGChunk writes a PNG chunk with its length and checksum.
+func writePNGChunk(buf *bytes.Buffer, typ string, data []byte) {
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], uint32(len(data)))
+	buf.Write(b[:])
+	crc := crc32.NewIEEE()
+	crc.Write([]byte(typ))
+	crc.Write(data)
+	buf.WriteString(typ)
+	buf.Write(data)
+	binary.BigEndian.PutUint32(b[:], crc.Sum32())
+	buf.Write(b[:])
+}
+
+// compressPNGRows filters and compresses the rows of the given image as
+// PNG image data. Each row uses the filter that minimizes the sum of
+// absolute differences, which is the heuristic of most PNG encoders.
+func compressPNGRows(img *image.RGBA) []byte {
+	const bpp = 4 // bytes per pixel
+	r := img.Bounds()
+	n := r.Dx() * bpp
+
+	buf := &bytes.Buffer{}
+	zw, _ := zlib.NewWriterLevel(buf, zlib.BestSpeed)
+	prev := make([]byte, n)
+	var filtered [5][]byte
+	for f := range filtered {
+		filtered[f] = make([]byte, n+1)
+		filtered[f][0] = byte(f)
+	}
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		i := img.PixOffset(r.Min.X, y)
+		cur := img.Pix[i : i+n : i+n]
+
+		best, bestSum := 0, -1
+		for f := range filtered {
+			out := filtered[f][1:]
+			sum := 0
+			for x := 0; x < n; x++ {
+				var a, b, c byte
+				if x >= bpp {
+					a, c = cur[x-bpp], prev[x-bpp]
+				}
+				b = prev[x]
+				switch f {
+				case 0: // none
+					out[x] = cur[x]
+				case 1: // sub
+					out[x] = cur[x] - a
+				case 2: // up
+					out[x] = cur[x] - b
+				case 3: // average
+					out[x] = cur[x] - byte((int(a)+int(b))/2)
+				case 4:
+					out[x] = cur[x] - paeth(a, b, c)
+				}
+				sum += absInt(int(int8(out[x])))
+			}
+			if bestSum < 0 || sum < bestSum {
+				best, bestSum = f, sum
+			}
+		}
+		zw.Write(filtered[best])
+		prev = cur
+	}
+	zw.Close()
+	return buf.Bytes()
+}
+
+// paeth returns the Paeth predictor of the left, above and upper left
+// bytes.
+func paeth(a, b, c byte) byte {
+	p := int(a) + int(b) - int(c)
+	pa, pb, pc := absInt(p-int(a)), absInt(p-int(b)), absInt(p-int(c))
+	if pa <= pb && pa <= pc {
+		return a
+	}
+	if pb <= pc {
+		return b
+	}
+	return c
+}
+
+func absInt(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
@@ -5,3 +5,20 @@
 package io
 
 var ParseFloat = parseFloats
+
+var ParseOBJFloat = parseOBJFloat
+
+// SetOBJChunkSize changes the chunk size of the obj parser and returns
+// a function that restores it.
+func SetOBJChunkSize(n int) func() {
+	old := objChunkSize
+	objChunkSize = n
+	return func() { objChunkSize = old }
+}
+
+var (
+	Float32ToHalf = float32ToHalf
+	HalfToFloat32 = halfToFloat32
+)
+
+var DecompressLZF = decompressLZF
@@ -0,0 +1,713 @@
+// Copyright 2021 Changkun Ou <changkun.de>. All rights reserved.
+// Use of this source code is governed by a GPLv3 license that
+// can be found in the LICENSE file.
+
+package io
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	goimage "image"
+	"io"
+
+	"poly.red/image"
+	"poly.red/math"
+)
+
+func init() {
+	goimage.RegisterFormat("exr", exrMagic, func(r io.Reader) (goimage.Image, error) {
+		img, err := LoadEXR(r)
+		if err != nil {
+			return nil, err
+		}
+		return img, nil
+	}, func(r io.Reader) (goimage.Config, error) {
+		h, err := readEXRHeader(r)
+		if err != nil {
+			return goimage.Config{}, err
+		}
+		return goimage.Config{
+			ColorModel: (&image.RGBAFloat{}).ColorModel(),
+			Width:      int(h.xmax - h.xmin + 1),
+			Height:     int(h.ymax - h.ymin + 1),
+		}, nil
+	})
+}
+
+const exrMagic = "\x76\x2f\x31\x01"
+
+// Flags of the version field of an OpenEXR file.
+const (
+	exrFlagTiled     = 0x200
+	exrFlagDeep      = 0x800
+	exrFlagMultipart = 0x1000
+)
+
+// EXRCompression is the compression method of an OpenEXR file.
+type EXRCompression uint8
+
+const (
+	EXRNone EXRCompression = iota
+	EXRRLE
+	EXRZIPS
+	EXRZIP
+	EXRPIZ
+)
+
+// lines returns the number of scanlines that are compressed together.
+func (c EXRCompression) lines() int {
+	switch c {
+	case EXRZIP:
+		return 16
+	case EXRPIZ:
+		return 32
+	default:
+		return 1
+	}
+}
+
+// exrPixelType is the data type of an OpenEXR channel.
+type exrPixelType int32
+
+const (
+	exrUint exrPixelType = iota
+	exrHalf
+	exrFloat
+)
+
+func (t exrPixelType) size() int {
+	if t == exrHalf {
+		return 2
+	}
+	return 4
+}
+
+type exrChannel struct {
+	name   string
+	typ    exrPixelType
+	linear bool
+	xs, ys int32
+}
+
+type exrHeader struct {
+	channels    []exrChannel
+	compression EXRCompression
+	// The data window, where both min and max are inclusive.
+	xmin, ymin, xmax, ymax int32
+}
+
+// LoadEXR loads a scanline OpenEXR file to a float image. Uncompressed,
+// RLE, ZIP and PIZ compressed files with half, float or uint channels
+// are supported. The R, G, B and A channels are loaded to the
+// corresponding components, and a luminance-only Y channel is loaded as
+// gray. Missing alpha is one, other channels are ignored.
+func LoadEXR(data io.Reader) (*image.RGBAFloat, error) {
+	buf, err := io.ReadAll(data)
+	if err != nil {
+		return nil, fmt.Errorf("loader: cannot read exr file, err: %w", err)
+	}
+
+	r := bytes.NewReader(buf)
+	h, err := readEXRHeader(r)
+	if err != nil {
+		return nil, err
+	}
+	width := int(h.xmax) - int(h.xmin) + 1
+	height := int(h.ymax) - int(h.ymin) + 1
+	if err := checkImageSize("exr", width, height); err != nil {
+		return nil, err
+	}
+
+	// Each channel is assigned to the components of the image.
+	var (
+		comps    = make([][]int, len(h.channels))
+		hasAlpha bool
+		found    bool
+		lineSize int
+	)
+	for i, c := range h.channels {
+		if c.xs != 1 || c.ys != 1 {
+			return nil, fmt.Errorf("loader: unsupported subsampled exr channel %s", c.name)
+		}
+		switch c.name {
+		case "R":
+			comps[i] = []int{0}
+		case "G":
+			comps[i] = []int{1}
+		case "B":
+			comps[i] = []int{2}
+		case "Y":
+			comps[i] = []int{0, 1, 2}
+		case "A":
+			comps[i] = []int{3}
+			hasAlpha = true
+		}
+		found = found || (comps[i] != nil && c.name != "A")
+		lineSize += width * c.typ.size()
+	}
+	if !found {
+		return nil, errors.New("loader: exr file does not contain color channels")
+	}
+
+	// The offset table of the blocks must fit in the file.
+	blockLines := h.compression.lines()
+	numBlocks := (height + blockLines - 1) / blockLines
+	if numBlocks > r.Len()/8 {
+		return nil, errors.New("loader: exr offset table out of range")
+	}
+	offsets := make([]uint64, numBlocks)
+	if err := binary.Read(r, binary.LittleEndian, offsets); err != nil {
+		return nil, fmt.Errorf("loader: cannot read exr offset table, err: %w", err)
+	}
+
+	img := image.NewRGBAFloat(image.Rect(0, 0, width, height))
+	if !hasAlpha {
+		for i := 3; i < len(img.Pix); i += 4 {
+			img.Pix[i] = 1
+		}
+	}
+
+	for _, off := range offsets {
+		if off > uint64(len(buf)) || uint64(len(buf))-off < 8 {
+			return nil, errors.New("loader: exr chunk offset out of range")
+		}
+		y := int32(binary.LittleEndian.Uint32(buf[off:]))
+		size := uint64(binary.LittleEndian.Uint32(buf[off+4:]))
+		if size > uint64(len(buf))-off-8 || y < h.ymin || y > h.ymax {
+			return nil, fmt.Errorf("loader: invalid exr chunk at line %d", y)
+		}
+		packed := buf[off+8 : off+8+size]
+
+		lines := blockLines
+		if rest := int(h.ymax-y) + 1; rest < lines {
+			lines = rest
+		}
+		block, err := decompressEXR(h, packed, lineSize*lines, width, lines)
+		if err != nil {
+			return nil, fmt.Errorf("loader: cannot decompress exr chunk at line %d, err: %w", y, err)
+		}
+
+		// A block consists of scanlines, where each scanline stores
+		// all values of each channel consecutively.
+		for l := 0; l < lines; l++ {
+			row := int(y-h.ymin) + l
+			for i, c := range h.channels {
+				for x := 0; x < width; x++ {
+					var v float32
+					switch c.typ {
+					case exrHalf:
+						v = halfToFloat32(binary.LittleEndian.Uint16(block))
+					case exrFloat:
+						v = math.Float32frombits(binary.LittleEndian.Uint32(block))
+					case exrUint:
+						v = float32(binary.LittleEndian.Uint32(block))
+					}
+					block = block[c.typ.size():]
+					o := img.PixOffset(x, row)
+					for _, k := range comps[i] {
+						img.Pix[o+k] = v
+					}
+				}
+			}
+		}
+	}
+	return img, nil
+}
+
+// readEXRHeader reads the magic, the version and the header attributes
+// of an OpenEXR file.
+func readEXRHeader(r io.Reader) (*exrHeader, error) {
+	var head [8]byte
+	if _, err := io.ReadFull(r, head[:]); err != nil || string(head[:4]) != exrMagic {
+		return nil, errors.New("loader: invalid exr signature")
+	}
+	version := binary.LittleEndian.Uint32(head[4:])
+	if version&0xff != 2 {
+		return nil, fmt.Errorf("loader: unsupported exr version %d", version&0xff)
+	}
+	if version&(exrFlagTiled|exrFlagDeep|exrFlagMultipart) != 0 {
+		return nil, errors.New("loader: only single-part scanline exr files are supported")
+	}
+
+	br := &exrReader{r: r}
+	h := &exrHeader{}
+	var hasChannels, hasWindow bool
+	for {
+		name := br.string()
+		if br.err != nil {
+			return nil, fmt.Errorf("loader: invalid exr header, err: %w", br.err)
+		}
+		if name == "" {
+			break
+		}
+		typ := br.string()
+		size := int(br.uint32())
+		value := br.bytes(size)
+		if br.err != nil {
+			return nil, fmt.Errorf("loader: invalid exr attribute %s, err: %w", name, br.err)
+		}
+
+		switch {
+		case name == "channels" && typ == "chlist":
+			channels, err := parseEXRChannels(value)
+			if err != nil {
+				return nil, err
+			}
+			h.channels = channels
+			hasChannels = true
+		case name == "compression" && typ == "compression" && size == 1:
+			h.compression = EXRCompression(value[0])
+			if h.compression > EXRPIZ {
+				return nil, fmt.Errorf("loader: unsupported exr compression %d", value[0])
+			}
+		case name == "dataWindow" && typ == "box2i" && size == 16:
+			h.xmin = int32(binary.LittleEndian.Uint32(value[0:]))
+			h.ymin = int32(binary.LittleEndian.Uint32(value[4:]))
+			h.xmax = int32(binary.LittleEndian.Uint32(value[8:]))
+			h.ymax = int32(binary.LittleEndian.Uint32(value[12:]))
+			hasWindow = true
+		}
+	}
+	if !hasChannels || !hasWindow {
+		return nil, errors.New("loader: exr header misses channels or data window")
+	}
+	return h, nil
+}
+
+func parseEXRChannels(value []byte) ([]exrChannel, error) {
+	var channels []exrChannel
+	for {
+		i := bytes.IndexByte(value, 0)
+		if i < 0 {
+			return nil, errors.New("loader: invalid exr channel list")
+		}
+		if i == 0 {
+			return channels, nil
+		}
+		name := string(value[:i])
+		value = value[i+1:]
+		if len(value) < 16 {
+			return nil, errors.New("loader: invalid exr channel list")
+		}
+		c := exrChannel{
+			name:   name,
+			typ:    exrPixelType(binary.LittleEndian.Uint32(value[0:])),
+			linear: value[4] != 0,
+			xs:     int32(binary.LittleEndian.Uint32(value[8:])),
+			ys:     int32(binary.LittleEndian.Uint32(value[12:])),
+		}
+		if c.typ > exrFloat {
+			return nil, fmt.Errorf("loader: unsupported exr pixel type %d", c.typ)
+		}
+		channels = append(channels, c)
+		value = value[16:]
+	}
+}
+
+// exrReader reads the null-terminated strings and values of an OpenEXR
+// header, and keeps the first error.
+type exrReader struct {
+	r   io.Reader
+	err error
+}
+
+func (r *exrReader) bytes(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n < 0 || n > 1<<24 {
+		r.err = errors.New("attribute too large")
+		return nil
+	}
+	b := make([]byte, n)
+	_, r.err = io.ReadFull(r.r, b)
+	return b
+}
+
+func (r *exrReader) uint32() uint32 {
+	b := r.bytes(4)
+	if r.err != nil {
+		return 0
+	}
+	return binary.LittleEndian.Uint32(b)
+}
+
+func (r *exrReader) string() string {
+	var s []byte
+	for r.err == nil {
+		b := r.bytes(1)
+		if r.err != nil || b[0] == 0 {
+			break
+		}
+		if len(s) >= 255 {
+			r.err = errors.New("name too long")
+			break
+		}
+		s = append(s, b[0])
+	}
+	return string(s)
+}
+
+// decompressEXR decompresses a block of the given number of lines to
+// size bytes. A block that does not become smaller by compression is
+// stored uncompressed.
+func decompressEXR(h *exrHeader, packed []byte, size, width, lines int) ([]byte, error) {
+	if len(packed) == size || h.compression == EXRNone {
+		if len(packed) != size {
+			return nil, errors.New("unexpected block size")
+		}
+		return packed, nil
+	}
+
+	switch h.compression {
+	case EXRRLE:
+		raw, err := decompressEXRRLE(packed, size)
+		if err != nil {
+			return nil, err
+		}
+		return exrUnpredict(raw), nil
+	case EXRZIPS, EXRZIP:
+		zr, err := zlib.NewReader(bytes.NewReader(packed))
+		if err != nil {
+			return nil, err
+		}
+		raw := make([]byte, size)
+		if _, err := io.ReadFull(zr, raw); err != nil {
+			return nil, err
+		}
+		return exrUnpredict(raw), nil
+	case EXRPIZ:
+		return decompressEXRPIZ(h, packed, size, width, lines)
+	}
+	return nil, fmt.Errorf("unsupported compression %d", h.compression)
+}
+
+// decompressEXRRLE decodes run-length encoded bytes, where a negative
+// count precedes a literal run, and a non-negative count n precedes a
+// byte that repeats n+1 times.
+func decompressEXRRLE(packed []byte, size int) ([]byte, error) {
+	raw := make([]byte, 0, size)
+	for len(packed) > 0 {
+		n := int(int8(packed[0]))
+		packed = packed[1:]
+		if n < 0 {
+			if -n > len(packed) || len(raw)-n > size {
+				return nil, errors.New("invalid rle literal run")
+			}
+			raw = append(raw, packed[:-n]...)
+			packed = packed[-n:]
+			continue
+		}
+		if len(packed) == 0 || len(raw)+n+1 > size {
+			return nil, errors.New("invalid rle run")
+		}
+		for i := 0; i <= n; i++ {
+			raw = append(raw, packed[0])
+		}
+		packed = packed[1:]
+	}
+	if len(raw) != size {
+		return nil, errors.New("unexpected rle size")
+	}
+	return raw, nil
+}
+
+// exrUnpredict reverses the delta predictor and the byte reordering of
+// RLE and ZIP compressed data. The encoder stores the differences of
+// consecutive bytes, where the first half of the bytes are the even
+// bytes and the second half are the odd bytes of the original data.
+func exrUnpredict(raw []byte) []byte {
+	for i := 1; i < len(raw); i++ {
+		raw[i] = raw[i-1] + raw[i] - 128
+	}
+	out := make([]byte, len(raw))
+	half := (len(raw) + 1) / 2
+	for i := range out {
+		if i%2 == 0 {
+			out[i] = raw[i/2]
+		} else {
+			out[i] = raw[half+i/2]
+		}
+	}
+	return out
+}
+
+// halfToFloat32 converts an IEEE 754 half precision value to float32.
+func halfToFloat32(h uint16) float32 {
+	sign := uint32(h>>15) << 31
+	exp := uint32(h>>10) & 0x1f
+	mant := uint32(h) & 0x3ff
+
+	switch {
+	case exp == 0 && mant == 0:
+		return math.Float32frombits(sign)
+	case exp == 0:
+		// Subnormal values are normalized.
+		e := uint32(127 - 15 + 1)
+		for mant&0x400 == 0 {
+			mant <<= 1
+			e--
+		}
+		mant &= 0x3ff
+		return math.Float32frombits(sign | e<<23 | mant<<13)
+	case exp == 0x1f:
+		return math.Float32frombits(sign | 0xff<<23 | mant<<13)
+	default:
+		return math.Float32frombits(sign | (exp+127-15)<<23 | mant<<13)
+	}
+}
+
+// float32ToHalf converts a float32 value to IEEE 754 half precision,
+// rounding to the nearest even value. Values out of range become
+// infinity.
+func float32ToHalf(f float32) uint16 {
+	bits := math.Float32bits(f)
+	sign := uint16(bits>>16) & 0x8000
+	exp := int(bits>>23) & 0xff
+	mant := bits & 0x7fffff
+
+	switch {
+	case exp == 0xff:
+		// Infinity stays infinity, NaN stays NaN.
+		if mant != 0 {
+			return sign | 0x7e00
+		}
+		return sign | 0x7c00
+	case exp-127 > 15:
+		return sign | 0x7c00
+	case exp-127 < -25:
+		return sign
+	case exp-127 < -14:
+		// Subnormal values keep fewer mantissa bits.
+		mant |= 0x800000
+		shift := uint(-(exp - 127) - 14 + 13)
+		half := mant >> shift
+		rest := mant & (1<<shift - 1)
+		if rest > 1<<(shift-1) || (rest == 1<<(shift-1) && half&1 != 0) {
+			half++
+		}
+		return sign | uint16(half)
+	}
+
+	half := uint32(exp-127+15)<<10 | mant>>13
+	rest := mant & 0x1fff
+	if rest > 0x1000 || (rest == 0x1000 && half&1 != 0) {
+		half++ // may carry into the exponent, which rounds up correctly
+	}
+	return sign | uint16(half)
+}
+
+// EXROption offers custom configurations for saving an OpenEXR file.
+type EXROption struct {
+	compression EXRCompression
+	half        bool
+}
+
+type WriteEXROption func(o *EXROption)
+
+// WithEXRCompression sets the compression method of the saved file. The
+// default is ZIP compression.
+func WithEXRCompression(c EXRCompression) WriteEXROption {
+	return func(o *EXROption) {
+		o.compression = c
+	}
+}
+
+// WithEXRHalf saves the values as half precision floats, which halves
+// the file size but loses precision. Values are saved as 32-bit floats
+// by default.
+func WithEXRHalf(enable bool) WriteEXROption {
+	return func(o *EXROption) {
+		o.half = enable
+	}
+}
+
+// SaveEXR writes the given image to a scanline OpenEXR file with R, G,
+// B and A channels.
+func SaveEXR(w io.Writer, img *image.RGBAFloat, opts ...WriteEXROption) error {
+	option := &EXROption{
+		compression: EXRZIP,
+		half:        false,
+	}
+	for _, opt := range opts {
+		opt(option)
+	}
+	if option.compression > EXRPIZ {
+		return fmt.Errorf("loader: unsupported exr compression %d", option.compression)
+	}
+
+	width, height := img.Bounds().Dx(), img.Bounds().Dy()
+	if width <= 0 || height <= 0 {
+		return errors.New("loader: cannot save an empty image")
+	}
+	typ := exrFloat
+	if option.half {
+		typ = exrHalf
+	}
+	// Channels are sorted by name, and each channel refers to the
+	// component of the image.
+	h := &exrHeader{
+		channels: []exrChannel{
+			{name: "A", typ: typ, xs: 1, ys: 1},
+			{name: "B", typ: typ, xs: 1, ys: 1},
+			{name: "G", typ: typ, xs: 1, ys: 1},
+			{name: "R", typ: typ, xs: 1, ys: 1},
+		},
+		compression: option.compression,
+		xmax:        int32(width - 1),
+		ymax:        int32(height - 1),
+	}
+	comps := []int{3, 2, 1, 0}
+
+	buf := &bytes.Buffer{}
+	le := binary.LittleEndian
+	buf.WriteString(exrMagic)
+	binary.Write(buf, le, uint32(2))
+	attr := func(name, typ string, value interface{}) {
+		v := &bytes.Buffer{}
+		binary.Write(v, le, value)
+		buf.WriteString(name)
+		buf.WriteByte(0)
+		buf.WriteString(typ)
+		buf.WriteByte(0)
+		binary.Write(buf, le, uint32(v.Len()))
+		buf.Write(v.Bytes())
+	}
+	chlist := &bytes.Buffer{}
+	for _, c := range h.channels {
+		chlist.WriteString(c.name)
+		chlist.WriteByte(0)
+		binary.Write(chlist, le, []int32{int32(c.typ), 0, c.xs, c.ys})
+	}
+	chlist.WriteByte(0)
+	attr("channels", "chlist", chlist.Bytes())
+	attr("compression", "compression", uint8(h.compression))
+	attr("dataWindow", "box2i", []int32{0, 0, h.xmax, h.ymax})
+	attr("displayWindow", "box2i", []int32{0, 0, h.xmax, h.ymax})
+	attr("lineOrder", "lineOrder", uint8(0)) // increasing y
+	attr("pixelAspectRatio", "float", float32(1))
+	attr("screenWindowCenter", "v2f", []float32{0, 0})
+	attr("screenWindowWidth", "float", float32(1))
+	buf.WriteByte(0)
+
+	blockLines := h.compression.lines()
+	numBlocks := (height + blockLines - 1) / blockLines
+	offsets := make([]uint64, numBlocks)
+	chunks := make([][]byte, numBlocks)
+	offset := uint64(buf.Len() + 8*numBlocks)
+	for i := range chunks {
+		y := i * blockLines
+		lines := blockLines
+		if y+lines > height {
+			lines = height - y
+		}
+
+		raw := make([]byte, 0, lines*width*len(h.channels)*typ.size())
+		for l := y; l < y+lines; l++ {
+			for _, k := range comps {
+				for x := 0; x < width; x++ {
+					v := img.Pix[img.PixOffset(img.Rect.Min.X+x, img.Rect.Min.Y+l)+k]
+					var b [4]byte
+					if option.half {
+						le.PutUint16(b[:], float32ToHalf(v))
+						raw = append(raw, b[:2]...)
+					} else {
+						le.PutUint32(b[:], math.Float32bits(v))
+						raw = append(raw, b[:]...)
+					}
+				}
+			}
+		}
+
+		data := compressEXR(h, raw, width, lines)
+		chunk := make([]byte, 8, 8+len(data))
+		le.PutUint32(chunk[0:], uint32(y))
+		le.PutUint32(chunk[4:], uint32(len(data)))
+		chunks[i] = append(chunk, data...)
+		offsets[i] = offset
+		offset += uint64(len(chunks[i]))
+	}
+	binary.Write(buf, le, offsets)
+	for _, c := range chunks {
+		buf.Write(c)
+	}
+
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		return fmt.Errorf("loader: cannot write exr file, err: %w", err)
+	}
+	return nil
+}
+
+// compressEXR compresses a block of the given number of lines, and
+// stores the block uncompressed if compression does not reduce its size.
+func compressEXR(h *exrHeader, raw []byte, width, lines int) []byte {
+	var packed []byte
+	switch h.compression {
+	case EXRNone:
+		return raw
+	case EXRRLE:
+		packed = compressEXRRLE(exrPredict(raw))
+	case EXRZIPS, EXRZIP:
+		buf := &bytes.Buffer{}
+		zw := zlib.NewWriter(buf)
+		zw.Write(exrPredict(raw))
+		zw.Close()
+		packed = buf.Bytes()
+	case EXRPIZ:
+		packed = compressEXRPIZ(h, raw, width, lines)
+	}
+	if len(packed) >= len(raw) {
+		return raw
+	}
+	return packed
+}
+
+// exrPredict reorders and delta encodes the given bytes, see
+// exrUnpredict.
+func exrPredict(raw []byte) []byte {
+	out := make([]byte, 0, len(raw))
+	for i := 0; i < len(raw); i += 2 {
+		out = append(out, raw[i])
+	}
+	for i := 1; i < len(raw); i += 2 {
+		out = append(out, raw[i])
+	}
+	for i := len(out) - 1; i > 0; i-- {
+		out[i] = out[i] - out[i-1] + 128
+	}
+	return out
+}
+
+// compressEXRRLE run-length encodes the given bytes, see
+// decompressEXRRLE.
+func compressEXRRLE(raw []byte) []byte {
+	const (
+		minRun = 3
+		maxRun = 127
+	)
+	var out []byte
+	for start := 0; start < len(raw); {
+		end := start + 1
+		for end < len(raw) && raw[end] == raw[start] && end-start-1 < maxRun {
+			end++
+		}
+		if end-start >= minRun {
+			out = append(out, byte(end-start-1), raw[start])
+			start = end
+			continue
+		}
+
+		// A literal run ends before three repeated bytes.
+		for end < len(raw) && end-start < maxRun &&
+			(end+2 >= len(raw) || raw[end] != raw[end+1] || raw[end+1] != raw[end+2]) {
+			end++
+		}
+		out = append(out, byte(int8(start-end)))
+		out = append(out, raw[start:end]...)
+		start = end
+	}
+	return out
+}
@@ -0,0 +1,799 @@
+// Copyright 2021 Changkun Ou <changkun.de>. All rights reserved.
+// Use of this source code is governed by a GPLv3 license that
+// can be found in the LICENSE file.
+
+package io
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// decompressEXRPIZ decodes PIZ compressed data. The values of each
+// channel are remapped through a lookup table to a dense range, Haar
+// wavelet transformed and Huffman encoded.
+func decompressEXRPIZ(h *exrHeader, packed []byte, size, width, lines int) ([]byte, error) {
+	if len(packed) < 4 {
+		return nil, errors.New("truncated piz data")
+	}
+	minNonZero := int(binary.LittleEndian.Uint16(packed[0:]))
+	maxNonZero := int(binary.LittleEndian.Uint16(packed[2:]))
+	packed = packed[4:]
+	if maxNonZero >= pizBitmapSize {
+		return nil, errors.New("invalid piz bitmap")
+	}
+	bitmap := make([]byte, pizBitmapSize)
+	if minNonZero <= maxNonZero {
+		n := maxNonZero - minNonZero + 1
+		if n > len(packed) {
+			return nil, errors.New("truncated piz bitmap")
+		}
+		copy(bitmap[minNonZero:], packed[:n])
+		packed = packed[n:]
+	}
+	lut, maxValue := pizReverseLUT(bitmap)
+
+	if len(packed) < 4 {
+		return nil, errors.New("truncated piz data")
+	}
+	length := int(binary.LittleEndian.Uint32(packed))
+	packed = packed[4:]
+	if length < 0 || length > len(packed) {
+		return nil, errors.New("truncated piz data")
+	}
+
+	tmp := make([]uint16, size/2)
+	if err := hufUncompress(packed[:length], tmp); err != nil {
+		return nil, err
+	}
+
+	// Values of each channel are stored consecutively, where 32-bit
+	// values are treated as two interleaved 16-bit values.
+	starts := make([]int, len(h.channels))
+	start := 0
+	for i, c := range h.channels {
+		n := c.typ.size() / 2
+		starts[i] = start
+		for j := 0; j < n; j++ {
+			wav2Decode(tmp, start+j, width, n, lines, width*n, maxValue)
+		}
+		start += width * lines * n
+	}
+	for i, v := range tmp {
+		tmp[i] = lut[v]
+	}
+
+	out := make([]byte, 0, size)
+	for y := 0; y < lines; y++ {
+		for i, c := range h.channels {
+			n := width * c.typ.size() / 2
+			for _, v := range tmp[starts[i]+y*n : starts[i]+(y+1)*n] {
+				out = append(out, byte(v), byte(v>>8))
+			}
+		}
+	}
+	return out, nil
+}
+
+const pizBitmapSize = 1 << 16 >> 3
+
+// pizReverseLUT builds a table that maps the dense values to the values
+// marked in the given bitmap, and returns the largest dense value.
+func pizReverseLUT(bitmap []byte) ([]uint16, uint16) {
+	lut := make([]uint16, 1<<16)
+	k := 0
+	for i := 0; i < 1<<16; i++ {
+		if i == 0 || bitmap[i>>3]&(1<<(i&7)) != 0 {
+			lut[k] = uint16(i)
+			k++
+		}
+	}
+	return lut, uint16(k - 1)
+}
+
+// wav2Decode reverses the 2D Haar wavelet transform of nx*ny values that
+// start at buf[start], where ox and oy are the offsets between
+// horizontally and vertically adjacent values. Values of at most 14 bits
+// are transformed without modulo arithmetic.
+func wav2Decode(buf []uint16, start, nx, ox, ny, oy int, mx uint16) {
+	dec := wdec16
+	if mx < 1<<14 {
+		dec = wdec14
+	}
+
+	n := nx
+	if ny < n {
+		n = ny
+	}
+	p := 1
+	for p <= n {
+		p <<= 1
+	}
+	p >>= 1
+	p2 := p
+	p >>= 1
+
+	for p >= 1 {
+		py := start
+		ey := start + oy*(ny-p2)
+		oy1, oy2 := oy*p, oy*p2
+		ox1, ox2 := ox*p, ox*p2
+
+		for ; py <= ey; py += oy2 {
+			px := py
+			ex := py + ox*(nx-p2)
+			for ; px <= ex; px += ox2 {
+				p01 := px + ox1
+				p10 := px + oy1
+				p11 := p10 + ox1
+				i00, i10 := dec(buf[px], buf[p10])
+				i01, i11 := dec(buf[p01], buf[p11])
+				buf[px], buf[p01] = dec(i00, i01)
+				buf[p10], buf[p11] = dec(i10, i11)
+			}
+			if nx&p != 0 {
+				p10 := px + oy1
+				buf[px], buf[p10] = dec(buf[px], buf[p10])
+			}
+		}
+		if ny&p != 0 {
+			px := py
+			ex := py + ox*(nx-p2)
+			for ; px <= ex; px += ox2 {
+				p01 := px + ox1
+				buf[px], buf[p01] = dec(buf[px], buf[p01])
+			}
+		}
+		p2 = p
+		p >>= 1
+	}
+}
+
+// wdec14 decodes a low and a high wavelet coefficient of 14-bit values.
+func wdec14(l, h uint16) (a, b uint16) {
+	hi := int(int16(h))
+	ai := int(int16(l)) + (hi & 1) + (hi >> 1)
+	return uint16(int16(ai)), uint16(int16(ai - hi))
+}
+
+// wdec16 decodes a low and a high wavelet coefficient of 16-bit values
+// using modulo arithmetic.
+func wdec16(l, h uint16) (a, b uint16) {
+	const (
+		modMask = 1<<16 - 1
+		aOffset = 1 << 15
+	)
+	m, d := int(l), int(h)
+	bb := (m - (d >> 1)) & modMask
+	aa := (d + bb - aOffset) & modMask
+	return uint16(aa), uint16(bb)
+}
+
+// Parameters of the Huffman coding of PIZ compressed data.
+const (
+	hufEncBits       = 16
+	hufDecBits       = 14
+	hufEncSize       = 1<<hufEncBits + 1
+	hufDecSize       = 1 << hufDecBits
+	hufDecMask       = hufDecSize - 1
+	shortZeroCodeRun = 59
+	longZeroCodeRun  = 63
+	shortestLongRun  = 2 + longZeroCodeRun - shortZeroCodeRun
+)
+
+// hufDec is an entry of the Huffman decoding table. Codes of at most
+// hufDecBits bits are decoded by a single lookup, longer codes that
+// share the same prefix are listed in p.
+type hufDec struct {
+	len int
+	lit int
+	p   []int
+}
+
+// hufBitReader reads bits from the most significant bit of each byte.
+type hufBitReader struct {
+	data []byte
+	pos  int
+	c    uint64
+	lc   int
+}
+
+func (r *hufBitReader) bits(n int) (uint64, error) {
+	for r.lc < n {
+		if r.pos >= len(r.data) {
+			return 0, io.ErrUnexpectedEOF
+		}
+		r.c = r.c<<8 | uint64(r.data[r.pos])
+		r.pos++
+		r.lc += 8
+	}
+	r.lc -= n
+	return (r.c >> r.lc) & (1<<n - 1), nil
+}
+
+// hufUncompress decodes Huffman encoded data to out. The data begins
+// with the range of encoded symbols, the length of the encoded bits and
+// the code length table.
+func hufUncompress(data []byte, out []uint16) error {
+	if len(out) == 0 {
+		return nil
+	}
+	if len(data) < 20 {
+		return errors.New("truncated huffman data")
+	}
+	im := int(binary.LittleEndian.Uint32(data[0:]))
+	iM := int(binary.LittleEndian.Uint32(data[4:]))
+	nBits := int(binary.LittleEndian.Uint32(data[12:]))
+	if im < 0 || im >= hufEncSize || iM < 0 || iM >= hufEncSize || im > iM {
+		return errors.New("invalid huffman table size")
+	}
+
+	hcode := make([]uint64, hufEncSize)
+	n, err := hufUnpackEncTable(data[20:], im, iM, hcode)
+	if err != nil {
+		return err
+	}
+	data = data[20+n:]
+	if nBits < 0 || nBits > 8*len(data) {
+		return errors.New("truncated huffman data")
+	}
+
+	hdec := make([]hufDec, hufDecSize)
+	if err := hufBuildDecTable(hcode, im, iM, hdec); err != nil {
+		return err
+	}
+	return hufDecode(hcode, hdec, data, nBits, iM, out)
+}
+
+// hufUnpackEncTable reads the code lengths of the symbols in [im, iM],
+// assigns canonical codes to hcode, and returns the number of bytes
+// read. Each entry of hcode is the code shifted by 6 bits or-ed with
+// the code length.
+func hufUnpackEncTable(data []byte, im, iM int, hcode []uint64) (int, error) {
+	r := &hufBitReader{data: data}
+	for ; im <= iM; im++ {
+		l, err := r.bits(6)
+		if err != nil {
+			return 0, err
+		}
+		hcode[im] = l
+
+		zerun := 0
+		if l == longZeroCodeRun {
+			n, err := r.bits(8)
+			if err != nil {
+				return 0, err
+			}
+			zerun = int(n) + shortestLongRun
+		} else if l >= shortZeroCodeRun {
+			zerun = int(l) - shortZeroCodeRun + 2
+		} else {
+			continue
+		}
+		if im+zerun > iM+1 {
+			return 0, errors.New("invalid huffman table")
+		}
+		for ; zerun > 0; zerun-- {
+			hcode[im] = 0
+			im++
+		}
+		im--
+	}
+	hufCanonicalCodeTable(hcode)
+	return r.pos, nil
+}
+
+// hufCanonicalCodeTable replaces the code lengths of hcode by canonical
+// codes, where longer codes have smaller values.
+func hufCanonicalCodeTable(hcode []uint64) {
+	var n [59]uint64
+	for _, l := range hcode {
+		n[l]++
+	}
+	c := uint64(0)
+	for i := 58; i > 0; i-- {
+		nc := (c + n[i]) >> 1
+		n[i] = c
+		c = nc
+	}
+	for i, l := range hcode {
+		if l > 0 {
+			hcode[i] = l | n[l]<<6
+			n[l]++
+		}
+	}
+}
+
+func hufBuildDecTable(hcode []uint64, im, iM int, hdec []hufDec) error {
+	for ; im <= iM; im++ {
+		c := hcode[im] >> 6
+		l := int(hcode[im] & 63)
+		if c>>l != 0 {
+			return errors.New("invalid huffman code")
+		}
+		if l > hufDecBits {
+			pl := &hdec[c>>(l-hufDecBits)]
+			if pl.len != 0 {
+				return errors.New("invalid huffman code")
+			}
+			pl.p = append(pl.p, im)
+		} else if l != 0 {
+			base := c << (hufDecBits - l)
+			for i := uint64(0); i < 1<<(hufDecBits-l); i++ {
+				pl := &hdec[base+i]
+				if pl.len != 0 || pl.p != nil {
+					return errors.New("invalid huffman code")
+				}
+				pl.len = l
+				pl.lit = im
+			}
+		}
+	}
+	return nil
+}
+
+// hufDecode decodes nBits bits of data to out, where the symbol rlc is
+// followed by an 8-bit count that repeats the previous symbol.
+func hufDecode(hcode []uint64, hdec []hufDec, data []byte, nBits, rlc int, out []uint16) error {
+	var (
+		c  uint64
+		lc int
+		in int
+		o  int
+		ie = (nBits + 7) / 8
+	)
+	emit := func(sym int) error {
+		if sym != rlc {
+			if o >= len(out) {
+				return errors.New("huffman data overrun")
+			}
+			out[o] = uint16(sym)
+			o++
+			return nil
+		}
+		if lc < 8 {
+			if in >= len(data) {
+				return errors.New("truncated huffman data")
+			}
+			c = c<<8 | uint64(data[in])
+			in++
+			lc += 8
+		}
+		lc -= 8
+		n := int((c >> lc) & 0xff)
+		if o+n > len(out) || o < 1 {
+			return errors.New("invalid huffman run")
+		}
+		for s := out[o-1]; n > 0; n-- {
+			out[o] = s
+			o++
+		}
+		return nil
+	}
+
+	for in < ie {
+		c = c<<8 | uint64(data[in])
+		in++
+		lc += 8
+		for lc >= hufDecBits {
+			pl := &hdec[(c>>(lc-hufDecBits))&hufDecMask]
+			if pl.len != 0 {
+				lc -= pl.len
+				if err := emit(pl.lit); err != nil {
+					return err
+				}
+				continue
+			}
+			if pl.p == nil {
+				return errors.New("invalid huffman code")
+			}
+
+			// Long codes share the prefix of the table entry.
+			j := 0
+			for ; j < len(pl.p); j++ {
+				l := int(hcode[pl.p[j]] & 63)
+				for lc < l && in < ie {
+					c = c<<8 | uint64(data[in])
+					in++
+					lc += 8
+				}
+				if lc >= l && hcode[pl.p[j]]>>6 == (c>>(lc-l))&(1<<l-1) {
+					lc -= l
+					if err := emit(pl.p[j]); err != nil {
+						return err
+					}
+					break
+				}
+			}
+			if j == len(pl.p) {
+				return errors.New("invalid huffman code")
+			}
+		}
+	}
+
+	// The remaining bits of the last byte.
+	i := (8 - nBits) & 7
+	c >>= i
+	lc -= i
+	for lc > 0 {
+		pl := &hdec[(c<<(hufDecBits-lc))&hufDecMask]
+		if pl.len == 0 || pl.len > lc {
+			return errors.New("invalid huffman code")
+		}
+		lc -= pl.len
+		if err := emit(pl.lit); err != nil {
+			return err
+		}
+	}
+	if o != len(out) {
+		return errors.New("huffman data underrun")
+	}
+	return nil
+}
+
+// compressEXRPIZ encodes a block of line interleaved channel values
+// using PIZ compression, see decompressEXRPIZ.
+func compressEXRPIZ(h *exrHeader, raw []byte, width, lines int) []byte {
+	// Values of each channel are gathered consecutively.
+	tmp := make([]uint16, 0, len(raw)/2)
+	for i, c := range h.channels {
+		n := width * c.typ.size()
+		stride := 0
+		offset := 0
+		for j, cc := range h.channels {
+			if j < i {
+				offset += width * cc.typ.size()
+			}
+			stride += width * cc.typ.size()
+		}
+		for y := 0; y < lines; y++ {
+			line := raw[y*stride+offset : y*stride+offset+n]
+			for k := 0; k < n; k += 2 {
+				tmp = append(tmp, binary.LittleEndian.Uint16(line[k:]))
+			}
+		}
+	}
+
+	bitmap := make([]byte, pizBitmapSize)
+	for _, v := range tmp {
+		bitmap[v>>3] |= 1 << (v & 7)
+	}
+	bitmap[0] &^= 1 // zero is always mapped
+	minNonZero, maxNonZero := pizBitmapSize-1, 0
+	for i, b := range bitmap {
+		if b != 0 {
+			if i < minNonZero {
+				minNonZero = i
+			}
+			if i > maxNonZero {
+				maxNonZero = i
+			}
+		}
+	}
+	lut, maxValue := pizForwardLUT(bitmap)
+	for i, v := range tmp {
+		tmp[i] = lut[v]
+	}
+
+	start := 0
+	for _, c := range h.channels {
+		n := c.typ.size() / 2
+		for j := 0; j < n; j++ {
+			wav2Encode(tmp, start+j, width, n, lines, width*n, maxValue)
+		}
+		start += width * lines * n
+	}
+
+	out := make([]byte, 4, len(raw))
+	binary.LittleEndian.PutUint16(out[0:], uint16(minNonZero))
+	binary.LittleEndian.PutUint16(out[2:], uint16(maxNonZero))
+	if minNonZero <= maxNonZero {
+		out = append(out, bitmap[minNonZero:maxNonZero+1]...)
+	}
+	huf := hufCompress(tmp)
+	var length [4]byte
+	binary.LittleEndian.PutUint32(length[:], uint32(len(huf)))
+	out = append(out, length[:]...)
+	return append(out, huf...)
+}
+
+// pizForwardLUT builds a table that maps the values marked in the given
+// bitmap to a dense range, and returns the largest dense value.
+func pizForwardLUT(bitmap []byte) ([]uint16, uint16) {
+	lut := make([]uint16, 1<<16)
+	k := 0
+	for i := 0; i < 1<<16; i++ {
+		if i == 0 || bitmap[i>>3]&(1<<(i&7)) != 0 {
+			lut[i] = uint16(k)
+			k++
+		}
+	}
+	return lut, uint16(k - 1)
+}
+
+// wav2Encode applies the 2D Haar wavelet transform that is reversed by
+// wav2Decode.
+func wav2Encode(buf []uint16, start, nx, ox, ny, oy int, mx uint16) {
+	enc := wenc16
+	if mx < 1<<14 {
+		enc = wenc14
+	}
+
+	n := nx
+	if ny < n {
+		n = ny
+	}
+	p, p2 := 1, 2
+	for p2 <= n {
+		py := start
+		ey := start + oy*(ny-p2)
+		oy1, oy2 := oy*p, oy*p2
+		ox1, ox2 := ox*p, ox*p2
+
+		for ; py <= ey; py += oy2 {
+			px := py
+			ex := py + ox*(nx-p2)
+			for ; px <= ex; px += ox2 {
+				p01 := px + ox1
+				p10 := px + oy1
+				p11 := p10 + ox1
+				i00, i01 := enc(buf[px], buf[p01])
+				i10, i11 := enc(buf[p10], buf[p11])
+				buf[px], buf[p10] = enc(i00, i10)
+				buf[p01], buf[p11] = enc(i01, i11)
+			}
+			if nx&p != 0 {
+				p10 := px + oy1
+				buf[px], buf[p10] = enc(buf[px], buf[p10])
+			}
+		}
+		if ny&p != 0 {
+			px := py
+			ex := py + ox*(nx-p2)
+			for ; px <= ex; px += ox2 {
+				p01 := px + ox1
+				buf[px], buf[p01] = enc(buf[px], buf[p01])
+			}
+		}
+		p = p2
+		p2 <<= 1
+	}
+}
+
+// wenc14 encodes two 14-bit values to a low and a high wavelet
+// coefficient.
+func wenc14(a, b uint16) (l, h uint16) {
+	as, bs := int(int16(a)), int(int16(b))
+	return uint16(int16((as + bs) >> 1)), uint16(int16(as - bs))
+}
+
+// wenc16 encodes two 16-bit values to a low and a high wavelet
+// coefficient using modulo arithmetic.
+func wenc16(a, b uint16) (l, h uint16) {
+	const (
+		modMask = 1<<16 - 1
+		aOffset = 1 << 15
+		mOffset = 1 << 15
+	)
+	ao := (int(a) + aOffset) & modMask
+	m := (ao + int(b)) >> 1
+	d := ao - int(b)
+	if d < 0 {
+		m = (m + mOffset) & modMask
+	}
+	d &= modMask
+	return uint16(m), uint16(d)
+}
+
+const longestLongRun = 255 + shortestLongRun
+
+// hufBitWriter writes bits from the most significant bit of each byte.
+type hufBitWriter struct {
+	out []byte
+	c   uint64
+	lc  int
+}
+
+func (w *hufBitWriter) bits(n int, bits uint64) {
+	w.c = w.c<<n | bits
+	w.lc += n
+	for w.lc >= 8 {
+		w.lc -= 8
+		w.out = append(w.out, byte(w.c>>w.lc))
+	}
+}
+
+func (w *hufBitWriter) code(code uint64) {
+	w.bits(int(code&63), code>>6)
+}
+
+// flush writes the remaining bits, and returns the number of bits.
+func (w *hufBitWriter) flush() int {
+	n := 8*len(w.out) + w.lc
+	if w.lc > 0 {
+		w.out = append(w.out, byte(w.c<<(8-w.lc)))
+	}
+	return n
+}
+
+// hufCompress encodes the given values using Huffman coding, see
+// hufUncompress.
+func hufCompress(raw []uint16) []byte {
+	if len(raw) == 0 {
+		return nil
+	}
+
+	hcode := make([]uint64, hufEncSize)
+	for _, v := range raw {
+		hcode[v]++
+	}
+	im, iM := hufBuildEncTable(hcode)
+
+	table := &hufBitWriter{}
+	hufPackEncTable(hcode, im, iM, table)
+	table.flush()
+
+	// Runs of the same value are encoded by the symbol iM.
+	data := &hufBitWriter{}
+	send := func(s uint16, n int) {
+		sc, rc := hcode[s], hcode[iM]
+		if int(sc&63)+int(rc&63)+8 < int(sc&63)*n {
+			data.code(sc)
+			data.code(rc)
+			data.bits(8, uint64(n))
+			return
+		}
+		for ; n >= 0; n-- {
+			data.code(sc)
+		}
+	}
+	s, n := raw[0], 0
+	for _, v := range raw[1:] {
+		if v == s && n < 255 {
+			n++
+			continue
+		}
+		send(s, n)
+		s, n = v, 0
+	}
+	send(s, n)
+	nBits := data.flush()
+
+	out := make([]byte, 20, 20+len(table.out)+len(data.out))
+	binary.LittleEndian.PutUint32(out[0:], uint32(im))
+	binary.LittleEndian.PutUint32(out[4:], uint32(iM))
+	binary.LittleEndian.PutUint32(out[8:], uint32(len(table.out)))
+	binary.LittleEndian.PutUint32(out[12:], uint32(nBits))
+	out = append(out, table.out...)
+	return append(out, data.out...)
+}
+
+// hufBuildEncTable replaces the frequencies of hcode by canonical codes
+// of a Huffman tree, and returns the range of the encoded symbols. The
+// symbol after the largest value is added for run-length encoding.
+func hufBuildEncTable(hcode []uint64) (im, iM int) {
+	for hcode[im] == 0 {
+		im++
+	}
+	var (
+		link = make([]int, hufEncSize)
+		heap = &hufHeap{freq: hcode}
+	)
+	for i := im; i < hufEncSize; i++ {
+		link[i] = i
+		if hcode[i] != 0 {
+			heap.syms = append(heap.syms, i)
+			iM = i
+		}
+	}
+	iM++
+	hcode[iM] = 1
+	heap.syms = append(heap.syms, iM)
+	heap.init()
+
+	// Merge the two least frequent subtrees, where the code length
+	// of each symbol in the subtrees grows by one.
+	length := make([]uint64, hufEncSize)
+	for len(heap.syms) > 1 {
+		mm := heap.pop()
+		m := heap.pop()
+		hcode[m] += hcode[mm]
+		heap.push(m)
+
+		for j := m; ; j = link[j] {
+			length[j]++
+			if link[j] == j {
+				link[j] = mm
+				break
+			}
+		}
+		for j := mm; ; j = link[j] {
+			length[j]++
+			if link[j] == j {
+				break
+			}
+		}
+	}
+	hufCanonicalCodeTable(length)
+	copy(hcode, length)
+	return im, iM
+}
+
+// hufHeap is a min-heap of symbols ordered by their frequencies.
+type hufHeap struct {
+	freq []uint64
+	syms []int
+}
+
+func (h *hufHeap) less(i, j int) bool { return h.freq[h.syms[i]] < h.freq[h.syms[j]] }
+
+func (h *hufHeap) init() {
+	for i := len(h.syms)/2 - 1; i >= 0; i-- {
+		h.down(i)
+	}
+}
+
+func (h *hufHeap) push(s int) {
+	h.syms = append(h.syms, s)
+	for i := len(h.syms) - 1; i > 0; {
+		p := (i - 1) / 2
+		if !h.less(i, p) {
+			break
+		}
+		h.syms[i], h.syms[p] = h.syms[p], h.syms[i]
+		i = p
+	}
+}
+
+func (h *hufHeap) pop() int {
+	s := h.syms[0]
+	n := len(h.syms) - 1
+	h.syms[0] = h.syms[n]
+	h.syms = h.syms[:n]
+	h.down(0)
+	return s
+}
+
+func (h *hufHeap) down(i int) {
+	for {
+		l := 2*i + 1
+		if l >= len(h.syms) {
+			return
+		}
+		j := l
+		if r := l + 1; r < len(h.syms) && h.less(r, l) {
+			j = r
+		}
+		if !h.less(j, i) {
+			return
+		}
+		h.syms[i], h.syms[j] = h.syms[j], h.syms[i]
+		i = j
+	}
+}
+
+// hufPackEncTable writes the code lengths of the symbols in [im, iM],
+// where runs of unused symbols are encoded compactly.
+func hufPackEncTable(hcode []uint64, im, iM int, w *hufBitWriter) {
+	for ; im <= iM; im++ {
+		l := hcode[im] & 63
+		if l == 0 {
+			zerun := 1
+			for im < iM && zerun < longestLongRun && hcode[im+1]&63 == 0 {
+				im++
+				zerun++
+			}
+			if zerun >= 2 {
+				if zerun >= shortestLongRun {
+					w.bits(6, longZeroCodeRun)
+					w.bits(8, uint64(zerun-shortestLongRun))
+				} else {
+					w.bits(6, uint64(shortZeroCodeRun+zerun-2))
+				}
+				continue
+			}
+		}
+		w.bits(6, l)
+	}
+}
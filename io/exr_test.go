@@ -0,0 +1,266 @@
+// Copyright 2021 Changkun Ou <changkun.de>. All rights reserved.
+// Use of this source code is governed by a GPLv3 license that
+// can be found in the LICENSE file.
+
+package io_test
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"image"
+	"math"
+	"math/rand"
+	"testing"
+
+	pimage "poly.red/image"
+	"poly.red/io"
+)
+
+// exrChannel is a channel of a test .exr file, where typ is 1 for half
+// and 2 for float values.
+type exrChannel struct {
+	name   string
+	typ    int32
+	values []uint32 // bits of each pixel in scanline order
+}
+
+// encodeEXR encodes a scanline .exr file with the given compression,
+// where 0 is none and 2 is zip with one scanline per block.
+func encodeEXR(t *testing.T, w, h int, compression byte, channels ...exrChannel) []byte {
+	le := binary.LittleEndian
+	buf := &bytes.Buffer{}
+	buf.WriteString("\x76\x2f\x31\x01")
+	binary.Write(buf, le, uint32(2))
+
+	attr := func(name, typ string, value []byte) {
+		buf.WriteString(name + "\x00" + typ + "\x00")
+		binary.Write(buf, le, uint32(len(value)))
+		buf.Write(value)
+	}
+	chlist := &bytes.Buffer{}
+	for _, c := range channels {
+		chlist.WriteString(c.name + "\x00")
+		binary.Write(chlist, le, []int32{c.typ, 0, 1, 1})
+	}
+	chlist.WriteByte(0)
+	attr("channels", "chlist", chlist.Bytes())
+	attr("compression", "compression", []byte{compression})
+	box := &bytes.Buffer{}
+	binary.Write(box, le, []int32{0, 0, int32(w - 1), int32(h - 1)})
+	attr("dataWindow", "box2i", box.Bytes())
+	attr("displayWindow", "box2i", box.Bytes())
+	attr("lineOrder", "lineOrder", []byte{0})
+	buf.WriteByte(0)
+
+	var blocks [][]byte
+	for y := 0; y < h; y++ {
+		line := &bytes.Buffer{}
+		for _, c := range channels {
+			for x := 0; x < w; x++ {
+				v := c.values[y*w+x]
+				if c.typ == 1 {
+					binary.Write(line, le, uint16(v))
+				} else {
+					binary.Write(line, le, v)
+				}
+			}
+		}
+		data := line.Bytes()
+		if compression == 2 {
+			data = zipEXR(t, data)
+		}
+		blocks = append(blocks, data)
+	}
+
+	offset := uint64(buf.Len() + 8*h)
+	for _, b := range blocks {
+		binary.Write(buf, le, offset)
+		offset += uint64(8 + len(b))
+	}
+	for y, b := range blocks {
+		binary.Write(buf, le, []int32{int32(y), int32(len(b))})
+		buf.Write(b)
+	}
+	return buf.Bytes()
+}
+
+// zipEXR reorders and delta encodes the given bytes before compressing
+// them using zlib.
+func zipEXR(t *testing.T, raw []byte) []byte {
+	tmp := make([]byte, 0, len(raw))
+	for i := 0; i < len(raw); i += 2 {
+		tmp = append(tmp, raw[i])
+	}
+	for i := 1; i < len(raw); i += 2 {
+		tmp = append(tmp, raw[i])
+	}
+	for i := len(tmp) - 1; i > 0; i-- {
+		tmp[i] = tmp[i] - tmp[i-1] + 128
+	}
+	buf := &bytes.Buffer{}
+	zw := zlib.NewWriter(buf)
+	if _, err := zw.Write(tmp); err != nil {
+		t.Fatalf("cannot compress: %v", err)
+	}
+	zw.Close()
+	return buf.Bytes()
+}
+
+func TestLoadEXR(t *testing.T) {
+	f := func(vs ...float32) []uint32 {
+		bits := make([]uint32, len(vs))
+		for i, v := range vs {
+			bits[i] = math.Float32bits(v)
+		}
+		return bits
+	}
+
+	// 2x2 float image, channels are sorted by name.
+	data := encodeEXR(t, 2, 2, 0,
+		exrChannel{"B", 2, f(0, 0, 3, 0.25)},
+		exrChannel{"G", 2, f(0, 1, 0, 0.5)},
+		exrChannel{"R", 2, f(1, 0, 0, 100)},
+	)
+	img, err := io.LoadEXR(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("cannot load exr: %v", err)
+	}
+	want := [][4]float64{{1, 0, 0, 1}, {0, 1, 0, 1}, {0, 0, 3, 1}, {100, 0.5, 0.25, 1}}
+	for i, w := range want {
+		got := img.RGBAFloatAt(i%2, i/2)
+		if got.X != w[0] || got.Y != w[1] || got.Z != w[2] || got.W != w[3] {
+			t.Fatalf("pixel %d, want %v, got %v", i, w, got)
+		}
+	}
+
+	// Half values: 1, 0.5, 2, 65504 and a subnormal 2^-24, the gray
+	// Y channel is loaded to all color components.
+	data = encodeEXR(t, 3, 2, 2,
+		exrChannel{"A", 1, []uint32{0x3c00, 0x3800, 0x3c00, 0x3c00, 0x3c00, 0}},
+		exrChannel{"Y", 1, []uint32{0x3c00, 0x3800, 0x4000, 0x7bff, 0x0001, 0xc000}},
+	)
+	img, err = io.LoadEXR(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("cannot load zip compressed exr: %v", err)
+	}
+	wantY := []float64{1, 0.5, 2, 65504, math.Ldexp(1, -24), -2}
+	wantA := []float64{1, 0.5, 1, 1, 1, 0}
+	for i := range wantY {
+		got := img.RGBAFloatAt(i%3, i/3)
+		if got.X != wantY[i] || got.Y != wantY[i] || got.Z != wantY[i] || got.W != wantA[i] {
+			t.Fatalf("pixel %d, want %v, got %v", i, wantY[i], got)
+		}
+	}
+
+	// Float images can be decoded using the image package as well.
+	decoded, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil || format != "exr" || decoded.Bounds().Dx() != 3 {
+		t.Fatalf("cannot decode exr using the image package: %v", err)
+	}
+
+	// A data window that is larger than the file must not be allocated.
+	window := func(w, h int32) []byte {
+		data := encodeEXR(t, 1, 1, 0, exrChannel{"Y", 2, f(1)})
+		i := bytes.Index(data, []byte("dataWindow\x00box2i\x00")) + len("dataWindow\x00box2i\x00") + 4
+		binary.LittleEndian.PutUint32(data[i+8:], uint32(w-1))
+		binary.LittleEndian.PutUint32(data[i+12:], uint32(h-1))
+		return data
+	}
+
+	for _, data := range [][]byte{
+		[]byte("\x76\x2f\x31\x01\x02\x02\x00\x00"), // tiled
+		encodeEXR(t, 1, 1, 0, exrChannel{"Z", 2, f(1)}),
+		data[:len(data)-4],
+		window(1<<30, 1<<30),
+		window(1, 1<<20),
+	} {
+		if _, err := io.LoadEXR(bytes.NewReader(data)); err == nil {
+			t.Fatalf("expect an error")
+		}
+	}
+}
+
+func TestFloat32ToHalf(t *testing.T) {
+	tests := []struct {
+		f    float32
+		want uint16
+	}{
+		{0, 0x0000},
+		{1, 0x3c00},
+		{-2, 0xc000},
+		{0.5, 0x3800},
+		{65504, 0x7bff},
+		{65520, 0x7c00},                           // rounds to infinity
+		{float32(math.Ldexp(1, -24)), 0x0001},     // smallest subnormal
+		{float32(math.Ldexp(1, -25)), 0x0000},     // ties to even
+		{float32(math.Ldexp(3, -25)), 0x0002},     // ties to even
+		{1 + float32(math.Ldexp(1, -11)), 0x3c00}, // ties to even
+		{1 + float32(math.Ldexp(3, -11)), 0x3c02}, // ties to even
+		{float32(math.Inf(-1)), 0xfc00},
+	}
+	for _, tt := range tests {
+		if got := io.Float32ToHalf(tt.f); got != tt.want {
+			t.Fatalf("half of %v, want %#04x, got %#04x", tt.f, tt.want, got)
+		}
+	}
+	if got := io.Float32ToHalf(float32(math.NaN())); got&0x7c00 != 0x7c00 || got&0x3ff == 0 {
+		t.Fatalf("half of NaN, got %#04x", got)
+	}
+
+	// All finite half values survive a round trip.
+	for h := 0; h < 1<<16; h++ {
+		if h&0x7c00 == 0x7c00 {
+			continue
+		}
+		if got := io.Float32ToHalf(io.HalfToFloat32(uint16(h))); got != uint16(h) {
+			t.Fatalf("round trip of %#04x, got %#04x", h, got)
+		}
+	}
+}
+
+func TestSaveEXR(t *testing.T) {
+	// An image whose size is not a multiple of the block sizes, with
+	// smooth gradients, noise, negative and large values.
+	rnd := rand.New(rand.NewSource(42))
+	img := pimage.NewRGBAFloat(image.Rect(0, 0, 37, 23))
+	for y := 0; y < 23; y++ {
+		for x := 0; x < 37; x++ {
+			i := img.PixOffset(x, y)
+			img.Pix[i+0] = float32(x) / 37
+			img.Pix[i+1] = float32(rnd.NormFloat64())
+			img.Pix[i+2] = float32(math.Ldexp(1, x%30-14))
+			img.Pix[i+3] = float32(y % 3)
+		}
+	}
+	img.Pix[0] = 1000
+
+	for _, c := range []io.EXRCompression{io.EXRNone, io.EXRRLE, io.EXRZIPS, io.EXRZIP, io.EXRPIZ} {
+		for _, half := range []bool{false, true} {
+			buf := &bytes.Buffer{}
+			err := io.SaveEXR(buf, img, io.WithEXRCompression(c), io.WithEXRHalf(half))
+			if err != nil {
+				t.Fatalf("cannot save exr: %v", err)
+			}
+			got, err := io.LoadEXR(buf)
+			if err != nil {
+				t.Fatalf("cannot load saved exr, compression %d, half %v: %v", c, half, err)
+			}
+			if got.Bounds() != img.Bounds() {
+				t.Fatalf("size mismatch, want %v, got %v", img.Bounds(), got.Bounds())
+			}
+			for i, v := range img.Pix {
+				if half {
+					v = io.HalfToFloat32(io.Float32ToHalf(v))
+				}
+				if got.Pix[i] != v {
+					t.Fatalf("compression %d, half %v, value %d, want %v, got %v", c, half, i, v, got.Pix[i])
+				}
+			}
+		}
+	}
+
+	if err := io.SaveEXR(&bytes.Buffer{}, img, io.WithEXRCompression(42)); err == nil {
+		t.Fatalf("expect an error for unsupported compression")
+	}
+}
@@ -0,0 +1,177 @@
+// Copyright 2021 Changkun Ou <changkun.de>. All rights reserved.
+// Use of this source code is governed by a GPLv3 license that
+// can be found in the LICENSE file.
+
+package io
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"poly.red/geometry"
+	"poly.red/geometry/primitive"
+	"poly.red/material"
+)
+
+// ErrFormat indicates that loading or saving a mesh encountered an
+// unknown format.
+var ErrFormat = errors.New("loader: unknown mesh format")
+
+// MeshDecoder decodes a mesh from the given reader. Files referenced by
+// the mesh, e.g. material libraries or textures, are resolved relative
+// to the given directory.
+type MeshDecoder func(r io.Reader, dir string) (geometry.Mesh, error)
+
+// MeshEncoder encodes the given mesh to the given writer.
+type MeshEncoder func(w io.Writer, m geometry.Mesh) error
+
+// A format holds a mesh format's name, file extensions, magic header
+// and how to decode and encode it.
+type format struct {
+	name   string
+	exts   []string
+	magic  string
+	decode MeshDecoder
+	encode MeshEncoder
+}
+
+var (
+	formatsMu sync.RWMutex
+	formats   []format
+)
+
+// RegisterFormat registers a mesh format for use by LoadMesh, SaveMesh
+// and DecodeMesh. Name is the name of the format, like "obj" or "stl".
+// Exts are the file extensions of the format including the leading dot,
+// like ".obj". Magic is the magic prefix that identifies the format's
+// encoding. The magic string can contain "?" wildcards that each match
+// any one byte, and an empty magic never matches. Either decode or
+// encode may be nil if the format cannot be loaded or saved.
+//
+// Formats registered later take precedence over earlier ones, which
+// allows third-party codecs to replace the builtin ones.
+func RegisterFormat(name string, exts []string, magic string, decode MeshDecoder, encode MeshEncoder) {
+	lower := make([]string, len(exts))
+	for i, ext := range exts {
+		lower[i] = strings.ToLower(ext)
+	}
+
+	formatsMu.Lock()
+	defer formatsMu.Unlock()
+	formats = append(formats, format{name, lower, magic, decode, encode})
+}
+
+// formatByExt returns the most recently registered format that has the
+// extension of the given path.
+func formatByExt(path string, match func(f *format) bool) (format, bool) {
+	ext := strings.ToLower(filepath.Ext(path))
+	if ext == "" {
+		return format{}, false
+	}
+
+	formatsMu.RLock()
+	defer formatsMu.RUnlock()
+	for i := len(formats) - 1; i >= 0; i-- {
+		f := &formats[i]
+		if !match(f) {
+			continue
+		}
+		for _, e := range f.exts {
+			if e == ext {
+				return *f, true
+			}
+		}
+	}
+	return format{}, false
+}
+
+// formatByMagic returns the most recently registered decodable format
+// whose magic matches the head of the given reader.
+func formatByMagic(r *bufio.Reader) (format, bool) {
+	formatsMu.RLock()
+	defer formatsMu.RUnlock()
+	for i := len(formats) - 1; i >= 0; i-- {
+		f := &formats[i]
+		if f.decode == nil || f.magic == "" {
+			continue
+		}
+		head, err := r.Peek(len(f.magic))
+		if err == nil && matchMagic(f.magic, head) {
+			return *f, true
+		}
+	}
+	return format{}, false
+}
+
+// matchMagic reports whether the magic matches b, where "?" in the magic
+// matches any byte.
+func matchMagic(magic string, b []byte) bool {
+	if len(magic) != len(b) {
+		return false
+	}
+	for i, c := range b {
+		if magic[i] != c && magic[i] != '?' {
+			return false
+		}
+	}
+	return true
+}
+
+// DecodeMesh decodes a mesh that has been encoded in a registered
+// format. The format is identified by its magic header, and the name of
+// the format is returned. Referenced files are resolved relative to the
+// given directory.
+func DecodeMesh(r io.Reader, dir string) (geometry.Mesh, string, error) {
+	br := bufio.NewReader(r)
+	f, ok := formatByMagic(br)
+	if !ok {
+		return nil, "", ErrFormat
+	}
+	m, err := f.decode(br, dir)
+	return m, f.name, err
+}
+
+// bufferedMesh returns the given mesh as a buffered mesh. Meshes that
+// are not buffered are converted to a buffered mesh where each triangle
+// has its own vertices.
+func bufferedMesh(m geometry.Mesh) *geometry.BufferedMesh {
+	if bm, ok := m.(*geometry.BufferedMesh); ok {
+		return bm
+	}
+
+	n := int(m.NumTriangles()) * 3
+	var (
+		pos = make([]float64, 0, n*3)
+		nor = make([]float64, 0, n*3)
+		uv  = make([]float64, 0, n*2)
+		col = make([]float64, 0, n*4)
+		idx = make([]uint64, 0, n)
+	)
+	m.Faces(func(f primitive.Face, _ material.Material) bool {
+		f.Triangles(func(t *primitive.Triangle) bool {
+			t.Vertices(func(v *primitive.Vertex) bool {
+				idx = append(idx, uint64(len(idx)))
+				pos = append(pos, v.Pos.X, v.Pos.Y, v.Pos.Z)
+				nor = append(nor, v.Nor.X, v.Nor.Y, v.Nor.Z)
+				uv = append(uv, v.UV.X, v.UV.Y)
+				col = append(col, float64(v.Col.R), float64(v.Col.G), float64(v.Col.B), float64(v.Col.A))
+				return true
+			})
+			return true
+		})
+		return true
+	})
+
+	bm := geometry.NewBufferedMesh()
+	bm.SetAttribute(geometry.AttributePos, geometry.NewBufferAttribute(3, pos))
+	bm.SetAttribute(geometry.AttributeNor, geometry.NewBufferAttribute(3, nor))
+	bm.SetAttribute(geometry.AttributeUV, geometry.NewBufferAttribute(2, uv))
+	bm.SetAttribute(geometry.AttributeCol, geometry.NewBufferAttribute(4, col))
+	bm.SetVertexIndex(idx)
+	bm.SetMaterial(m.GetMaterial())
+	return bm
+}
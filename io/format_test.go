@@ -0,0 +1,96 @@
+// Copyright 2021 Changkun Ou <changkun.de>. All rights reserved.
+// Use of this source code is governed by a GPLv3 license that
+// can be found in the LICENSE file.
+
+package io_test
+
+import (
+	"bytes"
+	"errors"
+	goio "io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"poly.red/geometry"
+	"poly.red/io"
+)
+
+func TestSaveMesh(t *testing.T) {
+	want, err := io.LoadMesh("../testdata/bunny.obj")
+	if err != nil {
+		t.Fatalf("cannot load mesh: %v", err)
+	}
+
+	dir := t.TempDir()
+	for _, ext := range []string{".obj", ".stl", ".ply", ".PLY"} {
+		path := filepath.Join(dir, "bunny"+ext)
+		if err := io.SaveMesh(path, want); err != nil {
+			t.Fatalf("cannot save mesh %s: %v", path, err)
+		}
+		got, err := io.LoadMesh(path)
+		if err != nil {
+			t.Fatalf("cannot load saved mesh %s: %v", path, err)
+		}
+		if got.NumTriangles() != want.NumTriangles() {
+			t.Fatalf("number of triangles of %s does not match, want %v, got %v",
+				path, want.NumTriangles(), got.NumTriangles())
+		}
+	}
+
+	// Files without a known extension are identified by their magic.
+	data, err := os.ReadFile(filepath.Join(dir, "bunny.ply"))
+	if err != nil {
+		t.Fatalf("cannot read file: %v", err)
+	}
+	path := filepath.Join(dir, "bunny.model")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatalf("cannot write file: %v", err)
+	}
+	if m, err := io.LoadMesh(path); err != nil || m.NumTriangles() != want.NumTriangles() {
+		t.Fatalf("cannot load mesh by magic: %v", err)
+	}
+	m, name, err := io.DecodeMesh(bytes.NewReader(data), dir)
+	if err != nil || name != "ply" || m.NumTriangles() != want.NumTriangles() {
+		t.Fatalf("cannot decode mesh, format %q: %v", name, err)
+	}
+
+	if err := io.SaveMesh(filepath.Join(dir, "bunny.unknown"), want); !errors.Is(err, io.ErrFormat) {
+		t.Fatalf("expect a format error, got %v", err)
+	}
+	if _, _, err := io.DecodeMesh(strings.NewReader("unknown"), dir); !errors.Is(err, io.ErrFormat) {
+		t.Fatalf("expect a format error, got %v", err)
+	}
+}
+
+func TestRegisterFormat(t *testing.T) {
+	var saved geometry.Mesh
+	io.RegisterFormat("test", []string{".test"}, "TEST??",
+		func(r goio.Reader, dir string) (geometry.Mesh, error) {
+			head := make([]byte, 6)
+			if _, err := goio.ReadFull(r, head); err != nil {
+				return nil, err
+			}
+			return geometry.NewPlane(1, 1), nil
+		},
+		func(w goio.Writer, m geometry.Mesh) error {
+			saved = m
+			_, err := w.Write([]byte("TEST01"))
+			return err
+		})
+
+	dir := t.TempDir()
+	plane := geometry.NewPlane(1, 1)
+	if err := io.SaveMesh(filepath.Join(dir, "plane.test"), plane); err != nil {
+		t.Fatalf("cannot save mesh: %v", err)
+	}
+	if saved != plane {
+		t.Fatalf("registered encoder is not used")
+	}
+
+	m, name, err := io.DecodeMesh(strings.NewReader("TEST02"), dir)
+	if err != nil || name != "test" || m.NumTriangles() != plane.NumTriangles() {
+		t.Fatalf("registered decoder is not used, format %q: %v", name, err)
+	}
+}
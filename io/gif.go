@@ -0,0 +1,207 @@
+// Copyright 2021 Changkun Ou <changkun.de>. All rights reserved.
+// Use of this source code is governed by a GPLv3 license that
+// can be found in the LICENSE file.
+
+package io
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"io"
+	"sort"
+)
+
+type gifWriter struct {
+	w      io.Writer
+	option *AnimationOption
+	size   image.Point
+	anim   gif.GIF
+	closed bool
+}
+
+// NewGIFWriter returns a frame writer that writes an animated GIF. Each
+// frame is quantized to its own palette of 256 colors using the median
+// cut algorithm. GIF frames are opaque, and the delay of each frame is
+// rounded to hundredths of a second.
+//
+// The quantized frames are kept in memory and written on Close,
+// because the GIF encoder needs all frames at once.
+func NewGIFWriter(w io.Writer, opts ...WriteAnimationOption) (FrameWriter, error) {
+	option, err := newAnimationOption(opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	g := &gifWriter{w: w, option: option}
+	switch option.loopCount {
+	case 0:
+		g.anim.LoopCount = 0
+	case 1:
+		g.anim.LoopCount = -1
+	default:
+		g.anim.LoopCount = option.loopCount - 1
+	}
+	return g, nil
+}
+
+func (g *gifWriter) WriteFrame(img *image.RGBA) error {
+	if g.closed {
+		return ErrFrameWriterClosed
+	}
+	if err := frameSize(&g.size, img); err != nil {
+		return err
+	}
+
+	r := img.Bounds()
+	frame := image.NewPaletted(image.Rect(0, 0, r.Dx(), r.Dy()), quantizeMedianCut(img, 256))
+	if g.option.dither {
+		draw.FloydSteinberg.Draw(frame, frame.Bounds(), img, r.Min)
+	} else {
+		draw.Draw(frame, frame.Bounds(), img, r.Min, draw.Src)
+	}
+
+	// The delay is accumulated to keep the frame rate, e.g. 30 fps
+	// alternates delays of 3 and 4 hundredths of a second.
+	n := len(g.anim.Image)
+	delay := (n+1)*100/g.option.fps - n*100/g.option.fps
+	g.anim.Image = append(g.anim.Image, frame)
+	g.anim.Delay = append(g.anim.Delay, delay)
+	g.anim.Disposal = append(g.anim.Disposal, gif.DisposalNone)
+	return nil
+}
+
+func (g *gifWriter) Close() error {
+	if g.closed {
+		return ErrFrameWriterClosed
+	}
+	g.closed = true
+	if len(g.anim.Image) == 0 {
+		return fmt.Errorf("loader: cannot write a gif without frames")
+	}
+	if err := gif.EncodeAll(g.w, &g.anim); err != nil {
+		return fmt.Errorf("loader: cannot write gif, err: %w", err)
+	}
+	return nil
+}
+
+// colorBox is a box of the RGB color space that holds a part of the
+// color histogram, see quantizeMedianCut.
+type colorBox struct {
+	colors []histColor
+	count  int
+}
+
+type histColor struct {
+	key   int
+	c     [3]uint8
+	count int
+}
+
+// quantizeMedianCut computes a palette of at most n colors for the
+// given image. The color space is repeatedly split at the median of the
+// longest axis of the box that covers the most pixels, and each box
+// contributes the average of its colors.
+func quantizeMedianCut(img *image.RGBA, n int) color.Palette {
+	// The histogram keeps 5 bits per component, which bounds the cost
+	// of splitting boxes independently of the image size.
+	const bits = 5
+	var (
+		hist [1 << (3 * bits)]int
+		sums [1 << (3 * bits)][3]int
+	)
+	r := img.Bounds()
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			i := img.PixOffset(x, y)
+			p := img.Pix[i : i+3 : i+3]
+			k := int(p[0]>>(8-bits))<<(2*bits) | int(p[1]>>(8-bits))<<bits | int(p[2]>>(8-bits))
+			hist[k]++
+			sums[k][0] += int(p[0])
+			sums[k][1] += int(p[1])
+			sums[k][2] += int(p[2])
+		}
+	}
+
+	var colors []histColor
+	for k, count := range hist {
+		if count > 0 {
+			c := [3]uint8{uint8(k >> (2 * bits)), uint8(k >> bits & (1<<bits - 1)), uint8(k & (1<<bits - 1))}
+			colors = append(colors, histColor{k, c, count})
+		}
+	}
+
+	boxes := []colorBox{{colors: colors, count: r.Dx() * r.Dy()}}
+	for len(boxes) < n {
+		// Split the most populated box that has more than one color.
+		split := -1
+		for i, b := range boxes {
+			if len(b.colors) > 1 && (split < 0 || b.count > boxes[split].count) {
+				split = i
+			}
+		}
+		if split < 0 {
+			break
+		}
+		a, b := boxes[split].split()
+		boxes[split] = a
+		boxes = append(boxes, b)
+	}
+
+	palette := make(color.Palette, len(boxes))
+	for i, b := range boxes {
+		var s [3]int
+		for _, c := range b.colors {
+			cs := sums[c.key]
+			s[0] += cs[0]
+			s[1] += cs[1]
+			s[2] += cs[2]
+		}
+		palette[i] = color.RGBA{
+			uint8((s[0] + b.count/2) / b.count),
+			uint8((s[1] + b.count/2) / b.count),
+			uint8((s[2] + b.count/2) / b.count),
+			0xff,
+		}
+	}
+	return palette
+}
+
+// split splits the box at the median of its longest axis.
+func (b colorBox) split() (colorBox, colorBox) {
+	var lo, hi [3]uint8
+	lo = b.colors[0].c
+	hi = lo
+	for _, c := range b.colors {
+		for k := 0; k < 3; k++ {
+			if c.c[k] < lo[k] {
+				lo[k] = c.c[k]
+			}
+			if c.c[k] > hi[k] {
+				hi[k] = c.c[k]
+			}
+		}
+	}
+	axis := 0
+	for k := 1; k < 3; k++ {
+		if hi[k]-lo[k] > hi[axis]-lo[axis] {
+			axis = k
+		}
+	}
+
+	colors := append([]histColor(nil), b.colors...)
+	sort.SliceStable(colors, func(i, j int) bool {
+		return colors[i].c[axis] < colors[j].c[axis]
+	})
+	half, median := 0, 1
+	for i := 0; i < len(colors)-1; i++ {
+		half += colors[i].count
+		median = i + 1
+		if 2*half >= b.count {
+			break
+		}
+	}
+	return colorBox{colors[:median], half}, colorBox{colors[median:], b.count - half}
+}
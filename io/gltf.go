@@ -0,0 +1,1667 @@
+// Copyright 2021 Changkun Ou <changkun.de>. All rights reserved.
+// Use of this source code is governed by a GPLv3 license that
+// can be found in the LICENSE file.
+
+package io
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"poly.red/camera"
+	"poly.red/color"
+	"poly.red/geometry"
+	"poly.red/geometry/primitive"
+	"poly.red/image"
+	"poly.red/light"
+	"poly.red/material"
+	"poly.red/math"
+	"poly.red/object"
+	"poly.red/scene"
+)
+
+// gltfDocument is the JSON document of a glTF 2.0 asset, only the parts
+// that are supported by the loader and the exporter are listed.
+type gltfDocument struct {
+	Asset          gltfAsset        `json:"asset"`
+	ExtensionsUsed []string         `json:"extensionsUsed,omitempty"`
+	Extensions     *gltfExtensions  `json:"extensions,omitempty"`
+	Scene          *int             `json:"scene,omitempty"`
+	Scenes         []gltfScene      `json:"scenes,omitempty"`
+	Nodes          []gltfNode       `json:"nodes,omitempty"`
+	Meshes         []gltfMesh       `json:"meshes,omitempty"`
+	Materials      []gltfMaterial   `json:"materials,omitempty"`
+	Textures       []gltfTexture    `json:"textures,omitempty"`
+	Images         []gltfImage      `json:"images,omitempty"`
+	Cameras        []gltfCamera     `json:"cameras,omitempty"`
+	Accessors      []gltfAccessor   `json:"accessors,omitempty"`
+	BufferViews    []gltfBufferView `json:"bufferViews,omitempty"`
+	Buffers        []gltfBuffer     `json:"buffers,omitempty"`
+}
+
+type gltfAsset struct {
+	Version   string `json:"version"`
+	Generator string `json:"generator,omitempty"`
+}
+
+type gltfExtensions struct {
+	LightsPunctual *gltfLights `json:"KHR_lights_punctual,omitempty"`
+}
+
+type gltfLights struct {
+	Lights []gltfLight `json:"lights"`
+}
+
+type gltfLight struct {
+	Name      string    `json:"name,omitempty"`
+	Type      string    `json:"type"`
+	Color     []float64 `json:"color,omitempty"`
+	Intensity *float64  `json:"intensity,omitempty"`
+}
+
+type gltfScene struct {
+	Name  string `json:"name,omitempty"`
+	Nodes []int  `json:"nodes,omitempty"`
+}
+
+type gltfNode struct {
+	Name        string              `json:"name,omitempty"`
+	Children    []int               `json:"children,omitempty"`
+	Mesh        *int                `json:"mesh,omitempty"`
+	Camera      *int                `json:"camera,omitempty"`
+	Matrix      []float64           `json:"matrix,omitempty"`
+	Translation []float64           `json:"translation,omitempty"`
+	Rotation    []float64           `json:"rotation,omitempty"`
+	Scale       []float64           `json:"scale,omitempty"`
+	Extensions  *gltfNodeExtensions `json:"extensions,omitempty"`
+}
+
+type gltfNodeExtensions struct {
+	LightsPunctual *gltfNodeLight `json:"KHR_lights_punctual,omitempty"`
+}
+
+type gltfNodeLight struct {
+	Light int `json:"light"`
+}
+
+type gltfMesh struct {
+	Name       string          `json:"name,omitempty"`
+	Primitives []gltfPrimitive `json:"primitives"`
+}
+
+type gltfPrimitive struct {
+	Attributes map[string]int `json:"attributes"`
+	Indices    *int           `json:"indices,omitempty"`
+	Material   *int           `json:"material,omitempty"`
+	Mode       *int           `json:"mode,omitempty"`
+}
+
+type gltfMaterial struct {
+	Name                 string           `json:"name,omitempty"`
+	PBRMetallicRoughness *gltfPBR         `json:"pbrMetallicRoughness,omitempty"`
+	NormalTexture        *gltfTextureInfo `json:"normalTexture,omitempty"`
+}
+
+type gltfPBR struct {
+	BaseColorFactor  []float64        `json:"baseColorFactor,omitempty"`
+	BaseColorTexture *gltfTextureInfo `json:"baseColorTexture,omitempty"`
+	MetallicFactor   *float64         `json:"metallicFactor,omitempty"`
+	RoughnessFactor  *float64         `json:"roughnessFactor,omitempty"`
+}
+
+type gltfTextureInfo struct {
+	Index int `json:"index"`
+}
+
+type gltfTexture struct {
+	Source *int `json:"source,omitempty"`
+}
+
+type gltfImage struct {
+	URI        string `json:"uri,omitempty"`
+	MimeType   string `json:"mimeType,omitempty"`
+	BufferView *int   `json:"bufferView,omitempty"`
+}
+
+type gltfCamera struct {
+	Name         string            `json:"name,omitempty"`
+	Type         string            `json:"type"`
+	Perspective  *gltfPerspective  `json:"perspective,omitempty"`
+	Orthographic *gltfOrthographic `json:"orthographic,omitempty"`
+}
+
+type gltfPerspective struct {
+	AspectRatio float64 `json:"aspectRatio,omitempty"`
+	Yfov        float64 `json:"yfov"`
+	Zfar        float64 `json:"zfar,omitempty"`
+	Znear       float64 `json:"znear"`
+}
+
+type gltfOrthographic struct {
+	Xmag  float64 `json:"xmag"`
+	Ymag  float64 `json:"ymag"`
+	Zfar  float64 `json:"zfar"`
+	Znear float64 `json:"znear"`
+}
+
+type gltfAccessor struct {
+	BufferView    *int            `json:"bufferView,omitempty"`
+	ByteOffset    int             `json:"byteOffset,omitempty"`
+	ComponentType int             `json:"componentType"`
+	Normalized    bool            `json:"normalized,omitempty"`
+	Count         int             `json:"count"`
+	Type          string          `json:"type"`
+	Min           []float64       `json:"min,omitempty"`
+	Max           []float64       `json:"max,omitempty"`
+	Sparse        json.RawMessage `json:"sparse,omitempty"`
+}
+
+type gltfBufferView struct {
+	Buffer     int `json:"buffer"`
+	ByteOffset int `json:"byteOffset,omitempty"`
+	ByteLength int `json:"byteLength"`
+	ByteStride int `json:"byteStride,omitempty"`
+	Target     int `json:"target,omitempty"`
+}
+
+type gltfBuffer struct {
+	URI        string `json:"uri,omitempty"`
+	ByteLength int    `json:"byteLength"`
+}
+
+// Constants of the glTF 2.0 specification.
+const (
+	gltfByte          = 5120
+	gltfUnsignedByte  = 5121
+	gltfShort         = 5122
+	gltfUnsignedShort = 5123
+	gltfUnsignedInt   = 5125
+	gltfFloat         = 5126
+
+	gltfTriangles     = 4
+	gltfTriangleStrip = 5
+	gltfTriangleFan   = 6
+
+	gltfArrayBuffer        = 34962
+	gltfElementArrayBuffer = 34963
+
+	glbMagic     = 0x46546C67 // "glTF"
+	glbChunkJSON = 0x4E4F534A // "JSON"
+	glbChunkBIN  = 0x004E4942 // "BIN\x00"
+)
+
+var gltfNumComponents = map[string]int{
+	"SCALAR": 1, "VEC2": 2, "VEC3": 3, "VEC4": 4,
+	"MAT2": 4, "MAT3": 9, "MAT4": 16,
+}
+
+// GLTFOption offers custom configurations for loading and saving a
+// glTF 2.0 asset.
+type GLTFOption struct {
+	dir    string
+	binary bool
+}
+
+type ReadGLTFOption func(o *GLTFOption)
+type WriteGLTFOption func(o *GLTFOption)
+
+// WithGLTFDir sets the directory that is used for resolving relative
+// URIs of external buffers and images. By default, URIs are resolved
+// relative to the current working directory.
+func WithGLTFDir(dir string) ReadGLTFOption {
+	return func(o *GLTFOption) {
+		o.dir = dir
+	}
+}
+
+// LoadGLTF loads a glTF 2.0 asset, either in .gltf or .glb container,
+// to a scene. The node hierarchy is loaded as nested groups, where each
+// mesh primitive is loaded as an indexed buffered mesh.
+//
+// The first camera of the scene becomes the camera of the loaded scene.
+// Cameras and punctual lights (KHR_lights_punctual) are placed at their
+// world space location, spot lights are loaded as point lights.
+func LoadGLTF(data io.Reader, opts ...ReadGLTFOption) (*scene.Scene, error) {
+	option := &GLTFOption{
+		dir: ".",
+	}
+	for _, opt := range opts {
+		opt(option)
+	}
+
+	r := bufio.NewReader(data)
+	var (
+		doc *gltfDocument
+		bin []byte
+		err error
+	)
+	if magic, _ := r.Peek(4); len(magic) == 4 && binary.LittleEndian.Uint32(magic) == glbMagic {
+		doc, bin, err = readGLB(r)
+	} else {
+		doc = &gltfDocument{}
+		err = json.NewDecoder(r).Decode(doc)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("loader: cannot read gltf asset, err: %w", err)
+	}
+	if !strings.HasPrefix(doc.Asset.Version, "2.") {
+		return nil, fmt.Errorf("loader: unsupported gltf version %q", doc.Asset.Version)
+	}
+
+	l := &gltfLoader{
+		doc:      doc,
+		dir:      option.dir,
+		bin:      bin,
+		buffers:  make([][]byte, len(doc.Buffers)),
+		textures: map[[2]int]*image.Texture{},
+		mats:     make([]material.Material, len(doc.Materials)),
+		s:        scene.NewScene(),
+	}
+	return l.load()
+}
+
+func readGLB(r io.Reader) (*gltfDocument, []byte, error) {
+	var header [12]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, nil, err
+	}
+	if v := binary.LittleEndian.Uint32(header[4:]); v != 2 {
+		return nil, nil, fmt.Errorf("unsupported glb version %d", v)
+	}
+
+	var (
+		doc *gltfDocument
+		bin []byte
+	)
+	for {
+		var chunk [8]byte
+		if _, err := io.ReadFull(r, chunk[:]); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, nil, err
+		}
+		data, err := readBytes(r, int64(binary.LittleEndian.Uint32(chunk[:])))
+		if err != nil {
+			return nil, nil, err
+		}
+		switch binary.LittleEndian.Uint32(chunk[4:]) {
+		case glbChunkJSON:
+			doc = &gltfDocument{}
+			if err := json.Unmarshal(data, doc); err != nil {
+				return nil, nil, err
+			}
+		case glbChunkBIN:
+			if bin == nil {
+				bin = data
+			}
+		}
+	}
+	if doc == nil {
+		return nil, nil, errors.New("glb does not contain a json chunk")
+	}
+	return doc, bin, nil
+}
+
+type gltfLoader struct {
+	doc      *gltfDocument
+	dir      string
+	bin      []byte
+	buffers  [][]byte
+	textures map[[2]int]*image.Texture // keyed by image index and gamma correction
+	mats     []material.Material
+	s        *scene.Scene
+}
+
+func (l *gltfLoader) load() (*scene.Scene, error) {
+	var roots []int
+	switch {
+	case l.doc.Scene != nil && *l.doc.Scene < len(l.doc.Scenes):
+		roots = l.doc.Scenes[*l.doc.Scene].Nodes
+	case len(l.doc.Scenes) > 0:
+		roots = l.doc.Scenes[0].Nodes
+	default:
+		// Without a scene, all nodes that are not a child of
+		// another node are considered as roots.
+		isChild := make([]bool, len(l.doc.Nodes))
+		for _, n := range l.doc.Nodes {
+			for _, c := range n.Children {
+				if c >= 0 && c < len(isChild) {
+					isChild[c] = true
+				}
+			}
+		}
+		for i := range isChild {
+			if !isChild[i] {
+				roots = append(roots, i)
+			}
+		}
+	}
+
+	visited := make([]bool, len(l.doc.Nodes))
+	for _, n := range roots {
+		g, err := l.loadNode(n, math.Mat4I, visited)
+		if err != nil {
+			return nil, err
+		}
+		l.s.Add(g)
+	}
+	return l.s, nil
+}
+
+func (l *gltfLoader) loadNode(idx int, parent math.Mat4, visited []bool) (*scene.Group, error) {
+	if idx < 0 || idx >= len(l.doc.Nodes) {
+		return nil, fmt.Errorf("loader: gltf node %d does not exist", idx)
+	}
+	if visited[idx] {
+		return nil, fmt.Errorf("loader: gltf node %d is referenced more than once", idx)
+	}
+	visited[idx] = true
+	n := &l.doc.Nodes[idx]
+
+	// The content of a node is attached to the node group, or to a
+	// nested scaling group if the scaling cannot be represented by the
+	// node group. See gltfTransform for details.
+	g := scene.NewGroup(n.Name)
+	t, r, sc := gltfTRS(n)
+	content := gltfTransform(g, t, r, sc)
+	world := parent.MulM(gltfMatrix(t, r, sc))
+
+	if n.Mesh != nil {
+		meshes, err := l.loadMesh(*n.Mesh)
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range meshes {
+			content.Add(m)
+		}
+	}
+	if n.Camera != nil {
+		c, err := l.loadCamera(*n.Camera, world)
+		if err != nil {
+			return nil, err
+		}
+		if l.s.GetCamera() == nil {
+			l.s.SetCamera(c)
+		}
+	}
+	if n.Extensions != nil && n.Extensions.LightsPunctual != nil {
+		li, err := l.loadLight(n.Extensions.LightsPunctual.Light, world)
+		if err != nil {
+			return nil, err
+		}
+		content.Add(li)
+	}
+	for _, c := range n.Children {
+		child, err := l.loadNode(c, world, visited)
+		if err != nil {
+			return nil, err
+		}
+		content.Add(child)
+	}
+	return g, nil
+}
+
+// gltfTRS returns the translation, rotation and scaling of a node. A
+// node matrix is decomposed, assuming it does not contain shearing.
+func gltfTRS(n *gltfNode) (t math.Vec3, r math.Quaternion, s math.Vec3) {
+	t = math.NewVec3(0, 0, 0)
+	r = math.NewQuaternion(1, 0, 0, 0)
+	s = math.NewVec3(1, 1, 1)
+
+	if len(n.Matrix) == 16 {
+		m := n.Matrix // column-major
+		t = math.NewVec3(m[12], m[13], m[14])
+		c0 := math.NewVec3(m[0], m[1], m[2])
+		c1 := math.NewVec3(m[4], m[5], m[6])
+		c2 := math.NewVec3(m[8], m[9], m[10])
+		s = math.NewVec3(c0.Len(), c1.Len(), c2.Len())
+		if c0.Cross(c1).Dot(c2) < 0 {
+			s.X = -s.X
+		}
+		if s.X != 0 && s.Y != 0 && s.Z != 0 {
+			r = quaternionFromBasis(
+				c0.Scale(1/s.X, 1/s.X, 1/s.X),
+				c1.Scale(1/s.Y, 1/s.Y, 1/s.Y),
+				c2.Scale(1/s.Z, 1/s.Z, 1/s.Z),
+			)
+		}
+		return
+	}
+	if len(n.Translation) == 3 {
+		t = math.NewVec3(n.Translation[0], n.Translation[1], n.Translation[2])
+	}
+	if len(n.Rotation) == 4 {
+		r = math.NewQuaternion(n.Rotation[3], n.Rotation[0], n.Rotation[1], n.Rotation[2])
+	}
+	if len(n.Scale) == 3 {
+		s = math.NewVec3(n.Scale[0], n.Scale[1], n.Scale[2])
+	}
+	return
+}
+
+// quaternionFromBasis converts an orthonormal basis, i.e. the columns
+// of a rotation matrix, to a unit quaternion.
+func quaternionFromBasis(c0, c1, c2 math.Vec3) math.Quaternion {
+	trace := c0.X + c1.Y + c2.Z
+	var w, x, y, z float64
+	switch {
+	case trace > 0:
+		s := 0.5 / math.Sqrt(trace+1)
+		w = 0.25 / s
+		x = (c1.Z - c2.Y) * s
+		y = (c2.X - c0.Z) * s
+		z = (c0.Y - c1.X) * s
+	case c0.X > c1.Y && c0.X > c2.Z:
+		s := 2 * math.Sqrt(1+c0.X-c1.Y-c2.Z)
+		w = (c1.Z - c2.Y) / s
+		x = 0.25 * s
+		y = (c1.X + c0.Y) / s
+		z = (c2.X + c0.Z) / s
+	case c1.Y > c2.Z:
+		s := 2 * math.Sqrt(1+c1.Y-c0.X-c2.Z)
+		w = (c2.X - c0.Z) / s
+		x = (c1.X + c0.Y) / s
+		y = 0.25 * s
+		z = (c2.Y + c1.Z) / s
+	default:
+		s := 2 * math.Sqrt(1+c2.Z-c0.X-c1.Y)
+		w = (c0.Y - c1.X) / s
+		x = (c2.X + c0.Z) / s
+		y = (c2.Y + c1.Z) / s
+		z = 0.25 * s
+	}
+	return math.NewQuaternion(w, x, y, z)
+}
+
+// gltfMatrix returns the local transformation T * R * S of a node.
+func gltfMatrix(t math.Vec3, r math.Quaternion, s math.Vec3) math.Mat4 {
+	return math.NewMat4(
+		1, 0, 0, t.X,
+		0, 1, 0, t.Y,
+		0, 0, 1, t.Z,
+		0, 0, 0, 1,
+	).MulM(r.ToRoMat()).MulM(math.NewMat4(
+		s.X, 0, 0, 0,
+		0, s.Y, 0, 0,
+		0, 0, s.Z, 0,
+		0, 0, 0, 1,
+	))
+}
+
+// gltfTransform applies the transformation T * R * S of a node to the
+// given group, and returns the group that should hold the node content.
+//
+// A group applies the scaling after the rotation, i.e. T * S * R, which
+// is equivalent to T * R * S only if the scaling is uniform. Otherwise,
+// the scaling is applied by a nested group.
+func gltfTransform(g *scene.Group, t math.Vec3, r math.Quaternion, s math.Vec3) *scene.Group {
+	content := g
+	if !r.V.IsZero() && !(s.X == s.Y && s.Y == s.Z) {
+		content = scene.NewGroup(g.Name() + ".scale")
+		g.Add(content)
+	}
+	content.Scale(s.X, s.Y, s.Z)
+
+	if !r.V.IsZero() {
+		// q = (cos(a/2), sin(a/2) * axis)
+		angle := 2 * math.Atan2(r.V.Len(), r.A)
+		g.Rotate(r.V, angle)
+	}
+	g.Translate(t.X, t.Y, t.Z)
+	return content
+}
+
+func (l *gltfLoader) loadMesh(idx int) ([]object.Object, error) {
+	if idx < 0 || idx >= len(l.doc.Meshes) {
+		return nil, fmt.Errorf("loader: gltf mesh %d does not exist", idx)
+	}
+
+	var meshes []object.Object
+	for i, p := range l.doc.Meshes[idx].Primitives {
+		mode := gltfTriangles
+		if p.Mode != nil {
+			mode = *p.Mode
+		}
+		if mode != gltfTriangles && mode != gltfTriangleStrip && mode != gltfTriangleFan {
+			// Points and lines cannot be represented by a mesh.
+			continue
+		}
+
+		bm, err := l.loadPrimitive(&p, mode)
+		if err != nil {
+			return nil, fmt.Errorf("loader: cannot load primitive %d of gltf mesh %d, err: %w", i, idx, err)
+		}
+		if p.Material != nil {
+			mat, err := l.loadMaterial(*p.Material)
+			if err != nil {
+				return nil, err
+			}
+			bm.SetMaterial(mat)
+		}
+		meshes = append(meshes, bm)
+	}
+	return meshes, nil
+}
+
+func (l *gltfLoader) loadPrimitive(p *gltfPrimitive, mode int) (*geometry.BufferedMesh, error) {
+	posIdx, ok := p.Attributes["POSITION"]
+	if !ok {
+		return nil, errors.New("primitive does not contain positions")
+	}
+	pos, stride, err := l.readAccessor(posIdx)
+	if err != nil {
+		return nil, err
+	}
+	if stride != 3 {
+		return nil, errors.New("positions are not of type VEC3")
+	}
+	numVerts := len(pos) / 3
+
+	bm := geometry.NewBufferedMesh()
+	bm.SetAttribute(geometry.AttributePos, geometry.NewBufferAttribute(3, pos))
+
+	if i, ok := p.Attributes["NORMAL"]; ok {
+		nor, stride, err := l.readAccessor(i)
+		if err != nil {
+			return nil, err
+		}
+		if stride != 3 || len(nor) != numVerts*3 {
+			return nil, errors.New("normals do not match the positions")
+		}
+		bm.SetAttribute(geometry.AttributeNor, geometry.NewBufferAttribute(3, nor))
+	}
+	if i, ok := p.Attributes["TEXCOORD_0"]; ok {
+		uv, stride, err := l.readAccessor(i)
+		if err != nil {
+			return nil, err
+		}
+		if stride != 2 || len(uv) != numVerts*2 {
+			return nil, errors.New("texture coordinates do not match the positions")
+		}
+		// The texture space origin of glTF is the top-left corner.
+		for j := 1; j < len(uv); j += 2 {
+			uv[j] = 1 - uv[j]
+		}
+		bm.SetAttribute(geometry.AttributeUV, geometry.NewBufferAttribute(2, uv))
+	}
+	if i, ok := p.Attributes["COLOR_0"]; ok {
+		col, stride, err := l.readAccessor(i)
+		if err != nil {
+			return nil, err
+		}
+		if (stride != 3 && stride != 4) || len(col) != numVerts*stride {
+			return nil, errors.New("colors do not match the positions")
+		}
+		// Colors are stored in [0, 255].
+		for j := range col {
+			col[j] = math.Clamp(col[j], 0, 1) * 0xff
+		}
+		bm.SetAttribute(geometry.AttributeCol, geometry.NewBufferAttribute(stride, col))
+	}
+	for name, i := range p.Attributes {
+		// Application-specific attributes, e.g. "_CONFIDENCE", are
+		// loaded as lower case attributes, e.g. "confidence".
+		if len(name) < 2 || name[0] != '_' {
+			continue
+		}
+		values, stride, err := l.readAccessor(i)
+		if err != nil {
+			return nil, err
+		}
+		if len(values) != numVerts*stride {
+			return nil, fmt.Errorf("attribute %s does not match the positions", name)
+		}
+		bm.SetAttribute(geometry.AttributeName(strings.ToLower(name[1:])), geometry.NewBufferAttribute(stride, values))
+	}
+
+	var idx []uint64
+	if p.Indices != nil {
+		values, stride, err := l.readAccessor(*p.Indices)
+		if err != nil {
+			return nil, err
+		}
+		if stride != 1 {
+			return nil, errors.New("indices are not of type SCALAR")
+		}
+		idx = make([]uint64, len(values))
+		for i, v := range values {
+			if v < 0 || int(v) >= numVerts {
+				return nil, fmt.Errorf("index %v out of range", v)
+			}
+			idx[i] = uint64(v)
+		}
+	} else {
+		idx = make([]uint64, numVerts)
+		for i := range idx {
+			idx[i] = uint64(i)
+		}
+	}
+
+	switch mode {
+	case gltfTriangleStrip:
+		tris := make([]uint64, 0, 3*len(idx))
+		for i := 0; i+2 < len(idx); i++ {
+			if i%2 == 0 {
+				tris = append(tris, idx[i], idx[i+1], idx[i+2])
+			} else {
+				tris = append(tris, idx[i+1], idx[i], idx[i+2])
+			}
+		}
+		idx = tris
+	case gltfTriangleFan:
+		tris := make([]uint64, 0, 3*len(idx))
+		for i := 1; i+1 < len(idx); i++ {
+			tris = append(tris, idx[0], idx[i], idx[i+1])
+		}
+		idx = tris
+	default:
+		idx = idx[:len(idx)/3*3]
+	}
+	bm.SetVertexIndex(idx)
+	return bm, nil
+}
+
+// readAccessor reads the elements of an accessor as float64 values, and
+// returns the values and the number of components of each element.
+func (l *gltfLoader) readAccessor(idx int) ([]float64, int, error) {
+	if idx < 0 || idx >= len(l.doc.Accessors) {
+		return nil, 0, fmt.Errorf("accessor %d does not exist", idx)
+	}
+	a := &l.doc.Accessors[idx]
+	if len(a.Sparse) > 0 {
+		return nil, 0, fmt.Errorf("sparse accessor %d is not supported", idx)
+	}
+	n, ok := gltfNumComponents[a.Type]
+	if !ok {
+		return nil, 0, fmt.Errorf("accessor %d has invalid type %s", idx, a.Type)
+	}
+
+	var size int
+	switch a.ComponentType {
+	case gltfByte, gltfUnsignedByte:
+		size = 1
+	case gltfShort, gltfUnsignedShort:
+		size = 2
+	case gltfUnsignedInt, gltfFloat:
+		size = 4
+	default:
+		return nil, 0, fmt.Errorf("accessor %d has invalid component type %d", idx, a.ComponentType)
+	}
+
+	if a.Count < 0 || a.ByteOffset < 0 {
+		return nil, 0, fmt.Errorf("accessor %d has negative count or offset", idx)
+	}
+	if a.BufferView == nil {
+		// An accessor without buffer view is initialized with zeros.
+		if a.Count > maxInt/n {
+			return nil, 0, fmt.Errorf("accessor %d is too large", idx)
+		}
+		return make([]float64, a.Count*n), n, nil
+	}
+	view, stride, err := l.readBufferView(*a.BufferView)
+	if err != nil {
+		return nil, 0, err
+	}
+	if stride < 0 || (stride != 0 && stride < size*n) {
+		return nil, 0, fmt.Errorf("accessor %d has invalid byte stride %d", idx, stride)
+	}
+	if stride == 0 {
+		stride = size * n
+	}
+	avail := len(view) - a.ByteOffset - size*n
+	if a.Count > 0 && (avail < 0 || a.Count-1 > avail/stride) {
+		return nil, 0, fmt.Errorf("accessor %d exceeds its buffer view", idx)
+	}
+
+	values := make([]float64, a.Count*n)
+
+	for i := 0; i < a.Count; i++ {
+		for j := 0; j < n; j++ {
+			b := view[a.ByteOffset+i*stride+j*size:]
+			var v float64
+			switch a.ComponentType {
+			case gltfByte:
+				v = float64(int8(b[0]))
+				if a.Normalized {
+					v = math.Max(v/127, -1)
+				}
+			case gltfUnsignedByte:
+				v = float64(b[0])
+				if a.Normalized {
+					v /= 255
+				}
+			case gltfShort:
+				v = float64(int16(binary.LittleEndian.Uint16(b)))
+				if a.Normalized {
+					v = math.Max(v/32767, -1)
+				}
+			case gltfUnsignedShort:
+				v = float64(binary.LittleEndian.Uint16(b))
+				if a.Normalized {
+					v /= 65535
+				}
+			case gltfUnsignedInt:
+				v = float64(binary.LittleEndian.Uint32(b))
+			case gltfFloat:
+				v = float64(math.Float32frombits(binary.LittleEndian.Uint32(b)))
+			}
+			values[i*n+j] = v
+		}
+	}
+	return values, n, nil
+}
+
+func (l *gltfLoader) readBufferView(idx int) ([]byte, int, error) {
+	if idx < 0 || idx >= len(l.doc.BufferViews) {
+		return nil, 0, fmt.Errorf("buffer view %d does not exist", idx)
+	}
+	v := &l.doc.BufferViews[idx]
+	buf, err := l.readBuffer(v.Buffer)
+	if err != nil {
+		return nil, 0, err
+	}
+	if v.ByteOffset < 0 || v.ByteLength < 0 || v.ByteOffset+v.ByteLength > len(buf) {
+		return nil, 0, fmt.Errorf("buffer view %d exceeds its buffer", idx)
+	}
+	return buf[v.ByteOffset : v.ByteOffset+v.ByteLength], v.ByteStride, nil
+}
+
+func (l *gltfLoader) readBuffer(idx int) ([]byte, error) {
+	if idx < 0 || idx >= len(l.doc.Buffers) {
+		return nil, fmt.Errorf("buffer %d does not exist", idx)
+	}
+	if l.buffers[idx] != nil {
+		return l.buffers[idx], nil
+	}
+
+	b := &l.doc.Buffers[idx]
+	var (
+		data []byte
+		err  error
+	)
+	if b.URI == "" {
+		// Only the first buffer may refer to the binary chunk of a glb.
+		if idx != 0 || l.bin == nil {
+			return nil, fmt.Errorf("buffer %d does not have data", idx)
+		}
+		data = l.bin
+	} else {
+		data, err = l.readURI(b.URI)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(data) < b.ByteLength {
+		return nil, fmt.Errorf("buffer %d is shorter than its byte length", idx)
+	}
+	l.buffers[idx] = data
+	return data, nil
+}
+
+// readURI reads the data of a data URI or a file relative to the
+// directory of the asset.
+func (l *gltfLoader) readURI(uri string) ([]byte, error) {
+	if strings.HasPrefix(uri, "data:") {
+		i := strings.Index(uri, ";base64,")
+		if i < 0 {
+			return nil, errors.New("only base64 data uris are supported")
+		}
+		return base64.StdEncoding.DecodeString(uri[i+len(";base64,"):])
+	}
+	path := filepath.FromSlash(uriUnescape(uri))
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(l.dir, path)
+	}
+	return os.ReadFile(path)
+}
+
+// uriUnescape decodes percent-encoded characters of a relative URI.
+func uriUnescape(uri string) string {
+	if !strings.Contains(uri, "%") {
+		return uri
+	}
+	var b strings.Builder
+	for i := 0; i < len(uri); i++ {
+		if uri[i] == '%' && i+2 < len(uri) {
+			var c byte
+			if _, err := fmt.Sscanf(uri[i+1:i+3], "%02x", &c); err == nil {
+				b.WriteByte(c)
+				i += 2
+				continue
+			}
+		}
+		b.WriteByte(uri[i])
+	}
+	return b.String()
+}
+
+func (l *gltfLoader) loadMaterial(idx int) (material.Material, error) {
+	if idx < 0 || idx >= len(l.doc.Materials) {
+		return nil, fmt.Errorf("loader: gltf material %d does not exist", idx)
+	}
+	if l.mats[idx] != nil {
+		return l.mats[idx], nil
+	}
+	m := &l.doc.Materials[idx]
+
+	factor := [4]float64{1, 1, 1, 1}
+	metallic, roughness := 1.0, 1.0
+	var baseTex *gltfTextureInfo
+	if pbr := m.PBRMetallicRoughness; pbr != nil {
+		if len(pbr.BaseColorFactor) == 4 {
+			copy(factor[:], pbr.BaseColorFactor)
+		}
+		if pbr.MetallicFactor != nil {
+			metallic = *pbr.MetallicFactor
+		}
+		if pbr.RoughnessFactor != nil {
+			roughness = *pbr.RoughnessFactor
+		}
+		baseTex = pbr.BaseColorTexture
+	}
+
+	// The metallic-roughness model is approximated by the Blinn-Phong
+	// model. The shininess is derived from the Beckmann distribution
+	// with alpha = roughness^2, see
+	// http://simonstechblog.blogspot.com/2011/12/microfacet-brdf.html
+	alpha := math.Max(roughness*roughness, 1e-3)
+	shininess := math.Clamp(2/(alpha*alpha)-2, 1, 1000)
+	kSpec := (1 - roughness) * (0.04 + 0.96*metallic)
+
+	opts := []material.BlinnPhongMaterialOption{
+		material.WithBlinnPhongShininess(shininess),
+	}
+	if baseTex != nil {
+		tex, err := l.loadTexture(baseTex.Index, true)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts,
+			material.WithBlinnPhongTexture(tex),
+			material.WithBlinnPhongFactors((factor[0]+factor[1]+factor[2])/3, kSpec),
+		)
+	} else {
+		opts = append(opts,
+			material.WithBlinnPhongTexture(image.NewColorTexture(color.RGBA{
+				uint8(math.Clamp(factor[0], 0, 1)*0xff + 0.5),
+				uint8(math.Clamp(factor[1], 0, 1)*0xff + 0.5),
+				uint8(math.Clamp(factor[2], 0, 1)*0xff + 0.5),
+				uint8(math.Clamp(factor[3], 0, 1)*0xff + 0.5),
+			})),
+			material.WithBlinnPhongFactors(1, kSpec),
+		)
+	}
+	if m.NormalTexture != nil {
+		tex, err := l.loadTexture(m.NormalTexture.Index, false)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, material.WithBlinnPhongNormalMap(tex))
+	}
+
+	l.mats[idx] = material.NewBlinnPhong(opts...)
+	return l.mats[idx], nil
+}
+
+func (l *gltfLoader) loadTexture(idx int, gammaCorrection bool) (*image.Texture, error) {
+	if idx < 0 || idx >= len(l.doc.Textures) || l.doc.Textures[idx].Source == nil {
+		return nil, fmt.Errorf("loader: gltf texture %d does not exist", idx)
+	}
+	src := *l.doc.Textures[idx].Source
+	if src < 0 || src >= len(l.doc.Images) {
+		return nil, fmt.Errorf("loader: gltf image %d does not exist", src)
+	}
+
+	key := [2]int{src, 0}
+	if gammaCorrection {
+		key[1] = 1
+	}
+	if tex, ok := l.textures[key]; ok {
+		return tex, nil
+	}
+
+	img := &l.doc.Images[src]
+	var (
+		data []byte
+		err  error
+	)
+	if img.BufferView != nil {
+		data, _, err = l.readBufferView(*img.BufferView)
+	} else {
+		data, err = l.readURI(img.URI)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("loader: cannot read gltf image %d, err: %w", src, err)
+	}
+	rgba, err := decodeImage(bytes.NewReader(data), WithGammaCorrection(gammaCorrection))
+	if err != nil {
+		return nil, fmt.Errorf("loader: cannot decode gltf image %d, err: %w", src, err)
+	}
+
+	tex := image.NewTexture(
+		image.WithSource(rgba),
+		image.WithIsotropicMipMap(true),
+	)
+	l.textures[key] = tex
+	return tex, nil
+}
+
+func (l *gltfLoader) loadCamera(idx int, world math.Mat4) (camera.Interface, error) {
+	if idx < 0 || idx >= len(l.doc.Cameras) {
+		return nil, fmt.Errorf("loader: gltf camera %d does not exist", idx)
+	}
+	c := &l.doc.Cameras[idx]
+
+	// A glTF camera looks towards -Z with +Y up in its local space.
+	pos := math.NewVec4(0, 0, 0, 1).Apply(world).ToVec3()
+	dir := math.NewVec4(0, 0, -1, 0).Apply(world).ToVec3().Unit()
+	up := math.NewVec4(0, 1, 0, 0).Apply(world).ToVec3().Unit()
+	target := pos.Add(dir)
+
+	switch c.Type {
+	case "perspective":
+		p := c.Perspective
+		if p == nil {
+			return nil, fmt.Errorf("loader: gltf camera %d does not have perspective parameters", idx)
+		}
+		aspect := p.AspectRatio
+		if aspect == 0 {
+			aspect = 1
+		}
+		far := p.Zfar
+		if far == 0 {
+			// An infinite projection is approximated with a far plane.
+			far = p.Znear * 1e6
+		}
+		return camera.NewPerspective(pos, target, up,
+			math.RadToDeg(p.Yfov), aspect, p.Znear, far), nil
+	case "orthographic":
+		o := c.Orthographic
+		if o == nil {
+			return nil, fmt.Errorf("loader: gltf camera %d does not have orthographic parameters", idx)
+		}
+		// The near and far planes of an orthographic camera are view
+		// space coordinates.
+		return camera.NewOrthographic(pos, target, up,
+			-o.Xmag, o.Xmag, -o.Ymag, o.Ymag, -o.Znear, -o.Zfar), nil
+	}
+	return nil, fmt.Errorf("loader: gltf camera %d has invalid type %s", idx, c.Type)
+}
+
+func (l *gltfLoader) loadLight(idx int, world math.Mat4) (object.Object, error) {
+	ext := l.doc.Extensions
+	if ext == nil || ext.LightsPunctual == nil || idx < 0 || idx >= len(ext.LightsPunctual.Lights) {
+		return nil, fmt.Errorf("loader: gltf light %d does not exist", idx)
+	}
+	li := &ext.LightsPunctual.Lights[idx]
+
+	c := color.RGBA{255, 255, 255, 255}
+	if len(li.Color) == 3 {
+		c.R = uint8(math.Clamp(li.Color[0], 0, 1)*0xff + 0.5)
+		c.G = uint8(math.Clamp(li.Color[1], 0, 1)*0xff + 0.5)
+		c.B = uint8(math.Clamp(li.Color[2], 0, 1)*0xff + 0.5)
+	}
+	intensity := 1.0
+	if li.Intensity != nil {
+		intensity = *li.Intensity
+	}
+
+	pos := math.NewVec4(0, 0, 0, 1).Apply(world).ToVec3()
+	switch li.Type {
+	case "directional":
+		dir := math.NewVec4(0, 0, -1, 0).Apply(world).ToVec3()
+		return light.NewDirectional(
+			light.WithDirectionalLightPosition(pos),
+			light.WithDirectionalLightDirection(dir),
+			light.WithDirectionalLightIntensity(intensity),
+			light.WithDirectionalLightColor(c),
+		), nil
+	case "point", "spot":
+		return light.NewPoint(
+			light.WithPointLightPosition(pos),
+			light.WithPointLightIntensity(intensity),
+			light.WithPointLightColor(c),
+		), nil
+	}
+	return nil, fmt.Errorf("loader: gltf light %d has invalid type %s", idx, li.Type)
+}
+
+// WithGLTFBinary writes a .glb container instead of a .gltf document
+// with an embedded buffer.
+func WithGLTFBinary(enable bool) WriteGLTFOption {
+	return func(o *GLTFOption) {
+		o.binary = enable
+	}
+}
+
+// SaveGLTF writes the given scene as a glTF 2.0 asset. Groups are saved
+// as nodes that preserve the transformations of the scene graph, and
+// each mesh is saved with all its vertex attributes. Attributes other
+// than positions, normals, texture coordinates and colors are saved as
+// application-specific attributes, e.g. "_CONFIDENCE".
+//
+// The camera of the scene and all point and directional lights are
+// saved as root nodes at their world space location. Blinn-Phong
+// materials are approximated by the metallic-roughness model.
+func SaveGLTF(w io.Writer, s *scene.Scene, opts ...WriteGLTFOption) error {
+	option := &GLTFOption{
+		binary: false,
+	}
+	for _, opt := range opts {
+		opt(option)
+	}
+
+	e := &gltfExporter{
+		doc: &gltfDocument{
+			Asset: gltfAsset{Version: "2.0", Generator: "poly.red"},
+		},
+		meshes:   map[geometry.Mesh]int{},
+		mats:     map[material.Material]int{},
+		textures: map[gltfTextureKey]int{},
+	}
+	if err := e.export(s); err != nil {
+		return err
+	}
+
+	if len(e.bin) > 0 {
+		b := gltfBuffer{ByteLength: len(e.bin)}
+		if !option.binary {
+			b.URI = "data:application/octet-stream;base64," + base64.StdEncoding.EncodeToString(e.bin)
+		}
+		e.doc.Buffers = []gltfBuffer{b}
+	}
+
+	if !option.binary {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(e.doc); err != nil {
+			return fmt.Errorf("loader: cannot write gltf asset, err: %w", err)
+		}
+		return nil
+	}
+
+	doc, err := json.Marshal(e.doc)
+	if err != nil {
+		return fmt.Errorf("loader: cannot write gltf asset, err: %w", err)
+	}
+	// Chunks are aligned to 4 bytes, the JSON chunk is padded with
+	// spaces and the binary chunk is padded with zeros.
+	for len(doc)%4 != 0 {
+		doc = append(doc, ' ')
+	}
+	length := 12 + 8 + len(doc)
+	if len(e.bin) > 0 {
+		length += 8 + len(e.bin)
+	}
+
+	buf := bufio.NewWriter(w)
+	binary.Write(buf, binary.LittleEndian, []uint32{glbMagic, 2, uint32(length)})
+	binary.Write(buf, binary.LittleEndian, []uint32{uint32(len(doc)), glbChunkJSON})
+	buf.Write(doc)
+	if len(e.bin) > 0 {
+		binary.Write(buf, binary.LittleEndian, []uint32{uint32(len(e.bin)), glbChunkBIN})
+		buf.Write(e.bin)
+	}
+	return buf.Flush()
+}
+
+type gltfTextureKey struct {
+	tex  *image.Texture
+	sRGB bool
+}
+
+type gltfExporter struct {
+	doc      *gltfDocument
+	bin      []byte
+	roots    []int
+	meshes   map[geometry.Mesh]int
+	mats     map[material.Material]int
+	textures map[gltfTextureKey]int
+}
+
+// gltfTransformer is implemented by objects that persist their
+// transformations with a math.TransformContext.
+type gltfTransformer interface {
+	Translation() math.Vec3
+	Scaling() math.Vec3
+	Rotation() math.Quaternion
+}
+
+func (e *gltfExporter) export(s *scene.Scene) error {
+	// An untransformed root group is omitted, so that a loaded asset
+	// can be saved without introducing an additional node.
+	root := s.Root()
+	if root.ModelMatrix().Eq(math.Mat4I) {
+		for _, c := range root.Children() {
+			n, err := e.exportGroup(c)
+			if err != nil {
+				return err
+			}
+			e.roots = append(e.roots, n)
+		}
+	} else {
+		n, err := e.exportGroup(root)
+		if err != nil {
+			return err
+		}
+		e.roots = append(e.roots, n)
+	}
+
+	if c := s.GetCamera(); c != nil {
+		e.exportCamera(c)
+	}
+	if e.doc.Extensions != nil {
+		e.doc.ExtensionsUsed = []string{"KHR_lights_punctual"}
+	}
+
+	scene := 0
+	e.doc.Scene = &scene
+	e.doc.Scenes = []gltfScene{{Nodes: e.roots}}
+	return nil
+}
+
+func (e *gltfExporter) exportGroup(g *scene.Group) (int, error) {
+	node, content := e.addNode(g.Name(), g)
+
+	if o := g.Object(); o != nil {
+		switch o.Type() {
+		case object.TypeMesh:
+			m, ok := o.(geometry.Mesh)
+			if !ok {
+				break
+			}
+			idx, err := e.exportMesh(m)
+			if err != nil {
+				return 0, err
+			}
+			if idx < 0 {
+				break
+			}
+			// The mesh is attached to a nested node if it carries
+			// its own transformations.
+			n := content
+			if !m.ModelMatrix().Eq(math.Mat4I) {
+				var inner int
+				n, inner = e.addNode("", m)
+				e.doc.Nodes[content].Children = append(e.doc.Nodes[content].Children, n)
+				n = inner
+			}
+			e.doc.Nodes[n].Mesh = &idx
+		case object.TypeLight:
+			// Lights are placed in world space regardless of their
+			// parent groups.
+			if l, ok := o.(light.Source); ok {
+				e.exportLight(l)
+			}
+		}
+	}
+
+	for _, c := range g.Children() {
+		n, err := e.exportGroup(c)
+		if err != nil {
+			return 0, err
+		}
+		e.doc.Nodes[content].Children = append(e.doc.Nodes[content].Children, n)
+	}
+	return node, nil
+}
+
+// addNode adds a node that carries the transformations of the given
+// object, and returns the node index and the index of the node that
+// should hold the content of the object.
+//
+// An object applies the scaling after the rotation, i.e. T * S * R,
+// whereas a node applies T * R * S. Both are equivalent only if the
+// scaling is uniform. Otherwise, the rotation is applied by a nested
+// node.
+func (e *gltfExporter) addNode(name string, o object.Object) (node, content int) {
+	n := gltfNode{Name: name}
+	tr, ok := o.(gltfTransformer)
+	if !ok {
+		if m := o.ModelMatrix(); !m.Eq(math.Mat4I) {
+			n.Matrix = []float64{
+				m.X00, m.X10, m.X20, m.X30,
+				m.X01, m.X11, m.X21, m.X31,
+				m.X02, m.X12, m.X22, m.X32,
+				m.X03, m.X13, m.X23, m.X33,
+			}
+		}
+		node = e.addGLTFNode(n)
+		return node, node
+	}
+
+	t, s, r := tr.Translation(), tr.Scaling(), tr.Rotation()
+	if !t.IsZero() {
+		n.Translation = []float64{t.X, t.Y, t.Z}
+	}
+	if s != math.NewVec3(1, 1, 1) {
+		n.Scale = []float64{s.X, s.Y, s.Z}
+	}
+	var rotation []float64
+	if !r.V.IsZero() {
+		l := math.Sqrt(r.A*r.A + r.V.Dot(r.V))
+		rotation = []float64{r.V.X / l, r.V.Y / l, r.V.Z / l, r.A / l}
+	}
+	if rotation != nil && s.X == s.Y && s.Y == s.Z {
+		n.Rotation = rotation
+		rotation = nil
+	}
+
+	node = e.addGLTFNode(n)
+	content = node
+	if rotation != nil {
+		content = e.addGLTFNode(gltfNode{Name: name + ".rotation", Rotation: rotation})
+		e.doc.Nodes[node].Children = append(e.doc.Nodes[node].Children, content)
+	}
+	return node, content
+}
+
+func (e *gltfExporter) addGLTFNode(n gltfNode) int {
+	e.doc.Nodes = append(e.doc.Nodes, n)
+	return len(e.doc.Nodes) - 1
+}
+
+// exportMesh exports the given mesh, and returns -1 if the mesh does
+// not contain any triangle.
+func (e *gltfExporter) exportMesh(m geometry.Mesh) (int, error) {
+	if idx, ok := e.meshes[m]; ok {
+		return idx, nil
+	}
+
+	var prims []gltfPrimitive
+	if bm, ok := m.(*geometry.BufferedMesh); ok {
+		attrs := map[geometry.AttributeName]*geometry.BufferAttribute{}
+		for _, name := range bm.AttributeNames() {
+			attrs[name] = bm.GetAttribute(name)
+		}
+		p, err := e.exportPrimitive(attrs, bm.GetVertexIndex(), bm.GetMaterial())
+		if err != nil {
+			return 0, err
+		}
+		if p != nil {
+			prims = append(prims, *p)
+		}
+	} else {
+		// Other meshes are exported per material, without sharing
+		// vertices between triangles.
+		var (
+			mats  []material.Material
+			attrs = map[material.Material]map[geometry.AttributeName]*geometry.BufferAttribute{}
+		)
+		triangles := func(f primitive.Face, mat material.Material) bool {
+			a, ok := attrs[mat]
+			if !ok {
+				a = map[geometry.AttributeName]*geometry.BufferAttribute{
+					geometry.AttributePos: geometry.NewBufferAttribute(3, nil),
+					geometry.AttributeNor: geometry.NewBufferAttribute(3, nil),
+					geometry.AttributeUV:  geometry.NewBufferAttribute(2, nil),
+					geometry.AttributeCol: geometry.NewBufferAttribute(4, nil),
+				}
+				attrs[mat] = a
+				mats = append(mats, mat)
+			}
+			f.Triangles(func(t *primitive.Triangle) bool {
+				t.Vertices(func(v *primitive.Vertex) bool {
+					pos, nor, uv, col := a[geometry.AttributePos], a[geometry.AttributeNor], a[geometry.AttributeUV], a[geometry.AttributeCol]
+					pos.Values = append(pos.Values, v.Pos.X, v.Pos.Y, v.Pos.Z)
+					nor.Values = append(nor.Values, v.Nor.X, v.Nor.Y, v.Nor.Z)
+					uv.Values = append(uv.Values, v.UV.X, v.UV.Y)
+					col.Values = append(col.Values, float64(v.Col.R), float64(v.Col.G), float64(v.Col.B), float64(v.Col.A))
+					return true
+				})
+				return true
+			})
+			return true
+		}
+		m.Faces(triangles)
+
+		for _, mat := range mats {
+			a := attrs[mat]
+			idx := make([]uint64, len(a[geometry.AttributePos].Values)/3)
+			for i := range idx {
+				idx[i] = uint64(i)
+			}
+			p, err := e.exportPrimitive(a, idx, mat)
+			if err != nil {
+				return 0, err
+			}
+			if p != nil {
+				prims = append(prims, *p)
+			}
+		}
+	}
+
+	idx := -1
+	if len(prims) > 0 {
+		e.doc.Meshes = append(e.doc.Meshes, gltfMesh{Primitives: prims})
+		idx = len(e.doc.Meshes) - 1
+	}
+	e.meshes[m] = idx
+	return idx, nil
+}
+
+// exportPrimitive exports the given vertex attributes as a triangle
+// primitive, and returns nil if there is no triangle.
+func (e *gltfExporter) exportPrimitive(
+	attrs map[geometry.AttributeName]*geometry.BufferAttribute,
+	idx []uint64, mat material.Material,
+) (*gltfPrimitive, error) {
+	idx = idx[:len(idx)/3*3]
+	if len(idx) == 0 {
+		return nil, nil
+	}
+
+	pos, ok := attrs[geometry.AttributePos]
+	if !ok || pos.Stride != 3 {
+		return nil, errors.New("loader: cannot save a mesh without positions")
+	}
+	numVerts := len(pos.Values) / 3
+	for _, i := range idx {
+		if i >= uint64(numVerts) {
+			return nil, fmt.Errorf("loader: vertex index %d out of range", i)
+		}
+	}
+
+	p := &gltfPrimitive{Attributes: map[string]int{}}
+	p.Attributes["POSITION"] = e.addAccessor(pos.Values, 3, true)
+
+	names := make([]string, 0, len(attrs))
+	for name := range attrs {
+		names = append(names, string(name))
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		a := attrs[geometry.AttributeName(name)]
+		if a.Stride < 1 || a.Stride > 4 || len(a.Values) != numVerts*a.Stride {
+			continue
+		}
+
+		switch geometry.AttributeName(name) {
+		case geometry.AttributePos:
+		case geometry.AttributeNor:
+			if a.Stride != 3 {
+				continue
+			}
+			nor := make([]float64, len(a.Values))
+			for i := 0; i < len(nor); i += 3 {
+				n := math.NewVec3(a.Values[i], a.Values[i+1], a.Values[i+2])
+				if !n.IsZero() {
+					n = n.Unit()
+				}
+				nor[i], nor[i+1], nor[i+2] = n.X, n.Y, n.Z
+			}
+			p.Attributes["NORMAL"] = e.addAccessor(nor, 3, false)
+		case geometry.AttributeUV:
+			if a.Stride != 2 {
+				continue
+			}
+			uv := make([]float64, len(a.Values))
+			for i := 0; i < len(uv); i += 2 {
+				uv[i], uv[i+1] = a.Values[i], 1-a.Values[i+1]
+			}
+			p.Attributes["TEXCOORD_0"] = e.addAccessor(uv, 2, false)
+		case geometry.AttributeCol:
+			if a.Stride != 3 && a.Stride != 4 {
+				continue
+			}
+			col := make([]float64, len(a.Values))
+			for i, v := range a.Values {
+				col[i] = math.Clamp(v/0xff, 0, 1)
+			}
+			p.Attributes["COLOR_0"] = e.addAccessor(col, a.Stride, false)
+		default:
+			p.Attributes["_"+strings.ToUpper(name)] = e.addAccessor(a.Values, a.Stride, false)
+		}
+	}
+
+	i := e.addIndices(idx)
+	p.Indices = &i
+	if mat != nil {
+		if m, ok := e.exportMaterial(mat); ok {
+			p.Material = &m
+		}
+	}
+	return p, nil
+}
+
+// addBufferView appends the given data to the binary buffer, and
+// returns the index of the buffer view that refers to the data.
+func (e *gltfExporter) addBufferView(data []byte, target int) int {
+	for len(e.bin)%4 != 0 {
+		e.bin = append(e.bin, 0)
+	}
+	e.doc.BufferViews = append(e.doc.BufferViews, gltfBufferView{
+		Buffer:     0,
+		ByteOffset: len(e.bin),
+		ByteLength: len(data),
+		Target:     target,
+	})
+	e.bin = append(e.bin, data...)
+	return len(e.doc.BufferViews) - 1
+}
+
+// addAccessor adds a float accessor for the given vertex attribute.
+func (e *gltfExporter) addAccessor(values []float64, stride int, bounds bool) int {
+	data := make([]byte, 4*len(values))
+	for i, v := range values {
+		binary.LittleEndian.PutUint32(data[4*i:], math.Float32bits(float32(v)))
+	}
+	view := e.addBufferView(data, gltfArrayBuffer)
+
+	a := gltfAccessor{
+		BufferView:    &view,
+		ComponentType: gltfFloat,
+		Count:         len(values) / stride,
+		Type:          [...]string{"SCALAR", "VEC2", "VEC3", "VEC4"}[stride-1],
+	}
+	if bounds && a.Count > 0 {
+		a.Min = make([]float64, stride)
+		a.Max = make([]float64, stride)
+		for j := 0; j < stride; j++ {
+			a.Min[j] = float64(float32(values[j]))
+			a.Max[j] = a.Min[j]
+		}
+		for i := 0; i < len(values); i += stride {
+			for j := 0; j < stride; j++ {
+				v := float64(float32(values[i+j]))
+				a.Min[j] = math.Min(a.Min[j], v)
+				a.Max[j] = math.Max(a.Max[j], v)
+			}
+		}
+	}
+	e.doc.Accessors = append(e.doc.Accessors, a)
+	return len(e.doc.Accessors) - 1
+}
+
+func (e *gltfExporter) addIndices(idx []uint64) int {
+	data := make([]byte, 4*len(idx))
+	for i, v := range idx {
+		binary.LittleEndian.PutUint32(data[4*i:], uint32(v))
+	}
+	view := e.addBufferView(data, gltfElementArrayBuffer)
+	e.doc.Accessors = append(e.doc.Accessors, gltfAccessor{
+		BufferView:    &view,
+		ComponentType: gltfUnsignedInt,
+		Count:         len(idx),
+		Type:          "SCALAR",
+	})
+	return len(e.doc.Accessors) - 1
+}
+
+// exportMaterial exports the given material, only Blinn-Phong materials
+// are supported.
+func (e *gltfExporter) exportMaterial(mat material.Material) (int, bool) {
+	if idx, ok := e.mats[mat]; ok {
+		return idx, true
+	}
+	bp, ok := mat.(*material.BlinnPhongMaterial)
+	if !ok {
+		return 0, false
+	}
+
+	// The inverse of the conversion in loadMaterial.
+	kDiff, _ := bp.Factors()
+	alpha := math.Sqrt(2 / (bp.Shininess() + 2))
+	roughness := math.Sqrt(alpha)
+	metallic := 0.0
+
+	pbr := &gltfPBR{
+		BaseColorFactor: []float64{kDiff, kDiff, kDiff, 1},
+		MetallicFactor:  &metallic,
+		RoughnessFactor: &roughness,
+	}
+	if tex := bp.Texture(); tex != nil {
+		if tex.Size() == 1 && tex.Image().Bounds().Dy() == 1 {
+			c := tex.Query(0, 0, 0)
+			pbr.BaseColorFactor[0] *= float64(c.R) / 0xff
+			pbr.BaseColorFactor[1] *= float64(c.G) / 0xff
+			pbr.BaseColorFactor[2] *= float64(c.B) / 0xff
+			pbr.BaseColorFactor[3] = float64(c.A) / 0xff
+		} else {
+			pbr.BaseColorTexture = &gltfTextureInfo{Index: e.exportTexture(tex, true)}
+		}
+	}
+	m := gltfMaterial{PBRMetallicRoughness: pbr}
+	if tex := bp.NormalMap(); tex != nil {
+		m.NormalTexture = &gltfTextureInfo{Index: e.exportTexture(tex, false)}
+	}
+
+	e.doc.Materials = append(e.doc.Materials, m)
+	e.mats[mat] = len(e.doc.Materials) - 1
+	return e.mats[mat], true
+}
+
+// exportTexture embeds the source image of the given texture as a PNG
+// image. Color textures are stored in linear space and converted to
+// sRGB space.
+func (e *gltfExporter) exportTexture(tex *image.Texture, sRGB bool) int {
+	key := gltfTextureKey{tex, sRGB}
+	if idx, ok := e.textures[key]; ok {
+		return idx
+	}
+
+	img := *tex.Image()
+	img.Pix = append([]uint8(nil), img.Pix...)
+	if sRGB {
+		for i := 0; i < len(img.Pix); i += 4 {
+			img.Pix[i+0] = uint8(color.FromLinear2sRGB(float64(img.Pix[i+0])/0xff)*0xff + 0.5)
+			img.Pix[i+1] = uint8(color.FromLinear2sRGB(float64(img.Pix[i+1])/0xff)*0xff + 0.5)
+			img.Pix[i+2] = uint8(color.FromLinear2sRGB(float64(img.Pix[i+2])/0xff)*0xff + 0.5)
+		}
+	}
+	buf := &bytes.Buffer{}
+	// Encoding an in-memory RGBA image to a bytes.Buffer cannot fail.
+	png.Encode(buf, &img)
+
+	view := e.addBufferView(buf.Bytes(), 0)
+	e.doc.Images = append(e.doc.Images, gltfImage{MimeType: "image/png", BufferView: &view})
+	src := len(e.doc.Images) - 1
+	e.doc.Textures = append(e.doc.Textures, gltfTexture{Source: &src})
+	e.textures[key] = len(e.doc.Textures) - 1
+	return e.textures[key]
+}
+
+func (e *gltfExporter) exportCamera(c camera.Interface) {
+	var gc gltfCamera
+	switch cam := c.(type) {
+	case *camera.Perspective:
+		near, far := cam.Clip()
+		gc = gltfCamera{Type: "perspective", Perspective: &gltfPerspective{
+			AspectRatio: cam.Aspect(),
+			Yfov:        math.DegToRad(cam.Fov()),
+			Znear:       near,
+			Zfar:        far,
+		}}
+	case *camera.Orthographic:
+		// An asymmetric viewing volume cannot be represented, and
+		// its center is moved to the viewing direction.
+		left, right, bottom, top, near, far := cam.Clip()
+		gc = gltfCamera{Type: "orthographic", Orthographic: &gltfOrthographic{
+			Xmag:  (right - left) / 2,
+			Ymag:  (top - bottom) / 2,
+			Znear: math.Max(-near, 0),
+			Zfar:  -far,
+		}}
+	default:
+		return
+	}
+	e.doc.Cameras = append(e.doc.Cameras, gc)
+	idx := len(e.doc.Cameras) - 1
+
+	pos := c.Position()
+	target, up := c.LookAt()
+	e.roots = append(e.roots, e.addGLTFNode(gltfNode{
+		Name:        "camera",
+		Camera:      &idx,
+		Translation: []float64{pos.X, pos.Y, pos.Z},
+		Rotation:    gltfLookAt(target.Sub(pos), up),
+	}))
+}
+
+func (e *gltfExporter) exportLight(l light.Source) {
+	c := l.Color()
+	gl := gltfLight{
+		Color: []float64{
+			float64(c.R) / 0xff,
+			float64(c.G) / 0xff,
+			float64(c.B) / 0xff,
+		},
+	}
+	intensity := l.Intensity()
+	gl.Intensity = &intensity
+
+	pos := l.Position()
+	n := gltfNode{Translation: []float64{pos.X, pos.Y, pos.Z}}
+	switch li := l.(type) {
+	case *light.Point:
+		gl.Type = "point"
+	case *light.Directional:
+		gl.Type = "directional"
+		n.Rotation = gltfLookAt(li.Dir(), math.NewVec3(0, 1, 0))
+	default:
+		return
+	}
+
+	if e.doc.Extensions == nil {
+		e.doc.Extensions = &gltfExtensions{LightsPunctual: &gltfLights{}}
+	}
+	lights := e.doc.Extensions.LightsPunctual
+	lights.Lights = append(lights.Lights, gl)
+	n.Name = fmt.Sprintf("light%d", len(lights.Lights)-1)
+	n.Extensions = &gltfNodeExtensions{
+		LightsPunctual: &gltfNodeLight{Light: len(lights.Lights) - 1},
+	}
+	e.roots = append(e.roots, e.addGLTFNode(n))
+}
+
+// gltfLookAt returns the rotation, as a quaternion in x, y, z, w order,
+// that turns the -Z axis towards the given direction and keeps the +Y
+// axis close to the given up direction.
+func gltfLookAt(dir, up math.Vec3) []float64 {
+	z := dir.Unit().Scale(-1, -1, -1)
+	x := up.Cross(z)
+	if x.IsZero() {
+		// The up direction is parallel to the direction.
+		if math.Abs(z.X) < 0.9 {
+			x = math.NewVec3(1, 0, 0).Cross(z)
+		} else {
+			x = math.NewVec3(0, 1, 0).Cross(z)
+		}
+	}
+	x = x.Unit()
+	y := z.Cross(x)
+	q := quaternionFromBasis(x, y, z)
+	return []float64{q.V.X, q.V.Y, q.V.Z, q.A}
+}
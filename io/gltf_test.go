@@ -0,0 +1,375 @@
+// Copyright 2021 Changkun Ou <changkun.de>. All rights reserved.
+// Use of this source code is governed by a GPLv3 license that
+// can be found in the LICENSE file.
+
+package io_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"testing"
+
+	"poly.red/camera"
+	"poly.red/color"
+	"poly.red/geometry"
+	"poly.red/geometry/primitive"
+	"poly.red/image"
+	"poly.red/io"
+	"poly.red/light"
+	"poly.red/material"
+	"poly.red/math"
+	"poly.red/object"
+	"poly.red/scene"
+)
+
+// gltfTriangle returns the binary buffer of a textured triangle, and a
+// glTF document that refers to the buffer using the given uri.
+func gltfTriangle(uri string) ([]byte, string) {
+	buf := &bytes.Buffer{}
+	for _, v := range []float32{
+		0, 0, 0, 1, 0, 0, 0, 1, 0, // POSITION
+		0, 1, 1, 1, 0, 0, // TEXCOORD_0
+	} {
+		binary.Write(buf, binary.LittleEndian, v)
+	}
+	binary.Write(buf, binary.LittleEndian, []uint16{0, 1, 2, 0})
+
+	if uri != "" {
+		uri = fmt.Sprintf(`"uri": %q,`, uri)
+	}
+	doc := fmt.Sprintf(`{
+	"asset": {"version": "2.0"},
+	"extensionsUsed": ["KHR_lights_punctual"],
+	"extensions": {"KHR_lights_punctual": {"lights": [
+		{"type": "directional", "color": [1, 0, 0], "intensity": 2}
+	]}},
+	"scene": 0,
+	"scenes": [{"nodes": [0]}],
+	"nodes": [
+		{"name": "root", "translation": [1, 0, 0], "children": [1, 2, 3]},
+		{"name": "triangle", "scale": [2, 2, 2], "mesh": 0},
+		{"name": "camera", "translation": [0, 0, 5], "camera": 0},
+		{"name": "sun", "rotation": [-0.7071068, 0, 0, 0.7071068],
+		 "extensions": {"KHR_lights_punctual": {"light": 0}}}
+	],
+	"cameras": [{"type": "perspective", "perspective": {"yfov": 0.7853982, "znear": 0.1, "zfar": 100}}],
+	"meshes": [{"primitives": [{"attributes": {"POSITION": 0, "TEXCOORD_0": 1}, "indices": 2, "material": 0}]}],
+	"materials": [{"pbrMetallicRoughness": {"baseColorFactor": [1, 0, 0, 1], "roughnessFactor": 0.5}}],
+	"accessors": [
+		{"bufferView": 0, "componentType": 5126, "count": 3, "type": "VEC3"},
+		{"bufferView": 0, "byteOffset": 36, "componentType": 5126, "count": 3, "type": "VEC2"},
+		{"bufferView": 1, "componentType": 5123, "count": 3, "type": "SCALAR"}
+	],
+	"bufferViews": [
+		{"buffer": 0, "byteLength": 60},
+		{"buffer": 0, "byteOffset": 60, "byteLength": 8}
+	],
+	"buffers": [{%s "byteLength": %d}]
+}`, uri, buf.Len())
+	return buf.Bytes(), doc
+}
+
+func TestLoadGLTF(t *testing.T) {
+	bin, doc := gltfTriangle("")
+	_, gltf := gltfTriangle("data:application/octet-stream;base64," + base64.StdEncoding.EncodeToString(bin))
+
+	// A .glb container with padded chunks.
+	json := []byte(doc)
+	for len(json)%4 != 0 {
+		json = append(json, ' ')
+	}
+	glb := &bytes.Buffer{}
+	binary.Write(glb, binary.LittleEndian, []uint32{0x46546C67, 2, uint32(12 + 8 + len(json) + 8 + len(bin))})
+	binary.Write(glb, binary.LittleEndian, []uint32{uint32(len(json)), 0x4E4F534A})
+	glb.Write(json)
+	binary.Write(glb, binary.LittleEndian, []uint32{uint32(len(bin)), 0x004E4942})
+	glb.Write(bin)
+
+	for name, data := range map[string][]byte{
+		"gltf": []byte(gltf),
+		"glb":  glb.Bytes(),
+	} {
+		t.Run(name, func(t *testing.T) {
+			s, err := io.LoadGLTF(bytes.NewReader(data))
+			if err != nil {
+				t.Fatalf("cannot load gltf: %v", err)
+			}
+			checkGLTFScene(t, s)
+		})
+	}
+}
+
+func checkGLTFScene(t *testing.T, s *scene.Scene) {
+	t.Helper()
+
+	var (
+		meshes int
+		lights int
+	)
+	s.IterObjects(func(o object.Object, modelMatrix math.Mat4) bool {
+		switch o.Type() {
+		case object.TypeMesh:
+			meshes++
+			bm := o.(*geometry.BufferedMesh)
+			if bm.NumTriangles() != 1 {
+				t.Fatalf("expect 1 triangle, got %v", bm.NumTriangles())
+			}
+			got := math.NewVec4(1, 0, 0, 1).Apply(modelMatrix)
+			want := math.NewVec4(3, 0, 0, 1)
+			if !got.Eq(want) {
+				t.Fatalf("unexpected world position, want %v, got %v", want, got)
+			}
+			uv := bm.GetAttribute(geometry.AttributeUV)
+			if uv.Values[1] != 0 || uv.Values[3] != 0 || uv.Values[5] != 1 {
+				t.Fatalf("texture coordinates are not flipped: %v", uv.Values)
+			}
+		case object.TypeLight:
+			lights++
+			d, ok := o.(*light.Directional)
+			if !ok {
+				t.Fatalf("expect a directional light, got %T", o)
+			}
+			if !d.Dir().Unit().Eq(math.NewVec3(0, -1, 0)) {
+				t.Fatalf("unexpected light direction: %v", d.Dir())
+			}
+			if d.Intensity() != 2 || d.Color().R != 255 || d.Color().G != 0 {
+				t.Fatalf("unexpected light: %v, %v", d.Intensity(), d.Color())
+			}
+		}
+		return true
+	})
+	if meshes != 1 || lights != 1 {
+		t.Fatalf("expect 1 mesh and 1 light, got %v and %v", meshes, lights)
+	}
+
+	c, ok := s.GetCamera().(*camera.Perspective)
+	if !ok {
+		t.Fatalf("expect a perspective camera, got %T", s.GetCamera())
+	}
+	if !c.Position().Eq(math.NewVec3(1, 0, 5)) || !math.ApproxEq(c.Fov(), 45, 1e-5) {
+		t.Fatalf("unexpected camera: %v, %v", c.Position(), c.Fov())
+	}
+	target, up := c.LookAt()
+	if !target.Eq(math.NewVec3(1, 0, 4)) || !up.Eq(math.NewVec3(0, 1, 0)) {
+		t.Fatalf("unexpected camera orientation: %v, %v", target, up)
+	}
+}
+
+func TestLoadGLTF_Errors(t *testing.T) {
+	_, doc := gltfTriangle("missing.bin")
+	if _, err := io.LoadGLTF(strings.NewReader(doc), io.WithGLTFDir(t.TempDir())); err == nil {
+		t.Fatalf("expect an error for a missing buffer")
+	}
+	if _, err := io.LoadGLTF(strings.NewReader(`{"asset": {"version": "1.0"}}`)); err == nil {
+		t.Fatalf("expect an error for an unsupported version")
+	}
+
+	// Malformed accessors and buffer views are rejected instead of read
+	// out of bounds.
+	bin, _ := gltfTriangle("")
+	uri := "data:application/octet-stream;base64," + base64.StdEncoding.EncodeToString(bin)
+	_, gltf := gltfTriangle(uri)
+	for _, r := range [][2]string{
+		{`"count": 3, "type": "VEC3"`, `"count": -1, "type": "VEC3"`},
+		{`"count": 3, "type": "VEC3"`, `"count": 1000000000000, "type": "VEC3"`},
+		{`"byteOffset": 36,`, `"byteOffset": -4,`},
+		{`{"buffer": 0, "byteLength": 60}`, `{"buffer": 0, "byteLength": 60, "byteStride": -12}`},
+		{`{"buffer": 0, "byteLength": 60}`, `{"buffer": 0, "byteLength": 60, "byteStride": 4}`},
+	} {
+		doc := strings.Replace(gltf, r[0], r[1], 1)
+		if _, err := io.LoadGLTF(strings.NewReader(doc)); err == nil {
+			t.Fatalf("expect an error for %s", r[1])
+		}
+	}
+
+	// A chunk that declares more bytes than the file contains.
+	glb := &bytes.Buffer{}
+	binary.Write(glb, binary.LittleEndian, []uint32{0x46546C67, 2, 0xffffffff, 0xfffffff0, 0x4E4F534A})
+	glb.WriteString(`{"asset": {"version": "2.0"}}`)
+	if _, err := io.LoadGLTF(bytes.NewReader(glb.Bytes())); err == nil {
+		t.Fatalf("expect an error for a truncated chunk")
+	}
+}
+
+func TestLoadGLTF_Transform(t *testing.T) {
+	bin, _ := gltfTriangle("")
+	uri := "data:application/octet-stream;base64," + base64.StdEncoding.EncodeToString(bin)
+	_, doc := gltfTriangle(uri)
+
+	// T * R * S with a non-uniform scaling, either as TRS properties
+	// or as a column-major matrix.
+	for name, node := range map[string]string{
+		"trs":    `"rotation": [0, 0, 0.7071068, 0.7071068], "scale": [2, 1, 1]`,
+		"matrix": `"matrix": [0, 2, 0, 0, -1, 0, 0, 0, 0, 0, 1, 0, 0, 0, 0, 1]`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			data := strings.Replace(doc, `"scale": [2, 2, 2]`, node, 1)
+			s, err := io.LoadGLTF(strings.NewReader(data))
+			if err != nil {
+				t.Fatalf("cannot load gltf: %v", err)
+			}
+			s.IterObjects(func(o object.Object, modelMatrix math.Mat4) bool {
+				if o.Type() != object.TypeMesh {
+					return true
+				}
+				got := math.NewVec4(1, 0, 0, 1).Apply(modelMatrix)
+				want := math.NewVec4(1, 2, 0, 1)
+				if !got.Eq(want) {
+					t.Fatalf("unexpected world position, want %v, got %v", want, got)
+				}
+				return true
+			})
+		})
+	}
+}
+
+func TestSaveGLTF(t *testing.T) {
+	bm := geometry.NewBufferedMesh()
+	bm.SetAttribute(geometry.AttributePos, geometry.NewBufferAttribute(3, []float64{
+		0, 0, 0, 1, 0, 0, 0, 1, 0, 0, 0, 1,
+	}))
+	bm.SetAttribute(geometry.AttributeCol, geometry.NewBufferAttribute(4, []float64{
+		255, 0, 0, 255, 0, 255, 0, 255, 0, 0, 255, 255, 255, 255, 255, 0,
+	}))
+	bm.SetAttribute("quality", geometry.NewBufferAttribute(1, []float64{
+		0.25, 0.5, 0.75, 1,
+	}))
+	bm.SetVertexIndex([]uint64{0, 2, 1, 0, 1, 3, 0, 3, 2, 1, 2, 3})
+	normalMap := image.NewTexture(image.WithSource(io.MustLoadImage("./testdata/ground.png")))
+	bm.SetMaterial(material.NewBlinnPhong(
+		material.WithBlinnPhongTexture(image.NewColorTexture(color.RGBA{255, 0, 0, 255})),
+		material.WithBlinnPhongNormalMap(normalMap),
+		material.WithBlinnPhongShininess(50),
+	))
+	bm.Translate(0, 1, 0)
+
+	// A non-uniform scaling after a rotation.
+	g := scene.NewGroup("parent")
+	g.RotateY(math.Pi / 2)
+	g.Scale(2, 1, 1)
+	g.Translate(1, 2, 3)
+	g.Add(bm)
+
+	want := scene.NewScene()
+	want.Add(g, geometry.NewPlane(1, 1))
+	want.Add(light.NewPoint(
+		light.WithPointLightPosition(math.NewVec3(1, 2, 3)),
+		light.WithPointLightIntensity(5),
+	), light.NewDirectional(
+		light.WithDirectionalLightDirection(math.NewVec3(1, -1, 0)),
+		light.WithDirectionalLightColor(color.RGBA{255, 0, 0, 255}),
+	))
+	want.SetCamera(camera.NewPerspective(
+		math.NewVec3(0, 1, 5), math.NewVec3(0, 1, 0), math.NewVec3(0, 1, 0),
+		45, 1.5, 0.1, 100,
+	))
+
+	for _, bin := range []bool{false, true} {
+		t.Run(fmt.Sprintf("binary=%v", bin), func(t *testing.T) {
+			buf := &bytes.Buffer{}
+			if err := io.SaveGLTF(buf, want, io.WithGLTFBinary(bin)); err != nil {
+				t.Fatalf("cannot save gltf: %v", err)
+			}
+			got, err := io.LoadGLTF(buf)
+			if err != nil {
+				t.Fatalf("cannot load saved gltf: %v", err)
+			}
+
+			wantVerts, wantLights := gltfWorld(want)
+			gotVerts, gotLights := gltfWorld(got)
+			if len(wantVerts) != len(gotVerts) {
+				t.Fatalf("number of meshes does not match, want %v, got %v", len(wantVerts), len(gotVerts))
+			}
+			for i := range wantVerts {
+				if len(wantVerts[i]) != len(gotVerts[i]) {
+					t.Fatalf("mesh %d does not match, want %v, got %v", i, wantVerts[i], gotVerts[i])
+				}
+				for j := range wantVerts[i] {
+					w, g := wantVerts[i][j], gotVerts[i][j]
+					if !math.ApproxEq(w.X, g.X, 1e-5) || !math.ApproxEq(w.Y, g.Y, 1e-5) || !math.ApproxEq(w.Z, g.Z, 1e-5) {
+						t.Fatalf("vertex %d of mesh %d does not match, want %v, got %v", j, i, w, g)
+					}
+				}
+			}
+
+			if len(wantLights) != len(gotLights) {
+				t.Fatalf("number of lights does not match, want %v, got %v", len(wantLights), len(gotLights))
+			}
+			for i := range wantLights {
+				w, g := wantLights[i], gotLights[i]
+				if !w.Position().Eq(g.Position()) || w.Intensity() != g.Intensity() || w.Color() != g.Color() {
+					t.Fatalf("light %d does not match, want %v, got %v", i, w, g)
+				}
+			}
+			d := gotLights[1].(*light.Directional)
+			if !d.Dir().Unit().Eq(math.NewVec3(1, -1, 0).Unit()) {
+				t.Fatalf("unexpected light direction: %v", d.Dir())
+			}
+
+			c := got.GetCamera().(*camera.Perspective)
+			target, up := c.LookAt()
+			if !c.Position().Eq(math.NewVec3(0, 1, 5)) || !target.Eq(math.NewVec3(0, 1, 4)) || !up.Eq(math.NewVec3(0, 1, 0)) {
+				t.Fatalf("unexpected camera: %v, %v, %v", c.Position(), target, up)
+			}
+			if !math.ApproxEq(c.Fov(), 45, 1e-5) || c.Aspect() != 1.5 {
+				t.Fatalf("unexpected camera parameters: %v, %v", c.Fov(), c.Aspect())
+			}
+
+			var saved *geometry.BufferedMesh
+			got.IterObjects(func(o object.Object, _ math.Mat4) bool {
+				if m, ok := o.(*geometry.BufferedMesh); ok && saved == nil {
+					saved = m
+				}
+				return true
+			})
+			q := saved.GetAttribute("quality")
+			if q == nil || q.Stride != 1 || q.Values[2] != 0.75 {
+				t.Fatalf("unexpected application-specific attribute: %v", q)
+			}
+			col := saved.GetAttribute(geometry.AttributeCol)
+			if col == nil || col.Stride != 4 || col.Values[5] != 255 || col.Values[15] != 0 {
+				t.Fatalf("unexpected colors: %v", col)
+			}
+			// The diffuse factor is merged into the base color.
+			mat := saved.GetMaterial().(*material.BlinnPhongMaterial)
+			kDiff, _ := mat.Factors()
+			diffuse := kDiff * float64(mat.Texture().Query(0, 0, 0).R) / 0xff
+			if !math.ApproxEq(mat.Shininess(), 50, 1e-5) || !math.ApproxEq(diffuse, 0.5, 1e-2) {
+				t.Fatalf("unexpected material: %v, %v", mat.Shininess(), diffuse)
+			}
+			if nm := mat.NormalMap(); nm == nil || !bytes.Equal(nm.Image().Pix, normalMap.Image().Pix) {
+				t.Fatalf("normal map does not match")
+			}
+		})
+	}
+}
+
+// gltfWorld returns the world space vertices of all meshes, and all
+// light sources of the given scene.
+func gltfWorld(s *scene.Scene) ([][]math.Vec4, []light.Source) {
+	var (
+		verts  [][]math.Vec4
+		lights []light.Source
+	)
+	s.IterObjects(func(o object.Object, modelMatrix math.Mat4) bool {
+		switch o.Type() {
+		case object.TypeMesh:
+			var vs []math.Vec4
+			o.(geometry.Mesh).Faces(func(f primitive.Face, _ material.Material) bool {
+				f.Vertices(func(v *primitive.Vertex) bool {
+					vs = append(vs, v.Pos.Apply(modelMatrix))
+					return true
+				})
+				return true
+			})
+			verts = append(verts, vs)
+		case object.TypeLight:
+			lights = append(lights, o.(light.Source))
+		}
+		return true
+	})
+	return verts, lights
+}
@@ -0,0 +1,317 @@
+// Copyright 2021 Changkun Ou <changkun.de>. All rights reserved.
+// Use of this source code is governed by a GPLv3 license that
+// can be found in the LICENSE file.
+
+package io
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	goimage "image"
+	"io"
+	"strconv"
+	"strings"
+
+	"poly.red/image"
+	"poly.red/math"
+)
+
+func init() {
+	goimage.RegisterFormat("hdr", "#?", func(r io.Reader) (goimage.Image, error) {
+		img, err := LoadHDR(r)
+		if err != nil {
+			return nil, err
+		}
+		return img, nil
+	}, func(r io.Reader) (goimage.Config, error) {
+		w, h, _, err := readHDRHeader(bufio.NewReader(r))
+		if err != nil {
+			return goimage.Config{}, err
+		}
+		return goimage.Config{ColorModel: (&image.RGBAFloat{}).ColorModel(), Width: w, Height: h}, nil
+	})
+}
+
+// hdrOrientation describes how scanlines of a .hdr file are mapped to
+// image rows.
+type hdrOrientation struct {
+	flipY bool // scanlines run from bottom to top
+	flipX bool // pixels run from right to left
+}
+
+// LoadHDR loads a Radiance .hdr (RGBE) file to a float image. Both flat
+// and run-length encoded scanlines are supported. The loaded values are
+// linear radiance, and the alpha channel is one.
+func LoadHDR(data io.Reader) (*image.RGBAFloat, error) {
+	r := bufio.NewReader(data)
+	w, h, o, err := readHDRHeader(r)
+	if err != nil {
+		return nil, err
+	}
+
+	img := image.NewRGBAFloat(image.Rect(0, 0, w, h))
+	scanline := make([]byte, 4*w)
+	for y := 0; y < h; y++ {
+		if err := readHDRScanline(r, scanline); err != nil {
+			return nil, fmt.Errorf("loader: cannot read hdr scanline %d, err: %w", y, err)
+		}
+		row := y
+		if o.flipY {
+			row = h - 1 - y
+		}
+		for x := 0; x < w; x++ {
+			col := x
+			if o.flipX {
+				col = w - 1 - x
+			}
+			e := scanline[4*x : 4*x+4 : 4*x+4]
+			img.SetRGBAFloat(col, row, rgbeToFloat(e[0], e[1], e[2], e[3]))
+		}
+	}
+	return img, nil
+}
+
+// readHDRHeader reads the header and the resolution line of a .hdr file.
+func readHDRHeader(r *bufio.Reader) (w, h int, o hdrOrientation, err error) {
+	line, err := r.ReadString('\n')
+	if err != nil || !strings.HasPrefix(line, "#?") {
+		return 0, 0, o, errors.New("loader: invalid hdr signature")
+	}
+	for {
+		line, err = r.ReadString('\n')
+		if err != nil {
+			return 0, 0, o, fmt.Errorf("loader: incomplete hdr header, err: %w", err)
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			break
+		}
+		if strings.HasPrefix(line, "FORMAT=") && line != "FORMAT=32-bit_rle_rgbe" {
+			return 0, 0, o, fmt.Errorf("loader: unsupported hdr format %s", line[len("FORMAT="):])
+		}
+	}
+
+	// The resolution line is either "-Y h +X w" or a variant that
+	// flips or transposes the image. Transposed images are rare and
+	// not supported.
+	line, err = r.ReadString('\n')
+	if err != nil {
+		return 0, 0, o, fmt.Errorf("loader: missing hdr resolution, err: %w", err)
+	}
+	fields := strings.Fields(line)
+	if len(fields) != 4 || len(fields[0]) != 2 || len(fields[2]) != 2 ||
+		fields[0][1] != 'Y' || fields[2][1] != 'X' {
+		return 0, 0, o, fmt.Errorf("loader: unsupported hdr resolution %q", strings.TrimSpace(line))
+	}
+	h, err1 := strconv.Atoi(fields[1])
+	w, err2 := strconv.Atoi(fields[3])
+	if err1 != nil || err2 != nil || w <= 0 || h <= 0 {
+		return 0, 0, o, fmt.Errorf("loader: invalid hdr resolution %q", strings.TrimSpace(line))
+	}
+	if err := checkImageSize("hdr", w, h); err != nil {
+		return 0, 0, o, err
+	}
+	o.flipY = fields[0][0] == '+'
+	o.flipX = fields[2][0] == '-'
+	return w, h, o, nil
+}
+
+// readHDRScanline reads a scanline of RGBE pixels. A scanline is either
+// flat, run-length encoded in the old format that repeats the previous
+// pixel, or run-length encoded per component in the new format.
+func readHDRScanline(r *bufio.Reader, scanline []byte) error {
+	w := len(scanline) / 4
+	head, err := r.Peek(4)
+	if err != nil {
+		return err
+	}
+	if w < 8 || w > 0x7fff || head[0] != 2 || head[1] != 2 || head[2]&0x80 != 0 {
+		return readHDRFlat(r, scanline)
+	}
+	if int(head[2])<<8|int(head[3]) != w {
+		return errors.New("scanline width mismatch")
+	}
+	r.Discard(4)
+
+	for c := 0; c < 4; c++ {
+		for x := 0; x < w; {
+			n, err := r.ReadByte()
+			if err != nil {
+				return err
+			}
+			if n > 128 {
+				// A run of the same value.
+				n -= 128
+				if x+int(n) > w {
+					return errors.New("run exceeds scanline")
+				}
+				v, err := r.ReadByte()
+				if err != nil {
+					return err
+				}
+				for ; n > 0; n-- {
+					scanline[4*x+c] = v
+					x++
+				}
+				continue
+			}
+			// A dump of different values.
+			if n == 0 || x+int(n) > w {
+				return errors.New("invalid dump length")
+			}
+			for ; n > 0; n-- {
+				v, err := r.ReadByte()
+				if err != nil {
+					return err
+				}
+				scanline[4*x+c] = v
+				x++
+			}
+		}
+	}
+	return nil
+}
+
+func readHDRFlat(r *bufio.Reader, scanline []byte) error {
+	w := len(scanline) / 4
+	shift := 0
+	for x := 0; x < w; {
+		var p [4]byte
+		if _, err := io.ReadFull(r, p[:]); err != nil {
+			return err
+		}
+		if p[0] == 1 && p[1] == 1 && p[2] == 1 {
+			// The old run-length encoding repeats the previous
+			// pixel, and consecutive runs form larger counts.
+			if x == 0 {
+				return errors.New("run without a previous pixel")
+			}
+			n := int(p[3]) << shift
+			if x+n > w {
+				return errors.New("run exceeds scanline")
+			}
+			for ; n > 0; n-- {
+				copy(scanline[4*x:4*x+4], scanline[4*x-4:4*x])
+				x++
+			}
+			shift += 8
+			continue
+		}
+		copy(scanline[4*x:4*x+4], p[:])
+		x++
+		shift = 0
+	}
+	return nil
+}
+
+// rgbeToFloat converts a RGBE pixel to linear float values.
+func rgbeToFloat(r, g, b, e byte) math.Vec4 {
+	if e == 0 {
+		return math.NewVec4(0, 0, 0, 1)
+	}
+	f := math.Ldexp(1, int(e)-(128+8))
+	return math.NewVec4(
+		(float64(r)+0.5)*f,
+		(float64(g)+0.5)*f,
+		(float64(b)+0.5)*f,
+		1,
+	)
+}
+
+// SaveHDR writes the given image to a Radiance .hdr file with run-length
+// encoded scanlines. The alpha channel is dropped, and negative values
+// are saved as zero.
+func SaveHDR(w io.Writer, img *image.RGBAFloat) error {
+	r := img.Bounds()
+	width, height := r.Dx(), r.Dy()
+	if width <= 0 || height <= 0 {
+		return errors.New("loader: cannot save an empty image")
+	}
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "#?RADIANCE\nFORMAT=32-bit_rle_rgbe\n\n-Y %d +X %d\n", height, width)
+	scanline := make([]byte, 4*width)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			e := floatToRGBE(img.RGBAFloatAt(r.Min.X+x, r.Min.Y+y))
+			copy(scanline[4*x:4*x+4], e[:])
+		}
+		writeHDRScanline(bw, scanline)
+	}
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("loader: cannot write hdr file, err: %w", err)
+	}
+	return nil
+}
+
+// writeHDRScanline writes a scanline of RGBE pixels. Scanlines whose
+// width is out of the range of the new run-length encoding are flat.
+func writeHDRScanline(w *bufio.Writer, scanline []byte) {
+	const minRun = 4
+
+	width := len(scanline) / 4
+	if width < 8 || width > 0x7fff {
+		w.Write(scanline)
+		return
+	}
+	w.Write([]byte{2, 2, byte(width >> 8), byte(width)})
+
+	comp := make([]byte, width)
+	for c := 0; c < 4; c++ {
+		for x := range comp {
+			comp[x] = scanline[4*x+c]
+		}
+		for x := 0; x < width; {
+			// Find the next run that is worth encoding.
+			start := x
+			run := 0
+			for start < width {
+				run = 1
+				for start+run < width && run < 127 && comp[start+run] == comp[start] {
+					run++
+				}
+				if run >= minRun {
+					break
+				}
+				start += run
+			}
+			if run < minRun {
+				start = width
+			}
+
+			// Dump the values before the run.
+			for x < start {
+				n := start - x
+				if n > 128 {
+					n = 128
+				}
+				w.WriteByte(byte(n))
+				w.Write(comp[x : x+n])
+				x += n
+			}
+			if start < width {
+				w.WriteByte(byte(128 + run))
+				w.WriteByte(comp[start])
+				x = start + run
+			}
+		}
+	}
+}
+
+// floatToRGBE converts linear float values to a RGBE pixel, where the
+// components share the exponent of the largest one.
+func floatToRGBE(c math.Vec4) [4]byte {
+	v := math.Max(c.X, math.Max(c.Y, c.Z))
+	if v < 1e-32 {
+		return [4]byte{}
+	}
+	m, e := math.Frexp(v)
+	f := m * 256 / v
+	return [4]byte{
+		byte(math.Max(c.X, 0) * f),
+		byte(math.Max(c.Y, 0) * f),
+		byte(math.Max(c.Z, 0) * f),
+		byte(e + 128),
+	}
+}
@@ -0,0 +1,121 @@
+// Copyright 2021 Changkun Ou <changkun.de>. All rights reserved.
+// Use of this source code is governed by a GPLv3 license that
+// can be found in the LICENSE file.
+
+package io_test
+
+import (
+	"bytes"
+	goimage "image"
+	"strings"
+	"testing"
+
+	"poly.red/image"
+	"poly.red/io"
+	"poly.red/math"
+)
+
+func TestLoadHDR(t *testing.T) {
+	// A 8x2 image, the first scanline is run-length encoded per
+	// component, the second scanline is flat and repeats its first
+	// pixel using the old run-length encoding.
+	buf := bytes.NewBufferString("#?RADIANCE\n# comment\nFORMAT=32-bit_rle_rgbe\n\n-Y 2 +X 8\n")
+	buf.Write([]byte{2, 2, 0, 8})
+	buf.Write([]byte{128 + 8, 128})                // r: 8 times 128
+	buf.Write([]byte{8, 0, 0, 0, 0, 0, 0, 0, 255}) // g: dump of 8 values
+	buf.Write([]byte{128 + 8, 0})                  // b: 8 times 0
+	buf.Write([]byte{128 + 8, 129})                // e: 8 times 129
+	buf.Write([]byte{128, 64, 32, 130, 1, 1, 1, 7})
+
+	img, err := io.LoadHDR(buf)
+	if err != nil {
+		t.Fatalf("cannot load hdr: %v", err)
+	}
+	if img.Bounds().Dx() != 8 || img.Bounds().Dy() != 2 {
+		t.Fatalf("unexpected size: %v", img.Bounds())
+	}
+
+	tests := []struct {
+		x, y int
+		want math.Vec4
+	}{
+		// (v+0.5) * 2^(e-136)
+		{0, 0, math.NewVec4(128.5/128, 0.5/128, 0.5/128, 1)},
+		{7, 0, math.NewVec4(128.5/128, 255.5/128, 0.5/128, 1)},
+		{0, 1, math.NewVec4(128.5/64, 64.5/64, 32.5/64, 1)},
+		{7, 1, math.NewVec4(128.5/64, 64.5/64, 32.5/64, 1)},
+	}
+	for _, tt := range tests {
+		if got := img.RGBAFloatAt(tt.x, tt.y); !got.Eq(tt.want) {
+			t.Fatalf("pixel (%d, %d), want %v, got %v", tt.x, tt.y, tt.want, got)
+		}
+	}
+
+	// Bottom-to-top scanlines are flipped.
+	flipped, err := io.LoadHDR(strings.NewReader("#?RGBE\n\n+Y 2 +X 1\n\x80\x00\x00\x81\x80\x00\x00\x80"))
+	if err != nil {
+		t.Fatalf("cannot load hdr: %v", err)
+	}
+	if got := flipped.RGBAFloatAt(0, 0); got.X != 128.5/256 {
+		t.Fatalf("scanlines are not flipped, got %v", got)
+	}
+
+	for _, data := range []string{
+		"P6\n",
+		"#?RADIANCE\nFORMAT=32-bit_rle_xyze\n\n-Y 1 +X 1\n\x00\x00\x00\x00",
+		"#?RADIANCE\n\n+X 1 -Y 1\n\x00\x00\x00\x00",
+		"#?RADIANCE\n\n-Y 2 +X 1\n\x00\x00\x00\x00",
+		"#?RADIANCE\n\n-Y 2000000000 +X 2000000000\n",
+	} {
+		if _, err := io.LoadHDR(strings.NewReader(data)); err == nil {
+			t.Fatalf("expect an error for %q", data)
+		}
+	}
+	// The image package dispatches to the same decoder.
+	data := "#?RADIANCE\n\n-Y 2000000000 +X 2000000000\n"
+	if _, _, err := goimage.Decode(strings.NewReader(data)); err == nil {
+		t.Fatalf("expect an error for an oversized hdr image")
+	}
+}
+
+func TestSaveHDR(t *testing.T) {
+	// Runs and dumps of different lengths in a scanline, and a narrow
+	// image whose scanlines are flat.
+	for _, w := range []int{300, 3} {
+		img := image.NewRGBAFloat(goimage.Rect(0, 0, w, 2))
+		for x := 0; x < w; x++ {
+			v := 0.0
+			if x%50 < 20 {
+				v = float64(x%7) + 0.25
+			}
+			img.SetRGBAFloat(x, 0, math.NewVec4(v, 1000, 0.001, 1))
+			img.SetRGBAFloat(x, 1, math.NewVec4(float64(x)/float64(w), -1, 0, 0))
+		}
+
+		buf := &bytes.Buffer{}
+		if err := io.SaveHDR(buf, img); err != nil {
+			t.Fatalf("cannot save hdr: %v", err)
+		}
+		got, err := io.LoadHDR(buf)
+		if err != nil {
+			t.Fatalf("cannot load saved hdr: %v", err)
+		}
+		for y := 0; y < 2; y++ {
+			for x := 0; x < w; x++ {
+				want := img.RGBAFloatAt(x, y)
+				g := got.RGBAFloatAt(x, y)
+				// RGBE keeps 8 bits of precision relative to the
+				// largest component, negative values become zero.
+				tol := math.Max(want.X, math.Max(want.Y, want.Z)) / 128
+				for _, c := range [][2]float64{{want.X, g.X}, {want.Y, g.Y}, {want.Z, g.Z}} {
+					if math.Abs(math.Max(c[0], 0)-c[1]) > tol {
+						t.Fatalf("pixel (%d, %d), want %v, got %v", x, y, want, g)
+					}
+				}
+				if g.W != 1 {
+					t.Fatalf("pixel (%d, %d), alpha is not one: %v", x, y, g)
+				}
+			}
+		}
+	}
+}
@@ -5,16 +5,21 @@
 package io
 
 import (
+	"bufio"
 	"fmt"
 	"image"
 	"image/draw"
+	"io"
 	"os"
+	"path/filepath"
 	"runtime"
+	"strings"
 
 	_ "image/jpeg"
 	_ "image/png"
 
 	"poly.red/color"
+	pimage "poly.red/image"
 	"poly.red/utils"
 )
 
@@ -41,22 +46,96 @@ func MustLoadImage(path string, opts ...ReadImageOption) *image.RGBA {
 }
 
 func LoadImage(path string, opts ...ReadImageOption) (*image.RGBA, error) {
-	option := &ImageOption{
-		gammaCorrection: false,
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("loader: cannot open file %s, err: %w", path, err)
 	}
-	for _, opt := range opts {
-		opt(option)
+	data, err := decodeImage(f, opts...)
+	f.Close()
+	if err != nil {
+		return nil, fmt.Errorf("loader: cannot load texture, path: %s, err: %w", path, err)
 	}
+	return data, nil
+}
 
+// LoadFloatImage loads a given file to a float image. Radiance .hdr,
+// portable float map and OpenEXR files keep their high dynamic range
+// values. Other formats are scaled to [0, 1], where the gamma
+// correction converts the values from sRGB to linear space.
+func LoadFloatImage(path string, opts ...ReadImageOption) (*pimage.RGBAFloat, error) {
 	f, err := os.Open(path)
 	if err != nil {
 		return nil, fmt.Errorf("loader: cannot open file %s, err: %w", path, err)
 	}
-	img, _, err := image.Decode(f)
-	f.Close()
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	var img *pimage.RGBAFloat
+	head, _ := r.Peek(len(exrMagic))
+	switch {
+	case string(head) == exrMagic:
+		img, err = LoadEXR(r)
+	case len(head) >= 2 && string(head[:2]) == "#?":
+		img, err = LoadHDR(r)
+	case len(head) >= 3 && (string(head[:3]) == "PF\n" || string(head[:3]) == "Pf\n"):
+		img, err = LoadPFM(r)
+	default:
+		var data *image.RGBA
+		data, err = decodeImage(r, opts...)
+		if err == nil {
+			img = pimage.NewRGBAFloat(data.Bounds())
+			for i, v := range data.Pix {
+				img.Pix[i] = float32(v) / 0xff
+			}
+		}
+	}
 	if err != nil {
 		return nil, fmt.Errorf("loader: cannot load texture, path: %s, err: %w", path, err)
 	}
+	return img, nil
+}
+
+// SaveFloatImage saves the given float image to a file without clamping
+// its values. The format is chosen by the file extension, which is one
+// of .exr, .pfm and .hdr.
+func SaveFloatImage(path string, img *pimage.RGBAFloat) (err error) {
+	var save func(w io.Writer, img *pimage.RGBAFloat) error
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".exr":
+		save = func(w io.Writer, img *pimage.RGBAFloat) error { return SaveEXR(w, img) }
+	case ".pfm":
+		save = SavePFM
+	case ".hdr":
+		save = SaveHDR
+	default:
+		return fmt.Errorf("loader: unsupported float image format %s", filepath.Ext(path))
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("loader: cannot create file %s, err: %w", path, err)
+	}
+	defer func() {
+		if cerr := f.Close(); err == nil && cerr != nil {
+			err = fmt.Errorf("loader: cannot close file %s, err: %w", path, cerr)
+		}
+	}()
+	return save(f, img)
+}
+
+// decodeImage decodes an image from the given reader.
+func decodeImage(r io.Reader, opts ...ReadImageOption) (*image.RGBA, error) {
+	option := &ImageOption{
+		gammaCorrection: false,
+	}
+	for _, opt := range opts {
+		opt(option)
+	}
+
+	img, _, err := image.Decode(r)
+	if err != nil {
+		return nil, err
+	}
 
 	var data *image.RGBA
 	if v, ok := img.(*image.RGBA); ok {
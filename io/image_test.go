@@ -5,12 +5,17 @@
 package io_test
 
 import (
+	"image"
 	"image/color"
 	"image/png"
+	"math"
 	"os"
+	"path/filepath"
 	"testing"
 
+	pimage "poly.red/image"
 	"poly.red/io"
+	pmath "poly.red/math"
 )
 
 func TestLoadImage(t *testing.T) {
@@ -52,3 +57,56 @@ func BenchmarkLoadImage(b *testing.B) {
 		}
 	})
 }
+
+func TestLoadFloatImage(t *testing.T) {
+	img, err := io.LoadFloatImage("./testdata/ground.png")
+	if err != nil {
+		t.Fatalf("cannot load float image: %v", err)
+	}
+	want := io.MustLoadImage("./testdata/ground.png")
+	for i, v := range want.Pix {
+		if img.Pix[i] != float32(v)/0xff {
+			t.Fatalf("value %d does not match, want %v, got %v", i, float32(v)/0xff, img.Pix[i])
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "sky.exr")
+	data := encodeEXR(t, 1, 1, 0, exrChannel{"R", 2, []uint32{math.Float32bits(42)}})
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatalf("cannot write file: %v", err)
+	}
+	img, err = io.LoadFloatImage(path)
+	if err != nil {
+		t.Fatalf("cannot load float image: %v", err)
+	}
+	if got := img.RGBAFloatAt(0, 0); got.X != 42 || got.W != 1 {
+		t.Fatalf("unexpected value: %v", got)
+	}
+}
+
+func TestSaveFloatImage(t *testing.T) {
+	img := pimage.NewRGBAFloat(image.Rect(0, 0, 2, 1))
+	img.SetRGBAFloat(0, 0, pmath.NewVec4(42, 0.5, 0, 1))
+	img.SetRGBAFloat(1, 0, pmath.NewVec4(0, 2, 4, 1))
+
+	// Radiance files keep 8 bits of precision per component.
+	for ext, tol := range map[string]float64{".exr": 0, ".pfm": 0, ".hdr": 42.0 / 128} {
+		path := filepath.Join(t.TempDir(), "render"+ext)
+		if err := io.SaveFloatImage(path, img); err != nil {
+			t.Fatalf("cannot save float image: %v", err)
+		}
+		got, err := io.LoadFloatImage(path)
+		if err != nil {
+			t.Fatalf("cannot load saved float image: %v", err)
+		}
+		for x := 0; x < 2; x++ {
+			if g, want := got.RGBAFloatAt(x, 0), img.RGBAFloatAt(x, 0); g.Sub(want).Len() > tol {
+				t.Fatalf("%s pixel %d, want %v, got %v", ext, x, want, g)
+			}
+		}
+	}
+
+	if err := io.SaveFloatImage(filepath.Join(t.TempDir(), "render.png"), img); err == nil {
+		t.Fatalf("expect an error for unsupported format")
+	}
+}
@@ -5,24 +5,105 @@
 package io
 
 import (
+	"bufio"
 	"fmt"
 	_ "image/jpeg"
 	_ "image/png"
+	"io"
 	"os"
+	"path/filepath"
 
 	"poly.red/geometry"
 )
 
-// MustLoadMesh loads a given file to a triangle mesh.
+// MustLoadMesh loads a given file to a triangle mesh, and panics if the
+// file cannot be loaded. See LoadMesh.
 func MustLoadMesh(path string) geometry.Mesh {
+	m, err := LoadMesh(path)
+	if err != nil {
+		panic(err)
+	}
+	return m
+}
+
+// LoadMesh loads a given file to a mesh. The format is selected by the
+// file extension and falls back to the magic header of the file, see
+// RegisterFormat. Material libraries and textures referenced by the
+// file are resolved relative to the directory of the file.
+func LoadMesh(path string) (geometry.Mesh, error) {
 	f, err := os.Open(path)
 	if err != nil {
-		panic(fmt.Errorf("loader: cannot open file %s, err: %v", path, err))
+		return nil, fmt.Errorf("loader: cannot open file %s, err: %w", path, err)
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	format, ok := formatByExt(path, func(f *format) bool { return f.decode != nil })
+	if !ok {
+		format, ok = formatByMagic(r)
 	}
-	m, err := LoadOBJ(f)
-	f.Close()
+	if !ok {
+		return nil, fmt.Errorf("loader: cannot load model, path: %s, err: %w", path, ErrFormat)
+	}
+
+	m, err := format.decode(r, filepath.Dir(path))
 	if err != nil {
-		panic(fmt.Errorf("cannot load obj model, path: %s, err: %v", path, err))
+		return nil, fmt.Errorf("loader: cannot load %s model, path: %s, err: %w", format.name, path, err)
 	}
-	return m
+	return m, nil
+}
+
+// SaveMesh writes the given mesh to a file. The format is selected by
+// the file extension, see RegisterFormat.
+func SaveMesh(path string, m geometry.Mesh) (err error) {
+	format, ok := formatByExt(path, func(f *format) bool { return f.encode != nil })
+	if !ok {
+		return fmt.Errorf("loader: cannot save model, path: %s, err: %w", path, ErrFormat)
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("loader: cannot create file %s, err: %w", path, err)
+	}
+	defer func() {
+		if cerr := f.Close(); err == nil && cerr != nil {
+			err = fmt.Errorf("loader: cannot close file %s, err: %w", path, cerr)
+		}
+	}()
+
+	if err := format.encode(f, m); err != nil {
+		return fmt.Errorf("loader: cannot save %s model, path: %s, err: %w", format.name, path, err)
+	}
+	return nil
+}
+
+// maxInt is the largest int, which bounds the sizes that are computed
+// from the untrusted counts of a file.
+const maxInt = int(^uint(0) >> 1)
+
+// maxImagePixels is the largest number of pixels of a loaded float
+// image, which bounds the allocation of an image whose size is only
+// declared by the header of a file.
+const maxImagePixels = 1 << 28
+
+// checkImageSize returns an error if an image of the given size is
+// empty or has more than maxImagePixels pixels.
+func checkImageSize(format string, w, h int) error {
+	if w <= 0 || h <= 0 || w > maxImagePixels/h {
+		return fmt.Errorf("loader: unsupported %s image size %dx%d", format, w, h)
+	}
+	return nil
+}
+
+// readBytes reads exactly n bytes, which are allocated as they arrive
+// rather than trusted from the declared size of a file.
+func readBytes(r io.Reader, n int64) ([]byte, error) {
+	b, err := io.ReadAll(io.LimitReader(r, n))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(b)) != n {
+		return nil, io.ErrUnexpectedEOF
+	}
+	return b, nil
 }
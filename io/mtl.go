@@ -0,0 +1,288 @@
+// Copyright 2021 Changkun Ou <changkun.de>. All rights reserved.
+// Use of this source code is governed by a GPLv3 license that
+// can be found in the LICENSE file.
+
+package io
+
+import (
+	"bufio"
+	"fmt"
+	"image/color"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"poly.red/geometry"
+	"poly.red/geometry/primitive"
+	"poly.red/image"
+	"poly.red/material"
+	"poly.red/math"
+)
+
+// mtl holds the raw parameters of a material statement in a .mtl file.
+type mtl struct {
+	kd, ks  [3]float64
+	ns      float64
+	d       float64
+	mapKd   string
+	mapBump string
+}
+
+func newMTL() *mtl {
+	return &mtl{
+		kd: [3]float64{1, 1, 1},
+		ks: [3]float64{0, 0, 0},
+		ns: 1,
+		d:  1,
+	}
+}
+
+// LoadMTL loads a .mtl material library from the given reader. The
+// returned map is keyed by the material names of the library. Relative
+// texture paths are resolved with respect to the given directory.
+func LoadMTL(data io.Reader, dir string) (map[string]material.Material, error) {
+	return loadMTL(data, dir, true)
+}
+
+// loadMTL loads a .mtl material library. Unless strict, materials whose
+// textures cannot be loaded are left out instead of failing the whole
+// library.
+func loadMTL(data io.Reader, dir string, strict bool) (map[string]material.Material, error) {
+	mtls := map[string]*mtl{}
+	names := []string{}
+
+	var cur *mtl
+	s := bufio.NewScanner(data)
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		k := fields[0]
+		args := fields[1:]
+		if k == "newmtl" {
+			if len(args) == 0 {
+				return nil, fmt.Errorf("loader: newmtl without material name")
+			}
+			name := strings.Join(args, " ")
+			cur = newMTL()
+			mtls[name] = cur
+			names = append(names, name)
+			continue
+		}
+		if cur == nil || len(args) == 0 {
+			continue
+		}
+
+		switch k {
+		case "Kd":
+			cur.kd = parseColor(args)
+		case "Ks":
+			cur.ks = parseColor(args)
+		case "Ns":
+			cur.ns = parseFloats(args[:1])[0]
+		case "d":
+			cur.d = parseFloats(args[len(args)-1:])[0]
+		case "Tr":
+			cur.d = 1 - parseFloats(args[len(args)-1:])[0]
+		case "map_Kd":
+			// Texture statements may carry options before the file
+			// name, such as "-s 1 1 1", the file name is always last.
+			cur.mapKd = args[len(args)-1]
+		case "map_Bump", "map_bump", "bump":
+			cur.mapBump = args[len(args)-1]
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, fmt.Errorf("loader: cannot read mtl file, err: %w", err)
+	}
+
+	// Color maps are converted from sRGB to linear space, whereas
+	// normal maps store vectors and are loaded as they are.
+	type texKey struct {
+		path  string
+		gamma bool
+	}
+	texs := map[texKey]*image.Texture{}
+	loadTexture := func(name string, gamma bool) (*image.Texture, error) {
+		path := name
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(dir, filepath.FromSlash(path))
+		}
+		if tex, ok := texs[texKey{path, gamma}]; ok {
+			return tex, nil
+		}
+		img, err := LoadImage(path, WithGammaCorrection(gamma))
+		if err != nil {
+			return nil, err
+		}
+		// Textures are named by their paths in the library, which are
+		// written back by SaveMTL.
+		tex := image.NewTexture(
+			image.WithSource(img),
+			image.WithIsotropicMipMap(true),
+			image.WithName(name),
+		)
+		texs[texKey{path, gamma}] = tex
+		return tex, nil
+	}
+
+	mats := make(map[string]material.Material, len(mtls))
+	for _, name := range names {
+		m := mtls[name]
+
+		opts := []material.BlinnPhongMaterialOption{
+			material.WithBlinnPhongName(name),
+		}
+		kDiff := 1.0
+		if m.mapKd != "" {
+			tex, err := loadTexture(m.mapKd, true)
+			if err != nil {
+				if !strict {
+					continue
+				}
+				return nil, fmt.Errorf("loader: cannot load material %s, err: %w", name, err)
+			}
+			opts = append(opts, material.WithBlinnPhongTexture(tex))
+			// The diffuse color modulates the texture map.
+			kDiff = (m.kd[0] + m.kd[1] + m.kd[2]) / 3
+		} else {
+			opts = append(opts, material.WithBlinnPhongTexture(
+				image.NewColorTexture(color.RGBA{
+					uint8(math.Clamp(m.kd[0], 0, 1)*0xff + 0.5),
+					uint8(math.Clamp(m.kd[1], 0, 1)*0xff + 0.5),
+					uint8(math.Clamp(m.kd[2], 0, 1)*0xff + 0.5),
+					uint8(math.Clamp(m.d, 0, 1)*0xff + 0.5),
+				}),
+			))
+		}
+		if m.mapBump != "" {
+			tex, err := loadTexture(m.mapBump, false)
+			if err != nil {
+				if !strict {
+					continue
+				}
+				return nil, fmt.Errorf("loader: cannot load material %s, err: %w", name, err)
+			}
+			opts = append(opts, material.WithBlinnPhongNormalMap(tex))
+		}
+
+		kSpec := (m.ks[0] + m.ks[1] + m.ks[2]) / 3
+		opts = append(opts, material.WithBlinnPhongFactors(kDiff, kSpec))
+		if m.ns > 0 {
+			opts = append(opts, material.WithBlinnPhongShininess(m.ns))
+		}
+		mats[name] = material.NewBlinnPhong(opts...)
+	}
+	return mats, nil
+}
+
+// SaveMTL writes the materials of the given mesh to a .mtl material
+// library. Material names match the usemtl statements written by
+// SaveOBJ, and named materials, such as the materials of LoadMTL, keep
+// their names. Faces without a material share a default material if
+// other faces have materials.
+//
+// Only Blinn-Phong materials are supported. Texture maps are written by
+// the names of their textures, see image.WithName, which are the paths
+// of the loaded library. Unnamed textures of a single color are written
+// as diffuse colors, other unnamed textures are not written.
+func SaveMTL(w io.Writer, m geometry.Mesh) error {
+	mats, names := materialNames(m)
+
+	buf := bufio.NewWriter(w)
+	for i, mat := range mats {
+		if i > 0 {
+			buf.WriteString("\n")
+		}
+		fmt.Fprintf(buf, "newmtl %s\n", names[mat])
+
+		if mat == nil {
+			mat = material.NewBlinnPhong()
+		}
+		bp, ok := mat.(*material.BlinnPhongMaterial)
+		if !ok {
+			continue
+		}
+		kDiff, kSpec := bp.Factors()
+		kd := [3]float64{kDiff, kDiff, kDiff}
+		d := 1.0
+		tex := bp.Texture()
+		if tex != nil && tex.Name() == "" && tex.Size() == 1 {
+			c := tex.Query(0, 0, 0)
+			kd[0] *= float64(c.R) / 0xff
+			kd[1] *= float64(c.G) / 0xff
+			kd[2] *= float64(c.B) / 0xff
+			d = float64(c.A) / 0xff
+		}
+		fmt.Fprintf(buf, "Ns %s\n", formatFloat(bp.Shininess()))
+		fmt.Fprintf(buf, "Kd %s %s %s\n", formatFloat(kd[0]), formatFloat(kd[1]), formatFloat(kd[2]))
+		fmt.Fprintf(buf, "Ks %s %s %s\n", formatFloat(kSpec), formatFloat(kSpec), formatFloat(kSpec))
+		fmt.Fprintf(buf, "d %s\n", formatFloat(d))
+		buf.WriteString("illum 2\n")
+		if tex != nil && tex.Name() != "" {
+			fmt.Fprintf(buf, "map_Kd %s\n", tex.Name())
+		}
+		if nm := bp.NormalMap(); nm != nil && nm.Name() != "" {
+			fmt.Fprintf(buf, "map_Bump %s\n", nm.Name())
+		}
+	}
+	return buf.Flush()
+}
+
+// materialNames collects and names the materials of a given mesh in the
+// order of their first appearance. Named Blinn-Phong materials keep
+// their names, and names are made unique by a number suffix. If any
+// face has a material, faces without a material are collected as a nil
+// material named default.
+func materialNames(m geometry.Mesh) ([]material.Material, map[material.Material]string) {
+	mats := []material.Material{}
+	names := map[material.Material]string{}
+	hasMats := false
+	m.Faces(func(f primitive.Face, mat material.Material) bool {
+		hasMats = mat != nil
+		return !hasMats
+	})
+	if !hasMats {
+		return mats, names
+	}
+
+	used := map[string]bool{}
+	m.Faces(func(f primitive.Face, mat material.Material) bool {
+		if _, ok := names[mat]; ok {
+			return true
+		}
+		name := "material"
+		switch mt := mat.(type) {
+		case nil:
+			name = "default"
+		case *material.BlinnPhongMaterial:
+			if n := strings.TrimSpace(mt.Name()); n != "" {
+				name = n
+			}
+		}
+		if used[name] || name == "material" {
+			base := name
+			for i := len(mats); used[name] || name == base; i++ {
+				name = fmt.Sprintf("%s%d", base, i)
+			}
+		}
+		used[name] = true
+		names[mat] = name
+		mats = append(mats, mat)
+		return true
+	})
+	return mats, names
+}
+
+func parseColor(args []string) [3]float64 {
+	c := parseFloats(args)
+	switch len(c) {
+	case 0:
+		return [3]float64{}
+	case 1, 2:
+		// A single value specifies a gray color.
+		return [3]float64{c[0], c[0], c[0]}
+	}
+	return [3]float64{c[0], c[1], c[2]}
+}
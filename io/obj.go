@@ -6,83 +6,484 @@ package io
 
 import (
 	"bufio"
+	"errors"
+	"fmt"
 	"io"
+	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 
 	"poly.red/color"
 	"poly.red/geometry"
 	"poly.red/geometry/primitive"
+	"poly.red/material"
 	"poly.red/math"
+	"poly.red/object"
+	"poly.red/scene"
 )
 
-// LoadOBJ loads a .obj file to a TriangleMesh object
-func LoadOBJ(data io.Reader) (geometry.Mesh, error) {
+func init() {
+	RegisterFormat("obj", []string{".obj"}, "",
+		func(r io.Reader, dir string) (geometry.Mesh, error) {
+			return LoadOBJ(r, WithOBJDir(dir))
+		},
+		func(w io.Writer, m geometry.Mesh) error {
+			return SaveOBJ(w, m)
+		})
+}
+
+// OBJOption offers custom configurations for loading and saving
+// a .obj file.
+type OBJOption struct {
+	dir    string
+	mtllib string
+	strict bool
+	quads  bool
+}
+
+type ReadOBJOption func(o *OBJOption)
+
+type WriteOBJOption func(o *OBJOption)
+
+// WithOBJDir sets the directory that is used for resolving relative
+// paths of referenced material libraries and textures. By default,
+// paths are resolved relative to the current working directory.
+func WithOBJDir(dir string) ReadOBJOption {
+	return func(o *OBJOption) {
+		o.dir = dir
+	}
+}
+
+// WithOBJStrict enables the validating parse mode. In the strict mode,
+// malformed numbers and indices, statements with too few arguments,
+// faces with less than three vertices, undefined materials, and
+// material libraries or textures that cannot be loaded are reported as
+// an *OBJError.
+//
+// By default, malformed numbers are read as zero, missing coordinates
+// are filled with zero, and undefined materials are ignored, as are
+// material libraries that cannot be read and materials whose textures
+// cannot be loaded, such that the geometry is still loaded. Indices
+// that are out of range are reported in both modes.
+func WithOBJStrict(enable bool) ReadOBJOption {
+	return func(o *OBJOption) {
+		o.strict = enable
+	}
+}
+
+// WithOBJQuads keeps the quads of a .obj file. If enabled, LoadOBJ
+// returns a *geometry.QuadMesh that consists of the quads and triangles
+// of the file, and only faces with more than four vertices are split
+// into triangles.
+func WithOBJQuads(enable bool) ReadOBJOption {
+	return func(o *OBJOption) {
+		o.quads = enable
+	}
+}
+
+// Errors that are wrapped by an *OBJError.
+var (
+	ErrInvalidNumber     = errors.New("invalid number")
+	ErrIndexOutOfRange   = errors.New("index out of range")
+	ErrTooFewArguments   = errors.New("too few arguments")
+	ErrUndefinedMaterial = errors.New("undefined material")
+)
+
+// OBJError reports a malformed statement of a .obj file.
+type OBJError struct {
+	Line  int    // line number, starting from 1
+	Token string // the malformed token, or the statement keyword
+	Err   error
+}
+
+func (e *OBJError) Error() string {
+	return fmt.Sprintf("loader: obj line %d, token %q: %v", e.Line, e.Token, e.Err)
+}
+
+func (e *OBJError) Unwrap() error {
+	return e.Err
+}
+
+// LoadOBJ loads a .obj file to a TriangleSoup object, or a QuadMesh
+// object if WithOBJQuads is enabled. Material libraries referenced by
+// mtllib statements are loaded, and the materials selected by usemtl
+// statements are attached to the corresponding faces.
+//
+// Vertices without a normal receive the normal of their face, smooth
+// normals can be computed using TriangleSoup.ComputeNormals.
+func LoadOBJ(data io.Reader, opts ...ReadOBJOption) (geometry.Mesh, error) {
+	option := &OBJOption{
+		dir:    ".",
+		strict: false,
+	}
+	for _, opt := range opts {
+		opt(option)
+	}
+
+	d, err := parseOBJ(data, option)
+	if err != nil {
+		return nil, err
+	}
+
+	// Materials are only tracked if the file uses any of them.
+	usedMtl := false
+	for _, f := range d.faces {
+		if f.mat != nil {
+			usedMtl = true
+			break
+		}
+	}
+
+	if option.quads {
+		return d.quadMesh(usedMtl), nil
+	}
+
+	var (
+		tris []*primitive.Triangle
+		mats []material.Material
+	)
+	vs, vts, vns := d.vs, d.vts, d.vns
+	for _, f := range d.faces {
+		for i := 1; i < f.n-1; i++ {
+			c1, c2, c3 := d.corners[f.start], d.corners[f.start+i], d.corners[f.start+i+1]
+			t := primitive.Triangle{}
+			t.V1.Pos = vs[c1.v]
+			t.V2.Pos = vs[c2.v]
+			t.V3.Pos = vs[c3.v]
+			t.V1.Nor = vns[c1.vn]
+			t.V2.Nor = vns[c2.vn]
+			t.V3.Nor = vns[c3.vn]
+			if t.V1.Nor.IsZero() {
+				t.V1.Nor = t.Normal()
+			}
+			if t.V2.Nor.IsZero() {
+				t.V2.Nor = t.Normal()
+			}
+			if t.V3.Nor.IsZero() {
+				t.V3.Nor = t.Normal()
+			}
+			t.V1.UV = vts[c1.vt]
+			t.V2.UV = vts[c2.vt]
+			t.V3.UV = vts[c3.vt]
+			t.V1.Col = color.FromHex("#ffffff")
+			t.V2.Col = color.FromHex("#ffffff")
+			t.V3.Col = color.FromHex("#ffffff")
+			tris = append(tris, &t)
+			if usedMtl {
+				mats = append(mats, f.mat)
+			}
+		}
+	}
+
+	m := geometry.NewTriangleSoup(tris)
+	if usedMtl {
+		m.SetFaceMaterials(mats)
+	}
+	return m, nil
+}
+
+// quadMesh converts the faces to a quad mesh. Triangles and quads are
+// kept, and larger polygons are split into triangle fans. Corners
+// without a normal receive the normal of their face.
+func (d *objData) quadMesh(usedMtl bool) *geometry.QuadMesh {
+	var (
+		faces []primitive.Face
+		mats  []material.Material
+	)
+	vertex := func(c objCorner) *primitive.Vertex {
+		return &primitive.Vertex{
+			Pos: d.vs[c.v],
+			Nor: d.vns[c.vn],
+			UV:  d.vts[c.vt],
+			Col: color.FromHex("#ffffff"),
+		}
+	}
+	add := func(f primitive.Face, mat material.Material) {
+		n := f.Normal()
+		f.Vertices(func(v *primitive.Vertex) bool {
+			if v.Nor.IsZero() {
+				v.Nor = n
+			}
+			return true
+		})
+		faces = append(faces, f)
+		if usedMtl {
+			mats = append(mats, mat)
+		}
+	}
+
+	for _, f := range d.faces {
+		cs := d.corners[f.start : f.start+f.n]
+		if f.n == 4 {
+			add(primitive.NewQuad(vertex(cs[0]), vertex(cs[1]), vertex(cs[2]), vertex(cs[3])), f.mat)
+			continue
+		}
+		for i := 1; i < f.n-1; i++ {
+			add(primitive.NewTriangle(vertex(cs[0]), vertex(cs[i]), vertex(cs[i+1])), f.mat)
+		}
+	}
+
+	m := geometry.NewQuadMesh(faces)
+	if usedMtl {
+		m.SetFaceMaterials(mats)
+	}
+	return m
+}
+
+// LoadOBJMeshes loads a .obj file to indexed buffered meshes. Corners of
+// faces that share the same position, texture coordinate and normal
+// are welded into a single vertex. Each object (o) and group (g) is
+// loaded as a separate mesh, and an object or group that uses several
+// materials is split into one mesh per material.
+//
+// Vertices without a normal receive the area weighted average of the
+// normals of their adjacent faces.
+func LoadOBJMeshes(data io.Reader, opts ...ReadOBJOption) ([]*geometry.BufferedMesh, error) {
+	g, err := LoadOBJGroup(data, opts...)
+	if err != nil {
+		return nil, err
+	}
 
-	vs := make([]math.Vec4, 1)
-	vts := make([]math.Vec4, 1, 1024)
-	vns := make([]math.Vec4, 1, 1024)
+	var meshes []*geometry.BufferedMesh
+	g.IterObjects(func(o object.Object, _ math.Mat4) bool {
+		if bm, ok := o.(*geometry.BufferedMesh); ok {
+			meshes = append(meshes, bm)
+		}
+		return true
+	})
+	return meshes, nil
+}
+
+// LoadOBJGroup loads a .obj file to a group that contains a child group
+// for each object (o) and group (g) of the file. The child groups are
+// named after the objects and groups, and contain the meshes that are
+// described in LoadOBJMeshes.
+func LoadOBJGroup(data io.Reader, opts ...ReadOBJOption) (*scene.Group, error) {
+	option := &OBJOption{
+		dir:    ".",
+		strict: false,
+	}
+	for _, opt := range opts {
+		opt(option)
+	}
 
-	var tris []*primitive.Triangle
+	d, err := parseOBJ(data, option)
+	if err != nil {
+		return nil, err
+	}
 
-	s := bufio.NewScanner(data)
-	for s.Scan() {
-		l := s.Text()
-		fields := strings.Fields(l)
-		if len(fields) == 0 { // nothing to read
+	root := scene.NewGroup("")
+	for _, og := range d.groups {
+		if og.start == og.end {
 			continue
 		}
-		k := fields[0]
-		args := fields[1:]
-		switch k {
-		case "v":
-			coord := parseFloats(args)
-			vs = append(vs, math.NewVec4(coord[0], coord[1], coord[2], 1))
-		case "vt":
-			coord := parseFloats(args)
-			vts = append(vts, math.NewVec4(coord[0], coord[1], 0, 1))
-		case "vn":
-			coord := parseFloats(args)
-			vns = append(vns, math.NewVec4(coord[0], coord[1], coord[2], 0))
-		case "f":
-			fvs := make([]int, len(args))
-			fvts := make([]int, len(args))
-			fvns := make([]int, len(args))
-			for i, arg := range args {
-				v := strings.Split(arg+"//", "/")
-				fvs[i] = parseIndex(v[0], len(vs))
-				fvts[i] = parseIndex(v[1], len(vts))
-				fvns[i] = parseIndex(v[2], len(vns))
+
+		// Faces are split by their materials in the order of the
+		// first appearance.
+		var (
+			mats  []material.Material
+			faces = map[material.Material][]objFace{}
+		)
+		for _, f := range d.faces[og.start:og.end] {
+			if _, ok := faces[f.mat]; !ok {
+				mats = append(mats, f.mat)
 			}
-			for i := 1; i < len(fvs)-1; i++ {
-				i1, i2, i3 := 0, i, i+1
-				t := primitive.Triangle{}
-				t.V1.Pos = vs[fvs[i1]]
-				t.V2.Pos = vs[fvs[i2]]
-				t.V3.Pos = vs[fvs[i3]]
-				t.V1.Nor = vns[fvns[i1]]
-				t.V2.Nor = vns[fvns[i2]]
-				t.V3.Nor = vns[fvns[i3]]
-				if t.V1.Nor.IsZero() {
-					t.V1.Nor = t.Normal()
-				}
-				if t.V2.Nor.IsZero() {
-					t.V1.Nor = t.Normal()
-				}
-				if t.V3.Nor.IsZero() {
-					t.V1.Nor = t.Normal()
+			faces[f.mat] = append(faces[f.mat], f)
+		}
+
+		g := scene.NewGroup(og.name)
+		for _, mat := range mats {
+			bm := d.weld(faces[mat])
+			bm.SetMaterial(mat)
+			g.Add(bm)
+		}
+		root.Add(g)
+	}
+	return root, nil
+}
+
+// weld converts the given faces to a buffered mesh, where corners with
+// identical position, texture coordinate and normal share a vertex.
+func (d *objData) weld(faces []objFace) *geometry.BufferedMesh {
+	hasUV := false
+	for _, f := range faces {
+		for _, c := range d.corners[f.start : f.start+f.n] {
+			if c.vt != 0 {
+				hasUV = true
+			}
+		}
+	}
+
+	type key struct {
+		v, vt, vn math.Vec4
+		smooth    bool // the corner does not have a normal
+	}
+	var (
+		index  = map[key]uint64{}
+		smooth []uint64
+		pos    []float64
+		nor    []float64
+		uv     []float64
+		idx    []uint64
+	)
+	vertex := func(c objCorner) uint64 {
+		k := key{d.vs[c.v], d.vts[c.vt], d.vns[c.vn], c.vn == 0}
+		if i, ok := index[k]; ok {
+			return i
+		}
+		i := uint64(len(pos) / 3)
+		index[k] = i
+		pos = append(pos, k.v.X, k.v.Y, k.v.Z)
+		nor = append(nor, k.vn.X, k.vn.Y, k.vn.Z)
+		if hasUV {
+			uv = append(uv, k.vt.X, k.vt.Y)
+		}
+		if k.smooth {
+			smooth = append(smooth, i)
+		}
+		return i
+	}
+
+	for _, f := range faces {
+		for i := 1; i < f.n-1; i++ {
+			c1, c2, c3 := d.corners[f.start], d.corners[f.start+i], d.corners[f.start+i+1]
+			i1, i2, i3 := vertex(c1), vertex(c2), vertex(c3)
+			idx = append(idx, i1, i2, i3)
+			if c1.vn != 0 && c2.vn != 0 && c3.vn != 0 {
+				continue
+			}
+
+			// The length of the cross product weights the face
+			// normal by the face area.
+			p1, p2, p3 := d.vs[c1.v], d.vs[c2.v], d.vs[c3.v]
+			n := p2.Sub(p1).Cross(p3.Sub(p1))
+			for _, c := range [...]struct {
+				corner objCorner
+				i      uint64
+			}{{c1, i1}, {c2, i2}, {c3, i3}} {
+				if c.corner.vn == 0 {
+					nor[3*c.i+0] += n.X
+					nor[3*c.i+1] += n.Y
+					nor[3*c.i+2] += n.Z
 				}
-				t.V1.UV = vts[fvts[i1]]
-				t.V2.UV = vts[fvts[i2]]
-				t.V3.UV = vts[fvts[i3]]
-				t.V1.Col = color.FromHex("#ffffff")
-				t.V2.Col = color.FromHex("#ffffff")
-				t.V3.Col = color.FromHex("#ffffff")
-				tris = append(tris, &t)
 			}
 		}
 	}
-	return geometry.NewTriangleSoup(tris), s.Err()
+	for _, i := range smooth {
+		n := math.NewVec4(nor[3*i], nor[3*i+1], nor[3*i+2], 0)
+		if !n.IsZero() {
+			n = n.Unit()
+		}
+		nor[3*i], nor[3*i+1], nor[3*i+2] = n.X, n.Y, n.Z
+	}
+
+	bm := geometry.NewBufferedMesh()
+	bm.SetAttribute(geometry.AttributePos, geometry.NewBufferAttribute(3, pos))
+	bm.SetAttribute(geometry.AttributeNor, geometry.NewBufferAttribute(3, nor))
+	if hasUV {
+		bm.SetAttribute(geometry.AttributeUV, geometry.NewBufferAttribute(2, uv))
+	}
+	bm.SetVertexIndex(idx)
+	return bm
+}
+
+// WithOBJMaterialLib references the given material library in the saved
+// .obj file and emits usemtl statements for the materials of the mesh.
+// The library itself can be written using SaveMTL.
+func WithOBJMaterialLib(name string) WriteOBJOption {
+	return func(o *OBJOption) {
+		o.mtllib = name
+	}
+}
+
+// SaveOBJ writes the given mesh to a .obj file. Vertex positions, texture
+// coordinates and normals are deduplicated into indexed lists. Vertices
+// are written in model space, the model matrix is not applied.
+func SaveOBJ(w io.Writer, m geometry.Mesh, opts ...WriteOBJOption) error {
+	option := &OBJOption{}
+	for _, opt := range opts {
+		opt(option)
+	}
+
+	var (
+		buf     = bufio.NewWriter(w)
+		vs      = map[math.Vec4]int{}
+		vts     = map[math.Vec4]int{}
+		vns     = map[math.Vec4]int{}
+		faces   = strings.Builder{}
+		mats    map[material.Material]string
+		usemtl  material.Material
+		started bool
+	)
+	if option.mtllib != "" {
+		_, mats = materialNames(m)
+		fmt.Fprintf(buf, "mtllib %s\n", option.mtllib)
+	}
+
+	index := func(list map[math.Vec4]int, v math.Vec4, write func(math.Vec4)) int {
+		if i, ok := list[v]; ok {
+			return i
+		}
+		i := len(list) + 1
+		list[v] = i
+		write(v)
+		return i
+	}
+	writeV := func(v math.Vec4) {
+		fmt.Fprintf(buf, "v %s %s %s\n", formatFloat(v.X), formatFloat(v.Y), formatFloat(v.Z))
+	}
+	writeVt := func(v math.Vec4) {
+		fmt.Fprintf(buf, "vt %s %s\n", formatFloat(v.X), formatFloat(v.Y))
+	}
+	writeVn := func(v math.Vec4) {
+		fmt.Fprintf(buf, "vn %s %s %s\n", formatFloat(v.X), formatFloat(v.Y), formatFloat(v.Z))
+	}
+
+	m.Faces(func(f primitive.Face, mat material.Material) bool {
+		// Faces without a material select the default material of
+		// SaveMTL, such that they do not inherit the previous material.
+		if name, ok := mats[mat]; ok && (!started || mat != usemtl) {
+			usemtl = mat
+			started = true
+			faces.WriteString("usemtl ")
+			faces.WriteString(name)
+			faces.WriteString("\n")
+		}
+
+		faces.WriteString("f")
+		f.Vertices(func(v *primitive.Vertex) bool {
+			iv := index(vs, math.NewVec4(v.Pos.X, v.Pos.Y, v.Pos.Z, 1), writeV)
+			ivt := index(vts, math.NewVec4(v.UV.X, v.UV.Y, 0, 1), writeVt)
+			ivn := index(vns, math.NewVec4(v.Nor.X, v.Nor.Y, v.Nor.Z, 0), writeVn)
+			fmt.Fprintf(&faces, " %d/%d/%d", iv, ivt, ivn)
+			return true
+		})
+		faces.WriteString("\n")
+		return true
+	})
+
+	// Vertex data are written while visiting the faces, the face
+	// statements are appended after all vertex data.
+	buf.WriteString(faces.String())
+	return buf.Flush()
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+func loadMTLFile(name, dir string, strict bool) (map[string]material.Material, error) {
+	path := filepath.FromSlash(name)
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(dir, path)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("loader: cannot open mtl file %s, err: %w", path, err)
+	}
+	defer f.Close()
+	return loadMTL(f, filepath.Dir(path), strict)
 }
 
 func parseFloats(items []string) []float64 {
@@ -93,12 +494,3 @@ func parseFloats(items []string) []float64 {
 	}
 	return result
 }
-
-func parseIndex(value string, length int) int {
-	parsed, _ := strconv.ParseInt(value, 0, 0)
-	n := int(parsed)
-	if n < 0 {
-		n += length
-	}
-	return n
-}
@@ -0,0 +1,544 @@
+// Copyright 2021 Changkun Ou <changkun.de>. All rights reserved.
+// Use of this source code is governed by a GPLv3 license that
+// can be found in the LICENSE file.
+
+package io
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"poly.red/material"
+	"poly.red/math"
+	"poly.red/utils"
+)
+
+// objData is the content of a .obj file. The first element of vs, vts
+// and vns is a placeholder that is referred by absent indices.
+type objData struct {
+	vs, vts, vns []math.Vec4
+	corners      []objCorner
+	faces        []objFace
+	groups       []objGroup
+}
+
+// objCorner is a corner of a face that refers to a position, a texture
+// coordinate and a normal.
+type objCorner struct {
+	v, vt, vn int
+}
+
+// objFace is a polygon that consists of corners[start:start+n].
+type objFace struct {
+	start, n int
+	mat      material.Material
+}
+
+// objGroup is an object or a group that consists of faces[start:end].
+type objGroup struct {
+	name       string
+	start, end int
+}
+
+// objChunkSize is the approximated size of a chunk of a .obj file that
+// is parsed by a single worker.
+var objChunkSize = 1 << 20
+
+// readOBJChunks reads a .obj file in chunks of about objChunkSize
+// bytes, each chunk ends at a line break except the last one. A line
+// that is longer than a chunk is kept in a single chunk.
+func readOBJChunks(r io.Reader) ([]*objChunk, error) {
+	var (
+		chunks []*objChunk
+		rest   []byte // the incomplete last line of the previous read
+	)
+	for {
+		buf := make([]byte, len(rest)+objChunkSize)
+		copy(buf, rest)
+		n, err := io.ReadFull(r, buf[len(rest):])
+		buf = buf[:len(rest)+n]
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			if len(buf) > 0 {
+				chunks = append(chunks, &objChunk{data: buf})
+			}
+			return chunks, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("loader: cannot read obj file, err: %w", err)
+		}
+
+		i := bytes.LastIndexByte(buf, '\n')
+		if i < 0 {
+			rest = buf
+			continue
+		}
+		chunks = append(chunks, &objChunk{data: buf[:i+1]})
+		rest = buf[i+1:]
+	}
+}
+
+// objChunk is a chunk of a .obj file that consists of complete lines.
+type objChunk struct {
+	data []byte
+	line int // the line number of the first line, starting from 1
+
+	// The number of v, vt and vn statements in the chunk, and in all
+	// preceding chunks.
+	nv, nvt, nvn int
+	ov, ovt, ovn int
+
+	// The parsed content of the chunk, indices of corners are global.
+	vs, vts, vns []math.Vec4
+	corners      []objCorner
+	faces        []objFace
+	stmts        []objStatement
+	err          error
+}
+
+// objStatement is a statement that depends on preceding chunks and is
+// therefore evaluated after all chunks are parsed.
+type objStatement struct {
+	keyword string
+	args    []string
+	face    int // the number of faces in the chunk before the statement
+	line    int
+}
+
+// parseOBJ parses a .obj file. The input is read in chunks of
+// complete lines which are parsed concurrently in two passes: the first
+// pass counts lines and vertex statements of each chunk, so that the
+// second pass can resolve relative indices and line numbers of each
+// chunk independently. Statements that refer to materials and groups
+// are evaluated sequentially at last.
+func parseOBJ(data io.Reader, option *OBJOption) (*objData, error) {
+	chunks, err := readOBJChunks(data)
+	if err != nil {
+		return nil, err
+	}
+
+	parallel(chunks, (*objChunk).count)
+	line, nv, nvt, nvn := 1, 0, 0, 0
+	for _, c := range chunks {
+		c.line, c.ov, c.ovt, c.ovn = line, nv, nvt, nvn
+		line += bytes.Count(c.data, []byte{'\n'})
+		nv, nvt, nvn = nv+c.nv, nvt+c.nvt, nvn+c.nvn
+	}
+	parallel(chunks, func(c *objChunk) { c.parse(option.strict) })
+
+	d := &objData{
+		vs:      make([]math.Vec4, 1, nv+1),
+		vts:     make([]math.Vec4, 1, nvt+1),
+		vns:     make([]math.Vec4, 1, nvn+1),
+		corners: make([]objCorner, 0, len(chunks)),
+		groups:  []objGroup{{}},
+	}
+	var (
+		mtllib = map[string]material.Material{}
+		usemtl material.Material
+	)
+	for _, c := range chunks {
+		d.vs = append(d.vs, c.vs...)
+		d.vts = append(d.vts, c.vts...)
+		d.vns = append(d.vns, c.vns...)
+
+		base := len(d.corners)
+		d.corners = append(d.corners, c.corners...)
+
+		i := 0
+		for fi := 0; fi <= len(c.faces); fi++ {
+			for ; i < len(c.stmts) && c.stmts[i].face == fi; i++ {
+				s := &c.stmts[i]
+				switch s.keyword {
+				case "mtllib":
+					for _, name := range s.args {
+						lib, err := loadMTLFile(name, option.dir, option.strict)
+						if err != nil {
+							if option.strict {
+								return nil, &OBJError{Line: s.line, Token: name, Err: err}
+							}
+							continue
+						}
+						for n, m := range lib {
+							mtllib[n] = m
+						}
+					}
+				case "usemtl":
+					name := strings.Join(s.args, " ")
+					usemtl = mtllib[name]
+					if usemtl == nil && option.strict {
+						return nil, &OBJError{Line: s.line, Token: name, Err: ErrUndefinedMaterial}
+					}
+				case "o", "g":
+					d.groups[len(d.groups)-1].end = len(d.faces)
+					d.groups = append(d.groups, objGroup{
+						name:  strings.Join(s.args, " "),
+						start: len(d.faces),
+					})
+				}
+			}
+			if fi < len(c.faces) {
+				f := c.faces[fi]
+				f.start += base
+				f.mat = usemtl
+				d.faces = append(d.faces, f)
+			}
+		}
+
+		// A chunk stops at its first error, and all statements
+		// before the error are evaluated.
+		if c.err != nil {
+			return nil, c.err
+		}
+		c.vs, c.vts, c.vns, c.corners, c.faces = nil, nil, nil, nil, nil
+	}
+	d.groups[len(d.groups)-1].end = len(d.faces)
+	return d, nil
+}
+
+// parallel calls fn for each of the given chunks concurrently.
+func parallel(chunks []*objChunk, fn func(c *objChunk)) {
+	if len(chunks) == 1 {
+		fn(chunks[0])
+		return
+	}
+	if len(chunks) == 0 {
+		return
+	}
+
+	pool := utils.NewWorkerPool(uint64(runtime.GOMAXPROCS(0)))
+	defer pool.Close()
+	pool.Add(uint64(len(chunks)))
+	for _, c := range chunks {
+		c := c
+		pool.Execute(func() { fn(c) })
+	}
+	pool.Wait()
+}
+
+// count counts the number of v, vt and vn statements of the chunk.
+func (c *objChunk) count() {
+	data := c.data
+	for len(data) > 0 {
+		var line []byte
+		line, data = objLine(data)
+		switch keyword, _ := objField(line); string(keyword) {
+		case "v":
+			c.nv++
+		case "vt":
+			c.nvt++
+		case "vn":
+			c.nvn++
+		}
+	}
+}
+
+// parse parses all statements of the chunk, and stops at the first
+// error.
+func (c *objChunk) parse(strict bool) {
+	c.vs = make([]math.Vec4, 0, c.nv)
+	c.vts = make([]math.Vec4, 0, c.nvt)
+	c.vns = make([]math.Vec4, 0, c.nvn)
+
+	p := &objParser{strict: strict, line: c.line - 1}
+	var coord [3]float64
+	data := c.data
+	for len(data) > 0 {
+		var line []byte
+		line, data = objLine(data)
+		p.line++
+
+		keyword, args := objField(line)
+		switch string(keyword) {
+		case "v":
+			if c.err = p.floats(keyword, args, coord[:], 3); c.err != nil {
+				return
+			}
+			c.vs = append(c.vs, math.NewVec4(coord[0], coord[1], coord[2], 1))
+		case "vt":
+			// The v coordinate is optional.
+			if c.err = p.floats(keyword, args, coord[:2], 1); c.err != nil {
+				return
+			}
+			c.vts = append(c.vts, math.NewVec4(coord[0], coord[1], 0, 1))
+		case "vn":
+			if c.err = p.floats(keyword, args, coord[:], 3); c.err != nil {
+				return
+			}
+			c.vns = append(c.vns, math.NewVec4(coord[0], coord[1], coord[2], 0))
+		case "f":
+			if c.err = c.face(p, args); c.err != nil {
+				return
+			}
+		case "mtllib", "usemtl", "o", "g":
+			c.stmts = append(c.stmts, objStatement{
+				keyword: string(keyword),
+				args:    strings.Fields(string(args)),
+				face:    len(c.faces),
+				line:    p.line,
+			})
+		}
+	}
+}
+
+func (c *objChunk) face(p *objParser, args []byte) error {
+	if n := objFields(args); n < 3 {
+		if p.strict {
+			return p.errorf([]byte("f"), ErrTooFewArguments)
+		}
+		return nil
+	}
+
+	start := len(c.corners)
+	// The number of elements that are defined before the face,
+	// including the placeholder.
+	lv := c.ov + len(c.vs) + 1
+	lvt := c.ovt + len(c.vts) + 1
+	lvn := c.ovn + len(c.vns) + 1
+
+	for {
+		var arg []byte
+		arg, args = objField(args)
+		if len(arg) == 0 {
+			break
+		}
+
+		// A corner is one of v, v/vt, v//vn and v/vt/vn.
+		v, vt, vn := arg, []byte(nil), []byte(nil)
+		if i := bytes.IndexByte(v, '/'); i >= 0 {
+			v, vt = arg[:i], arg[i+1:]
+			if j := bytes.IndexByte(vt, '/'); j >= 0 {
+				vt, vn = vt[:j], vt[j+1:]
+			}
+		}
+
+		var (
+			corner objCorner
+			err    error
+		)
+		if corner.v, err = p.index(arg, v, lv, false); err != nil {
+			return err
+		}
+		if corner.vt, err = p.index(arg, vt, lvt, true); err != nil {
+			return err
+		}
+		if corner.vn, err = p.index(arg, vn, lvn, true); err != nil {
+			return err
+		}
+		c.corners = append(c.corners, corner)
+	}
+
+	c.faces = append(c.faces, objFace{start: start, n: len(c.corners) - start})
+	return nil
+}
+
+// objParser parses the arguments of .obj statements and tracks the
+// current line for error reporting.
+type objParser struct {
+	strict bool
+	line   int
+}
+
+func (p *objParser) errorf(token []byte, err error) error {
+	return &OBJError{Line: p.line, Token: string(token), Err: err}
+}
+
+// floats parses the arguments of the statement k to the given values,
+// and requires at least n arguments. In the lenient mode, malformed
+// numbers are zero and missing values are filled with zero. Remaining
+// arguments, e.g. w or vertex colors, are ignored but checked in the
+// strict mode.
+func (p *objParser) floats(k, args []byte, values []float64, n int) error {
+	for i := 0; ; i++ {
+		var arg []byte
+		arg, args = objField(args)
+		if len(arg) == 0 {
+			if i < n && p.strict {
+				return p.errorf(k, ErrTooFewArguments)
+			}
+			for ; i < len(values); i++ {
+				values[i] = 0
+			}
+			return nil
+		}
+		f, ok := parseOBJFloat(arg)
+		if !ok && p.strict {
+			return p.errorf(arg, ErrInvalidNumber)
+		}
+		if i < len(values) {
+			values[i] = f
+		}
+	}
+}
+
+// index parses a one-based or negative relative index into a list of
+// the given length whose first element is a placeholder. An empty
+// optional index refers to the placeholder.
+func (p *objParser) index(token, value []byte, length int, optional bool) (int, error) {
+	if len(value) == 0 && optional {
+		return 0, nil
+	}
+	n, ok := parseOBJInt(value)
+	if !ok {
+		if p.strict {
+			return 0, p.errorf(token, ErrInvalidNumber)
+		}
+		return 0, nil
+	}
+	if n < 0 {
+		n += length
+	}
+	if n < 0 || n >= length || (n == 0 && p.strict) {
+		return 0, p.errorf(token, ErrIndexOutOfRange)
+	}
+	return n, nil
+}
+
+// objLine returns the first line of the given data without the line
+// break, and the remaining data.
+func objLine(data []byte) (line, rest []byte) {
+	i := bytes.IndexByte(data, '\n')
+	if i < 0 {
+		return data, nil
+	}
+	return data[:i], data[i+1:]
+}
+
+// objField returns the first whitespace separated field of the given
+// line, and the remaining line.
+func objField(line []byte) (field, rest []byte) {
+	i := 0
+	for i < len(line) && isOBJSpace(line[i]) {
+		i++
+	}
+	j := i
+	for j < len(line) && !isOBJSpace(line[j]) {
+		j++
+	}
+	return line[i:j], line[j:]
+}
+
+// objFields returns the number of whitespace separated fields of the
+// given line.
+func objFields(line []byte) int {
+	n := 0
+	for {
+		var field []byte
+		field, line = objField(line)
+		if len(field) == 0 {
+			return n
+		}
+		n++
+	}
+}
+
+func isOBJSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == '\v' || c == '\f'
+}
+
+// float64pow10 are the powers of ten that are exactly representable as
+// float64 values.
+var float64pow10 = [...]float64{
+	1e0, 1e1, 1e2, 1e3, 1e4, 1e5, 1e6, 1e7, 1e8, 1e9, 1e10, 1e11,
+	1e12, 1e13, 1e14, 1e15, 1e16, 1e17, 1e18, 1e19, 1e20, 1e21, 1e22,
+}
+
+// parseOBJFloat parses a decimal number without allocation. A number
+// with at most 15 significant digits and a small exponent is exactly
+// representable by its mantissa and a power of ten, so the result is
+// correctly rounded. Other numbers fall back to strconv.ParseFloat.
+func parseOBJFloat(b []byte) (float64, bool) {
+	i := 0
+	neg := false
+	if i < len(b) && (b[i] == '+' || b[i] == '-') {
+		neg = b[i] == '-'
+		i++
+	}
+
+	var (
+		mant    uint64
+		digits  int // significant digits in mant
+		exp     int
+		hasMant bool
+	)
+	for ; i < len(b) && '0' <= b[i] && b[i] <= '9'; i++ {
+		hasMant = true
+		mant = mant*10 + uint64(b[i]-'0')
+		if mant != 0 {
+			digits++
+		}
+	}
+	if i < len(b) && b[i] == '.' {
+		for i++; i < len(b) && '0' <= b[i] && b[i] <= '9'; i++ {
+			hasMant = true
+			mant = mant*10 + uint64(b[i]-'0')
+			if mant != 0 {
+				digits++
+			}
+			exp--
+		}
+	}
+	if i < len(b) && (b[i] == 'e' || b[i] == 'E') && hasMant {
+		i++
+		eneg := false
+		if i < len(b) && (b[i] == '+' || b[i] == '-') {
+			eneg = b[i] == '-'
+			i++
+		}
+		e, edigits := 0, 0
+		for ; i < len(b) && '0' <= b[i] && b[i] <= '9' && edigits < 4; i++ {
+			e = e*10 + int(b[i]-'0')
+			edigits++
+		}
+		if edigits == 0 {
+			hasMant = false
+		}
+		if eneg {
+			e = -e
+		}
+		exp += e
+	}
+
+	if i == len(b) && hasMant && digits <= 15 && -22 <= exp && exp <= 22 {
+		f := float64(mant)
+		if exp < 0 {
+			f /= float64pow10[-exp]
+		} else {
+			f *= float64pow10[exp]
+		}
+		if neg {
+			f = -f
+		}
+		return f, true
+	}
+
+	f, err := strconv.ParseFloat(string(b), 64)
+	return f, err == nil
+}
+
+// parseOBJInt parses a decimal integer without allocation.
+func parseOBJInt(b []byte) (int, bool) {
+	i := 0
+	neg := false
+	if i < len(b) && (b[i] == '+' || b[i] == '-') {
+		neg = b[i] == '-'
+		i++
+	}
+	if i == len(b) || len(b)-i > 18 {
+		return 0, false
+	}
+	n := 0
+	for ; i < len(b); i++ {
+		if b[i] < '0' || b[i] > '9' {
+			return 0, false
+		}
+		n = n*10 + int(b[i]-'0')
+	}
+	if neg {
+		n = -n
+	}
+	return n, true
+}
@@ -5,12 +5,21 @@
 package io_test
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
 	"math/rand"
 	"os"
+	"strconv"
+	"strings"
 	"testing"
+	"testing/iotest"
 
+	"poly.red/geometry"
+	"poly.red/geometry/primitive"
 	"poly.red/io"
+	"poly.red/material"
+	"poly.red/math"
 )
 
 func TestLoadOBJ(t *testing.T) {
@@ -29,19 +38,590 @@ func TestLoadOBJ(t *testing.T) {
 	}
 }
 
-func BenchmarkLoadOBJ(b *testing.B) {
-	path := "../testdata/bunny-high.obj"
+func TestLoadOBJ_Strict(t *testing.T) {
+	tests := []struct {
+		name  string
+		data  string
+		line  int
+		token string
+		err   error
+	}{
+		{"number", "v 0 0 0\nv 1 x 0\n", 2, "x", io.ErrInvalidNumber},
+		{"short vertex", "v 0 0 0\nv 1 0\n", 2, "v", io.ErrTooFewArguments},
+		{"short face", "v 0 0 0\nv 1 0 0\nf 1 2\n", 3, "f", io.ErrTooFewArguments},
+		{"index", "v 0 0 0\nv 1 0 0\nv 0 1 0\nf 1 2 a\n", 4, "a", io.ErrInvalidNumber},
+		{"zero index", "v 0 0 0\nv 1 0 0\nv 0 1 0\nf 0 1 2\n", 4, "0", io.ErrIndexOutOfRange},
+		{"out of range", "v 0 0 0\nv 1 0 0\nv 0 1 0\nf 1 2 4\n", 4, "4", io.ErrIndexOutOfRange},
+		{"relative", "v 0 0 0\nv 1 0 0\nv 0 1 0\nf -1 -2 -4\n", 4, "-4", io.ErrIndexOutOfRange},
+		{"texcoord", "v 0 0 0\nv 1 0 0\nv 0 1 0\nvt 0 0\nf 1/1 2/1 3/2\n", 5, "3/2", io.ErrIndexOutOfRange},
+		{"material", "usemtl missing\n", 1, "missing", io.ErrUndefinedMaterial},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := io.LoadOBJ(strings.NewReader(tt.data), io.WithOBJStrict(true))
+			var objErr *io.OBJError
+			if !errors.As(err, &objErr) {
+				t.Fatalf("expect an obj error, got %v", err)
+			}
+			if objErr.Line != tt.line || objErr.Token != tt.token || !errors.Is(err, tt.err) {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		})
+	}
+
+	// The lenient mode accepts malformed numbers and short statements,
+	// but indices must still be in range.
+	m, err := io.LoadOBJ(strings.NewReader("v 0 0 0\nv 1 x\nv 0 1 0\nvt 1\nf 1/1 2/1 3/1\n"))
+	if err != nil || m.NumTriangles() != 1 {
+		t.Fatalf("lenient mode does not accept malformed statements: %v", err)
+	}
+	_, err = io.LoadOBJ(strings.NewReader("v 0 0 0\nf 1 2 3\n"))
+	if !errors.Is(err, io.ErrIndexOutOfRange) {
+		t.Fatalf("expect an out of range error, got %v", err)
+	}
+
+	m, err = io.LoadOBJ(strings.NewReader("v 0 0 0\nv 1 0 0\nv 0 1 0\nf -3 -2 -1\n"), io.WithOBJStrict(true))
+	if err != nil || m.NumTriangles() != 1 {
+		t.Fatalf("cannot load relative indices: %v", err)
+	}
+}
+
+func TestLoadOBJ_FaceNormals(t *testing.T) {
+	data := "v 0 0 0\nv 1 0 0\nv 0 1 0\nf 1 2 3\n"
+	m, err := io.LoadOBJ(strings.NewReader(data))
+	if err != nil {
+		t.Fatalf("cannot load obj: %v", err)
+	}
+	m.Faces(func(f primitive.Face, _ material.Material) bool {
+		f.Vertices(func(v *primitive.Vertex) bool {
+			if !v.Nor.Eq(math.NewVec4(0, 0, 1, 0)) {
+				t.Fatalf("expect the face normal, got %v", v.Nor)
+			}
+			return true
+		})
+		return true
+	})
+}
+
+func TestLoadOBJ_Quads(t *testing.T) {
+	data := `v 0 0 0
+v 1 0 0
+v 1 1 0
+v 0 1 0
+v 2 0 0
+v 2 1 0
+v 3 1 0
+v 3 0 0
+vn 0 0 1
+f 1//1 2//1 3//1 4//1
+f 2 5 6
+f 5 8 7 6 3
+`
+	m, err := io.LoadOBJ(strings.NewReader(data), io.WithOBJQuads(true))
+	if err != nil {
+		t.Fatalf("cannot load obj: %v", err)
+	}
+	qm, ok := m.(*geometry.QuadMesh)
+	if !ok {
+		t.Fatalf("expect a quad mesh, got %T", m)
+	}
+	// The pentagon is split into three triangles.
+	if qm.NumFaces() != 5 || qm.NumQuads() != 1 || qm.NumTriangles() != 6 {
+		t.Fatalf("unexpected faces: %d faces, %d quads, %d triangles",
+			qm.NumFaces(), qm.NumQuads(), qm.NumTriangles())
+	}
+	qm.Faces(func(f primitive.Face, _ material.Material) bool {
+		f.Vertices(func(v *primitive.Vertex) bool {
+			if !v.Nor.Eq(math.NewVec4(0, 0, 1, 0)) {
+				t.Fatalf("unexpected normal: %v", v.Nor)
+			}
+			return true
+		})
+		return true
+	})
+
+	// Quads are kept by saving and loading again.
+	buf := &bytes.Buffer{}
+	if err := io.SaveOBJ(buf, qm); err != nil {
+		t.Fatalf("cannot save obj: %v", err)
+	}
+	if n := strings.Count(buf.String(), "\nf "); n != 5 {
+		t.Fatalf("expect 5 faces, got %d:\n%s", n, buf.String())
+	}
+	m, err = io.LoadOBJ(buf, io.WithOBJQuads(true))
+	if err != nil {
+		t.Fatalf("cannot load obj: %v", err)
+	}
+	if n := m.(*geometry.QuadMesh).NumQuads(); n != 1 {
+		t.Fatalf("expect 1 quad, got %d", n)
+	}
+}
+
+func TestLoadOBJ_Chunks(t *testing.T) {
+	data, err := os.ReadFile("../testdata/gopher.obj")
+	if err != nil {
+		t.Fatalf("cannot read file: %v", err)
+	}
+	want, err := io.LoadOBJMeshes(bytes.NewReader(data), io.WithOBJDir("../testdata"))
+	if err != nil {
+		t.Fatalf("cannot load obj meshes: %v", err)
+	}
+
+	// Small chunks split the file across many workers, relative
+	// indices, groups and materials must resolve the same way.
+	defer io.SetOBJChunkSize(4096)()
+	got, err := io.LoadOBJMeshes(bytes.NewReader(data), io.WithOBJDir("../testdata"))
+	if err != nil {
+		t.Fatalf("cannot load obj meshes: %v", err)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("number of meshes does not match, want %v, got %v", len(want), len(got))
+	}
+	for i := range want {
+		if got[i].NumVertices() != want[i].NumVertices() || got[i].NumTriangles() != want[i].NumTriangles() {
+			t.Fatalf("mesh %d does not match", i)
+		}
+		if got[i].GetMaterial() != nil && want[i].GetMaterial() == nil {
+			t.Fatalf("mesh %d has an unexpected material", i)
+		}
+		wp := want[i].GetAttribute(geometry.AttributePos).Values
+		gp := got[i].GetAttribute(geometry.AttributePos).Values
+		for j := range wp {
+			if wp[j] != gp[j] {
+				t.Fatalf("mesh %d position %d does not match, want %v, got %v", i, j, wp[j], gp[j])
+			}
+		}
+	}
+
+	// Chunks are read from short reads and may be shorter than a line.
+	restore := io.SetOBJChunkSize(8)
+	m, err := io.LoadOBJ(iotest.HalfReader(strings.NewReader(
+		"v 0.125 0.25 0.375\nv 1 0 0\nv 0 1 0\nf 1 2 3",
+	)), io.WithOBJStrict(true))
+	restore()
+	if err != nil {
+		t.Fatalf("cannot load obj from short reads: %v", err)
+	}
+	if m.NumTriangles() != 1 {
+		t.Fatalf("expect 1 triangle, got %v", m.NumTriangles())
+	}
+
+	// Line numbers of errors count the lines of preceding chunks.
+	src := strings.Repeat("v 0 0 0\n", 2000) + "f 1 2 2001\n"
+	_, err = io.LoadOBJ(strings.NewReader(src), io.WithOBJStrict(true))
+	var objErr *io.OBJError
+	if !errors.As(err, &objErr) || objErr.Line != 2001 || !errors.Is(err, io.ErrIndexOutOfRange) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	src = strings.Repeat("v 0 0 0\n", 2000) + "f -2000 -1 -2\n"
+	if _, err = io.LoadOBJ(strings.NewReader(src), io.WithOBJStrict(true)); err != nil {
+		t.Fatalf("cannot resolve relative indices across chunks: %v", err)
+	}
+}
+
+func TestParseOBJFloat(t *testing.T) {
+	tests := []string{
+		"0", "-0", "1", "-1.5", "+2.25", ".5", "5.", "1e3", "1E-3", "-1.25e+2",
+		"0.1", "0.000001", "123456789012345", "1234567890123456789",
+		"3.14159265358979323846", "1e300", "nan", "inf",
+	}
+	for i := 0; i < 100; i++ {
+		tests = append(tests, fmt.Sprintf("%v", rand.NormFloat64()), fmt.Sprintf("%.6f", rand.Float64()))
+	}
+	for _, tt := range tests {
+		got, ok := io.ParseOBJFloat([]byte(tt))
+		want, err := strconv.ParseFloat(tt, 64)
+		if ok != (err == nil) || (ok && got != want && !(got != got && want != want)) {
+			t.Fatalf("parse %q, want %v, got %v", tt, want, got)
+		}
+	}
+	for _, tt := range []string{"", "-", ".", "e3", "1e", "1.2.3", "x"} {
+		if _, ok := io.ParseOBJFloat([]byte(tt)); ok {
+			t.Fatalf("expect %q to be invalid", tt)
+		}
+	}
+}
+
+func TestLoadOBJGroup(t *testing.T) {
+	data := `
+o quad
+v 0 0 0
+v 1 0 0
+v 1 1 0
+v 0 1 0
+vn 0 0 1
+f 1//1 2//1 3//1 4//1
+o triangle
+v 0 0 1
+v 1 0 1
+v 0 1 1
+f 5 6 7
+f -3 -2 -1
+`
+	g, err := io.LoadOBJGroup(strings.NewReader(data))
+	if err != nil {
+		t.Fatalf("cannot load obj group: %v", err)
+	}
+	children := g.Children()
+	if len(children) != 2 || children[0].Name() != "quad" || children[1].Name() != "triangle" {
+		t.Fatalf("unexpected groups: %v", children)
+	}
+
+	meshes, err := io.LoadOBJMeshes(strings.NewReader(data))
+	if err != nil {
+		t.Fatalf("cannot load obj meshes: %v", err)
+	}
+	if len(meshes) != 2 {
+		t.Fatalf("expect 2 meshes, got %v", len(meshes))
+	}
+	if meshes[0].NumVertices() != 4 || meshes[0].NumTriangles() != 2 {
+		t.Fatalf("quad is not welded, got %v vertices and %v triangles",
+			meshes[0].NumVertices(), meshes[0].NumTriangles())
+	}
+	if meshes[1].NumVertices() != 3 || meshes[1].NumTriangles() != 2 {
+		t.Fatalf("triangle is not welded, got %v vertices and %v triangles",
+			meshes[1].NumVertices(), meshes[1].NumTriangles())
+	}
+	if meshes[1].GetAttribute(geometry.AttributeUV) != nil {
+		t.Fatalf("expect no texture coordinates")
+	}
+	nor := meshes[1].GetAttribute(geometry.AttributeNor)
+	if !math.NewVec3(nor.Values[0], nor.Values[1], nor.Values[2]).Eq(math.NewVec3(0, 0, 1)) {
+		t.Fatalf("unexpected generated normal: %v", nor.Values[:3])
+	}
+}
+
+func TestLoadOBJMeshes(t *testing.T) {
+	f, err := os.Open("../testdata/bunny-smooth.obj")
+	if err != nil {
+		t.Fatalf("cannot open file: %v", err)
+	}
+	defer f.Close()
+
+	meshes, err := io.LoadOBJMeshes(f, io.WithOBJDir("../testdata"))
+	if err != nil {
+		t.Fatalf("cannot load obj meshes: %v", err)
+	}
+	verts, tris := 0, uint64(0)
+	for _, m := range meshes {
+		verts += m.NumVertices()
+		tris += m.NumTriangles()
+	}
+	// A closed triangle mesh has about twice as many triangles as
+	// vertices, a triangle soup has three vertices per triangle.
+	if tris == 0 || uint64(verts) > tris {
+		t.Fatalf("vertices are not welded, got %v vertices for %v triangles", verts, tris)
+	}
+}
+
+func TestLoadMesh(t *testing.T) {
+	m, err := io.LoadMesh("../testdata/gopher.obj")
+	if err != nil {
+		t.Fatalf("cannot load mesh: %v", err)
+	}
+	if m.NumTriangles() == 0 {
+		t.Fatalf("loaded mesh is empty")
+	}
+
+	_, err = io.LoadMesh("../testdata/missing.obj")
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expect a not exist error, got %v", err)
+	}
+}
+
+func TestLoadOBJ_Materials(t *testing.T) {
+	path := "../testdata/gopher.obj"
+
 	f, err := os.Open(path)
 	if err != nil {
-		b.Errorf("loader: cannot open file %s, err: %v", path, err)
-		return
+		t.Fatalf("loader: cannot open file %s, err: %v", path, err)
 	}
 	defer f.Close()
 
+	m, err := io.LoadOBJ(f, io.WithOBJDir("../testdata"))
+	if err != nil {
+		t.Fatalf("cannot load obj model, path: %s, err: %v", path, err)
+	}
+
+	mats := map[material.Material]bool{}
+	m.Faces(func(f primitive.Face, m material.Material) bool {
+		if m == nil {
+			t.Fatalf("face does not have a material")
+		}
+		mats[m] = true
+		return true
+	})
+	if len(mats) != 7 {
+		t.Fatalf("expect 7 different materials, got %v", len(mats))
+	}
+}
+
+func TestLoadOBJ_MissingMaterials(t *testing.T) {
+	dir := t.TempDir()
+	lib := "newmtl Missing\nmap_Kd missing.png\n\nnewmtl Red\nKd 1 0 0\n"
+	if err := os.WriteFile(dir+"/lib.mtl", []byte(lib), 0644); err != nil {
+		t.Fatalf("cannot write mtl library: %v", err)
+	}
+	tri := "v 0 0 0\nv 1 0 0\nv 0 1 0\n"
+
+	// Unreadable libraries and materials are skipped by default, and
+	// the geometry is kept.
+	for _, src := range []string{
+		"mtllib missing.mtl\nusemtl Red\n" + tri + "f 1 2 3\n",
+		"mtllib lib.mtl\nusemtl Missing\n" + tri + "f 1 2 3\n",
+	} {
+		m, err := io.LoadOBJ(strings.NewReader(src), io.WithOBJDir(dir))
+		if err != nil {
+			t.Fatalf("cannot load obj without its materials: %v", err)
+		}
+		m.Faces(func(f primitive.Face, m material.Material) bool {
+			if m != nil {
+				t.Fatalf("expect no material, got %v", m)
+			}
+			return true
+		})
+		if _, err := io.LoadOBJ(strings.NewReader(src), io.WithOBJDir(dir), io.WithOBJStrict(true)); err == nil {
+			t.Fatalf("expect an error in strict mode for %q", src)
+		} else if objErr := (*io.OBJError)(nil); !errors.As(err, &objErr) || objErr.Line != 1 {
+			t.Fatalf("unexpected error in strict mode: %v", err)
+		}
+	}
+
+	// Other materials of the library are still loaded.
+	m, err := io.LoadOBJ(strings.NewReader("mtllib lib.mtl\nusemtl Red\n"+tri+"f 1 2 3\n"), io.WithOBJDir(dir))
+	if err != nil {
+		t.Fatalf("cannot load obj: %v", err)
+	}
+	m.Faces(func(f primitive.Face, m material.Material) bool {
+		if m == nil {
+			t.Fatalf("expect the material of the library")
+		}
+		return true
+	})
+}
+
+func TestLoadMTL(t *testing.T) {
+	lib := `
+newmtl Flat
+Kd 0.5 0.25 1.0
+Ks 0.5 0.5 0.5
+Ns 100
+d 0.5
+
+newmtl Textured
+Kd 1 1 1
+map_Kd -s 1 1 1 bunny.png
+`
+	mats, err := io.LoadMTL(strings.NewReader(lib), "../testdata")
+	if err != nil {
+		t.Fatalf("cannot load mtl: %v", err)
+	}
+	if len(mats) != 2 {
+		t.Fatalf("expect 2 materials, got %v", len(mats))
+	}
+
+	c := mats["Flat"].Texture().Query(0, 0.5, 0.5)
+	if c.R != 128 || c.G != 64 || c.B != 255 || c.A != 128 {
+		t.Fatalf("unexpected diffuse color, got %v", c)
+	}
+	if mats["Textured"].Texture().Size() <= 1 {
+		t.Fatalf("texture map is not loaded")
+	}
+
+	// Normal maps are not gamma corrected, whereas color maps are.
+	mats, err = io.LoadMTL(strings.NewReader("newmtl Bumpy\nmap_Kd bunny.png\nmap_Bump bunny.png\n"), "../testdata")
+	if err != nil {
+		t.Fatalf("cannot load mtl: %v", err)
+	}
+	raw, err := io.LoadImage("../testdata/bunny.png")
+	if err != nil {
+		t.Fatalf("cannot load image: %v", err)
+	}
+	bumpy := mats["Bumpy"].(*material.BlinnPhongMaterial)
+	if !bytes.Equal(bumpy.NormalMap().Image().Pix, raw.Pix) {
+		t.Fatalf("normal map texels are changed by loading")
+	}
+	if bytes.Equal(bumpy.Texture().Image().Pix, raw.Pix) {
+		t.Fatalf("color map is not gamma corrected")
+	}
+
+	_, err = io.LoadMTL(strings.NewReader("newmtl Missing\nmap_Kd missing.png\n"), "../testdata")
+	if err == nil {
+		t.Fatalf("expect an error for missing texture file")
+	}
+}
+
+func TestSaveOBJ(t *testing.T) {
+	path := "../testdata/gopher.obj"
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("loader: cannot open file %s, err: %v", path, err)
+	}
+	defer f.Close()
+
+	want, err := io.LoadOBJ(f, io.WithOBJDir("../testdata"))
+	if err != nil {
+		t.Fatalf("cannot load obj model, path: %s, err: %v", path, err)
+	}
+
+	dir := t.TempDir()
+	objBuf := &bytes.Buffer{}
+	if err := io.SaveOBJ(objBuf, want, io.WithOBJMaterialLib("gopher.mtl")); err != nil {
+		t.Fatalf("cannot save obj model: %v", err)
+	}
+	mtlBuf := &bytes.Buffer{}
+	if err := io.SaveMTL(mtlBuf, want); err != nil {
+		t.Fatalf("cannot save mtl library: %v", err)
+	}
+	if err := os.WriteFile(dir+"/gopher.mtl", mtlBuf.Bytes(), 0644); err != nil {
+		t.Fatalf("cannot write mtl library: %v", err)
+	}
+
+	// Shared vertices must be deduplicated.
+	numV := strings.Count(objBuf.String(), "\nv ")
+	if numV >= int(want.NumTriangles())*3 {
+		t.Fatalf("vertices are not deduplicated, got %v vertices", numV)
+	}
+
+	got, err := io.LoadOBJ(bytes.NewReader(objBuf.Bytes()), io.WithOBJDir(dir))
+	if err != nil {
+		t.Fatalf("cannot load saved obj model: %v", err)
+	}
+	if got.NumTriangles() != want.NumTriangles() {
+		t.Fatalf("number of triangles does not match, want %v, got %v",
+			want.NumTriangles(), got.NumTriangles())
+	}
+
+	var (
+		wantFaces []primitive.Face
+		wantMats  []material.Material
+		i         int
+	)
+	want.Faces(func(f primitive.Face, m material.Material) bool {
+		wantFaces = append(wantFaces, f)
+		wantMats = append(wantMats, m)
+		return true
+	})
+	mats := map[material.Material]material.Material{}
+	got.Faces(func(f primitive.Face, m material.Material) bool {
+		w := wantFaces[i].(*primitive.Triangle)
+		g := f.(*primitive.Triangle)
+		if !w.V1.Pos.Eq(g.V1.Pos) || !w.V2.Pos.Eq(g.V2.Pos) || !w.V3.Pos.Eq(g.V3.Pos) {
+			t.Fatalf("face %d positions do not match", i)
+		}
+		if !w.V1.Nor.Eq(g.V1.Nor) || w.V2.UV.X != g.V2.UV.X || w.V3.UV.Y != g.V3.UV.Y {
+			t.Fatalf("face %d attributes do not match", i)
+		}
+		if mm, ok := mats[wantMats[i]]; ok && mm != m {
+			t.Fatalf("face %d material does not match", i)
+		}
+		mats[wantMats[i]] = m
+
+		wc := wantMats[i].Texture().Query(0, 0, 0)
+		gc := m.Texture().Query(0, 0, 0)
+		if wc != gc {
+			t.Fatalf("face %d material color does not match, want %v, got %v", i, wc, gc)
+		}
+		i++
+		return true
+	})
+}
+
+func TestSaveMTL(t *testing.T) {
+	lib := `
+newmtl Flat
+Kd 0.5 0.25 1.0
+
+newmtl Textured
+Kd 1 1 1
+map_Kd bunny.png
+map_Bump bunny.png
+`
+	mats, err := io.LoadMTL(strings.NewReader(lib), "../testdata")
+	if err != nil {
+		t.Fatalf("cannot load mtl: %v", err)
+	}
+
+	// A face without a material follows the textured face and must not
+	// inherit its material.
+	tri := func() *primitive.Triangle {
+		return primitive.NewTriangle(
+			&primitive.Vertex{Pos: math.NewVec4(0, 0, 0, 1)},
+			&primitive.Vertex{Pos: math.NewVec4(1, 0, 0, 1)},
+			&primitive.Vertex{Pos: math.NewVec4(0, 1, 0, 1)},
+		)
+	}
+	m := geometry.NewTriangleSoup([]*primitive.Triangle{tri(), tri(), tri()})
+	m.SetFaceMaterials([]material.Material{mats["Flat"], mats["Textured"], nil})
+
+	mtlBuf := &bytes.Buffer{}
+	if err := io.SaveMTL(mtlBuf, m); err != nil {
+		t.Fatalf("cannot save mtl library: %v", err)
+	}
+	for _, want := range []string{
+		"newmtl Flat\n",
+		"newmtl Textured\n",
+		"map_Kd bunny.png\n",
+		"map_Bump bunny.png\n",
+		"newmtl default\n",
+	} {
+		if !strings.Contains(mtlBuf.String(), want) {
+			t.Fatalf("expect %q in the saved library, got:\n%s", want, mtlBuf.String())
+		}
+	}
+	got, err := io.LoadMTL(bytes.NewReader(mtlBuf.Bytes()), "../testdata")
+	if err != nil {
+		t.Fatalf("cannot load saved mtl: %v", err)
+	}
+	if got["Textured"].Texture().Size() <= 1 {
+		t.Fatalf("texture map is not saved")
+	}
+
+	objBuf := &bytes.Buffer{}
+	if err := io.SaveOBJ(objBuf, m, io.WithOBJMaterialLib("lib.mtl")); err != nil {
+		t.Fatalf("cannot save obj model: %v", err)
+	}
+	if n := strings.Count(objBuf.String(), "usemtl "); n != 3 {
+		t.Fatalf("expect 3 usemtl statements, got %d:\n%s", n, objBuf.String())
+	}
+	if !strings.Contains(objBuf.String(), "usemtl default\n") {
+		t.Fatalf("face without a material does not reset the material:\n%s", objBuf.String())
+	}
+}
+
+func BenchmarkLoadOBJ(b *testing.B) {
+	for _, name := range []string{"bunny", "dragon", "gopher"} {
+		b.Run(name, func(b *testing.B) {
+			data, err := os.ReadFile("../testdata/" + name + ".obj")
+			if err != nil {
+				b.Fatalf("loader: cannot read file, err: %v", err)
+			}
+
+			b.SetBytes(int64(len(data)))
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				_, err := io.LoadOBJ(bytes.NewReader(data), io.WithOBJDir("../testdata"))
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkParseOBJFloat(b *testing.B) {
+	fs := make([][]byte, 100)
+	for i := range fs {
+		fs[i] = []byte(fmt.Sprintf("%.6f", rand.Float64()))
+	}
+
 	b.ReportAllocs()
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		io.LoadOBJ(f)
+		for _, f := range fs {
+			io.ParseOBJFloat(f)
+		}
 	}
 }
 
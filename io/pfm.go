@@ -0,0 +1,106 @@
+// Copyright 2021 Changkun Ou <changkun.de>. All rights reserved.
+// Use of this source code is governed by a GPLv3 license that
+// can be found in the LICENSE file.
+
+package io
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"poly.red/image"
+	"poly.red/math"
+)
+
+// LoadPFM loads a portable float map (.pfm) file to a float image. Both
+// color (PF) and grayscale (Pf) files are supported, and the alpha
+// channel is one.
+func LoadPFM(data io.Reader) (*image.RGBAFloat, error) {
+	r := bufio.NewReader(data)
+	var (
+		magic string
+		w, h  int
+		scale float64
+	)
+	if _, err := fmt.Fscan(r, &magic, &w, &h, &scale); err != nil {
+		return nil, fmt.Errorf("loader: invalid pfm header, err: %w", err)
+	}
+	channels := 0
+	switch magic {
+	case "PF":
+		channels = 3
+	case "Pf":
+		channels = 1
+	default:
+		return nil, errors.New("loader: invalid pfm signature")
+	}
+	if w <= 0 || h <= 0 || scale == 0 {
+		return nil, fmt.Errorf("loader: invalid pfm header %dx%d, scale %v", w, h, scale)
+	}
+	if err := checkImageSize("pfm", w, h); err != nil {
+		return nil, err
+	}
+	// A single whitespace separates the header and the pixels.
+	if _, err := r.ReadByte(); err != nil {
+		return nil, fmt.Errorf("loader: incomplete pfm file, err: %w", err)
+	}
+
+	// A negative scale indicates little endian values.
+	var order binary.ByteOrder = binary.BigEndian
+	if scale < 0 {
+		order = binary.LittleEndian
+	}
+
+	// The pixels are read before the image is allocated, such that the
+	// size of the header is backed by data.
+	rowSize := 4 * channels * w
+	pix, err := readBytes(r, int64(rowSize)*int64(h))
+	if err != nil {
+		return nil, fmt.Errorf("loader: incomplete pfm file, err: %w", err)
+	}
+	img := image.NewRGBAFloat(image.Rect(0, 0, w, h))
+	for y := h - 1; y >= 0; y-- {
+		row := pix[:rowSize]
+		pix = pix[rowSize:]
+		for x := 0; x < w; x++ {
+			var c [3]float64
+			for k := range c {
+				i := 4 * (channels*x + k%channels)
+				c[k] = float64(math.Float32frombits(order.Uint32(row[i:])))
+			}
+			img.SetRGBAFloat(x, y, math.NewVec4(c[0], c[1], c[2], 1))
+		}
+	}
+	return img, nil
+}
+
+// SavePFM writes the given image to a color portable float map (.pfm)
+// file in little endian. The alpha channel is dropped.
+func SavePFM(w io.Writer, img *image.RGBAFloat) error {
+	r := img.Bounds()
+	width, height := r.Dx(), r.Dy()
+	if width <= 0 || height <= 0 {
+		return errors.New("loader: cannot save an empty image")
+	}
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "PF\n%d %d\n-1.0\n", width, height)
+	row := make([]byte, 12*width)
+	// Rows are stored from bottom to top.
+	for y := height - 1; y >= 0; y-- {
+		for x := 0; x < width; x++ {
+			i := img.PixOffset(r.Min.X+x, r.Min.Y+y)
+			for k := 0; k < 3; k++ {
+				binary.LittleEndian.PutUint32(row[12*x+4*k:], math.Float32bits(img.Pix[i+k]))
+			}
+		}
+		bw.Write(row)
+	}
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("loader: cannot write pfm file, err: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+// Copyright 2021 Changkun Ou <changkun.de>. All rights reserved.
+// Use of this source code is governed by a GPLv3 license that
+// can be found in the LICENSE file.
+
+package io_test
+
+import (
+	"bytes"
+	goimage "image"
+	"strings"
+	"testing"
+
+	"poly.red/image"
+	"poly.red/io"
+	"poly.red/math"
+)
+
+func TestPFM(t *testing.T) {
+	img := image.NewRGBAFloat(goimage.Rect(0, 0, 3, 2))
+	for i := range img.Pix {
+		img.Pix[i] = float32(i*i) - 10.5
+	}
+
+	buf := &bytes.Buffer{}
+	if err := io.SavePFM(buf, img); err != nil {
+		t.Fatalf("cannot save pfm: %v", err)
+	}
+	if !strings.HasPrefix(buf.String(), "PF\n3 2\n-1.0\n") {
+		t.Fatalf("unexpected pfm header: %q", buf.String()[:12])
+	}
+	got, err := io.LoadPFM(buf)
+	if err != nil {
+		t.Fatalf("cannot load pfm: %v", err)
+	}
+	for y := 0; y < 2; y++ {
+		for x := 0; x < 3; x++ {
+			want := img.RGBAFloatAt(x, y)
+			want.W = 1
+			if g := got.RGBAFloatAt(x, y); !g.Eq(want) {
+				t.Fatalf("pixel (%d, %d), want %v, got %v", x, y, want, g)
+			}
+		}
+	}
+
+	// A big endian grayscale file, the first row is the bottom.
+	gray := "Pf\n1 2\n1.0\n\x3f\x80\x00\x00\x40\x00\x00\x00"
+	got, err = io.LoadPFM(strings.NewReader(gray))
+	if err != nil {
+		t.Fatalf("cannot load pfm: %v", err)
+	}
+	if g := got.RGBAFloatAt(0, 0); !g.Eq(math.NewVec4(2, 2, 2, 1)) {
+		t.Fatalf("unexpected top pixel: %v", g)
+	}
+	if g := got.RGBAFloatAt(0, 1); !g.Eq(math.NewVec4(1, 1, 1, 1)) {
+		t.Fatalf("unexpected bottom pixel: %v", g)
+	}
+
+	for _, data := range []string{
+		"P6\n1 1\n255\n",
+		"PF\n1 1\n0\n\x00\x00\x00\x00",
+		"PF\n1 1\n-1.0\n\x00\x00\x00\x00",
+		"PF\n2000000000 2000000000\n-1\n ",
+		"Pf\n4096 4096\n-1\n\x00\x00\x00\x00",
+	} {
+		if _, err := io.LoadPFM(strings.NewReader(data)); err == nil {
+			t.Fatalf("expect an error for %q", data)
+		}
+	}
+}
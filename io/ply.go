@@ -0,0 +1,625 @@
+// Copyright 2021 Changkun Ou <changkun.de>. All rights reserved.
+// Use of this source code is governed by a GPLv3 license that
+// can be found in the LICENSE file.
+
+package io
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"poly.red/geometry"
+)
+
+func init() {
+	RegisterFormat("ply", []string{".ply"}, "ply",
+		func(r io.Reader, _ string) (geometry.Mesh, error) {
+			m, err := LoadPLY(r)
+			if err != nil {
+				return nil, err
+			}
+			return m, nil
+		},
+		func(w io.Writer, m geometry.Mesh) error {
+			return SavePLY(w, bufferedMesh(m), PLYBinaryLittleEndian)
+		})
+}
+
+// PLYFormat is the encoding of the data section of a .ply file.
+type PLYFormat int
+
+const (
+	PLYASCII PLYFormat = iota
+	PLYBinaryLittleEndian
+	PLYBinaryBigEndian
+)
+
+func (f PLYFormat) String() string {
+	switch f {
+	case PLYASCII:
+		return "ascii"
+	case PLYBinaryLittleEndian:
+		return "binary_little_endian"
+	case PLYBinaryBigEndian:
+		return "binary_big_endian"
+	}
+	return "unknown"
+}
+
+type plyType int
+
+const (
+	plyInt8 plyType = iota + 1
+	plyUint8
+	plyInt16
+	plyUint16
+	plyInt32
+	plyUint32
+	plyFloat32
+	plyFloat64
+)
+
+var plyTypes = map[string]plyType{
+	"char": plyInt8, "int8": plyInt8,
+	"uchar": plyUint8, "uint8": plyUint8,
+	"short": plyInt16, "int16": plyInt16,
+	"ushort": plyUint16, "uint16": plyUint16,
+	"int": plyInt32, "int32": plyInt32,
+	"uint": plyUint32, "uint32": plyUint32,
+	"float": plyFloat32, "float32": plyFloat32,
+	"double": plyFloat64, "float64": plyFloat64,
+}
+
+func (t plyType) size() int {
+	switch t {
+	case plyInt8, plyUint8:
+		return 1
+	case plyInt16, plyUint16:
+		return 2
+	case plyInt32, plyUint32, plyFloat32:
+		return 4
+	}
+	return 8
+}
+
+func (t plyType) isFloat() bool {
+	return t == plyFloat32 || t == plyFloat64
+}
+
+type plyProperty struct {
+	name      string
+	typ       plyType
+	countType plyType // non-zero if the property is a list
+}
+
+type plyElement struct {
+	name  string
+	count int
+	props []plyProperty
+}
+
+// plyDecoder reads scalar values from the data section of a .ply file.
+type plyDecoder interface {
+	read(t plyType) (float64, error)
+}
+
+type plyASCIIDecoder struct {
+	s *bufio.Scanner
+}
+
+func (d *plyASCIIDecoder) read(t plyType) (float64, error) {
+	if !d.s.Scan() {
+		if err := d.s.Err(); err != nil {
+			return 0, err
+		}
+		return 0, io.ErrUnexpectedEOF
+	}
+	return strconv.ParseFloat(d.s.Text(), 64)
+}
+
+type plyBinaryDecoder struct {
+	r     *bufio.Reader
+	order binary.ByteOrder
+	buf   [8]byte
+}
+
+func (d *plyBinaryDecoder) read(t plyType) (float64, error) {
+	b := d.buf[:t.size()]
+	if _, err := io.ReadFull(d.r, b); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return 0, err
+	}
+	switch t {
+	case plyInt8:
+		return float64(int8(b[0])), nil
+	case plyUint8:
+		return float64(b[0]), nil
+	case plyInt16:
+		return float64(int16(d.order.Uint16(b))), nil
+	case plyUint16:
+		return float64(d.order.Uint16(b)), nil
+	case plyInt32:
+		return float64(int32(d.order.Uint32(b))), nil
+	case plyUint32:
+		return float64(d.order.Uint32(b)), nil
+	case plyFloat32:
+		return float64(math.Float32frombits(d.order.Uint32(b))), nil
+	}
+	return math.Float64frombits(d.order.Uint64(b)), nil
+}
+
+// plyAttribute maps a set of vertex properties to a buffer attribute.
+type plyAttribute struct {
+	name  geometry.AttributeName
+	props []string
+}
+
+// The well-known vertex properties, other vertex properties are loaded
+// as attributes with the same name as the property.
+var plyAttributes = []plyAttribute{
+	{geometry.AttributePos, []string{"x", "y", "z"}},
+	{geometry.AttributeNor, []string{"nx", "ny", "nz"}},
+	{geometry.AttributeCol, []string{"red", "green", "blue", "alpha"}},
+	{geometry.AttributeUV, []string{"u", "v"}},
+	{geometry.AttributeUV, []string{"s", "t"}},
+	{geometry.AttributeUV, []string{"texture_u", "texture_v"}},
+}
+
+// LoadPLY loads a .ply file in either ASCII or binary encoding to a
+// buffered mesh. Vertex positions, normals, colors and texture coordinates
+// are loaded as the corresponding attributes, and any other scalar vertex
+// property is loaded as an attribute of stride 1 named after the property.
+// Properties named after a built-in attribute, e.g. "color", are
+// prefixed by "ply:" instead. Polygonal faces are triangulated.
+func LoadPLY(data io.Reader) (*geometry.BufferedMesh, error) {
+	r := bufio.NewReader(data)
+	format, elements, err := readPLYHeader(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var dec plyDecoder
+	switch format {
+	case PLYASCII:
+		s := bufio.NewScanner(r)
+		s.Split(bufio.ScanWords)
+		dec = &plyASCIIDecoder{s: s}
+	case PLYBinaryLittleEndian:
+		dec = &plyBinaryDecoder{r: r, order: binary.LittleEndian}
+	case PLYBinaryBigEndian:
+		dec = &plyBinaryDecoder{r: r, order: binary.BigEndian}
+	}
+
+	var (
+		vertIdx    []uint64
+		attributes = map[geometry.AttributeName]*geometry.BufferAttribute{}
+		numVerts   int
+	)
+	for _, e := range elements {
+		switch e.name {
+		case "vertex":
+			numVerts = e.count
+			attributes, err = readPLYVertices(dec, e)
+		case "face":
+			vertIdx, err = readPLYFaces(dec, e)
+		default:
+			err = skipPLYElement(dec, e)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("loader: cannot read ply element %s, err: %w", e.name, err)
+		}
+	}
+
+	if attributes[geometry.AttributePos] == nil {
+		return nil, errors.New("loader: ply file does not contain vertex positions")
+	}
+	for _, idx := range vertIdx {
+		if idx >= uint64(numVerts) {
+			return nil, fmt.Errorf("loader: ply face index %d out of range", idx)
+		}
+	}
+
+	bm := geometry.NewBufferedMesh()
+	for name, attr := range attributes {
+		bm.SetAttribute(name, attr)
+	}
+	bm.SetVertexIndex(vertIdx)
+	return bm, nil
+}
+
+func readPLYHeader(r *bufio.Reader) (PLYFormat, []*plyElement, error) {
+	var (
+		format   PLYFormat = -1
+		elements []*plyElement
+	)
+
+	line, err := r.ReadString('\n')
+	if err != nil || strings.TrimSpace(line) != "ply" {
+		return format, nil, errors.New("loader: invalid ply file, missing magic number")
+	}
+
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return format, nil, fmt.Errorf("loader: invalid ply header, err: %w", err)
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		switch fields[0] {
+		case "format":
+			if len(fields) < 2 {
+				return format, nil, errors.New("loader: invalid ply format statement")
+			}
+			switch fields[1] {
+			case "ascii":
+				format = PLYASCII
+			case "binary_little_endian":
+				format = PLYBinaryLittleEndian
+			case "binary_big_endian":
+				format = PLYBinaryBigEndian
+			default:
+				return format, nil, fmt.Errorf("loader: unsupported ply format %s", fields[1])
+			}
+		case "element":
+			if len(fields) != 3 {
+				return format, nil, fmt.Errorf("loader: invalid ply element statement: %s", strings.TrimSpace(line))
+			}
+			count, err := strconv.Atoi(fields[2])
+			if err != nil || count < 0 {
+				return format, nil, fmt.Errorf("loader: invalid ply element count: %s", fields[2])
+			}
+			elements = append(elements, &plyElement{name: fields[1], count: count})
+		case "property":
+			if len(elements) == 0 {
+				return format, nil, errors.New("loader: ply property without element")
+			}
+			e := elements[len(elements)-1]
+			if len(fields) == 5 && fields[1] == "list" {
+				ct, ok1 := plyTypes[fields[2]]
+				it, ok2 := plyTypes[fields[3]]
+				if !ok1 || !ok2 {
+					return format, nil, fmt.Errorf("loader: invalid ply property type: %s", strings.TrimSpace(line))
+				}
+				e.props = append(e.props, plyProperty{name: fields[4], typ: it, countType: ct})
+				continue
+			}
+			if len(fields) != 3 {
+				return format, nil, fmt.Errorf("loader: invalid ply property statement: %s", strings.TrimSpace(line))
+			}
+			t, ok := plyTypes[fields[1]]
+			if !ok {
+				return format, nil, fmt.Errorf("loader: invalid ply property type: %s", fields[1])
+			}
+			e.props = append(e.props, plyProperty{name: fields[2], typ: t})
+		case "end_header":
+			if format < 0 {
+				return format, nil, errors.New("loader: ply header does not specify a format")
+			}
+			return format, elements, nil
+		}
+	}
+}
+
+func readPLYVertices(dec plyDecoder, e *plyElement) (map[geometry.AttributeName]*geometry.BufferAttribute, error) {
+	// Locate the buffer attribute and the component of each property.
+	type target struct {
+		attr  *geometry.BufferAttribute
+		comp  int
+		scale float64
+	}
+	propIdx := map[string]int{}
+	for i, p := range e.props {
+		propIdx[p.name] = i
+	}
+	targets := make([]*target, len(e.props))
+	attributes := map[geometry.AttributeName]*geometry.BufferAttribute{}
+
+	// Values are appended as rows are read, since the count of the
+	// header may exceed the data. Each row starts from its defaults.
+	type row struct {
+		attr     *geometry.BufferAttribute
+		defaults []float64
+	}
+	var rows []row
+	for _, a := range plyAttributes {
+		if attributes[a.name] != nil {
+			continue
+		}
+		if _, ok := propIdx[a.props[0]]; !ok {
+			continue
+		}
+		stride := len(a.props)
+		attr := geometry.NewBufferAttribute(stride, nil)
+		attributes[a.name] = attr
+		defaults := make([]float64, stride)
+		rows = append(rows, row{attr, defaults})
+		for comp, name := range a.props {
+			i, ok := propIdx[name]
+			if !ok {
+				if a.name == geometry.AttributeCol && name == "alpha" {
+					// Colors without alpha are opaque.
+					defaults[comp] = 0xff
+				}
+				continue
+			}
+			scale := 1.0
+			if a.name == geometry.AttributeCol && e.props[i].typ.isFloat() {
+				// Colors are stored in [0, 255].
+				scale = 0xff
+			}
+			targets[i] = &target{attr: attr, comp: comp, scale: scale}
+		}
+	}
+	for i, p := range e.props {
+		if targets[i] != nil || p.countType != 0 {
+			continue
+		}
+		attr := geometry.NewBufferAttribute(1, nil)
+		attributes[plyAttributeName(p.name)] = attr
+		rows = append(rows, row{attr, []float64{0}})
+		targets[i] = &target{attr: attr, comp: 0, scale: 1}
+	}
+
+	for j := 0; j < e.count; j++ {
+		for _, r := range rows {
+			r.attr.Values = append(r.attr.Values, r.defaults...)
+		}
+		for i, p := range e.props {
+			if p.countType != 0 {
+				if err := skipPLYList(dec, p); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			v, err := dec.read(p.typ)
+			if err != nil {
+				return nil, err
+			}
+			t := targets[i]
+			t.attr.Values[j*t.attr.Stride+t.comp] = v * t.scale
+		}
+	}
+	return attributes, nil
+}
+
+func readPLYFaces(dec plyDecoder, e *plyElement) ([]uint64, error) {
+	var vertIdx []uint64
+	poly := make([]uint64, 0, 4)
+	for j := 0; j < e.count; j++ {
+		for _, p := range e.props {
+			if p.countType == 0 {
+				if _, err := dec.read(p.typ); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			if p.name != "vertex_indices" && p.name != "vertex_index" {
+				if err := skipPLYList(dec, p); err != nil {
+					return nil, err
+				}
+				continue
+			}
+
+			n, err := dec.read(p.countType)
+			if err != nil {
+				return nil, err
+			}
+			poly = poly[:0]
+			for k := 0; k < int(n); k++ {
+				idx, err := dec.read(p.typ)
+				if err != nil {
+					return nil, err
+				}
+				if idx < 0 {
+					return nil, fmt.Errorf("negative vertex index %v", idx)
+				}
+				poly = append(poly, uint64(idx))
+			}
+			for k := 1; k < len(poly)-1; k++ {
+				vertIdx = append(vertIdx, poly[0], poly[k], poly[k+1])
+			}
+		}
+	}
+	return vertIdx, nil
+}
+
+func skipPLYElement(dec plyDecoder, e *plyElement) error {
+	for j := 0; j < e.count; j++ {
+		for _, p := range e.props {
+			if p.countType != 0 {
+				if err := skipPLYList(dec, p); err != nil {
+					return err
+				}
+				continue
+			}
+			if _, err := dec.read(p.typ); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func skipPLYList(dec plyDecoder, p plyProperty) error {
+	n, err := dec.read(p.countType)
+	if err != nil {
+		return err
+	}
+	for k := 0; k < int(n); k++ {
+		if _, err := dec.read(p.typ); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// plyAttributeName returns the attribute name of an extra scalar vertex
+// property, which must not replace a built-in attribute of a different
+// stride.
+func plyAttributeName(prop string) geometry.AttributeName {
+	name := geometry.AttributeName(prop)
+	switch name {
+	case geometry.AttributePos, geometry.AttributeNor, geometry.AttributeUV,
+		geometry.AttributeCol, geometry.AttributeTan:
+		return "ply:" + name
+	}
+	return name
+}
+
+// SavePLY writes the given buffered mesh to a .ply file using the given
+// encoding. Positions, normals and texture coordinates are written as
+// float properties, and colors are written as uchar properties. Other
+// attributes are written as float properties named after the attribute,
+// where attributes with a stride larger than 1 are written as properties
+// with the component index as suffix, e.g. "name_0", "name_1".
+func SavePLY(w io.Writer, m *geometry.BufferedMesh, format PLYFormat) error {
+	pos := m.GetAttribute(geometry.AttributePos)
+	if pos == nil {
+		return errors.New("loader: mesh does not contain vertex positions")
+	}
+	numVerts := m.NumVertices()
+
+	type column struct {
+		attr  *geometry.BufferAttribute
+		comp  int
+		typ   plyType
+		value float64 // used if attr is nil
+	}
+	var (
+		header  strings.Builder
+		columns []column
+	)
+	addColumn := func(name string, attr *geometry.BufferAttribute, comp int, typ plyType) {
+		t := "float"
+		if typ == plyUint8 {
+			t = "uchar"
+		}
+		fmt.Fprintf(&header, "property %s %s\n", t, name)
+		columns = append(columns, column{attr: attr, comp: comp, typ: typ})
+	}
+
+	fmt.Fprintf(&header, "ply\nformat %s 1.0\ncomment poly.red\n", format)
+	fmt.Fprintf(&header, "element vertex %d\n", numVerts)
+	for i, name := range []string{"x", "y", "z"} {
+		addColumn(name, pos, i, plyFloat32)
+	}
+	if nor := m.GetAttribute(geometry.AttributeNor); nor != nil {
+		for i, name := range []string{"nx", "ny", "nz"} {
+			addColumn(name, nor, i, plyFloat32)
+		}
+	}
+	if uv := m.GetAttribute(geometry.AttributeUV); uv != nil {
+		for i, name := range []string{"u", "v"} {
+			addColumn(name, uv, i, plyFloat32)
+		}
+	}
+	if col := m.GetAttribute(geometry.AttributeCol); col != nil {
+		for i, name := range []string{"red", "green", "blue"} {
+			addColumn(name, col, i, plyUint8)
+		}
+		if col.Stride > 3 {
+			addColumn("alpha", col, 3, plyUint8)
+		} else {
+			fmt.Fprintf(&header, "property uchar alpha\n")
+			columns = append(columns, column{typ: plyUint8, value: 0xff})
+		}
+	}
+	for _, name := range m.AttributeNames() {
+		switch name {
+		case geometry.AttributePos, geometry.AttributeNor,
+			geometry.AttributeUV, geometry.AttributeCol:
+			continue
+		}
+		attr := m.GetAttribute(name)
+		if attr.Stride == 1 {
+			addColumn(string(name), attr, 0, plyFloat32)
+			continue
+		}
+		for i := 0; i < attr.Stride; i++ {
+			addColumn(fmt.Sprintf("%s_%d", name, i), attr, i, plyFloat32)
+		}
+	}
+	idx := m.GetVertexIndex()
+	fmt.Fprintf(&header, "element face %d\n", len(idx)/3)
+	fmt.Fprintf(&header, "property list uchar uint vertex_indices\n")
+	fmt.Fprintf(&header, "end_header\n")
+
+	buf := bufio.NewWriter(w)
+	buf.WriteString(header.String())
+
+	var enc func(t plyType, v float64)
+	var sep func(last bool)
+	switch format {
+	case PLYASCII:
+		enc = func(t plyType, v float64) {
+			if t.isFloat() {
+				buf.WriteString(strconv.FormatFloat(v, 'g', -1, 32))
+			} else {
+				buf.WriteString(strconv.FormatInt(int64(v), 10))
+			}
+		}
+		sep = func(last bool) {
+			if last {
+				buf.WriteByte('\n')
+			} else {
+				buf.WriteByte(' ')
+			}
+		}
+	case PLYBinaryLittleEndian, PLYBinaryBigEndian:
+		var order binary.ByteOrder = binary.LittleEndian
+		if format == PLYBinaryBigEndian {
+			order = binary.BigEndian
+		}
+		b := make([]byte, 4)
+		enc = func(t plyType, v float64) {
+			switch t {
+			case plyUint8:
+				buf.WriteByte(uint8(v))
+			case plyUint32:
+				order.PutUint32(b, uint32(v))
+				buf.Write(b)
+			default:
+				order.PutUint32(b, math.Float32bits(float32(v)))
+				buf.Write(b)
+			}
+		}
+		sep = func(last bool) {}
+	default:
+		return fmt.Errorf("loader: unsupported ply format %v", format)
+	}
+
+	for j := 0; j < numVerts; j++ {
+		for i, c := range columns {
+			v := c.value
+			if c.attr != nil {
+				v = c.attr.Values[j*c.attr.Stride+c.comp]
+			}
+			if c.typ == plyUint8 {
+				v = math.Max(0, math.Min(0xff, math.Round(v)))
+			}
+			enc(c.typ, v)
+			sep(i == len(columns)-1)
+		}
+	}
+	for j := 0; j+2 < len(idx); j += 3 {
+		enc(plyUint8, 3)
+		sep(false)
+		enc(plyUint32, float64(idx[j]))
+		sep(false)
+		enc(plyUint32, float64(idx[j+1]))
+		sep(false)
+		enc(plyUint32, float64(idx[j+2]))
+		sep(true)
+	}
+	return buf.Flush()
+}
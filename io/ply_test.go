@@ -0,0 +1,164 @@
+// Copyright 2021 Changkun Ou <changkun.de>. All rights reserved.
+// Use of this source code is governed by a GPLv3 license that
+// can be found in the LICENSE file.
+
+package io_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"poly.red/geometry"
+	"poly.red/io"
+	"poly.red/math"
+)
+
+func TestLoadPLY(t *testing.T) {
+	data := `ply
+format ascii 1.0
+comment a unit quad with an extra element
+element vertex 4
+property float x
+property float y
+property float z
+property uchar red
+property uchar green
+property uchar blue
+property float confidence
+element face 1
+property list uchar int vertex_indices
+element edge 1
+property int vertex1
+property int vertex2
+end_header
+0 0 0 255 0 0 0.1
+1 0 0 0 255 0 0.2
+1 1 0 0 0 255 0.3
+0 1 0 255 255 255 0.4
+4 0 1 2 3
+0 2
+`
+	m, err := io.LoadPLY(strings.NewReader(data))
+	if err != nil {
+		t.Fatalf("cannot load ply: %v", err)
+	}
+	if m.NumTriangles() != 2 {
+		t.Fatalf("expect 2 triangles, got %v", m.NumTriangles())
+	}
+	if m.NumVertices() != 4 {
+		t.Fatalf("expect 4 vertices, got %v", m.NumVertices())
+	}
+	col := m.GetAttribute(geometry.AttributeCol)
+	if col.Stride != 4 || col.Values[4*1+1] != 255 || col.Values[4*1+3] != 255 {
+		t.Fatalf("unexpected color attribute: %v", col)
+	}
+	conf := m.GetAttribute("confidence")
+	if conf == nil || conf.Stride != 1 || !math.ApproxEq(conf.Values[3], 0.4, 1e-6) {
+		t.Fatalf("unexpected extra attribute: %v", conf)
+	}
+
+	// Extra properties do not replace built-in attributes.
+	m, err = io.LoadPLY(strings.NewReader(strings.Replace(data, "property float confidence", "property float color", 1)))
+	if err != nil {
+		t.Fatalf("cannot load ply: %v", err)
+	}
+	if col := m.GetAttribute(geometry.AttributeCol); col.Stride != 4 {
+		t.Fatalf("color attribute is replaced by a property: %v", col)
+	}
+	if extra := m.GetAttribute("ply:color"); extra == nil || extra.Stride != 1 {
+		t.Fatalf("unexpected prefixed attribute: %v", extra)
+	}
+
+	_, err = io.LoadPLY(strings.NewReader(strings.Replace(data, "4 0 1 2 3", "4 0 1 2 7", 1)))
+	if err == nil {
+		t.Fatalf("expect an error for an out of range index")
+	}
+
+	// Counts of the header that exceed the data are not allocated.
+	for _, format := range []string{"ascii", "binary_little_endian"} {
+		huge := "ply\nformat " + format + " 1.0\nelement vertex 3074457345618258603\n" +
+			"property float x\nproperty float y\nproperty float z\n" +
+			"element face 3074457345618258603\nproperty list uchar int vertex_indices\nend_header\n"
+		if _, err := io.LoadPLY(strings.NewReader(huge)); err == nil {
+			t.Fatalf("expect an error for truncated %s data", format)
+		}
+	}
+}
+
+func TestSavePLY(t *testing.T) {
+	want := geometry.NewBufferedMesh()
+	want.SetAttribute(geometry.AttributePos, geometry.NewBufferAttribute(3, []float64{
+		0, 0, 0,
+		1, 0, 0,
+		0, 1, 0,
+		0, 0, 1,
+	}))
+	want.SetAttribute(geometry.AttributeNor, geometry.NewBufferAttribute(3, []float64{
+		-1, -1, -1,
+		1, 0, 0,
+		0, 1, 0,
+		0, 0, 1,
+	}))
+	want.SetAttribute(geometry.AttributeUV, geometry.NewBufferAttribute(2, []float64{
+		0, 0,
+		1, 0,
+		0, 1,
+		0.5, 0.5,
+	}))
+	want.SetAttribute(geometry.AttributeCol, geometry.NewBufferAttribute(4, []float64{
+		255, 0, 0, 255,
+		0, 255, 0, 255,
+		0, 0, 255, 128,
+		10, 20, 30, 40,
+	}))
+	want.SetAttribute("quality", geometry.NewBufferAttribute(1, []float64{
+		0.25, 0.5, 0.75, 1,
+	}))
+	want.SetVertexIndex([]uint64{
+		0, 2, 1,
+		0, 1, 3,
+		0, 3, 2,
+		1, 2, 3,
+	})
+
+	for _, format := range []io.PLYFormat{
+		io.PLYASCII,
+		io.PLYBinaryLittleEndian,
+		io.PLYBinaryBigEndian,
+	} {
+		t.Run(format.String(), func(t *testing.T) {
+			buf := &bytes.Buffer{}
+			if err := io.SavePLY(buf, want, format); err != nil {
+				t.Fatalf("cannot save ply: %v", err)
+			}
+			got, err := io.LoadPLY(buf)
+			if err != nil {
+				t.Fatalf("cannot load saved ply: %v", err)
+			}
+
+			for _, name := range want.AttributeNames() {
+				w := want.GetAttribute(name)
+				g := got.GetAttribute(name)
+				if g == nil || g.Stride != w.Stride || len(g.Values) != len(w.Values) {
+					t.Fatalf("attribute %s does not match, want %v, got %v", name, w, g)
+				}
+				for i := range w.Values {
+					if !math.ApproxEq(w.Values[i], g.Values[i], 1e-6) {
+						t.Fatalf("attribute %s does not match, want %v, got %v", name, w.Values, g.Values)
+					}
+				}
+			}
+			wantIdx := want.GetVertexIndex()
+			gotIdx := got.GetVertexIndex()
+			if len(wantIdx) != len(gotIdx) {
+				t.Fatalf("index does not match, want %v, got %v", wantIdx, gotIdx)
+			}
+			for i := range wantIdx {
+				if wantIdx[i] != gotIdx[i] {
+					t.Fatalf("index does not match, want %v, got %v", wantIdx, gotIdx)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,562 @@
+// Copyright 2021 Changkun Ou <changkun.de>. All rights reserved.
+// Use of this source code is governed by a GPLv3 license that
+// can be found in the LICENSE file.
+
+package io
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image/color"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"poly.red/geometry"
+	"poly.red/math"
+)
+
+// LoadPointCloud loads a point cloud file. The format is chosen by the
+// file extension, which is one of .xyz, .pts and .pcd.
+func LoadPointCloud(path string) (*geometry.PointCloud, error) {
+	var load func(io.Reader) (*geometry.PointCloud, error)
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".xyz":
+		load = LoadXYZ
+	case ".pts":
+		load = LoadPTS
+	case ".pcd":
+		load = LoadPCD
+	default:
+		return nil, fmt.Errorf("loader: unsupported point cloud format %s", filepath.Ext(path))
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("loader: cannot open file %s, err: %w", path, err)
+	}
+	defer f.Close()
+
+	pc, err := load(f)
+	if err != nil {
+		return nil, fmt.Errorf("loader: cannot load point cloud, path: %s, err: %w", path, err)
+	}
+	return pc, nil
+}
+
+// pointCloudBuilder collects the points of a point cloud.
+type pointCloudBuilder struct {
+	pos []math.Vec3
+	nor []math.Vec3
+	col []color.RGBA
+}
+
+func (b *pointCloudBuilder) build() *geometry.PointCloud {
+	pc := geometry.NewPointCloud(b.pos)
+	if len(b.nor) > 0 {
+		pc.SetNormals(b.nor)
+	}
+	if len(b.col) > 0 {
+		pc.SetColors(b.col)
+	}
+	return pc
+}
+
+// readPointLines calls the given function with the values of each
+// line of an ASCII point cloud. Empty lines and comments that start
+// with '#' or "//" are skipped.
+func readPointLines(data io.Reader, fn func(line int, values []float64) error) error {
+	s := bufio.NewScanner(data)
+	s.Buffer(make([]byte, 64*1024), 1<<20)
+	var values []float64
+	for line := 1; s.Scan(); line++ {
+		rest := bytes.TrimSpace(s.Bytes())
+		if len(rest) == 0 || rest[0] == '#' || bytes.HasPrefix(rest, []byte("//")) {
+			continue
+		}
+		values = values[:0]
+		for {
+			var field []byte
+			field, rest = objField(rest)
+			if len(field) == 0 {
+				break
+			}
+			// Some exporters separate values by commas.
+			field = bytes.TrimSuffix(field, []byte(","))
+			v, ok := parseOBJFloat(field)
+			if !ok {
+				return fmt.Errorf("loader: invalid number %q at line %d", field, line)
+			}
+			values = append(values, v)
+		}
+		if err := fn(line, values); err != nil {
+			return err
+		}
+	}
+	if err := s.Err(); err != nil {
+		return fmt.Errorf("loader: cannot read point cloud, err: %w", err)
+	}
+	return nil
+}
+
+// pointColor converts 8-bit color values to a color.
+func pointColor(r, g, b float64) color.RGBA {
+	return color.RGBA{
+		uint8(math.Clamp(r, 0, 0xff)),
+		uint8(math.Clamp(g, 0, 0xff)),
+		uint8(math.Clamp(b, 0, 0xff)),
+		0xff,
+	}
+}
+
+// LoadXYZ loads an ASCII .xyz point cloud, where each line holds the
+// position of a point. The position is optionally followed by a normal
+// or an 8-bit RGB color, or both in this order. Lines with six values
+// are loaded as colors if all the last three values are integers up to
+// 255 and at least one is larger than one, and as normals otherwise.
+func LoadXYZ(data io.Reader) (*geometry.PointCloud, error) {
+	var (
+		b      pointCloudBuilder
+		n      int
+		extra  []float64
+		colors = true
+	)
+	err := readPointLines(data, func(line int, values []float64) error {
+		if n == 0 {
+			n = len(values)
+			if n != 3 && n != 6 && n != 9 {
+				return fmt.Errorf("loader: unsupported xyz line of %d values at line %d", n, line)
+			}
+		}
+		if len(values) != n {
+			return fmt.Errorf("loader: expect %d values at line %d, got %d", n, line, len(values))
+		}
+
+		b.pos = append(b.pos, math.NewVec3(values[0], values[1], values[2]))
+		switch n {
+		case 6:
+			for _, v := range values[3:6] {
+				if v != math.Round(v) || v < 0 || v > 0xff {
+					colors = false
+				}
+			}
+			extra = append(extra, values[3:6]...)
+		case 9:
+			b.nor = append(b.nor, math.NewVec3(values[3], values[4], values[5]))
+			b.col = append(b.col, pointColor(values[6], values[7], values[8]))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if n == 6 {
+		// Unit normals never exceed one, unlike most colors.
+		if colors {
+			colors = false
+			for _, v := range extra {
+				if v > 1 {
+					colors = true
+					break
+				}
+			}
+		}
+		for i := 0; i < len(extra); i += 3 {
+			if colors {
+				b.col = append(b.col, pointColor(extra[i], extra[i+1], extra[i+2]))
+			} else {
+				b.nor = append(b.nor, math.NewVec3(extra[i], extra[i+1], extra[i+2]))
+			}
+		}
+	}
+	return b.build(), nil
+}
+
+// LoadPTS loads an ASCII .pts point cloud of laser scanners. Each line
+// holds the position of a point, which is optionally followed by the
+// intensity, an 8-bit RGB color, or both in this order. Lines with a
+// single value are the number of points of the following scan. The
+// intensity is not loaded.
+func LoadPTS(data io.Reader) (*geometry.PointCloud, error) {
+	var b pointCloudBuilder
+	n := 0
+	err := readPointLines(data, func(line int, values []float64) error {
+		if len(values) == 1 {
+			return nil
+		}
+		if n == 0 {
+			n = len(values)
+			if n != 3 && n != 4 && n != 6 && n != 7 {
+				return fmt.Errorf("loader: unsupported pts line of %d values at line %d", n, line)
+			}
+		}
+		if len(values) != n {
+			return fmt.Errorf("loader: expect %d values at line %d, got %d", n, line, len(values))
+		}
+
+		b.pos = append(b.pos, math.NewVec3(values[0], values[1], values[2]))
+		switch n {
+		case 6:
+			b.col = append(b.col, pointColor(values[3], values[4], values[5]))
+		case 7:
+			b.col = append(b.col, pointColor(values[4], values[5], values[6]))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return b.build(), nil
+}
+
+// pcdField is a field of a .pcd file.
+type pcdField struct {
+	name   string
+	size   int
+	typ    byte // 'I', 'U' or 'F'
+	count  int
+	offset int // offset in a point record
+	index  int // index in the values of an ASCII point
+}
+
+// pcdHeader is the header of a .pcd file.
+type pcdHeader struct {
+	fields []pcdField
+	points int
+	data   string
+	stride int // size of a point record
+	values int // number of values of an ASCII point
+}
+
+// LoadPCD loads a .pcd point cloud of the Point Cloud Library. ASCII,
+// binary and LZF compressed binary data are supported. Positions are
+// loaded from the x, y and z fields, normals from the normal_x,
+// normal_y and normal_z fields, and colors from the packed rgb or rgba
+// field. Points with an invalid (NaN) position are skipped, which are
+// common in organized point clouds.
+func LoadPCD(data io.Reader) (*geometry.PointCloud, error) {
+	r := bufio.NewReader(data)
+	h, err := readPCDHeader(r)
+	if err != nil {
+		return nil, err
+	}
+
+	// records holds the binary point records, or the parsed values of
+	// all fields for ASCII data.
+	var (
+		records []byte
+		values  []float64
+	)
+	switch h.data {
+	case "ascii":
+		n := h.values
+		err := readPointLines(r, func(line int, vs []float64) error {
+			if len(vs) != n {
+				return fmt.Errorf("loader: expect %d pcd values, got %d", n, len(vs))
+			}
+			values = append(values, vs...)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		if len(values) != n*h.points {
+			return nil, fmt.Errorf("loader: expect %d pcd points, got %d", h.points, len(values)/n)
+		}
+	case "binary":
+		records, err = readBytes(r, int64(h.stride*h.points))
+		if err != nil {
+			return nil, fmt.Errorf("loader: incomplete pcd data, err: %w", err)
+		}
+	case "binary_compressed":
+		records, err = readPCDCompressed(r, h)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("loader: unsupported pcd data %q", h.data)
+	}
+
+	// value returns the first value of the given field of a point.
+	value := func(i int, f *pcdField) float64 {
+		if values != nil {
+			v := values[i*h.values+f.index]
+			if f.typ == 'F' && f.size == 4 && (f.name == "rgb" || f.name == "rgba") {
+				// Packed colors are the bits of a float.
+				return float64(math.Float32bits(float32(v)))
+			}
+			return v
+		}
+		b := records[i*h.stride+f.offset:]
+		return pcdValue(b, f, f.name == "rgb" || f.name == "rgba")
+	}
+
+	var x, y, z, nx, ny, nz, rgb *pcdField
+	for i := range h.fields {
+		f := &h.fields[i]
+		switch f.name {
+		case "x":
+			x = f
+		case "y":
+			y = f
+		case "z":
+			z = f
+		case "normal_x":
+			nx = f
+		case "normal_y":
+			ny = f
+		case "normal_z":
+			nz = f
+		case "rgb", "rgba":
+			rgb = f
+		}
+	}
+	if x == nil || y == nil || z == nil {
+		return nil, errors.New("loader: pcd file has no x, y and z fields")
+	}
+
+	var b pointCloudBuilder
+	for i := 0; i < h.points; i++ {
+		p := math.NewVec3(value(i, x), value(i, y), value(i, z))
+		if math.IsNaN(p.X) || math.IsNaN(p.Y) || math.IsNaN(p.Z) {
+			continue
+		}
+		b.pos = append(b.pos, p)
+		if nx != nil && ny != nil && nz != nil {
+			b.nor = append(b.nor, math.NewVec3(value(i, nx), value(i, ny), value(i, nz)))
+		}
+		if rgb != nil {
+			c := uint32(value(i, rgb))
+			a := uint8(0xff)
+			if rgb.name == "rgba" {
+				a = uint8(c >> 24)
+			}
+			b.col = append(b.col, color.RGBA{uint8(c >> 16), uint8(c >> 8), uint8(c), a})
+		}
+	}
+	return b.build(), nil
+}
+
+// readPCDHeader reads the header of a .pcd file until the DATA line.
+func readPCDHeader(r *bufio.Reader) (*pcdHeader, error) {
+	h := &pcdHeader{}
+	var (
+		sizes, counts []int
+		types         []string
+		width, height = -1, 1
+	)
+	ints := func(fields []string) ([]int, error) {
+		vs := make([]int, len(fields))
+		for i, f := range fields {
+			v, err := strconv.Atoi(f)
+			if err != nil || v <= 0 {
+				return nil, fmt.Errorf("loader: invalid pcd value %q", f)
+			}
+			vs[i] = v
+		}
+		return vs, nil
+	}
+
+	for h.data == "" {
+		line, err := r.ReadString('\n')
+		if err != nil && (err != io.EOF || line == "") {
+			return nil, fmt.Errorf("loader: incomplete pcd header, err: %w", err)
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		key, args := strings.ToUpper(fields[0]), fields[1:]
+		switch key {
+		case "FIELDS", "COLUMNS":
+			h.fields = make([]pcdField, len(args))
+			for i, name := range args {
+				h.fields[i] = pcdField{name: name, size: 4, typ: 'F', count: 1}
+			}
+		case "SIZE":
+			sizes, err = ints(args)
+		case "TYPE":
+			types = args
+		case "COUNT":
+			counts, err = ints(args)
+		case "WIDTH":
+			width, err = strconv.Atoi(strings.Join(args, ""))
+		case "HEIGHT":
+			height, err = strconv.Atoi(strings.Join(args, ""))
+		case "POINTS":
+			h.points, err = strconv.Atoi(strings.Join(args, ""))
+		case "DATA":
+			if len(args) != 1 {
+				return nil, errors.New("loader: invalid pcd data line")
+			}
+			h.data = strings.ToLower(args[0])
+		case "VERSION", "VIEWPOINT":
+		default:
+			return nil, fmt.Errorf("loader: unknown pcd header %q", fields[0])
+		}
+		if err != nil {
+			return nil, fmt.Errorf("loader: invalid pcd header %q, err: %w", strings.TrimSpace(line), err)
+		}
+	}
+
+	if len(h.fields) == 0 {
+		return nil, errors.New("loader: pcd file has no fields")
+	}
+	for _, vs := range []int{len(sizes), len(types), len(counts)} {
+		if vs != 0 && vs != len(h.fields) {
+			return nil, errors.New("loader: pcd header does not match the number of fields")
+		}
+	}
+	for i := range h.fields {
+		f := &h.fields[i]
+		if sizes != nil {
+			f.size = sizes[i]
+		}
+		if types != nil {
+			f.typ = strings.ToUpper(types[i])[0]
+		}
+		if counts != nil {
+			f.count = counts[i]
+		}
+		switch {
+		case f.typ == 'F' && (f.size == 4 || f.size == 8):
+		case (f.typ == 'I' || f.typ == 'U') && (f.size == 1 || f.size == 2 || f.size == 4 || f.size == 8):
+		default:
+			return nil, fmt.Errorf("loader: unsupported pcd field %s of type %c and size %d", f.name, f.typ, f.size)
+		}
+		if f.count > (maxInt-h.stride)/f.size {
+			return nil, fmt.Errorf("loader: pcd field %s is too large", f.name)
+		}
+		f.offset, f.index = h.stride, h.values
+		h.stride += f.size * f.count
+		h.values += f.count
+	}
+	if h.points == 0 && width >= 0 {
+		if height < 0 || (height > 0 && width > maxInt/height) {
+			return nil, fmt.Errorf("loader: invalid pcd size %d x %d", width, height)
+		}
+		h.points = width * height
+	}
+	if h.points < 0 || (h.points > 0 && h.stride > maxInt/h.points) {
+		return nil, fmt.Errorf("loader: invalid number of pcd points %d", h.points)
+	}
+	return h, nil
+}
+
+// pcdValue decodes a little endian value of the given field. Packed
+// colors keep their bits.
+func pcdValue(b []byte, f *pcdField, packed bool) float64 {
+	le := binary.LittleEndian
+	switch f.typ {
+	case 'F':
+		if f.size == 4 {
+			if packed {
+				return float64(le.Uint32(b))
+			}
+			return float64(math.Float32frombits(le.Uint32(b)))
+		}
+		return math.Float64frombits(le.Uint64(b))
+	case 'U':
+		switch f.size {
+		case 1:
+			return float64(b[0])
+		case 2:
+			return float64(le.Uint16(b))
+		case 4:
+			return float64(le.Uint32(b))
+		}
+		return float64(le.Uint64(b))
+	default:
+		switch f.size {
+		case 1:
+			return float64(int8(b[0]))
+		case 2:
+			return float64(int16(le.Uint16(b)))
+		case 4:
+			return float64(int32(le.Uint32(b)))
+		}
+		return float64(int64(le.Uint64(b)))
+	}
+}
+
+// readPCDCompressed reads LZF compressed binary data, and converts the
+// decompressed data from a field-major layout to point records.
+func readPCDCompressed(r io.Reader, h *pcdHeader) ([]byte, error) {
+	var sizes [2]uint32
+	if err := binary.Read(r, binary.LittleEndian, &sizes); err != nil {
+		return nil, fmt.Errorf("loader: incomplete pcd data, err: %w", err)
+	}
+	if int(sizes[1]) != h.stride*h.points {
+		return nil, fmt.Errorf("loader: pcd data size %d does not match %d points", sizes[1], h.points)
+	}
+	packed, err := readBytes(r, int64(sizes[0]))
+	if err != nil {
+		return nil, fmt.Errorf("loader: incomplete pcd data, err: %w", err)
+	}
+	raw, err := decompressLZF(packed, int(sizes[1]))
+	if err != nil {
+		return nil, fmt.Errorf("loader: invalid compressed pcd data, err: %w", err)
+	}
+
+	records := make([]byte, len(raw))
+	offset := 0
+	for _, f := range h.fields {
+		n := f.size * f.count
+		for i := 0; i < h.points; i++ {
+			copy(records[i*h.stride+f.offset:i*h.stride+f.offset+n], raw[offset:offset+n])
+			offset += n
+		}
+	}
+	return records, nil
+}
+
+// decompressLZF decompresses LZF data of the given decompressed size.
+func decompressLZF(in []byte, size int) ([]byte, error) {
+	out := make([]byte, 0, len(in))
+	for i := 0; i < len(in); {
+		ctrl := int(in[i])
+		i++
+		if ctrl < 1<<5 {
+			// A literal run of ctrl+1 bytes.
+			n := ctrl + 1
+			if i+n > len(in) || len(out)+n > size {
+				return nil, errors.New("literal run out of range")
+			}
+			out = append(out, in[i:i+n]...)
+			i += n
+			continue
+		}
+
+		// A back reference, which may overlap the output.
+		n := ctrl >> 5
+		if n == 7 {
+			if i >= len(in) {
+				return nil, errors.New("truncated back reference")
+			}
+			n += int(in[i])
+			i++
+		}
+		if i >= len(in) {
+			return nil, errors.New("truncated back reference")
+		}
+		ref := len(out) - (ctrl&0x1f)<<8 - int(in[i]) - 1
+		i++
+		n += 2
+		if ref < 0 || len(out)+n > size {
+			return nil, errors.New("back reference out of range")
+		}
+		for k := 0; k < n; k++ {
+			out = append(out, out[ref+k])
+		}
+	}
+	if len(out) != size {
+		return nil, fmt.Errorf("decompressed %d bytes, expect %d", len(out), size)
+	}
+	return out, nil
+}
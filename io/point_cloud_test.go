@@ -0,0 +1,247 @@
+// Copyright 2021 Changkun Ou <changkun.de>. All rights reserved.
+// Use of this source code is governed by a GPLv3 license that
+// can be found in the LICENSE file.
+
+package io_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image/color"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"poly.red/io"
+	"poly.red/math"
+)
+
+func TestLoadXYZ(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		nor  bool
+		col  bool
+	}{
+		{"position", "# comment\n0 0 0\n1 2 3\n\n-1 0.5 2e1\n", false, false},
+		{"normal", "0 0 0 0 0 1\n1 2 3 0 1 0\n-1 0.5 20 1 0 0\n", true, false},
+		{"color", "0 0 0 255 0 0\n1 2 3 0 128 0\n-1 0.5 20 0 0 1\n", false, true},
+		{"normal and color", "0 0 0 0 0 1 255 0 0\n1 2 3 0 1 0 0 128 0\n-1 0.5 20 1 0 0 0 0 1\n", true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pc, err := io.LoadXYZ(strings.NewReader(tt.data))
+			if err != nil {
+				t.Fatalf("cannot load xyz: %v", err)
+			}
+			if pc.NumPoints() != 3 {
+				t.Fatalf("expect 3 points, got %d", pc.NumPoints())
+			}
+			if !pc.Positions()[2].Eq(math.NewVec3(-1, 0.5, 20)) {
+				t.Fatalf("unexpected position: %v", pc.Positions()[2])
+			}
+			if (pc.Normals() != nil) != tt.nor {
+				t.Fatalf("expect normals %v, got %v", tt.nor, pc.Normals())
+			}
+			if tt.nor && !pc.Normals()[1].Eq(math.NewVec3(0, 1, 0)) {
+				t.Fatalf("unexpected normal: %v", pc.Normals()[1])
+			}
+			if (pc.Colors() != nil) != tt.col {
+				t.Fatalf("expect colors %v, got %v", tt.col, pc.Colors())
+			}
+			if tt.col && pc.Colors()[1] != (color.RGBA{0, 128, 0, 255}) {
+				t.Fatalf("unexpected color: %v", pc.Colors()[1])
+			}
+		})
+	}
+
+	for _, data := range []string{"0 0\n", "0 0 0\n1 1 1 1 1 1\n", "0 0 x\n"} {
+		if _, err := io.LoadXYZ(strings.NewReader(data)); err == nil {
+			t.Fatalf("expect an error for %q", data)
+		}
+	}
+}
+
+func TestLoadPTS(t *testing.T) {
+	data := `2
+0 0 0 -100 255 0 0
+1 2 3 12 0 128 0
+1
+4 5 6 0 0 0 255
+`
+	pc, err := io.LoadPTS(strings.NewReader(data))
+	if err != nil {
+		t.Fatalf("cannot load pts: %v", err)
+	}
+	if pc.NumPoints() != 3 {
+		t.Fatalf("expect 3 points, got %d", pc.NumPoints())
+	}
+	if !pc.Positions()[2].Eq(math.NewVec3(4, 5, 6)) {
+		t.Fatalf("unexpected position: %v", pc.Positions()[2])
+	}
+	if pc.Colors()[1] != (color.RGBA{0, 128, 0, 255}) {
+		t.Fatalf("unexpected color: %v", pc.Colors()[1])
+	}
+
+	pc, err = io.LoadPTS(strings.NewReader("0 0 0 1\n1 1 1 2\n"))
+	if err != nil {
+		t.Fatalf("cannot load pts: %v", err)
+	}
+	if pc.NumPoints() != 2 || pc.Colors() != nil {
+		t.Fatalf("unexpected points: %v, colors: %v", pc.Positions(), pc.Colors())
+	}
+}
+
+// pcdPoints are the points of the pcd tests, where the last point is
+// invalid.
+var pcdPoints = []struct {
+	pos [3]float32
+	nor [3]float32
+	rgb uint32
+}{
+	{[3]float32{0, 0, 0}, [3]float32{0, 0, 1}, 0xff0000},
+	{[3]float32{1, 2, 3}, [3]float32{0, 1, 0}, 0x008000},
+	{[3]float32{-1, 0.5, 20}, [3]float32{1, 0, 0}, 0x0000ff},
+	{[3]float32{float32(math.Inf(1)) * 0, 0, 0}, [3]float32{0, 0, 0}, 0},
+}
+
+const pcdHeader = `# .PCD v0.7 - Point Cloud Data file format
+VERSION 0.7
+FIELDS x y z normal_x normal_y normal_z rgb
+SIZE 4 4 4 4 4 4 4
+TYPE F F F F F F F
+COUNT 1 1 1 1 1 1 1
+WIDTH 4
+HEIGHT 1
+VIEWPOINT 0 0 0 1 0 0 0
+POINTS 4
+`
+
+// pcdRecord returns the binary record of the given point.
+func pcdRecord(i int) []byte {
+	p := pcdPoints[i]
+	var b [28]byte
+	vs := append(p.pos[:], p.nor[:]...)
+	for k, v := range vs {
+		binary.LittleEndian.PutUint32(b[4*k:], math.Float32bits(v))
+	}
+	binary.LittleEndian.PutUint32(b[24:], p.rgb)
+	return b[:]
+}
+
+func TestLoadPCD(t *testing.T) {
+	ascii := &bytes.Buffer{}
+	ascii.WriteString(pcdHeader + "DATA ascii\n")
+	ascii.WriteString("0 0 0 0 0 1 2.3418052e-38\n")
+	ascii.WriteString("1 2 3 0 1 0 4.5918e-41\n")
+	ascii.WriteString("-1 0.5 20 1 0 0 3.5733111e-43\n")
+	ascii.WriteString("nan nan nan 0 0 0 0\n")
+
+	bin := &bytes.Buffer{}
+	bin.WriteString(pcdHeader + "DATA binary\n")
+	for i := range pcdPoints {
+		bin.Write(pcdRecord(i))
+	}
+
+	// The compressed data is field-major and stored as literal runs.
+	var raw []byte
+	for f := 0; f < 7; f++ {
+		for i := range pcdPoints {
+			raw = append(raw, pcdRecord(i)[4*f:4*f+4]...)
+		}
+	}
+	var lzf []byte
+	for i := 0; i < len(raw); i += 32 {
+		n := len(raw) - i
+		if n > 32 {
+			n = 32
+		}
+		lzf = append(lzf, byte(n-1))
+		lzf = append(lzf, raw[i:i+n]...)
+	}
+	compressed := &bytes.Buffer{}
+	compressed.WriteString(pcdHeader + "DATA binary_compressed\n")
+	binary.Write(compressed, binary.LittleEndian, [2]uint32{uint32(len(lzf)), uint32(len(raw))})
+	compressed.Write(lzf)
+
+	for name, data := range map[string]*bytes.Buffer{
+		"ascii":             ascii,
+		"binary":            bin,
+		"binary_compressed": compressed,
+	} {
+		t.Run(name, func(t *testing.T) {
+			pc, err := io.LoadPCD(data)
+			if err != nil {
+				t.Fatalf("cannot load pcd: %v", err)
+			}
+			if pc.NumPoints() != 3 {
+				t.Fatalf("expect 3 points, got %d", pc.NumPoints())
+			}
+			want := []color.RGBA{{255, 0, 0, 255}, {0, 128, 0, 255}, {0, 0, 255, 255}}
+			for i := 0; i < 3; i++ {
+				p := pcdPoints[i]
+				pos := math.NewVec3(float64(p.pos[0]), float64(p.pos[1]), float64(p.pos[2]))
+				nor := math.NewVec3(float64(p.nor[0]), float64(p.nor[1]), float64(p.nor[2]))
+				if !pc.Positions()[i].Eq(pos) || !pc.Normals()[i].Eq(nor) {
+					t.Fatalf("unexpected point %d: %v, %v", i, pc.Positions()[i], pc.Normals()[i])
+				}
+				if pc.Colors()[i] != want[i] {
+					t.Fatalf("unexpected color %d: %v", i, pc.Colors()[i])
+				}
+			}
+		})
+	}
+
+	for _, data := range []string{
+		"FIELDS a b\nPOINTS 0\nDATA ascii\n",
+		"FIELDS x y z\nSIZE 4 4\nPOINTS 0\nDATA ascii\n",
+		"FIELDS x y z\nPOINTS 1\nDATA binary\n\x00",
+		"FIELDS x y z\nPOINTS 1\nDATA ascii\n0 0\n",
+		"FIELDS x y z\nPOINTS 1\nDATA unknown\n",
+		// Sizes of the header that exceed the data or overflow.
+		"FIELDS x y z\nPOINTS 3074457345618258603\nDATA ascii\n0 0 0\n",
+		"FIELDS x y z\nPOINTS 3074457345618258603\nDATA binary\n\x00",
+		"FIELDS x y z\nPOINTS 100000000\nDATA binary\n\x00",
+		"FIELDS x y z\nWIDTH 4294967296\nHEIGHT 4294967296\nDATA binary\n\x00",
+		"FIELDS x\nCOUNT 9223372036854775807\nPOINTS 1\nDATA binary\n\x00",
+		"FIELDS x y z\nPOINTS 89478485\nDATA binary_compressed\n\xff\xff\xff\xff\xfc\xff\xff\x3f",
+	} {
+		if _, err := io.LoadPCD(strings.NewReader(data)); err == nil {
+			t.Fatalf("expect an error for %q", data)
+		}
+	}
+}
+
+func TestDecompressLZF(t *testing.T) {
+	// A literal "ab" followed by a back reference of 5 bytes at
+	// distance 2, which overlaps the output.
+	out, err := io.DecompressLZF([]byte{1, 'a', 'b', 3 << 5, 1}, 7)
+	if err != nil {
+		t.Fatalf("cannot decompress: %v", err)
+	}
+	if string(out) != "abababa" {
+		t.Fatalf("expect abababa, got %q", out)
+	}
+	if _, err := io.DecompressLZF([]byte{1 << 5, 3}, 3); err == nil {
+		t.Fatalf("expect an error for an invalid back reference")
+	}
+}
+
+func TestLoadPointCloud(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "points.XYZ")
+	if err := os.WriteFile(path, []byte("0 0 0\n1 1 1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	pc, err := io.LoadPointCloud(path)
+	if err != nil {
+		t.Fatalf("cannot load point cloud: %v", err)
+	}
+	if pc.NumPoints() != 2 {
+		t.Fatalf("expect 2 points, got %d", pc.NumPoints())
+	}
+	if _, err := io.LoadPointCloud(filepath.Join(dir, "points.las")); err == nil {
+		t.Fatalf("expect an error for an unsupported format")
+	}
+}
@@ -0,0 +1,420 @@
+// Copyright 2021 Changkun Ou <changkun.de>. All rights reserved.
+// Use of this source code is governed by a GPLv3 license that
+// can be found in the LICENSE file.
+
+package io
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image/color"
+	"io"
+	"path/filepath"
+
+	"poly.red/camera"
+	"poly.red/image"
+	"poly.red/light"
+	"poly.red/material"
+	"poly.red/math"
+	"poly.red/object"
+	"poly.red/render"
+	"poly.red/scene"
+)
+
+// SceneDescription is a declarative description of a scene and its
+// rendering options, which is stored as a JSON file. For instance:
+//
+//	{
+//	  "camera": {
+//	    "type": "perspective",
+//	    "position": [0, 0.6, 0.9], "target": [0, 0, 0], "up": [0, 1, 0],
+//	    "fov": 45, "near": 0.1, "far": 2
+//	  },
+//	  "lights": [
+//	    {"type": "point", "position": [4, 4, 2], "intensity": 3, "shadow": true},
+//	    {"type": "ambient", "intensity": 0.7}
+//	  ],
+//	  "materials": {
+//	    "bunny": {"type": "blinnphong", "texture": "bunny.png", "mipmap": true}
+//	  },
+//	  "meshes": [
+//	    {"file": "bunny.obj", "material": "bunny", "scale": [2, 2, 2]}
+//	  ],
+//	  "renderer": {"width": 800, "height": 500, "msaa": 2, "shadowMap": true}
+//	}
+//
+// Relative paths of mesh and texture files are resolved against the
+// directory that is given to Build, see also WithSceneDir, and optional
+// fields that are omitted keep the defaults of the corresponding
+// constructors and render options.
+type SceneDescription struct {
+	Camera    CameraDescription              `json:"camera"`
+	Lights    []LightDescription             `json:"lights,omitempty"`
+	Materials map[string]MaterialDescription `json:"materials,omitempty"`
+	Meshes    []MeshDescription              `json:"meshes,omitempty"`
+	Renderer  RendererDescription            `json:"renderer"`
+}
+
+// CameraDescription describes either a "perspective" or an
+// "orthographic" camera. The field of view of a perspective camera is
+// in degrees, and its aspect defaults to the aspect of the renderer.
+type CameraDescription struct {
+	Type     string     `json:"type"`
+	Position [3]float64 `json:"position"`
+	Target   [3]float64 `json:"target"`
+	Up       [3]float64 `json:"up"`
+	Fov      float64    `json:"fov,omitempty"`
+	Aspect   float64    `json:"aspect,omitempty"`
+	Left     float64    `json:"left,omitempty"`
+	Right    float64    `json:"right,omitempty"`
+	Bottom   float64    `json:"bottom,omitempty"`
+	Top      float64    `json:"top,omitempty"`
+	Near     float64    `json:"near"`
+	Far      float64    `json:"far"`
+}
+
+// LightDescription describes a "point", "directional" or "ambient"
+// light. Colors are 8-bit RGBA values.
+type LightDescription struct {
+	Type      string      `json:"type"`
+	Position  *[3]float64 `json:"position,omitempty"`
+	Direction *[3]float64 `json:"direction,omitempty"`
+	Intensity *float64    `json:"intensity,omitempty"`
+	Color     *[4]uint8   `json:"color,omitempty"`
+	Shadow    bool        `json:"shadow,omitempty"`
+}
+
+// MaterialDescription describes a "blinnphong" material. Textures are
+// image files, where GammaCorrection converts the texture from sRGB to
+// linear space.
+type MaterialDescription struct {
+	Type             string   `json:"type"`
+	Texture          string   `json:"texture,omitempty"`
+	NormalMap        string   `json:"normalMap,omitempty"`
+	Mipmap           bool     `json:"mipmap,omitempty"`
+	GammaCorrection  bool     `json:"gammaCorrection,omitempty"`
+	Kdiff            *float64 `json:"kdiff,omitempty"`
+	Kspec            *float64 `json:"kspec,omitempty"`
+	Shininess        *float64 `json:"shininess,omitempty"`
+	FlatShading      bool     `json:"flatShading,omitempty"`
+	Shadow           bool     `json:"shadow,omitempty"`
+	AmbientOcclusion bool     `json:"ambientOcclusion,omitempty"`
+}
+
+// MeshDescription describes a mesh file that is loaded by LoadMesh.
+// Material refers to a material of the scene description, and the mesh
+// keeps the material of its file if it is empty. Regardless of their
+// order in the description, the mesh is rotated first, then scaled and
+// then translated, see math.TransformContext. Multiple rotations are
+// applied in the given order.
+type MeshDescription struct {
+	File      string                `json:"file"`
+	Material  string                `json:"material,omitempty"`
+	Scale     *[3]float64           `json:"scale,omitempty"`
+	Rotate    []RotationDescription `json:"rotate,omitempty"`
+	Translate *[3]float64           `json:"translate,omitempty"`
+}
+
+// RotationDescription describes a counterclockwise rotation around an
+// axis, where the angle is in degrees.
+type RotationDescription struct {
+	Axis  [3]float64 `json:"axis"`
+	Angle float64    `json:"angle"`
+}
+
+// RendererDescription describes the options of a renderer. A zero size
+// or msaa keeps the renderer defaults.
+type RendererDescription struct {
+	Width           int       `json:"width,omitempty"`
+	Height          int       `json:"height,omitempty"`
+	MSAA            int       `json:"msaa,omitempty"`
+	Background      *[4]uint8 `json:"background,omitempty"`
+	ShadowMap       bool      `json:"shadowMap,omitempty"`
+	GammaCorrection bool      `json:"gammaCorrection,omitempty"`
+	HDR             bool      `json:"hdr,omitempty"`
+}
+
+// SceneOption offers custom configurations for loading a scene
+// description.
+type SceneOption struct {
+	dir string
+}
+
+type ReadSceneOption func(o *SceneOption)
+
+// WithSceneDir sets the directory that is used for resolving relative
+// paths of mesh and texture files, which is usually the directory of
+// the description file. By default, paths are resolved relative to the
+// current working directory.
+func WithSceneDir(dir string) ReadSceneOption {
+	return func(o *SceneOption) {
+		o.dir = dir
+	}
+}
+
+// LoadScene loads a JSON scene description and builds the described
+// scene. The returned render options include the scene itself, which
+// can be passed to render.NewRenderer directly.
+func LoadScene(data io.Reader, opts ...ReadSceneOption) (*scene.Scene, []render.Option, error) {
+	option := &SceneOption{
+		dir: ".",
+	}
+	for _, opt := range opts {
+		opt(option)
+	}
+
+	d, err := ReadSceneDescription(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	return d.Build(option.dir)
+}
+
+// ReadSceneDescription reads a JSON scene description. Unknown fields
+// are rejected to catch typos.
+func ReadSceneDescription(data io.Reader) (*SceneDescription, error) {
+	dec := json.NewDecoder(data)
+	dec.DisallowUnknownFields()
+	d := &SceneDescription{}
+	if err := dec.Decode(d); err != nil {
+		return nil, fmt.Errorf("loader: cannot read scene description, err: %w", err)
+	}
+	return d, nil
+}
+
+// SaveScene writes the given scene description as an indented JSON
+// file, which can be loaded by LoadScene. Built scenes cannot be saved,
+// since a scene.Scene does not keep the files of its meshes and
+// textures.
+func SaveScene(w io.Writer, d *SceneDescription) error {
+	b, err := json.MarshalIndent(d, "", "  ")
+	if err != nil {
+		return fmt.Errorf("loader: cannot encode scene description, err: %w", err)
+	}
+	if _, err := w.Write(append(b, '\n')); err != nil {
+		return fmt.Errorf("loader: cannot write scene description, err: %w", err)
+	}
+	return nil
+}
+
+// Build builds the described scene and its render options, where files
+// are resolved relative to the given directory.
+func (d *SceneDescription) Build(dir string) (*scene.Scene, []render.Option, error) {
+	s := scene.NewScene()
+	cam, err := d.buildCamera()
+	if err != nil {
+		return nil, nil, err
+	}
+	s.SetCamera(cam)
+
+	for i, l := range d.Lights {
+		o, err := l.build()
+		if err != nil {
+			return nil, nil, fmt.Errorf("loader: invalid light %d, err: %w", i, err)
+		}
+		s.Add(o)
+	}
+
+	// Textures are shared by materials that refer to the same file.
+	textures := map[string]*image.Texture{}
+	loadTexture := func(path string, mipmap, gamma bool) (*image.Texture, error) {
+		key := fmt.Sprintf("%s:%v:%v", path, mipmap, gamma)
+		if tex, ok := textures[key]; ok {
+			return tex, nil
+		}
+		data, err := LoadImage(resolvePath(dir, path), WithGammaCorrection(gamma))
+		if err != nil {
+			return nil, err
+		}
+		tex := image.NewTexture(image.WithSource(data), image.WithIsotropicMipMap(mipmap))
+		textures[key] = tex
+		return tex, nil
+	}
+	mats := map[string]material.Material{}
+	for name, m := range d.Materials {
+		mat, err := m.build(loadTexture)
+		if err != nil {
+			return nil, nil, fmt.Errorf("loader: invalid material %q, err: %w", name, err)
+		}
+		mats[name] = mat
+	}
+
+	for _, m := range d.Meshes {
+		mesh, err := LoadMesh(resolvePath(dir, m.File))
+		if err != nil {
+			return nil, nil, err
+		}
+		if m.Material != "" {
+			mat, ok := mats[m.Material]
+			if !ok {
+				return nil, nil, fmt.Errorf("loader: mesh %s refers to unknown material %q", m.File, m.Material)
+			}
+			mesh.SetMaterial(mat)
+		}
+		if m.Scale != nil {
+			mesh.Scale(m.Scale[0], m.Scale[1], m.Scale[2])
+		}
+		for _, r := range m.Rotate {
+			mesh.Rotate(math.NewVec3(r.Axis[0], r.Axis[1], r.Axis[2]), r.Angle*math.Pi/180)
+		}
+		if m.Translate != nil {
+			mesh.Translate(m.Translate[0], m.Translate[1], m.Translate[2])
+		}
+		s.Add(mesh)
+	}
+
+	return s, d.Renderer.options(s), nil
+}
+
+func (d *SceneDescription) buildCamera() (camera.Interface, error) {
+	c := &d.Camera
+	pos := math.NewVec3(c.Position[0], c.Position[1], c.Position[2])
+	target := math.NewVec3(c.Target[0], c.Target[1], c.Target[2])
+	up := math.NewVec3(c.Up[0], c.Up[1], c.Up[2])
+	if up.IsZero() {
+		return nil, errors.New("loader: camera has no up direction")
+	}
+
+	switch c.Type {
+	case "perspective":
+		aspect := c.Aspect
+		if aspect == 0 && d.Renderer.Width > 0 && d.Renderer.Height > 0 {
+			aspect = float64(d.Renderer.Width) / float64(d.Renderer.Height)
+		}
+		if aspect <= 0 || c.Fov <= 0 {
+			return nil, errors.New("loader: perspective camera needs a field of view and an aspect")
+		}
+		return camera.NewPerspective(pos, target, up, c.Fov, aspect, c.Near, c.Far), nil
+	case "orthographic":
+		return camera.NewOrthographic(pos, target, up,
+			c.Left, c.Right, c.Bottom, c.Top, c.Near, c.Far), nil
+	default:
+		return nil, fmt.Errorf("loader: unsupported camera type %q", c.Type)
+	}
+}
+
+func (l *LightDescription) build() (object.Object, error) {
+	vec := func(v *[3]float64) math.Vec3 {
+		return math.NewVec3(v[0], v[1], v[2])
+	}
+	rgba := func(c *[4]uint8) color.RGBA {
+		return color.RGBA{c[0], c[1], c[2], c[3]}
+	}
+
+	switch l.Type {
+	case "point":
+		var opts []light.PointOption
+		if l.Position != nil {
+			opts = append(opts, light.WithPointLightPosition(vec(l.Position)))
+		}
+		if l.Intensity != nil {
+			opts = append(opts, light.WithPointLightIntensity(*l.Intensity))
+		}
+		if l.Color != nil {
+			opts = append(opts, light.WithPointLightColor(rgba(l.Color)))
+		}
+		opts = append(opts, light.WithPointLightShadowMap(l.Shadow))
+		return light.NewPoint(opts...), nil
+	case "directional":
+		var opts []light.DirectionalOption
+		if l.Position != nil {
+			opts = append(opts, light.WithDirectionalLightPosition(vec(l.Position)))
+		}
+		if l.Direction != nil {
+			if vec(l.Direction).IsZero() {
+				return nil, errors.New("zero light direction")
+			}
+			opts = append(opts, light.WithDirectionalLightDirection(vec(l.Direction)))
+		}
+		if l.Intensity != nil {
+			opts = append(opts, light.WithDirectionalLightIntensity(*l.Intensity))
+		}
+		if l.Color != nil {
+			opts = append(opts, light.WithDirectionalLightColor(rgba(l.Color)))
+		}
+		opts = append(opts, light.WithDirectionalLightShadowMap(l.Shadow))
+		return light.NewDirectional(opts...), nil
+	case "ambient":
+		var opts []light.AmbientOption
+		if l.Intensity != nil {
+			opts = append(opts, light.WithAmbientIntensity(*l.Intensity))
+		}
+		if l.Color != nil {
+			opts = append(opts, light.WithAmbientColor(rgba(l.Color)))
+		}
+		return light.NewAmbient(opts...), nil
+	default:
+		return nil, fmt.Errorf("unsupported light type %q", l.Type)
+	}
+}
+
+func (m *MaterialDescription) build(loadTexture func(path string, mipmap, gamma bool) (*image.Texture, error)) (material.Material, error) {
+	if m.Type != "blinnphong" {
+		return nil, fmt.Errorf("unsupported material type %q", m.Type)
+	}
+
+	opts := []material.BlinnPhongMaterialOption{
+		material.WithBlinnPhongFlatShading(m.FlatShading),
+		material.WithBlinnPhongShadow(m.Shadow),
+		material.WithBlinnPhongAmbientOcclusion(m.AmbientOcclusion),
+	}
+	if m.Texture != "" {
+		tex, err := loadTexture(m.Texture, m.Mipmap, m.GammaCorrection)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, material.WithBlinnPhongTexture(tex))
+	}
+	if m.NormalMap != "" {
+		// Normal maps store directions rather than colors, and are
+		// never gamma corrected.
+		tex, err := loadTexture(m.NormalMap, m.Mipmap, false)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, material.WithBlinnPhongNormalMap(tex))
+	}
+	if m.Kdiff != nil || m.Kspec != nil {
+		kdiff, kspec := material.NewBlinnPhong().(*material.BlinnPhongMaterial).Factors()
+		if m.Kdiff != nil {
+			kdiff = *m.Kdiff
+		}
+		if m.Kspec != nil {
+			kspec = *m.Kspec
+		}
+		opts = append(opts, material.WithBlinnPhongFactors(kdiff, kspec))
+	}
+	if m.Shininess != nil {
+		opts = append(opts, material.WithBlinnPhongShininess(*m.Shininess))
+	}
+	return material.NewBlinnPhong(opts...), nil
+}
+
+func (r *RendererDescription) options(s *scene.Scene) []render.Option {
+	opts := []render.Option{
+		render.WithScene(s),
+		render.WithShadowMap(r.ShadowMap),
+		render.WithGammaCorrection(r.GammaCorrection),
+		render.WithHDR(r.HDR),
+	}
+	if r.Width > 0 && r.Height > 0 {
+		opts = append(opts, render.WithSize(r.Width, r.Height))
+	}
+	if r.MSAA > 0 {
+		opts = append(opts, render.WithMSAA(r.MSAA))
+	}
+	if r.Background != nil {
+		c := r.Background
+		opts = append(opts, render.WithBackground(color.RGBA{c[0], c[1], c[2], c[3]}))
+	}
+	return opts
+}
+
+// resolvePath resolves a relative path against the given directory.
+func resolvePath(dir, path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(dir, path)
+}
@@ -0,0 +1,138 @@
+// Copyright 2021 Changkun Ou <changkun.de>. All rights reserved.
+// Use of this source code is governed by a GPLv3 license that
+// can be found in the LICENSE file.
+
+package io_test
+
+import (
+	"bytes"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"poly.red/camera"
+	"poly.red/geometry"
+	"poly.red/io"
+	"poly.red/light"
+	"poly.red/material"
+	"poly.red/math"
+	"poly.red/object"
+	"poly.red/render"
+)
+
+func TestLoadScene(t *testing.T) {
+	f, err := os.Open("../testdata/shadow.json")
+	if err != nil {
+		t.Fatalf("cannot open scene description: %v", err)
+	}
+	defer f.Close()
+
+	s, opts, err := io.LoadScene(f, io.WithSceneDir("../testdata"))
+	if err != nil {
+		t.Fatalf("cannot load scene: %v", err)
+	}
+
+	cam, ok := s.GetCamera().(*camera.Perspective)
+	if !ok {
+		t.Fatalf("unexpected camera: %T", s.GetCamera())
+	}
+	if cam.Fov() != 45 || cam.Aspect() != 80.0/50 || !cam.Position().Eq(math.NewVec3(0, 0.6, 0.9)) {
+		t.Fatalf("unexpected camera: fov %v, aspect %v, position %v", cam.Fov(), cam.Aspect(), cam.Position())
+	}
+
+	var (
+		points, ambients int
+		meshes           []geometry.Mesh
+	)
+	s.IterObjects(func(o object.Object, modelMatrix math.Mat4) bool {
+		switch o := o.(type) {
+		case *light.Point:
+			points++
+			if o.Intensity() != 3 || !o.CastShadow() {
+				t.Fatalf("unexpected point light: %v, %v", o.Intensity(), o.CastShadow())
+			}
+		case *light.Ambient:
+			ambients++
+			if o.Intensity() != 0.7 {
+				t.Fatalf("unexpected ambient light: %v", o.Intensity())
+			}
+		case geometry.Mesh:
+			meshes = append(meshes, o)
+		}
+		return true
+	})
+	if points != 2 || ambients != 1 || len(meshes) != 2 {
+		t.Fatalf("unexpected objects: %d points, %d ambients, %d meshes", points, ambients, len(meshes))
+	}
+	mat := meshes[1].GetMaterial().(*material.BlinnPhongMaterial)
+	if kd, ks := mat.Factors(); kd != 0.6 || ks != 0.3 || mat.Shininess() != 20 || !mat.ReceiveShadow() {
+		t.Fatalf("unexpected material: %v, %v, %v", kd, ks, mat.Shininess())
+	}
+	if !meshes[0].ModelMatrix().Eq(math.NewMat4(
+		2, 0, 0, 0,
+		0, 2, 0, 0,
+		0, 0, 2, 0,
+		0, 0, 0, 1,
+	)) {
+		t.Fatalf("unexpected model matrix: %v", meshes[0].ModelMatrix())
+	}
+
+	img := render.NewRenderer(opts...).Render()
+	if img.Bounds().Dx() != 80 || img.Bounds().Dy() != 50 {
+		t.Fatalf("unexpected render size: %v", img.Bounds())
+	}
+	if c := img.RGBAAt(0, 0); c.R != 0 || c.G != 127 || c.B != 255 {
+		t.Fatalf("unexpected background: %v", c)
+	}
+}
+
+func TestSaveScene(t *testing.T) {
+	data, err := os.ReadFile("../testdata/shadow.json")
+	if err != nil {
+		t.Fatalf("cannot read scene description: %v", err)
+	}
+	want, err := io.ReadSceneDescription(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("cannot read scene description: %v", err)
+	}
+	want.Meshes[0].Rotate = []io.RotationDescription{{Axis: [3]float64{0, 1, 0}, Angle: -30}}
+	want.Lights = append(want.Lights, io.LightDescription{
+		Type:      "directional",
+		Direction: &[3]float64{0, -1, -1},
+		Color:     &[4]uint8{255, 200, 100, 255},
+	})
+
+	buf := &bytes.Buffer{}
+	if err := io.SaveScene(buf, want); err != nil {
+		t.Fatalf("cannot save scene description: %v", err)
+	}
+	got, err := io.ReadSceneDescription(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("cannot read saved scene description: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("scene description does not round trip:\n%s", buf.String())
+	}
+	if _, _, err := got.Build("../testdata"); err != nil {
+		t.Fatalf("cannot build saved scene description: %v", err)
+	}
+}
+
+func TestLoadScene_Errors(t *testing.T) {
+	camera := `"camera": {"type": "perspective", "up": [0, 1, 0], "fov": 45, "aspect": 1, "near": 0.1, "far": 2}`
+	for _, data := range []string{
+		`{`,
+		`{"camera": {"type": "fisheye", "up": [0, 1, 0]}}`,
+		`{"camera": {"type": "perspective", "up": [0, 1, 0], "near": 0.1, "far": 2}}`,
+		`{` + camera + `, "unknown": true}`,
+		`{` + camera + `, "lights": [{"type": "spot"}]}`,
+		`{` + camera + `, "materials": {"m": {"type": "pbr"}}}`,
+		`{` + camera + `, "meshes": [{"file": "bunny.obj", "material": "m"}]}`,
+		`{` + camera + `, "meshes": [{"file": "missing.obj"}]}`,
+	} {
+		if _, _, err := io.LoadScene(strings.NewReader(data), io.WithSceneDir("../testdata")); err == nil {
+			t.Fatalf("expect an error for %s", data)
+		}
+	}
+}
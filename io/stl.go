@@ -0,0 +1,334 @@
+// Copyright 2021 Changkun Ou <changkun.de>. All rights reserved.
+// Use of this source code is governed by a GPLv3 license that
+// can be found in the LICENSE file.
+
+package io
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"poly.red/color"
+	"poly.red/geometry"
+	"poly.red/geometry/primitive"
+	"poly.red/material"
+	"poly.red/math"
+)
+
+func init() {
+	// Binary .stl files do not have a magic header, and may begin
+	// with "solid" as well.
+	RegisterFormat("stl", []string{".stl"}, "solid",
+		func(r io.Reader, _ string) (geometry.Mesh, error) {
+			return LoadSTL(r)
+		},
+		func(w io.Writer, m geometry.Mesh) error {
+			return SaveSTL(w, m, STLBinary)
+		})
+}
+
+// STLFormat is the encoding of a .stl file.
+type STLFormat int
+
+const (
+	STLASCII STLFormat = iota
+	STLBinary
+)
+
+// STLOption offers custom configurations for loading a .stl file.
+type STLOption struct {
+	weld bool
+}
+
+type ReadSTLOption func(o *STLOption)
+
+// WithSTLWelding welds vertices that share the same position, and
+// returns a buffered mesh instead of a triangle soup. The normal of a
+// welded vertex is the area weighted average of its facet normals.
+func WithSTLWelding(enable bool) ReadSTLOption {
+	return func(o *STLOption) {
+		o.weld = enable
+	}
+}
+
+// LoadSTL loads a .stl file in either ASCII or binary encoding. By
+// default, the loaded mesh is a triangle soup where each vertex carries
+// the normal of its facet.
+func LoadSTL(data io.Reader, opts ...ReadSTLOption) (geometry.Mesh, error) {
+	option := &STLOption{
+		weld: false,
+	}
+	for _, opt := range opts {
+		opt(option)
+	}
+
+	r := bufio.NewReader(data)
+	var (
+		tris []*primitive.Triangle
+		err  error
+	)
+	if isASCIISTL(r) {
+		tris, err = loadASCIISTL(r)
+	} else {
+		tris, err = loadBinarySTL(r)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(tris) == 0 {
+		return nil, errors.New("loader: stl file does not contain any facet")
+	}
+
+	if option.weld {
+		return weldSTL(tris), nil
+	}
+	return geometry.NewTriangleSoup(tris), nil
+}
+
+// isASCIISTL reports whether the data is an ASCII .stl file. A binary
+// file may also begin with "solid" in its header, hence the first facet
+// is checked too.
+func isASCIISTL(r *bufio.Reader) bool {
+	head, _ := r.Peek(512)
+	head = bytes.TrimLeft(head, " \t\r\n")
+	if !bytes.HasPrefix(head, []byte("solid")) {
+		return false
+	}
+	i := bytes.IndexByte(head, '\n')
+	if i < 0 {
+		return false
+	}
+	rest := bytes.TrimLeft(head[i+1:], " \t\r\n")
+	return bytes.HasPrefix(rest, []byte("facet")) || bytes.HasPrefix(rest, []byte("endsolid"))
+}
+
+func loadASCIISTL(r io.Reader) ([]*primitive.Triangle, error) {
+	var (
+		tris   []*primitive.Triangle
+		normal math.Vec4
+		vs     []math.Vec4
+		line   int
+	)
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		line++
+		fields := strings.Fields(s.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		switch fields[0] {
+		case "facet":
+			if len(fields) != 5 || fields[1] != "normal" {
+				return nil, fmt.Errorf("loader: invalid stl facet at line %d", line)
+			}
+			n := parseFloats(fields[2:])
+			normal = math.NewVec4(n[0], n[1], n[2], 0)
+			vs = vs[:0]
+		case "vertex":
+			if len(fields) != 4 {
+				return nil, fmt.Errorf("loader: invalid stl vertex at line %d", line)
+			}
+			p := parseFloats(fields[1:])
+			vs = append(vs, math.NewVec4(p[0], p[1], p[2], 1))
+		case "endfacet":
+			if len(vs) != 3 {
+				return nil, fmt.Errorf("loader: stl facet at line %d does not have 3 vertices", line)
+			}
+			tris = append(tris, newSTLTriangle(normal, vs[0], vs[1], vs[2]))
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	return tris, nil
+}
+
+func loadBinarySTL(r io.Reader) ([]*primitive.Triangle, error) {
+	var head [84]byte
+	if _, err := io.ReadFull(r, head[:]); err != nil {
+		return nil, fmt.Errorf("loader: invalid binary stl header, err: %w", err)
+	}
+	n := binary.LittleEndian.Uint32(head[80:])
+
+	// Facets are appended as they are read, since the count of the
+	// header may exceed the data.
+	var (
+		tris []*primitive.Triangle
+		buf  [50]byte
+		f    [12]float64
+	)
+	for i := uint32(0); i < n; i++ {
+		if _, err := io.ReadFull(r, buf[:]); err != nil {
+			return nil, fmt.Errorf("loader: binary stl facet %d is incomplete, err: %w", i, err)
+		}
+		for j := range f {
+			f[j] = float64(math.Float32frombits(binary.LittleEndian.Uint32(buf[4*j:])))
+		}
+		tris = append(tris, newSTLTriangle(
+			math.NewVec4(f[0], f[1], f[2], 0),
+			math.NewVec4(f[3], f[4], f[5], 1),
+			math.NewVec4(f[6], f[7], f[8], 1),
+			math.NewVec4(f[9], f[10], f[11], 1),
+		))
+	}
+	return tris, nil
+}
+
+func newSTLTriangle(normal, p1, p2, p3 math.Vec4) *primitive.Triangle {
+	t := primitive.NewTriangle(
+		&primitive.Vertex{Pos: p1, Col: color.White},
+		&primitive.Vertex{Pos: p2, Col: color.White},
+		&primitive.Vertex{Pos: p3, Col: color.White},
+	)
+	// Some exporters leave the facet normal zero, and the normal
+	// can be recovered from the vertex order unless the facet is
+	// degenerate.
+	if normal.IsZero() {
+		if n := stlCross(t); !n.IsZero() {
+			normal = n.Unit()
+		}
+	}
+	t.V1.Nor = normal
+	t.V2.Nor = normal
+	t.V3.Nor = normal
+	return t
+}
+
+// weldSTL merges vertices that share the same position to a buffered mesh.
+func weldSTL(tris []*primitive.Triangle) *geometry.BufferedMesh {
+	index := map[math.Vec4]uint64{}
+	pos := make([]float64, 0, len(tris)*3)
+	nor := make([]float64, 0, len(tris)*3)
+	idx := make([]uint64, 0, len(tris)*3)
+	var facet []math.Vec4 // a facet normal of each vertex
+
+	for _, t := range tris {
+		// The length of the cross product weights the facet normal
+		// by the facet area, and degenerate facets do not contribute.
+		n := stlCross(t)
+		t.Vertices(func(v *primitive.Vertex) bool {
+			i, ok := index[v.Pos]
+			if !ok {
+				i = uint64(len(pos) / 3)
+				index[v.Pos] = i
+				pos = append(pos, v.Pos.X, v.Pos.Y, v.Pos.Z)
+				nor = append(nor, 0, 0, 0)
+				facet = append(facet, math.Vec4{})
+			}
+			nor[3*i+0] += n.X
+			nor[3*i+1] += n.Y
+			nor[3*i+2] += n.Z
+			if facet[i].IsZero() {
+				facet[i] = v.Nor
+			}
+			idx = append(idx, i)
+			return true
+		})
+	}
+	for i := 0; i < len(nor); i += 3 {
+		// Vertices of only degenerate facets keep the facet normal of
+		// the file, if any.
+		n := math.NewVec4(nor[i], nor[i+1], nor[i+2], 0)
+		if n.IsZero() {
+			n = facet[i/3]
+		}
+		if !n.IsZero() {
+			n = n.Unit()
+		}
+		nor[i], nor[i+1], nor[i+2] = n.X, n.Y, n.Z
+	}
+
+	bm := geometry.NewBufferedMesh()
+	bm.SetAttribute(geometry.AttributePos, geometry.NewBufferAttribute(3, pos))
+	bm.SetAttribute(geometry.AttributeNor, geometry.NewBufferAttribute(3, nor))
+	bm.SetVertexIndex(idx)
+	return bm
+}
+
+// stlCross returns the cross product of the edges of the triangle,
+// which is zero for degenerate triangles.
+func stlCross(t *primitive.Triangle) math.Vec4 {
+	return t.V2.Pos.Sub(t.V1.Pos).Cross(t.V3.Pos.Sub(t.V1.Pos))
+}
+
+// stlNormal returns the facet normal of the triangle, which is zero for
+// degenerate triangles.
+func stlNormal(t *primitive.Triangle) math.Vec4 {
+	n := stlCross(t)
+	if n.IsZero() {
+		return n
+	}
+	return n.Unit()
+}
+
+// SaveSTL writes the given mesh to a .stl file using the given encoding.
+// Faces are triangulated, and facet normals are computed from the vertex
+// order of each triangle, where degenerate triangles have zero normals.
+// Vertices are written in model space.
+func SaveSTL(w io.Writer, m geometry.Mesh, format STLFormat) error {
+	buf := bufio.NewWriter(w)
+
+	switch format {
+	case STLASCII:
+		buf.WriteString("solid polyred\n")
+		triangles(m, func(t *primitive.Triangle) {
+			n := stlNormal(t)
+			fmt.Fprintf(buf, "facet normal %s %s %s\n", formatFloat(n.X), formatFloat(n.Y), formatFloat(n.Z))
+			buf.WriteString("  outer loop\n")
+			t.Vertices(func(v *primitive.Vertex) bool {
+				fmt.Fprintf(buf, "    vertex %s %s %s\n", formatFloat(v.Pos.X), formatFloat(v.Pos.Y), formatFloat(v.Pos.Z))
+				return true
+			})
+			buf.WriteString("  endloop\n")
+			buf.WriteString("endfacet\n")
+		})
+		buf.WriteString("endsolid polyred\n")
+	case STLBinary:
+		n := uint32(0)
+		triangles(m, func(t *primitive.Triangle) { n++ })
+
+		var head [84]byte
+		copy(head[:], "binary stl exported by poly.red")
+		binary.LittleEndian.PutUint32(head[80:], n)
+		buf.Write(head[:])
+
+		var facet [50]byte
+		put := func(i int, v float64) {
+			binary.LittleEndian.PutUint32(facet[4*i:], math.Float32bits(float32(v)))
+		}
+		triangles(m, func(t *primitive.Triangle) {
+			n := stlNormal(t)
+			put(0, n.X)
+			put(1, n.Y)
+			put(2, n.Z)
+			i := 3
+			t.Vertices(func(v *primitive.Vertex) bool {
+				put(i+0, v.Pos.X)
+				put(i+1, v.Pos.Y)
+				put(i+2, v.Pos.Z)
+				i += 3
+				return true
+			})
+			buf.Write(facet[:])
+		})
+	default:
+		return fmt.Errorf("loader: unsupported stl format %v", format)
+	}
+	return buf.Flush()
+}
+
+// triangles visits all triangles of the given mesh.
+func triangles(m geometry.Mesh, iter func(t *primitive.Triangle)) {
+	m.Faces(func(f primitive.Face, _ material.Material) bool {
+		f.Triangles(func(t *primitive.Triangle) bool {
+			iter(t)
+			return true
+		})
+		return true
+	})
+}
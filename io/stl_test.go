@@ -0,0 +1,180 @@
+// Copyright 2021 Changkun Ou <changkun.de>. All rights reserved.
+// Use of this source code is governed by a GPLv3 license that
+// can be found in the LICENSE file.
+
+package io_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"poly.red/geometry"
+	"poly.red/geometry/primitive"
+	"poly.red/io"
+	"poly.red/material"
+	"poly.red/math"
+)
+
+const tetrahedronSTL = `solid tetrahedron
+facet normal 0 0 -1
+  outer loop
+    vertex 0 0 0
+    vertex 0 1 0
+    vertex 1 0 0
+  endloop
+endfacet
+facet normal 0 -1 0
+  outer loop
+    vertex 0 0 0
+    vertex 1 0 0
+    vertex 0 0 1
+  endloop
+endfacet
+facet normal -1 0 0
+  outer loop
+    vertex 0 0 0
+    vertex 0 0 1
+    vertex 0 1 0
+  endloop
+endfacet
+facet normal 0 0 0
+  outer loop
+    vertex 1 0 0
+    vertex 0 1 0
+    vertex 0 0 1
+  endloop
+endfacet
+endsolid tetrahedron
+`
+
+func TestLoadSTL(t *testing.T) {
+	m, err := io.LoadSTL(strings.NewReader(tetrahedronSTL))
+	if err != nil {
+		t.Fatalf("cannot load stl: %v", err)
+	}
+	if m.NumTriangles() != 4 {
+		t.Fatalf("expect 4 triangles, got %v", m.NumTriangles())
+	}
+
+	// The zero facet normal is recovered from the vertex order.
+	var last *primitive.Triangle
+	m.Faces(func(f primitive.Face, _ material.Material) bool {
+		last = f.(*primitive.Triangle)
+		return true
+	})
+	want := math.NewVec4(1, 1, 1, 0).Unit()
+	if !last.V1.Nor.Eq(want) {
+		t.Fatalf("unexpected recovered normal, want %v, got %v", want, last.V1.Nor)
+	}
+
+	m, err = io.LoadSTL(strings.NewReader(tetrahedronSTL), io.WithSTLWelding(true))
+	if err != nil {
+		t.Fatalf("cannot load stl: %v", err)
+	}
+	bm, ok := m.(*geometry.BufferedMesh)
+	if !ok {
+		t.Fatalf("expect a buffered mesh from welding, got %T", m)
+	}
+	if bm.NumVertices() != 4 || bm.NumTriangles() != 4 {
+		t.Fatalf("expect 4 vertices and 4 triangles, got %v and %v",
+			bm.NumVertices(), bm.NumTriangles())
+	}
+
+	// A degenerate facet with a zero normal does not spoil the welded
+	// normals of its vertices.
+	degenerate := strings.Replace(tetrahedronSTL, "endsolid", `facet normal 0 0 0
+  outer loop
+    vertex 0 0 0
+    vertex 1 0 0
+    vertex 2 0 0
+  endloop
+endfacet
+endsolid`, 1)
+	m, err = io.LoadSTL(strings.NewReader(degenerate), io.WithSTLWelding(true))
+	if err != nil {
+		t.Fatalf("cannot load stl: %v", err)
+	}
+	nor := m.(*geometry.BufferedMesh).GetAttribute(geometry.AttributeNor)
+	for i := 0; i < len(nor.Values); i += 3 {
+		n := math.NewVec3(nor.Values[i], nor.Values[i+1], nor.Values[i+2])
+		if n.X != n.X || n.Y != n.Y || n.Z != n.Z {
+			t.Fatalf("vertex %d has an invalid normal %v", i/3, n)
+		}
+	}
+
+	// The facet count of a binary header that exceeds the data.
+	bin := make([]byte, 84)
+	copy(bin[80:], []byte{0xff, 0xff, 0xff, 0xff})
+	if _, err := io.LoadSTL(bytes.NewReader(bin)); err == nil {
+		t.Fatalf("expect an error for a truncated binary stl")
+	}
+}
+
+func TestSaveSTL(t *testing.T) {
+	want, err := io.LoadSTL(strings.NewReader(tetrahedronSTL))
+	if err != nil {
+		t.Fatalf("cannot load stl: %v", err)
+	}
+
+	for _, format := range []io.STLFormat{io.STLASCII, io.STLBinary} {
+		buf := &bytes.Buffer{}
+		if err := io.SaveSTL(buf, want, format); err != nil {
+			t.Fatalf("cannot save stl: %v", err)
+		}
+		if format == io.STLBinary {
+			// Binary headers may begin with "solid" as well.
+			copy(buf.Bytes(), "solid")
+		}
+
+		got, err := io.LoadSTL(buf)
+		if err != nil {
+			t.Fatalf("cannot load saved stl: %v", err)
+		}
+		if got.NumTriangles() != want.NumTriangles() {
+			t.Fatalf("number of triangles does not match, want %v, got %v",
+				want.NumTriangles(), got.NumTriangles())
+		}
+
+		var wantTris []*primitive.Triangle
+		want.Faces(func(f primitive.Face, _ material.Material) bool {
+			wantTris = append(wantTris, f.(*primitive.Triangle))
+			return true
+		})
+		i := 0
+		got.Faces(func(f primitive.Face, _ material.Material) bool {
+			w, g := wantTris[i], f.(*primitive.Triangle)
+			if !w.V1.Pos.Eq(g.V1.Pos) || !w.V2.Pos.Eq(g.V2.Pos) || !w.V3.Pos.Eq(g.V3.Pos) {
+				t.Fatalf("facet %d positions do not match", i)
+			}
+			if !w.Normal().Eq(g.V1.Nor) {
+				t.Fatalf("facet %d normal does not match, want %v, got %v", i, w.Normal(), g.V1.Nor)
+			}
+			i++
+			return true
+		})
+	}
+
+	// Degenerate triangles are written with zero normals rather than
+	// NaNs.
+	degenerate := geometry.NewTriangleSoup([]*primitive.Triangle{primitive.NewTriangle(
+		&primitive.Vertex{Pos: math.NewVec4(0, 0, 0, 1)},
+		&primitive.Vertex{Pos: math.NewVec4(1, 0, 0, 1)},
+		&primitive.Vertex{Pos: math.NewVec4(2, 0, 0, 1)},
+	)})
+	for _, format := range []io.STLFormat{io.STLASCII, io.STLBinary} {
+		buf := &bytes.Buffer{}
+		if err := io.SaveSTL(buf, degenerate, format); err != nil {
+			t.Fatalf("cannot save stl: %v", err)
+		}
+		if format == io.STLASCII && !strings.Contains(buf.String(), "facet normal 0 0 0\n") {
+			t.Fatalf("expect a zero facet normal, got:\n%s", buf.String())
+		}
+		if format == io.STLBinary {
+			normal := buf.Bytes()[84 : 84+12]
+			if !bytes.Equal(normal, make([]byte, 12)) {
+				t.Fatalf("expect a zero facet normal, got %v", normal)
+			}
+		}
+	}
+}
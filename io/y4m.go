@@ -0,0 +1,132 @@
+// Copyright 2021 Changkun Ou <changkun.de>. All rights reserved.
+// Use of this source code is governed by a GPLv3 license that
+// can be found in the LICENSE file.
+
+package io
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"io"
+)
+
+// Y4MChroma is the chroma subsampling of a YUV4MPEG2 stream.
+type Y4MChroma int
+
+const (
+	// Y4MChroma420 stores a chroma sample per 2x2 pixels, which is
+	// expected by most video encoders.
+	Y4MChroma420 Y4MChroma = iota
+	// Y4MChroma444 stores a chroma sample per pixel.
+	Y4MChroma444
+)
+
+type y4mWriter struct {
+	w      *bufio.Writer
+	option *AnimationOption
+	size   image.Point
+	planes [3][]byte
+	err    error
+	closed bool
+}
+
+// NewY4MWriter returns a frame writer that streams frames as
+// uncompressed YUV4MPEG2 video, e.g. for piping into ffmpeg:
+//
+//	ffmpeg -i - -c:v libx264 turntable.mp4
+//
+// Colors are converted to limited range BT.601 YCbCr, and the alpha
+// channel is dropped. Frames are written as soon as they arrive.
+func NewY4MWriter(w io.Writer, opts ...WriteAnimationOption) (FrameWriter, error) {
+	option, err := newAnimationOption(opts...)
+	if err != nil {
+		return nil, err
+	}
+	if option.chroma != Y4MChroma420 && option.chroma != Y4MChroma444 {
+		return nil, fmt.Errorf("loader: unsupported y4m chroma subsampling %d", option.chroma)
+	}
+	return &y4mWriter{w: bufio.NewWriter(w), option: option}, nil
+}
+
+func (y *y4mWriter) WriteFrame(img *image.RGBA) error {
+	if y.closed {
+		return ErrFrameWriterClosed
+	}
+	if y.err != nil {
+		return y.err
+	}
+	first := y.size == image.Point{}
+	if err := frameSize(&y.size, img); err != nil {
+		return err
+	}
+
+	w, h := y.size.X, y.size.Y
+	cw, ch := w, h
+	chroma := "444"
+	if y.option.chroma == Y4MChroma420 {
+		cw, ch = (w+1)/2, (h+1)/2
+		chroma = "420jpeg"
+	}
+	if first {
+		fmt.Fprintf(y.w, "YUV4MPEG2 W%d H%d F%d:1 Ip A1:1 C%s XCOLORRANGE=LIMITED\n", w, h, y.option.fps, chroma)
+		y.planes = [3][]byte{make([]byte, w*h), make([]byte, cw*ch), make([]byte, cw*ch)}
+	}
+
+	// Chroma samples average the covered pixels, which are centered
+	// between pixels for 4:2:0 (jpeg siting).
+	cb, cr, cn := make([]int, cw*ch), make([]int, cw*ch), make([]int, cw*ch)
+	r := img.Bounds()
+	for j := 0; j < h; j++ {
+		for i := 0; i < w; i++ {
+			o := img.PixOffset(r.Min.X+i, r.Min.Y+j)
+			p := img.Pix[o : o+3 : o+3]
+			R, G, B := int(p[0]), int(p[1]), int(p[2])
+			y.planes[0][j*w+i] = uint8((66*R + 129*G + 25*B + 128 + 16<<8) >> 8)
+
+			k := j*cw + i
+			if y.option.chroma == Y4MChroma420 {
+				k = j/2*cw + i/2
+			}
+			cb[k] += -38*R - 74*G + 112*B
+			cr[k] += 112*R - 94*G - 18*B
+			cn[k]++
+		}
+	}
+	for k := range cn {
+		n := cn[k] << 8
+		y.planes[1][k] = uint8(128 + divRound(cb[k], n))
+		y.planes[2][k] = uint8(128 + divRound(cr[k], n))
+	}
+
+	y.w.WriteString("FRAME\n")
+	for _, p := range y.planes {
+		if _, err := y.w.Write(p); err != nil {
+			y.err = fmt.Errorf("loader: cannot write y4m frame, err: %w", err)
+			return y.err
+		}
+	}
+	return nil
+}
+
+func (y *y4mWriter) Close() error {
+	if y.closed {
+		return ErrFrameWriterClosed
+	}
+	y.closed = true
+	if y.err != nil {
+		return y.err
+	}
+	if err := y.w.Flush(); err != nil {
+		return fmt.Errorf("loader: cannot write y4m frame, err: %w", err)
+	}
+	return nil
+}
+
+// divRound divides a by a positive b and rounds to the nearest integer.
+func divRound(a, b int) int {
+	if a < 0 {
+		return -((-a + b/2) / b)
+	}
+	return (a + b/2) / b
+}
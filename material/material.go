@@ -24,3 +24,11 @@ type Material interface {
 	) primitive.Vertex
 	FragmentShader(col color.RGBA, x, n, fn, camera math.Vec4, ls []light.Source, es []light.Environment) color.RGBA
 }
+
+// HDRMaterial is a material that shades high dynamic range colors. The
+// given and returned colors are linear where one corresponds to the
+// largest 8-bit value, and the returned color is not clamped.
+type HDRMaterial interface {
+	Material
+	FragmentShaderHDR(col math.Vec4, x, n, fn, camera math.Vec4, ls []light.Source, es []light.Environment) math.Vec4
+}
@@ -14,7 +14,9 @@ import (
 )
 
 type BlinnPhongMaterial struct {
+	name             string
 	tex              *image.Texture
+	normalMap        *image.Texture
 	kDiff            float64
 	kSpec            float64
 	shininess        float64
@@ -27,14 +29,52 @@ func (m *BlinnPhongMaterial) Texture() *image.Texture {
 	return m.tex
 }
 
+// Name returns the name of the material, or an empty string if the
+// material is not named.
+func (m *BlinnPhongMaterial) Name() string {
+	return m.name
+}
+
+// NormalMap returns the tangent space normal map of the material,
+// or nil if the material does not have a normal map.
+func (m *BlinnPhongMaterial) NormalMap() *image.Texture {
+	return m.normalMap
+}
+
+// Factors returns the diffuse and specular factors of the material.
+func (m *BlinnPhongMaterial) Factors() (Kdiff, Kspec float64) {
+	return m.kDiff, m.kSpec
+}
+
+// Shininess returns the shininess exponent of the material.
+func (m *BlinnPhongMaterial) Shininess() float64 {
+	return m.shininess
+}
+
 type BlinnPhongMaterialOption func(m *BlinnPhongMaterial)
 
+// WithBlinnPhongName names the material, e.g. by the name of its
+// statement in a material library.
+func WithBlinnPhongName(name string) BlinnPhongMaterialOption {
+	return func(m *BlinnPhongMaterial) {
+		m.name = name
+	}
+}
+
 func WithBlinnPhongTexture(tex *image.Texture) BlinnPhongMaterialOption {
 	return func(m *BlinnPhongMaterial) {
 		m.tex = tex
 	}
 }
 
+// WithBlinnPhongNormalMap sets a tangent space normal map. The map is
+// carried by the material but not yet considered in shading.
+func WithBlinnPhongNormalMap(tex *image.Texture) BlinnPhongMaterialOption {
+	return func(m *BlinnPhongMaterial) {
+		m.normalMap = tex
+	}
+}
+
 func WithBlinnPhongFactors(Kdiff, Kspec float64) BlinnPhongMaterialOption {
 	return func(m *BlinnPhongMaterial) {
 		m.kDiff = Kdiff
@@ -69,6 +109,7 @@ func WithBlinnPhongShadow(enable bool) BlinnPhongMaterialOption {
 func NewBlinnPhong(opts ...BlinnPhongMaterialOption) Material {
 	t := &BlinnPhongMaterial{
 		tex:              nil,
+		normalMap:        nil,
 		kDiff:            0.5,
 		kSpec:            1,
 		shininess:        1,
@@ -98,14 +139,32 @@ func (m *BlinnPhongMaterial) VertexShader(v primitive.Vertex, uniforms map[strin
 }
 
 func (m *BlinnPhongMaterial) FragmentShader(col color.RGBA, x, n, fN, c math.Vec4, ls []light.Source, es []light.Environment) color.RGBA {
+	L := m.shade(math.NewVec4(float64(col.R), float64(col.G), float64(col.B), float64(col.A)), x, n, fN, c, ls, es)
+	return color.RGBA{
+		uint8(math.Clamp(L.X, 0, 0xff)),
+		uint8(math.Clamp(L.Y, 0, 0xff)),
+		uint8(math.Clamp(L.Z, 0, 0xff)),
+		uint8(math.Clamp(L.W, 0, 0xff))}
+}
+
+// FragmentShaderHDR shades the same as FragmentShader but keeps the
+// radiance above one.
+func (m *BlinnPhongMaterial) FragmentShaderHDR(col math.Vec4, x, n, fN, c math.Vec4, ls []light.Source, es []light.Environment) math.Vec4 {
+	L := m.shade(col.Scale(0xff, 0xff, 0xff, 0xff), x, n, fN, c, ls, es)
+	return L.Scale(1.0/0xff, 1.0/0xff, 1.0/0xff, 1.0/0xff)
+}
+
+// shade evaluates the Blinn-Phong reflection model, where colors are
+// scaled to [0, 255] the same as the light colors.
+func (m *BlinnPhongMaterial) shade(col, x, n, fN, c math.Vec4, ls []light.Source, es []light.Environment) math.Vec4 {
 	LaR := 0.0
 	LaG := 0.0
 	LaB := 0.0
 
 	for _, e := range es {
-		LaR += e.Intensity() * float64(col.R)
-		LaG += e.Intensity() * float64(col.G)
-		LaB += e.Intensity() * float64(col.B)
+		LaR += e.Intensity() * col.X
+		LaG += e.Intensity() * col.Y
+		LaB += e.Intensity() * col.Z
 	}
 
 	LdR := 0.0
@@ -140,9 +199,9 @@ func (m *BlinnPhongMaterial) FragmentShader(col color.RGBA, x, n, fN, c math.Vec
 		Ld := math.Clamp(n.Dot(L), 0, 1)
 		Ls := math.Pow(math.Clamp(n.Dot(H), 0, 1), m.shininess)
 
-		LdR += Ld * float64(col.R) * I
-		LdG += Ld * float64(col.G) * I
-		LdB += Ld * float64(col.B) * I
+		LdR += Ld * col.X * I
+		LdG += Ld * col.Y * I
+		LdB += Ld * col.Z * I
 
 		LsR += Ls * float64(l.Color().R) * I
 		LsG += Ls * float64(l.Color().G) * I
@@ -154,11 +213,7 @@ func (m *BlinnPhongMaterial) FragmentShader(col color.RGBA, x, n, fN, c math.Vec
 	g := LaG + m.kDiff*LdG + m.kSpec*LsG
 	b := LaB + m.kDiff*LdB + m.kSpec*LsB
 
-	return color.RGBA{
-		uint8(math.Clamp(r, 0, 0xff)),
-		uint8(math.Clamp(g, 0, 0xff)),
-		uint8(math.Clamp(b, 0, 0xff)),
-		uint8(math.Clamp(float64(col.A), 0, 0xff))}
+	return math.NewVec4(r, g, b, col.W)
 }
 
 func (m *BlinnPhongMaterial) ReceiveShadow() bool {
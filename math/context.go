@@ -177,3 +177,18 @@ func (ctx *TransformContext) RotateZ(angle float64) {
 	ctx.rotation = q.Mul(ctx.rotation)
 	ctx.needUpdate = true
 }
+
+// Translation returns the accumulated translation of the context.
+func (ctx *TransformContext) Translation() Vec3 {
+	return NewVec3(ctx.translate.X03, ctx.translate.X13, ctx.translate.X23)
+}
+
+// Scaling returns the accumulated scaling factors of the context.
+func (ctx *TransformContext) Scaling() Vec3 {
+	return NewVec3(ctx.scale.X00, ctx.scale.X11, ctx.scale.X22)
+}
+
+// Rotation returns the accumulated rotation of the context.
+func (ctx *TransformContext) Rotation() Quaternion {
+	return ctx.rotation
+}
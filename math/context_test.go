@@ -172,3 +172,25 @@ func TestTransformationContextScale(t *testing.T) {
 
 	})
 }
+
+func TestTransformationContext_Components(t *testing.T) {
+	ctx := math.TransformContext{}
+	ctx.ResetContext()
+
+	ctx.Scale(1, 2, 3)
+	ctx.Translate(1, 2, 3)
+	ctx.Translate(1, 1, 1)
+	ctx.RotateZ(math.Pi / 2)
+
+	if !ctx.Translation().Eq(math.NewVec3(2, 3, 4)) {
+		t.Fatalf("unexpected translation, got %v", ctx.Translation())
+	}
+	if !ctx.Scaling().Eq(math.NewVec3(1, 2, 3)) {
+		t.Fatalf("unexpected scaling, got %v", ctx.Scaling())
+	}
+	r := ctx.Rotation()
+	want := math.NewQuaternion(math.Cos(math.Pi/4), 0, 0, math.Sin(math.Pi/4))
+	if !math.ApproxEq(r.A, want.A, math.Epsilon) || !r.V.Eq(want.V) {
+		t.Fatalf("unexpected rotation, got %v, want %v", r, want)
+	}
+}
@@ -25,11 +25,18 @@ var (
 	MaxFloat64 = math.MaxFloat64
 	Round      = math.Round
 	Floor      = math.Floor
+	Ceil       = math.Ceil
 	Log2       = math.Log2
 	Pow        = math.Pow
 	Sqrt       = math.Sqrt
 	IsNaN      = math.IsNaN
 	Modf       = math.Modf
+	Frexp      = math.Frexp
+	Ldexp      = math.Ldexp
+
+	Float32bits     = math.Float32bits
+	Float32frombits = math.Float32frombits
+	Float64frombits = math.Float64frombits
 )
 
 const (
@@ -13,6 +13,7 @@ const (
 	TypeMesh
 	TypeCamera
 	TypeLight
+	TypePointCloud
 )
 
 type Object interface {
@@ -5,6 +5,7 @@
 package render
 
 import (
+	"poly.red/geometry"
 	"poly.red/geometry/primitive"
 	"poly.red/material"
 	"poly.red/math"
@@ -21,8 +22,17 @@ var (
 		r.resetFrameBuf()
 	}
 	PassForward = func(r *Renderer) {
+		r.selectLevels()
 		r.passForward()
 	}
+	ScreenSize = func(r *Renderer, mesh geometry.Mesh, modelMatrix math.Mat4) float64 {
+		r.renderCamera = r.scene.GetCamera()
+		return r.screenSize(mesh, modelMatrix, r.renderCamera.ViewMatrix(), r.renderCamera.ProjMatrix(), float64(r.height))
+	}
+	SelectLevels = func(r *Renderer) []int {
+		r.selectLevels()
+		return r.levels
+	}
 	PassDeferred = func(r *Renderer) {
 		r.passDeferred()
 	}
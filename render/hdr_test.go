@@ -0,0 +1,90 @@
+// Copyright 2021 Changkun Ou <changkun.de>. All rights reserved.
+// Use of this source code is governed by a GPLv3 license that
+// can be found in the LICENSE file.
+
+package render_test
+
+import (
+	"image/color"
+	"testing"
+
+	"poly.red/camera"
+	"poly.red/light"
+	"poly.red/math"
+	"poly.red/render"
+)
+
+func TestRenderHDR(t *testing.T) {
+	w, h := 160, 100
+	s := newscene(w, h)
+	opts := []render.Option{
+		render.WithSize(w, h),
+		render.WithMSAA(1),
+		render.WithScene(s),
+		render.WithBackground(color.RGBA{0, 127, 255, 255}),
+	}
+	want := render.NewRenderer(opts...).Render()
+
+	r := render.NewRenderer(append(opts, render.WithHDR(true))...)
+	got := r.Render()
+	for i := range want.Pix {
+		if got.Pix[i] != want.Pix[i] {
+			t.Fatalf("8-bit frame changed with hdr at %d, want %d, got %d", i, want.Pix[i], got.Pix[i])
+		}
+	}
+
+	img := r.HDRImage()
+	if img == nil || img.Bounds() != want.Bounds() {
+		t.Fatalf("unexpected hdr image: %v", img)
+	}
+	maxDiff := 0.0
+	for i, v := range want.Pix {
+		if v == 0xff {
+			continue
+		}
+		maxDiff = math.Max(maxDiff, math.Abs(float64(img.Pix[i])*0xff-float64(v)))
+	}
+	// The 8-bit frame truncates the shaded values.
+	if maxDiff > 1 {
+		t.Fatalf("hdr image differs from the 8-bit frame by %v", maxDiff)
+	}
+
+	// A bright ambient light exceeds the 8-bit range.
+	s.Add(light.NewAmbient(light.WithAmbientIntensity(4)))
+	r = render.NewRenderer(append(opts, render.WithHDR(true))...)
+	r.Render()
+	brightest := 0.0
+	for _, v := range r.HDRImage().Pix {
+		brightest = math.Max(brightest, float64(v))
+	}
+	if brightest <= 1 {
+		t.Fatalf("hdr image is clamped, brightest value %v", brightest)
+	}
+
+	// The image of a frame is not overwritten by the next frame.
+	img = r.HDRImage()
+	pix := append([]float32(nil), img.Pix...)
+	s.SetCamera(camera.NewPerspective(
+		math.NewVec3(0, 0, 2),
+		math.NewVec3(0, 0, 0),
+		math.NewVec3(0, 1, 0),
+		45, float64(w)/float64(h), 0.1, 3,
+	))
+	r.Render()
+	for i := range pix {
+		if img.Pix[i] != pix[i] {
+			t.Fatalf("hdr image is changed by the next frame at %d", i)
+		}
+	}
+
+	// Multisampled frames are resolved to the output size.
+	r = render.NewRenderer(append(opts, render.WithMSAA(2), render.WithHDR(true))...)
+	r.Render()
+	if r.HDRImage().Bounds() != want.Bounds() {
+		t.Fatalf("unexpected hdr image size: %v", r.HDRImage().Bounds())
+	}
+
+	if render.NewRenderer(opts...).HDRImage() != nil {
+		t.Fatalf("expect no hdr image without WithHDR")
+	}
+}
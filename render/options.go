@@ -10,6 +10,7 @@ import (
 	"sync"
 
 	"poly.red/camera"
+	pimage "poly.red/image"
 	"poly.red/light"
 	"poly.red/math"
 	"poly.red/object"
@@ -64,6 +65,26 @@ func WithGammaCorrection(enable bool) Option {
 	}
 }
 
+// WithHDR enables a float frame buffer that keeps the radiance above
+// one, see Renderer.HDRImage. The blend function does not apply to the
+// float frame buffer.
+func WithHDR(enable bool) Option {
+	return func(r *Renderer) {
+		r.hdr = enable
+	}
+}
+
+// WithLevelOfDetail enables the level of detail selection of
+// progressive meshes. Each progressive mesh is drawn with the finest
+// level that has at most one triangle per the given number of pixels
+// of its projected bounding sphere. Zero disables the selection, and
+// progressive meshes are drawn at their current level.
+func WithLevelOfDetail(pixelsPerTriangle float64) Option {
+	return func(r *Renderer) {
+		r.lodPixels = pixelsPerTriangle
+	}
+}
+
 func WithBlendFunc(f BlendFunc) Option {
 	return func(r *Renderer) {
 		r.blendFunc = f
@@ -102,6 +123,10 @@ func (r *Renderer) UpdateOptions(opts ...Option) {
 	r.lockBuf = make([]sync.Mutex, w*h)
 	r.gBuf = make([]gInfo, w*h)
 	r.frameBuf = image.NewRGBA(image.Rect(0, 0, w, h))
+	r.hdrBuf = nil
+	if r.hdr {
+		r.hdrBuf = pimage.NewRGBAFloat(image.Rect(0, 0, w, h))
+	}
 
 	r.lightSources = []light.Source{}
 	r.lightEnv = []light.Environment{}
@@ -22,6 +22,11 @@ func (r *Renderer) resetFrameBuf() {
 	for i := range r.frameBuf.Pix {
 		r.frameBuf.Pix[i] = 0
 	}
+	if r.hdrBuf != nil {
+		for i := range r.hdrBuf.Pix {
+			r.hdrBuf.Pix[i] = 0
+		}
+	}
 }
 
 // wait waits the current rendering terminates
@@ -15,17 +15,19 @@ type ambientOcclusionPass struct {
 	gbuffer []gInfo
 }
 
-func (ao *ambientOcclusionPass) Shade(x, y int, col color.RGBA) color.RGBA {
+// Occlusion returns the ambient visibility factor of the pixel at
+// (x, y), which is one if the pixel is not occluded.
+func (ao *ambientOcclusionPass) Occlusion(x, y int) float64 {
 	// FIXME: naive and super slow SSAO implementation. Optimize
 	// when denoiser is available.
 	w := ao.w
 	idx := x + w*y
 	info := &ao.gbuffer[idx]
 	if info.mat == nil {
-		return col
+		return 1
 	}
 	if !info.mat.AmbientOcclusion() {
-		return col
+		return 1
 	}
 
 	total := 0.0
@@ -33,8 +35,14 @@ func (ao *ambientOcclusionPass) Shade(x, y int, col color.RGBA) color.RGBA {
 		total += math.Pi/2 - ao.maxElevationAngle(x, y, math.Cos(a), math.Sin(a))
 	}
 	total /= (math.Pi / 2) * 8
-	total = math.Pow(total, 10000)
+	return math.Pow(total, 10000)
+}
 
+// Shade applies the given ambient visibility factor to the given color.
+func (ao *ambientOcclusionPass) Shade(col color.RGBA, total float64) color.RGBA {
+	if total == 1 {
+		return col
+	}
 	return color.RGBA{
 		uint8(total * float64(col.R)),
 		uint8(total * float64(col.G)),
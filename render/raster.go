@@ -14,6 +14,7 @@ import (
 	"poly.red/color"
 	"poly.red/geometry"
 	"poly.red/geometry/primitive"
+	pimage "poly.red/image"
 	"poly.red/light"
 	"poly.red/material"
 	"poly.red/math"
@@ -34,6 +35,8 @@ type Renderer struct {
 	msaa         int
 	correctGamma bool
 	useShadowMap bool
+	hdr          bool
+	lodPixels    float64
 	debug        bool
 	scene        *scene.Scene
 	background   color.RGBA
@@ -54,8 +57,11 @@ type Renderer struct {
 	frameBuf       *image.RGBA
 	renderCamera   camera.Interface
 	renderPerspect bool
+	levels         []int // levels of detail of the progressive meshes
 	shadowBufs     []shadowInfo
 	outBuf         *image.RGBA
+	hdrBuf         *pimage.RGBAFloat
+	hdrOut         *pimage.RGBAFloat
 }
 
 // NewRenderer creates a new renderer.
@@ -85,6 +91,9 @@ func NewRenderer(opts ...Option) *Renderer {
 	r.lockBuf = make([]sync.Mutex, w*h)
 	r.gBuf = make([]gInfo, w*h)
 	r.frameBuf = image.NewRGBA(image.Rect(0, 0, w, h))
+	if r.hdr {
+		r.hdrBuf = pimage.NewRGBAFloat(image.Rect(0, 0, w, h))
+	}
 	r.sched = utils.NewWorkerPool(uint64(r.gomaxprocs))
 
 	if r.scene != nil {
@@ -131,6 +140,8 @@ func (r *Renderer) Render() *image.RGBA {
 		return r.outBuf
 	}
 
+	r.selectLevels()
+
 	// decide if need shadow passes
 	if r.useShadowMap {
 		for i := 0; i < len(r.shadowBufs); i++ {
@@ -157,6 +168,15 @@ func (r *Renderer) Render() *image.RGBA {
 	return r.outBuf
 }
 
+// HDRImage returns the linear float image of the last rendered frame,
+// which keeps the radiance above one and is not gamma corrected.
+// Multisampled pixels are averaged by a box filter. The image is not
+// changed by later frames. It returns nil if the renderer is not
+// created with WithHDR.
+func (r *Renderer) HDRImage() *pimage.RGBAFloat {
+	return r.hdrOut
+}
+
 // gInfo is the geometry information collected in a forward pass.
 type gInfo struct {
 	ok         bool
@@ -181,24 +201,26 @@ func (r *Renderer) passForward() {
 	matProj := r.renderCamera.ProjMatrix()
 	matVP := math.ViewportMatrix(float64(w), float64(h))
 
+	k := 0
 	r.scene.IterObjects(func(o object.Object, modelMatrix math.Mat4) bool {
 		if o.Type() != object.TypeMesh {
 			return true
 		}
 
-		mesh := o.(geometry.Mesh)
-		r.sched.Add(mesh.NumTriangles())
+		_, n := r.lodFaces(o.(geometry.Mesh), &k)
+		r.sched.Add(n)
 		return true
 	})
 
+	k = 0
 	r.scene.IterObjects(func(o object.Object, modelMatrix math.Mat4) bool {
 		if o.Type() != object.TypeMesh {
 			return true
 		}
 
-		mesh := o.(geometry.Mesh)
+		faces, _ := r.lodFaces(o.(geometry.Mesh), &k)
 		uniforms := map[string]interface{}{
-			"matModel":   mesh.ModelMatrix(),
+			"matModel":   modelMatrix,
 			"matView":    matView,
 			"matViewInv": matView.Inv(),
 			"matProj":    matProj,
@@ -212,10 +234,10 @@ func (r *Renderer) passForward() {
 			// The reason we need normal matrix is that normals are transformed
 			// incorrectly using MVP matrices. However, a normal matrix helps us
 			// to fix the problem.
-			"matNormal": mesh.ModelMatrix().Inv().T(),
+			"matNormal": modelMatrix.Inv().T(),
 		}
 
-		mesh.Faces(func(f primitive.Face, m material.Material) bool {
+		faces(func(f primitive.Face, m material.Material) bool {
 			f.Triangles(func(t *primitive.Triangle) bool {
 				r.sched.Execute(func() {
 					if t.IsValid() {
@@ -231,6 +253,70 @@ func (r *Renderer) passForward() {
 	r.sched.Wait()
 }
 
+// selectLevels selects the level of detail of each progressive mesh by
+// its projected size in the camera of the scene, which is selected per
+// object since a mesh may appear several times in the scene. The levels
+// are shared by the shadow and the forward passes of a frame.
+func (r *Renderer) selectLevels() {
+	r.levels = r.levels[:0]
+	r.renderCamera = r.scene.GetCamera()
+	matView := r.renderCamera.ViewMatrix()
+	matProj := r.renderCamera.ProjMatrix()
+	r.scene.IterObjects(func(o object.Object, modelMatrix math.Mat4) bool {
+		pm, ok := o.(*geometry.ProgressiveMesh)
+		if !ok {
+			return true
+		}
+		level := pm.Level()
+		if r.lodPixels > 0 {
+			// The size is measured in pixels rather than samples, thus
+			// multisampling does not change the level.
+			size := r.screenSize(pm, modelMatrix, matView, matProj, float64(r.height))
+			level = pm.LevelForTriangles(uint64(size / r.lodPixels))
+		}
+		r.levels = append(r.levels, level)
+		return true
+	})
+}
+
+// lodFaces returns the faces of the mesh and their number, where the
+// k-th progressive mesh of the scene is drawn at its selected level of
+// detail and k is advanced.
+func (r *Renderer) lodFaces(mesh geometry.Mesh, k *int) (func(func(primitive.Face, material.Material) bool), uint64) {
+	pm, ok := mesh.(*geometry.ProgressiveMesh)
+	if !ok {
+		return mesh.Faces, mesh.NumTriangles()
+	}
+	level := r.levels[*k]
+	*k++
+	return func(iter func(primitive.Face, material.Material) bool) {
+		pm.LevelFaces(level, iter)
+	}, pm.LevelTriangles(level)
+}
+
+// screenSize returns the area in pixels of the projected bounding
+// sphere of the mesh, where h is the height of the frame buffer. It is
+// infinite if the camera is inside the bounding sphere.
+func (r *Renderer) screenSize(mesh geometry.Mesh, modelMatrix, matView, matProj math.Mat4, h float64) float64 {
+	// The bounding box of the mesh includes the transformation of the
+	// mesh itself, which is also part of the model matrix.
+	aabb := mesh.AABB()
+	m := modelMatrix.MulM(mesh.ModelMatrix().Inv())
+	min := aabb.Min.ToVec4(1).Apply(m).ToVec3()
+	max := aabb.Max.ToVec4(1).Apply(m).ToVec3()
+	center := min.Add(max).Scale(0.5, 0.5, 0.5)
+	radius := max.Sub(min).Len() / 2
+
+	// The w component is the distance to the camera for perspective
+	// projections, and one for orthographic projections.
+	w := math.Abs(center.ToVec4(1).Apply(matView).Apply(matProj).W)
+	if _, ok := r.renderCamera.(*camera.Perspective); ok && w <= radius {
+		return math.Inf(1)
+	}
+	rpx := radius * math.Abs(matProj.X11) * h / 2 / w
+	return math.Pi * rpx * rpx
+}
+
 func (r *Renderer) passDeferred() {
 	if r.debug {
 		done := utils.Timed("deferred pass (shading)")
@@ -262,20 +348,28 @@ func (r *Renderer) passDeferred() {
 	}
 
 	r.ScreenPass(r.frameBuf, func(frag primitive.Fragment) color.RGBA {
-		frag.Col = r.shade(frag.X, h-frag.Y-1, uniforms)
-		return ao.Shade(frag.X, h-frag.Y-1, frag.Col)
+		x, y := frag.X, h-frag.Y-1
+		col, hdr := r.shade(x, y, uniforms)
+		occlusion := ao.Occlusion(x, y)
+		if r.hdrBuf != nil {
+			r.hdrBuf.SetRGBAFloat(frag.X, frag.Y, hdr.Scale(occlusion, occlusion, occlusion, 1))
+		}
+		return ao.Shade(col, occlusion)
 	})
 }
 
-func (r *Renderer) shade(x, y int, uniforms map[string]interface{}) color.RGBA {
+// shade shades the pixel at (x, y) of the geometry buffer. The float
+// color is only computed if the renderer has a float frame buffer.
+func (r *Renderer) shade(x, y int, uniforms map[string]interface{}) (color.RGBA, math.Vec4) {
 	w := r.width * r.msaa
 	idx := x + w*y
 	info := &r.gBuf[idx]
 	if !info.ok {
-		return r.background
+		return r.background, colorToHDR(r.background)
 	}
 
 	col := info.col
+	hdr := math.Vec4{}
 	if info.mat != nil {
 		lod := 0.0
 		if info.mat.Texture().UseMipmap() {
@@ -290,6 +384,18 @@ func (r *Renderer) shade(x, y int, uniforms map[string]interface{}) color.RGBA {
 		col = info.mat.FragmentShader(
 			col, info.pos, info.n, info.fN,
 			r.renderCamera.Position().ToVec4(1), r.lightSources, r.lightEnv)
+
+		if r.hdrBuf != nil {
+			hdr = colorToHDR(col)
+			if m, ok := info.mat.(material.HDRMaterial); ok {
+				hdr = m.FragmentShaderHDR(
+					info.mat.Texture().QueryFloat(lod, info.u, 1-info.v),
+					info.pos, info.n, info.fN,
+					r.renderCamera.Position().ToVec4(1), r.lightSources, r.lightEnv)
+			}
+		}
+	} else if r.hdrBuf != nil {
+		hdr = colorToHDR(col)
 	}
 
 	if r.useShadowMap && info.mat != nil && info.mat.ReceiveShadow() {
@@ -306,8 +412,14 @@ func (r *Renderer) shade(x, y int, uniforms map[string]interface{}) color.RGBA {
 		g := uint8(float64(col.G) * w)
 		b := uint8(float64(col.B) * w)
 		col = color.RGBA{r, g, b, col.A}
+		hdr = hdr.Scale(w, w, w, 1)
 	}
-	return col
+	return col, hdr
+}
+
+// colorToHDR converts an 8-bit color to a linear float color.
+func colorToHDR(c color.RGBA) math.Vec4 {
+	return math.NewVec4(float64(c.R)/0xff, float64(c.G)/0xff, float64(c.B)/0xff, float64(c.A)/0xff)
 }
 
 func (r *Renderer) passAntialiasing() {
@@ -318,6 +430,15 @@ func (r *Renderer) passAntialiasing() {
 
 	r.passGammaCorrect()
 	r.outBuf = utils.Resize(r.width, r.height, r.frameBuf)
+	if r.hdrBuf != nil {
+		r.hdrOut = pimage.ResizeFloat(r.width, r.height, r.hdrBuf)
+		if r.hdrOut == r.hdrBuf {
+			// Without multisampling the buffer is not resized but
+			// reused by the next frame, thus the output is a copy.
+			r.hdrOut = pimage.NewRGBAFloat(r.hdrBuf.Rect)
+			copy(r.hdrOut.Pix, r.hdrBuf.Pix)
+		}
+	}
 }
 
 func (r *Renderer) draw(
@@ -242,3 +242,83 @@ func BenchmarkDraw(b *testing.B) {
 		})
 	}
 }
+
+func TestLevelOfDetail(t *testing.T) {
+	// A flat grid, which collapses to few triangles.
+	var (
+		pos []float64
+		idx []uint64
+	)
+	const n = 16
+	for i := 0; i <= n; i++ {
+		for j := 0; j <= n; j++ {
+			pos = append(pos, float64(i)/n-0.5, float64(j)/n-0.5, 0)
+		}
+	}
+	for i := 0; i < n; i++ {
+		for j := 0; j < n; j++ {
+			a, b := uint64(i*(n+1)+j), uint64((i+1)*(n+1)+j)
+			idx = append(idx, a, b, b+1, a, b+1, a+1)
+		}
+	}
+	bm := geometry.NewBufferedMesh()
+	bm.SetAttribute(geometry.AttributePos, geometry.NewBufferAttribute(3, pos))
+	bm.SetVertexIndex(idx)
+	pm := geometry.NewProgressiveMesh(bm)
+
+	w, h := 100, 100
+	s := scene.NewScene()
+	s.SetCamera(camera.NewPerspective(
+		math.NewVec3(0, 0, 1),
+		math.NewVec3(0, 0, 0),
+		math.NewVec3(0, 1, 0),
+		45, 1, 0.1, 100,
+	))
+	s.Add(pm)
+	r := render.NewRenderer(
+		render.WithSize(w, h),
+		render.WithScene(s),
+		render.WithLevelOfDetail(50),
+	)
+
+	near := render.ScreenSize(r, pm, pm.ModelMatrix())
+	far := render.ScreenSize(r, pm, math.NewMat4(
+		1, 0, 0, 0,
+		0, 1, 0, 0,
+		0, 0, 1, -10,
+		0, 0, 0, 1,
+	))
+	if near <= far || far <= 0 {
+		t.Fatalf("expect a larger projection of a closer mesh, got %v and %v", near, far)
+	}
+	if l := pm.LevelForTriangles(uint64(far / 50)); l == 0 {
+		t.Fatalf("expect a coarser level for a distant mesh")
+	}
+
+	// Each appearance of the mesh has its own level of detail, which
+	// does not change with multisampling.
+	g := scene.NewGroup("far")
+	g.Translate(0, 0, -3)
+	g.Add(pm)
+	s.Add(g)
+	levels := render.SelectLevels(r)
+	if len(levels) != 2 || levels[0] >= levels[1] {
+		t.Fatalf("expect a coarser level of the distant mesh, got %v", levels)
+	}
+	msaa := render.NewRenderer(
+		render.WithSize(w, h),
+		render.WithScene(s),
+		render.WithLevelOfDetail(50),
+		render.WithMSAA(2),
+	)
+	if got := render.SelectLevels(msaa); fmt.Sprint(got) != fmt.Sprint(levels) {
+		t.Fatalf("expect the levels %v with multisampling, got %v", levels, got)
+	}
+
+	// The level of detail is selected per frame and does not change
+	// the current level of the mesh.
+	r.Render()
+	if pm.Level() != 0 {
+		t.Fatalf("expect the current level to be unchanged, got %d", pm.Level())
+	}
+}
@@ -180,24 +180,26 @@ func (r *Renderer) passShadows(index int) {
 	matView := c.ViewMatrix()
 	matProj := c.ProjMatrix()
 	matVP := math.ViewportMatrix(float64(w), float64(h))
+	k := 0
 	r.scene.IterObjects(func(o object.Object, modelMatrix math.Mat4) bool {
 		if o.Type() != object.TypeMesh {
 			return true
 		}
 
-		mesh := o.(geometry.Mesh)
-		r.sched.Add(mesh.NumTriangles())
+		_, n := r.lodFaces(o.(geometry.Mesh), &k)
+		r.sched.Add(n)
 		return true
 	})
 
+	k = 0
 	r.scene.IterObjects(func(o object.Object, modelMatrix math.Mat4) bool {
 		if o.Type() != object.TypeMesh {
 			return true
 		}
 
-		mesh := o.(geometry.Mesh)
+		faces, _ := r.lodFaces(o.(geometry.Mesh), &k)
 		uniforms := map[string]interface{}{
-			"matModel": mesh.ModelMatrix(),
+			"matModel": modelMatrix,
 			"matView":  matView,
 			"matProj":  matProj,
 			"matVP":    matVP,
@@ -208,10 +210,10 @@ func (r *Renderer) passShadows(index int) {
 			// The reason we need normal matrix is that normals are transformed
 			// incorrectly using MVP matrices. However, a normal matrix helps us
 			// to fix the problem.
-			"matNormal": mesh.ModelMatrix().Inv().T(),
+			"matNormal": modelMatrix.Inv().T(),
 		}
 
-		mesh.Faces(func(f primitive.Face, m material.Material) bool {
+		faces(func(f primitive.Face, m material.Material) bool {
 			f.Triangles(func(t *primitive.Triangle) bool {
 				r.sched.Execute(func() {
 					if t.IsValid() {
@@ -35,6 +35,11 @@ func (s *Scene) Add(geo ...object.Object) *Group {
 	return s.root
 }
 
+// Root returns the root group of the scene.
+func (s *Scene) Root() *Group {
+	return s.root
+}
+
 func (s *Scene) SetCamera(c camera.Interface) {
 	s.camera = c
 }
@@ -43,14 +48,11 @@ func (s *Scene) GetCamera() camera.Interface {
 	return s.camera
 }
 
+// IterObjects visits all objects of the scene graph. The given model
+// matrix of an object accumulates the transformations of all its
+// parent groups.
 func (s *Scene) IterObjects(iter func(o object.Object, modelMatrix math.Mat4) bool) {
-
-	for i := range s.root.children {
-		s.root.children[i].IterObjects(func(o object.Object, modelMatrix math.Mat4) bool {
-			iter(o, s.root.ModelMatrix().MulM(modelMatrix))
-			return true
-		})
-	}
+	s.root.IterObjects(iter)
 }
 
 func (s *Scene) Center() math.Vec3 {
@@ -83,6 +85,14 @@ type Group struct {
 	children []*Group
 }
 
+// NewGroup creates a new empty group with the given name. A group can
+// be added to another group or a scene to construct a hierarchy.
+func NewGroup(name string) *Group {
+	g := newGroup()
+	g.name = name
+	return g
+}
+
 func newGroup() *Group {
 	g := &Group{
 		name:     "",
@@ -99,8 +109,35 @@ func (g *Group) Type() object.Type {
 	return object.TypeGroup
 }
 
+// Name returns the name of the group.
+func (g *Group) Name() string {
+	return g.name
+}
+
+// Object returns the object that is held by the group, or nil if the
+// group only holds child groups.
+func (g *Group) Object() object.Object {
+	return g.object
+}
+
+// Children returns the child groups of the group.
+func (g *Group) Children() []*Group {
+	return g.children
+}
+
+// Add adds the given objects to the group. A given group becomes a
+// child group of the group and is removed from its previous parent,
+// other objects are wrapped by new child groups.
 func (g *Group) Add(geo ...object.Object) *Group {
 	for i := range geo {
+		if gg, ok := geo[i].(*Group); ok {
+			gg.detach()
+			gg.parent = g
+			gg.setRoot(g.root)
+			g.children = append(g.children, gg)
+			continue
+		}
+
 		gg := newGroup()
 		gg.root = g.root
 		gg.parent = g
@@ -111,11 +148,44 @@ func (g *Group) Add(geo ...object.Object) *Group {
 	return g
 }
 
+// detach removes the group from the children of its parent.
+func (g *Group) detach() {
+	if g.parent == nil {
+		return
+	}
+	children := g.parent.children
+	for i := range children {
+		if children[i] == g {
+			g.parent.children = append(children[:i:i], children[i+1:]...)
+			break
+		}
+	}
+	g.parent = nil
+}
+
+func (g *Group) setRoot(s *Scene) {
+	g.root = s
+	for i := range g.children {
+		g.children[i].setRoot(s)
+	}
+}
+
+// IterObjects visits all objects of the group and its child groups.
 func (g *Group) IterObjects(iter func(o object.Object, modelMatrix math.Mat4) bool) {
-	iter(g.object, g.ModelMatrix().MulM(g.object.ModelMatrix()))
+	g.iterObjects(math.Mat4I, iter)
+}
+
+func (g *Group) iterObjects(parent math.Mat4, iter func(o object.Object, modelMatrix math.Mat4) bool) bool {
+	m := parent.MulM(g.ModelMatrix())
+	if g.object != nil {
+		if !iter(g.object, m.MulM(g.object.ModelMatrix())) {
+			return false
+		}
+	}
 	for i := range g.children {
-		g.children[i].IterObjects(func(o object.Object, modelMatrix math.Mat4) bool {
-			return iter(o, g.ModelMatrix().MulM(o.ModelMatrix()))
-		})
+		if !g.children[i].iterObjects(m, iter) {
+			return false
+		}
 	}
+	return true
 }
@@ -37,3 +37,62 @@ func TestScene(t *testing.T) {
 		return true
 	})
 }
+
+func TestGroup_Nested(t *testing.T) {
+	s := scene.NewScene()
+	p := geometry.NewPlane(1, 1)
+
+	g1 := scene.NewGroup("parent")
+	g1.Translate(1, 0, 0)
+	g2 := scene.NewGroup("child")
+	g2.Scale(2, 2, 2)
+	g2.Add(p)
+	g1.Add(g2)
+	s.Add(g1)
+
+	n := 0
+	s.IterObjects(func(o object.Object, modelMatrix math.Mat4) bool {
+		n++
+		if o != p {
+			t.Fatalf("unexpected object %v", o)
+		}
+		got := math.NewVec4(1, 1, 1, 1).Apply(modelMatrix)
+		want := math.NewVec4(3, 2, 2, 1)
+		if !got.Eq(want) {
+			t.Fatalf("nested transformation is not composed, want %v, got %v", want, got)
+		}
+		return true
+	})
+	if n != 1 {
+		t.Fatalf("expect 1 object, got %v", n)
+	}
+}
+
+func TestGroup_Reparent(t *testing.T) {
+	s := scene.NewScene()
+	p := geometry.NewPlane(1, 1)
+
+	g1 := scene.NewGroup("first")
+	g2 := scene.NewGroup("second")
+	g2.Translate(1, 0, 0)
+	child := scene.NewGroup("child")
+	child.Add(p)
+	g1.Add(child)
+	s.Add(g1, g2)
+	g2.Add(child)
+
+	if len(g1.Children()) != 0 || len(g2.Children()) != 1 {
+		t.Fatalf("expect the child to move, got %d and %d children", len(g1.Children()), len(g2.Children()))
+	}
+	n := 0
+	s.IterObjects(func(o object.Object, modelMatrix math.Mat4) bool {
+		n++
+		if got := math.NewVec4(0, 0, 0, 1).Apply(modelMatrix); !got.Eq(math.NewVec4(1, 0, 0, 1)) {
+			t.Fatalf("expect the transformation of the new parent, got %v", got)
+		}
+		return true
+	})
+	if n != 1 {
+		t.Fatalf("expect 1 object, got %v", n)
+	}
+}
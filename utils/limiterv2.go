@@ -76,6 +76,12 @@ func (p *WorkerPool) Running() uint64 {
 	return atomic.LoadUint64(&p.running)
 }
 
+// Close stops all workers of the pool. Tasks must not be executed
+// after the pool is closed.
+func (p *WorkerPool) Close() {
+	close(p.taskQueues)
+}
+
 // fanout implements a generic fan-out for variadic channels
 func fanout(randomizer func(max int) int, in <-chan funcdata, outs ...chan funcdata) {
 	l := len(outs)
@@ -86,4 +92,7 @@ func fanout(randomizer func(max int) int, in <-chan funcdata, outs ...chan funcd
 		}
 		outs[i] <- v
 	}
+	for _, out := range outs {
+		close(out)
+	}
 }